@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"cred.com/hack25/backend/internal/config"
+	"cred.com/hack25/backend/internal/repointel"
+	"cred.com/hack25/backend/internal/repository"
+	"cred.com/hack25/backend/internal/service"
+	"cred.com/hack25/backend/pkg/database"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+const insightsUsage = "usage: api-server insights stale <repo-id> | regenerate <repo-id> [max-tokens]"
+
+// runInsights runs the insights command: stale lists the insights of a repository whose inputs
+// changed since they were generated, and regenerate queues a job regenerating them, capped to a
+// number of tokens if given, for the workers of the servers to run
+func runInsights(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, insightsUsage)
+		os.Exit(2)
+	}
+	repoID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		logger.Fatalf("Invalid repository ID: %s", args[1])
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.NewDB(cfg.Database)
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	codeAnalyzerRepo := repository.NewCodeAnalyzerRepository(db.Conn)
+	repoIntlService := repointel.NewService(codeAnalyzerRepo, cfg.LLM.LiteLLM.BaseURL, cfg.LLM.LiteLLM.APIKey, cfg.LLM.LiteLLM.DefaultModel)
+	insightsManager := repointel.NewInsightsManager(repoIntlService, repointel.NewRepository(db.Conn))
+
+	switch args[0] {
+	case "stale":
+		stale, err := insightsManager.ListStaleInsights(repoID)
+		if err != nil {
+			logger.Fatalf("Failed to list stale insights: %v", err)
+		}
+		for _, insight := range stale {
+			name := insight.Name
+			if name == "" {
+				name = insight.Path
+			}
+			fmt.Printf("%-10s %-8d %-8s %s\n", insight.Type, insight.InsightID, insight.Reason, name)
+		}
+		fmt.Printf("%d stale insights\n", len(stale))
+
+	case "regenerate":
+		maxTokens := 0
+		if len(args) > 2 {
+			if maxTokens, err = strconv.Atoi(args[2]); err != nil || maxTokens < 0 {
+				logger.Fatalf("Invalid number of tokens: %s", args[2])
+			}
+		}
+
+		codeAnalyzerService := service.NewCodeAnalyzerService(codeAnalyzerRepo, "/tmp", cfg.LLM.LiteLLM.BaseURL, cfg.LLM.LiteLLM.APIKey, cfg.LLM.LiteLLM.DefaultModel, insightsManager)
+		codeAnalyzerService.SetUsageService(service.NewLLMUsageService(repository.NewLLMUsageRepository(db.Conn), cfg.LLM.Prices))
+
+		job, err := codeAnalyzerService.RegenerateStaleInsights("", repoID, "", maxTokens)
+		if err != nil {
+			logger.Fatalf("Failed to queue insight regeneration: %v", err)
+		}
+		if job == nil {
+			logger.Fatalf("Repository %d not found", repoID)
+		}
+		fmt.Printf("regenerate job %d %s\n", job.ID, job.Status)
+
+	default:
+		fmt.Fprintln(os.Stderr, insightsUsage)
+		os.Exit(2)
+	}
+}
@@ -16,12 +16,26 @@ import (
 	"cred.com/hack25/backend/internal/service"
 	"cred.com/hack25/backend/pkg/auth"
 	"cred.com/hack25/backend/pkg/database"
+	"cred.com/hack25/backend/pkg/llm/cache"
 	"cred.com/hack25/backend/pkg/llm/client"
 	"cred.com/hack25/backend/pkg/logger"
+	"cred.com/hack25/backend/pkg/source"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// migrate up|down|status manages the database schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	// insights stale|regenerate tracks the insights whose code changed instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "insights" {
+		runInsights(os.Args[2:])
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	logger.Infof("Configuration loaded: %+v", cfg)
@@ -41,14 +55,19 @@ func main() {
 	}
 	defer db.Close()
 
-	// Initialize database schema
-	if err := db.InitSchema(); err != nil {
-		logger.Fatalf("Failed to initialize database schema: %v", err)
+	// Apply pending schema migrations; replicas starting at once take turns
+	if cfg.Database.AutoMigrate {
+		if err := db.Migrate(context.Background()); err != nil {
+			logger.Fatalf("Failed to migrate database schema: %v", err)
+		}
 	}
 
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db.Conn)
 	codeAnalyzerRepo := repository.NewCodeAnalyzerRepository(db.Conn)
+	codeAnalysisRepo := repository.NewCodeAnalysisRepository(db.Conn)
+	llmUsageRepo := repository.NewLLMUsageRepository(db.Conn)
+	llmCacheRepo := repository.NewLLMCacheRepository(db.Conn)
 
 	// Initialize JWT service
 	jwtService := auth.NewJWTService(
@@ -60,37 +79,97 @@ func main() {
 
 	// Initialize LLM client factory
 	llmClientFactory, err := client.NewFactory(client.Config{
-		OpenAIAPIKey:   cfg.LLM.OpenAI.APIKey,
-		GeminiAPIKey:   cfg.LLM.Gemini.APIKey,
-		SonnetAPIKey:   cfg.LLM.Sonnet.APIKey,
-		SonnetBaseURL:  cfg.LLM.Sonnet.BaseURL,
-		LiteLLMAPIKey:  cfg.LLM.LiteLLM.APIKey,
-		LiteLLMBaseURL: cfg.LLM.LiteLLM.BaseURL,
+		OpenAIAPIKey:     cfg.LLM.OpenAI.APIKey,
+		GeminiAPIKey:     cfg.LLM.Gemini.APIKey,
+		SonnetAPIKey:     cfg.LLM.Sonnet.APIKey,
+		SonnetBaseURL:    cfg.LLM.Sonnet.BaseURL,
+		AnthropicAPIKey:  cfg.LLM.Anthropic.APIKey,
+		AnthropicBaseURL: cfg.LLM.Anthropic.BaseURL,
+		LiteLLMAPIKey:    cfg.LLM.LiteLLM.APIKey,
+		LiteLLMBaseURL:   cfg.LLM.LiteLLM.BaseURL,
+		LocalBaseURL:     cfg.LLM.Local.BaseURL,
+		LocalAPIKey:      cfg.LLM.Local.APIKey,
+		Resilience:       &cfg.LLM.Resilience,
+		FallbackChains:   cfg.LLM.FallbackChains,
+		FallbackOn:       cfg.LLM.FallbackOn,
 	})
 	if err != nil {
 		logger.Fatalf("Failed to initialize LLM client factory: %v", err)
 	}
 	defer llmClientFactory.Close()
 
+	// Every LLM call is recorded with what it cost and who it was made for
+	llmUsageService := service.NewLLMUsageService(llmUsageRepo, cfg.LLM.Prices)
+	llmClientFactory.SetUsageRecorder(llmUsageService)
+
+	// Responses are cached by the content of their requests, so identical prompts are paid once
+	var llmCache *cache.Cache
+	if cfg.LLM.CacheEnabled {
+		llmCache = cache.New(llmCacheRepo, cfg.LLM.Cache)
+		llmClientFactory.SetCache(llmCache)
+	}
+
 	// Initialize services
 	userService := service.NewUserService(userRepo, jwtService)
 	llmService := service.NewLLMService(llmClientFactory, cfg.LLM.DefaultModelName)
-	codeAnalysisService := service.NewCodeAnalysisService(llmService)
+	codeAnalysisService := service.NewCodeAnalysisService(llmService, codeAnalysisRepo)
 	// Get LiteLLM configuration from config
 	liteLLMURL := cfg.LLM.LiteLLM.BaseURL
 	liteLLMAPIKey := cfg.LLM.LiteLLM.APIKey
 	liteLLMDefaultModel := cfg.LLM.LiteLLM.DefaultModel
 	repoIntlRepo := repointel.NewRepository(db.Conn)
 	repoIntlService := repointel.NewService(codeAnalyzerRepo, cfg.LLM.LiteLLM.BaseURL, cfg.LLM.LiteLLM.APIKey, cfg.LLM.LiteLLM.DefaultModel)
+	repoIntlService.SetGuard(llmClientFactory.Guard("litellm"))
+	repoIntlService.SetFallbackPolicy(llmClientFactory.FallbackPolicy("litellm"))
+	repoIntlService.SetUsageRecorder(llmUsageService)
+	repoIntlService.SetExampleSource(repoIntlRepo)
+	if llmCache != nil {
+		repoIntlService.SetCache(llmCache)
+	}
 	insightsService := repointel.NewInsightsManager(repoIntlService, repoIntlRepo)
 
 	codeAnalyzerService := service.NewCodeAnalyzerService(codeAnalyzerRepo, "/tmp", liteLLMURL, liteLLMAPIKey, liteLLMDefaultModel, insightsService)
+	codeAnalyzerService.SetUsageService(llmUsageService)
+
+	// Register the source providers that need configuration
+	codeAnalyzerService.RegisterSourceProvider(source.KindLocal, source.NewLocalProvider(cfg.Sources.LocalRoots...))
+	codeAnalyzerService.RegisterSourceProvider(source.KindGitLab, source.NewGitLabProvider(cfg.Sources.GitLabURL, cfg.Sources.GitLabToken))
+	codeAnalyzerService.RegisterSourceProvider(source.KindBitbucket, source.NewBitbucketProvider(
+		cfg.Sources.BitbucketAPIURL, cfg.Sources.BitbucketUsername, cfg.Sources.BitbucketAppPassword))
+
+	// Stored credentials for private repositories are encrypted with the configured key
+	if cfg.Sources.CredentialsKey != "" {
+		if err := codeAnalyzerService.SetCredentialsKey(cfg.Sources.CredentialsKey); err != nil {
+			logger.Fatalf("Invalid credentials encryption key: %v", err)
+		}
+	} else {
+		logger.Warn("CREDENTIALS_ENCRYPTION_KEY not set, repository credentials cannot be stored or used")
+	}
+
+	// Start the workers that run queued indexing jobs
+	if err := codeAnalyzerService.StartIndexWorkers(service.IndexJobConfig{
+		Workers:      cfg.Indexing.Workers,
+		MaxAttempts:  cfg.Indexing.MaxAttempts,
+		PollInterval: cfg.Indexing.PollInterval,
+		LeaseTimeout: cfg.Indexing.LeaseTimeout,
+	}); err != nil {
+		logger.Fatalf("Failed to start index workers: %v", err)
+	}
+
+	// Sweep expired responses from the cache until shutdown
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	if llmCache != nil {
+		go llmCache.Run(sweepCtx)
+	}
 
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler(userService)
 	llmHandler := handlers.NewLLMHandler(llmService)
 	codeAnalysisHandler := handlers.NewCodeAnalysisHandler(codeAnalysisService)
 	codeAnalyzerHandler := handlers.NewCodeAnalyzerHandler(codeAnalyzerService)
+	llmUsageHandler := handlers.NewLLMUsageHandler(llmUsageService)
+	repoIntlHandler := repointel.NewHandler(repoIntlService, repoIntlRepo, codeAnalyzerHandler.QueueRepositoryInsights)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(jwtService)
@@ -131,26 +210,48 @@ func main() {
 		admin.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
 		{
 			admin.GET("/users", userHandler.ListUsers)
+			admin.GET("/llm-budgets", llmUsageHandler.ListBudgets)
+			admin.PUT("/llm-budgets", llmUsageHandler.SetBudget)
+			admin.DELETE("/llm-budgets/:id", llmUsageHandler.DeleteBudget)
+			admin.PUT("/organizations/:organization/members/:user_id", codeAnalyzerHandler.AddOrganizationMember)
+			admin.DELETE("/organizations/:organization/members/:user_id", codeAnalyzerHandler.RemoveOrganizationMember)
 		}
 
 		// LLM routes
 		llm := api.Group("/llm")
+		llm.Use(authMiddleware.OptionalAuth())
 		{
 			llm.POST("/chat", llmHandler.Chat)
 			llm.POST("/stream", llmHandler.StreamChat)
 			llm.POST("/embedding", llmHandler.Embedding)
 			llm.GET("/models", llmHandler.Models)
+			llm.GET("/usage", authMiddleware.RequireAuth(), llmUsageHandler.GetUsage)
 		}
 
 		// Code analysis routes
 		code := api.Group("/code")
+		code.Use(authMiddleware.OptionalAuth())
 		{
 			code.POST("/analyze", codeAnalysisHandler.AnalyzeRepository)
+			code.GET("/workflows", codeAnalysisHandler.ListWorkflows)
+			code.GET("/workflow-steps", codeAnalysisHandler.ListWorkflowSteps)
+		}
+
+		// Credentials for indexing private repositories
+		credentials := api.Group("/credentials")
+		credentials.Use(authMiddleware.RequireAuth())
+		{
+			credentials.POST("", codeAnalyzerHandler.CreateCredential)
+			credentials.GET("", codeAnalyzerHandler.ListCredentials)
+			credentials.DELETE("/:id", codeAnalyzerHandler.DeleteCredential)
 		}
 	}
 
 	// Register code analyzer routes
-	codeAnalyzerHandler.RegisterRoutes(router)
+	codeAnalyzerHandler.RegisterRoutes(router, authMiddleware.OptionalAuth())
+
+	// Register repository intelligence routes, whose insights are generated for signed-in users
+	repoIntlHandler.RegisterRoutes(router, authMiddleware.RequireAuth())
 
 	// Create HTTP server
 	server := &http.Server{
@@ -184,5 +285,11 @@ func main() {
 		logger.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Let running indexing jobs finish; those still running after the timeout are
+	// queued again and resumed on the next start
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Indexing.DrainTimeout)
+	defer drainCancel()
+	codeAnalyzerService.StopIndexWorkers(drainCtx)
+
 	logger.Info("Server exited")
 }
@@ -1,11 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"cred.com/hack25/backend/pkg/database"
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/resilience"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -18,6 +24,8 @@ type Config struct {
 	Database    database.Config
 	JWT         JWTConfig
 	LLM         LLMConfig
+	Indexing    IndexingConfig
+	Sources     SourcesConfig
 	LogLevel    logrus.Level
 	LogFile     string
 }
@@ -38,6 +46,32 @@ type JWTConfig struct {
 	SigningAlgorithm string
 }
 
+// IndexingConfig holds configuration for the repository indexing workers
+type IndexingConfig struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	LeaseTimeout time.Duration
+	DrainTimeout time.Duration
+}
+
+// SourcesConfig holds configuration for the providers repositories are fetched from
+type SourcesConfig struct {
+	LocalRoots           []string // Directories local repositories may be indexed from; none if empty
+	GitLabURL            string   // GitLab instance the token is for; gitlab.com if empty
+	GitLabToken          string
+	BitbucketAPIURL      string
+	BitbucketUsername    string
+	BitbucketAppPassword string
+	CredentialsKey       string // Base64-encoded 32-byte key stored credentials are encrypted with
+}
+
+// String describes the configuration without its secrets, as the configuration is logged
+func (c SourcesConfig) String() string {
+	return fmt.Sprintf("{LocalRoots:%v GitLabURL:%s BitbucketAPIURL:%s BitbucketUsername:%s}",
+		c.LocalRoots, c.GitLabURL, c.BitbucketAPIURL, c.BitbucketUsername)
+}
+
 // Load loads the application configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if it exists
@@ -59,6 +93,8 @@ func Load() (*Config, error) {
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "code_analyser"),
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+
+			AutoMigrate: getEnvAsBool("DB_AUTO_MIGRATE", true),
 		},
 		JWT: JWTConfig{
 			Secret:           getEnv("JWT_SECRET", "your-secret-key"),
@@ -81,11 +117,55 @@ func Load() (*Config, error) {
 				BaseURL:      getEnv("SONNET_BASE_URL", "https://api.sonnet.ai/v1"),
 				DefaultModel: getEnv("SONNET_DEFAULT_MODEL", "sonnet-3.5-pro"),
 			},
+			Anthropic: AnthropicConfig{
+				APIKey:       getEnv("ANTHROPIC_API_KEY", ""),
+				BaseURL:      getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com"),
+				DefaultModel: getEnv("ANTHROPIC_DEFAULT_MODEL", "claude-3-7-sonnet-20250219"),
+			},
 			LiteLLM: LiteLLMConfig{
 				APIKey:       getEnv("LITELLM_API_KEY", "sk-_ANTPTNsfl9XBVA5Q4jvyg"),
 				BaseURL:      getEnv("LITELLM_BASE_URL", "https://api.rabbithole.cred.club"),
 				DefaultModel: getEnv("LITELLM_DEFAULT_MODEL", "gpt-4o"),
 			},
+			Local: LocalConfig{
+				BaseURL: getEnv("LOCAL_LLM_BASE_URL", ""),
+				APIKey:  getEnv("LOCAL_LLM_API_KEY", ""),
+			},
+			Resilience: resilience.Config{
+				MaxRetries: getEnvAsInt("LLM_MAX_RETRIES", 3),
+				BaseDelay:  time.Duration(getEnvAsInt("LLM_RETRY_BASE_DELAY_MS", 500)) * time.Millisecond,
+				MaxDelay:   time.Duration(getEnvAsInt("LLM_RETRY_MAX_DELAY", 30)) * time.Second,
+				Limits: resilience.Limits{
+					RequestsPerMinute: getEnvAsInt("LLM_REQUESTS_PER_MINUTE", 0),
+					TokensPerMinute:   getEnvAsInt("LLM_TOKENS_PER_MINUTE", 0),
+				},
+				BreakerThreshold: getEnvAsInt("LLM_BREAKER_THRESHOLD", 5),
+				BreakerCooldown:  time.Duration(getEnvAsInt("LLM_BREAKER_COOLDOWN", 30)) * time.Second,
+			},
+			FallbackChains: getEnvAsList("LLM_FALLBACK_CHAINS"),
+			FallbackOn:     getEnvAsErrorClasses("LLM_FALLBACK_ON"),
+			CacheEnabled:   getEnvAsBool("LLM_CACHE_ENABLED", true),
+			Cache: cache.Config{
+				TTL:           time.Duration(getEnvAsInt("LLM_CACHE_TTL", 168)) * time.Hour,
+				MemoryEntries: getEnvAsInt("LLM_CACHE_MEMORY_ENTRIES", 1000),
+				SweepInterval: time.Duration(getEnvAsInt("LLM_CACHE_SWEEP_INTERVAL", 60)) * time.Minute,
+			},
+		},
+		Indexing: IndexingConfig{
+			Workers:      getEnvAsInt("INDEX_WORKERS", 2),
+			MaxAttempts:  getEnvAsInt("INDEX_JOB_MAX_ATTEMPTS", 3),
+			PollInterval: time.Duration(getEnvAsInt("INDEX_JOB_POLL_INTERVAL", 5)) * time.Second,
+			LeaseTimeout: time.Duration(getEnvAsInt("INDEX_JOB_LEASE", 120)) * time.Second,
+			DrainTimeout: time.Duration(getEnvAsInt("INDEX_DRAIN_TIMEOUT", 60)) * time.Second,
+		},
+		Sources: SourcesConfig{
+			LocalRoots:           getEnvAsList("LOCAL_SOURCE_ROOTS"),
+			GitLabURL:            getEnv("GITLAB_URL", ""),
+			GitLabToken:          getEnv("GITLAB_TOKEN", ""),
+			BitbucketAPIURL:      getEnv("BITBUCKET_API_URL", ""),
+			BitbucketUsername:    getEnv("BITBUCKET_USERNAME", ""),
+			BitbucketAppPassword: getEnv("BITBUCKET_APP_PASSWORD", ""),
+			CredentialsKey:       getEnv("CREDENTIALS_ENCRYPTION_KEY", ""),
 		},
 		LogLevel: getLogLevel(getEnv("LOG_LEVEL", "info")),
 		LogFile:  getEnv("LOG_FILE", ""),
@@ -94,6 +174,10 @@ func Load() (*Config, error) {
 	// Initialize logger
 	logger.Init(config.LogLevel, config.LogFile)
 
+	// Model limits and prices are parsed once invalid ones can be logged
+	config.LLM.Resilience.ModelLimits = getEnvAsModelLimits("LLM_MODEL_LIMITS")
+	config.LLM.Prices = getEnvAsPrices("LLM_PRICES")
+
 	logger.WithFields(logger.Fields{
 		"environment": config.Environment,
 		"server_port": config.Server.Port,
@@ -122,6 +206,70 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsBool gets an environment variable as a boolean or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(getEnv(key, "")); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsList gets a comma-separated environment variable as a list
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsModelLimits gets the rate limits of models from a comma-separated environment
+// variable of model=requests:tokens entries, where either limit may be 0 for unlimited
+func getEnvAsModelLimits(key string) map[string]resilience.Limits {
+	limits := make(map[string]resilience.Limits)
+	for _, entry := range getEnvAsList(key) {
+		model, rates, ok := strings.Cut(entry, "=")
+		requests, tokens, _ := strings.Cut(rates, ":")
+		rpm, rpmErr := strconv.Atoi(strings.TrimSpace(requests))
+		tpm, tpmErr := strconv.Atoi(strings.TrimSpace(tokens))
+		if !ok || rpmErr != nil || (tokens != "" && tpmErr != nil) {
+			logger.Warnf("Ignoring invalid model limits %q in %s", entry, key)
+			continue
+		}
+		limits[strings.TrimSpace(model)] = resilience.Limits{RequestsPerMinute: rpm, TokensPerMinute: tpm}
+	}
+	return limits
+}
+
+// getEnvAsPrices gets the prices of models from a comma-separated environment variable of
+// model=prompt:completion entries in USD per million tokens, over the default prices
+func getEnvAsPrices(key string) usage.PriceTable {
+	prices := usage.DefaultPrices()
+	for _, entry := range getEnvAsList(key) {
+		model, rates, ok := strings.Cut(entry, "=")
+		prompt, completion, _ := strings.Cut(rates, ":")
+		promptPrice, promptErr := strconv.ParseFloat(strings.TrimSpace(prompt), 64)
+		completionPrice, completionErr := strconv.ParseFloat(strings.TrimSpace(completion), 64)
+		if !ok || promptErr != nil || completionErr != nil {
+			logger.Warnf("Ignoring invalid model price %q in %s", entry, key)
+			continue
+		}
+		prices[strings.TrimSpace(model)] = usage.Price{Prompt: promptPrice, Completion: completionPrice}
+	}
+	return prices
+}
+
+// getEnvAsErrorClasses gets a comma-separated environment variable as LLM error classes
+func getEnvAsErrorClasses(key string) []interfaces.ErrorClass {
+	var classes []interfaces.ErrorClass
+	for _, class := range getEnvAsList(key) {
+		classes = append(classes, interfaces.ErrorClass(class))
+	}
+	return classes
+}
+
 // getLogLevel converts a string log level to a logrus.Level
 func getLogLevel(level string) logrus.Level {
 	switch level {
@@ -1,12 +1,27 @@
 package config
 
+import (
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/resilience"
+	"cred.com/hack25/backend/pkg/llm/usage"
+)
+
 // LLMConfig contains configuration for the LLM clients
 type LLMConfig struct {
 	DefaultModelName string `env:"LLM_DEFAULT_MODEL" envDefault:"openai:gpt-3.5-turbo"`
 	OpenAI           OpenAIConfig
 	Gemini           GeminiConfig
 	Sonnet           SonnetConfig
+	Anthropic        AnthropicConfig
 	LiteLLM          LiteLLMConfig
+	Local            LocalConfig
+	Resilience       resilience.Config       // Retries, rate limits and circuit breaking of each provider
+	FallbackChains   []string                // Models separated by "->", tried in turn
+	FallbackOn       []interfaces.ErrorClass // Errors moving to the next model of a chain
+	Prices           usage.PriceTable        // USD per million tokens of each model, for usage costs
+	CacheEnabled     bool                    // Whether responses are cached by the content of their requests
+	Cache            cache.Config
 }
 
 // OpenAIConfig contains configuration for the OpenAI client
@@ -28,9 +43,23 @@ type SonnetConfig struct {
 	DefaultModel string `env:"SONNET_DEFAULT_MODEL" envDefault:"sonnet-3.5-pro"`
 }
 
+// AnthropicConfig contains configuration for the Anthropic client
+type AnthropicConfig struct {
+	APIKey       string `env:"ANTHROPIC_API_KEY"`
+	BaseURL      string `env:"ANTHROPIC_BASE_URL" envDefault:"https://api.anthropic.com"`
+	DefaultModel string `env:"ANTHROPIC_DEFAULT_MODEL" envDefault:"claude-3-7-sonnet-20250219"`
+}
+
 // LiteLLMConfig contains configuration for the LiteLLM client
 type LiteLLMConfig struct {
 	APIKey       string `env:"LITELLM_API_KEY"`
 	BaseURL      string `env:"LITELLM_BASE_URL" envDefault:"https://api.rabbithole.cred.club"`
 	DefaultModel string `env:"LITELLM_DEFAULT_MODEL" envDefault:"claude-3-7-sonnet"`
 }
+
+// LocalConfig contains configuration for the client of local models, served by Ollama or any
+// OpenAI-compatible server. It is only enabled if its base URL is set.
+type LocalConfig struct {
+	BaseURL string `env:"LOCAL_LLM_BASE_URL"`
+	APIKey  string `env:"LOCAL_LLM_API_KEY"`
+}
@@ -5,6 +5,7 @@ import (
 
 	"cred.com/hack25/backend/internal/models"
 	"cred.com/hack25/backend/internal/service"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/gin-gonic/gin"
 )
@@ -37,8 +38,9 @@ func (h *CodeAnalysisHandler) AnalyzeRepository(c *gin.Context) {
 		return
 	}
 
-	// Process analysis request
-	result, err := h.codeAnalysisService.AnalyzeRepository(c.Request.Context(), req.RepoURL, req.AuthToken)
+	// Process analysis request, its LLM calls charged to the user making it
+	ctx := usage.WithAttribution(c.Request.Context(), usage.Attribution{UserID: requestUserID(c)})
+	result, err := h.codeAnalysisService.AnalyzeRepository(ctx, req.RepoURL, req.AuthToken)
 	if err != nil {
 		logger.Errorf("Repository analysis error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to analyze repository"})
@@ -47,3 +49,65 @@ func (h *CodeAnalysisHandler) AnalyzeRepository(c *gin.Context) {
 
 	c.JSON(http.StatusOK, result)
 }
+
+// ListWorkflows handles a request to list the workflows of an analyzed repository
+func (h *CodeAnalysisHandler) ListWorkflows(c *gin.Context) {
+	repoURL, stepType, ok := workflowQuery(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.codeAnalysisService.ListWorkflows(repoURL, stepType)
+	if err != nil {
+		logger.Errorf("Failed to list workflows: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository has not been analyzed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListWorkflowSteps handles a request to list the workflow steps of an analyzed repository
+func (h *CodeAnalysisHandler) ListWorkflowSteps(c *gin.Context) {
+	repoURL, stepType, ok := workflowQuery(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.codeAnalysisService.ListWorkflowSteps(repoURL, stepType)
+	if err != nil {
+		logger.Errorf("Failed to list workflow steps: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository has not been analyzed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// workflowQuery gets the repository URL and optional step type filter of a request,
+// responding with an error if they are invalid
+func workflowQuery(c *gin.Context) (string, string, bool) {
+	repoURL := c.Query("repo_url")
+	if repoURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo_url is required"})
+		return "", "", false
+	}
+
+	stepType := c.Query("step_type")
+	if stepType != "" {
+		stepType = models.NormalizeStepType(stepType)
+		if !models.IsStepType(stepType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "step_type must be one of external_system, database, logic, function_call"})
+			return "", "", false
+		}
+	}
+	return repoURL, stepType, true
+}
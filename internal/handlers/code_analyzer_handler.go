@@ -1,20 +1,42 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/internal/service"
 	analyzerModels "cred.com/hack25/backend/pkg/goanalyzer/models"
+	"cred.com/hack25/backend/pkg/source"
 	"github.com/gin-gonic/gin"
 )
 
 // CodeAnalyzerService defines the service interface for code analyzer operations
 type CodeAnalyzerService interface {
-	IndexRepository(url string) (*models.IndexRepositoryResponse, error)
-	GetRepositoryIndex(url, filePath string) (*models.GetIndexResponse, error)
+	IndexRepository(userID, role, url, kind, ref string, credentialID int64) (*models.IndexRepositoryResponse, error)
+	UploadRepository(userID, name string, archive io.Reader) (*models.IndexRepositoryResponse, error)
+	GetRepositoryIndex(url, filePath, ref string) (*models.GetIndexResponse, error)
 	AnalyzeGoFile(filePath string) (*analyzerModels.FileAnalysis, error)
+	FindSymbolUsages(url, symbol, pkgPath, ref string) (*models.SymbolUsagesResponse, error)
+	GetFunctionFlow(functionID int64) (*models.FunctionFlowResponse, error)
+	GetIndexJob(id int64) (*models.IndexJob, error)
+	CancelIndexJob(userID, role string, id int64) (*models.IndexJob, error)
+	GenerateRepositoryInsights(userID string, repoID int64, model string) (*models.IndexJob, error)
+	RegenerateStaleInsights(userID string, repoID int64, model string, maxTokens int) (*models.IndexJob, error)
+	AuthorizeCredential(userID, role string, id int64, url string) error
+	CreateCredential(userID, role string, request *models.CreateCredentialRequest) (*models.RepositoryCredential, error)
+	ListCredentials(userID string) ([]models.RepositoryCredential, error)
+	DeleteCredential(userID, role string, id int64) error
+	AddOrganizationMember(organization, userID string) (*models.OrganizationMember, error)
+	RemoveOrganizationMember(organization, userID string) error
 }
 
+// maxArchiveUploadSize caps the size of uploaded repository archives
+const maxArchiveUploadSize = 256 << 20
+
 // CodeAnalyzerHandler handles code analyzer API requests
 type CodeAnalyzerHandler struct {
 	service CodeAnalyzerService
@@ -27,13 +49,21 @@ func NewCodeAnalyzerHandler(service CodeAnalyzerService) *CodeAnalyzerHandler {
 	}
 }
 
-// RegisterRoutes registers the code analyzer routes
-func (h *CodeAnalyzerHandler) RegisterRoutes(router *gin.Engine) {
+// RegisterRoutes registers the code analyzer routes, behind the given middlewares
+func (h *CodeAnalyzerHandler) RegisterRoutes(router *gin.Engine, middlewares ...gin.HandlerFunc) {
 	group := router.Group("/api/code-analyzer")
+	group.Use(middlewares...)
 	{
 		group.POST("/repositories", h.IndexRepository)
+		group.POST("/repositories/upload", h.UploadRepository)
 		group.GET("/repositories", h.GetRepositoryIndex)
+		group.POST("/repositories/:id/insights", h.GenerateRepositoryInsights)
+		group.POST("/repositories/:id/insights/regenerate", h.RegenerateStaleInsights)
 		group.POST("/analyze-file", h.AnalyzeFile)
+		group.GET("/usages", h.FindSymbolUsages)
+		group.GET("/functions/:id/flow", h.GetFunctionFlow)
+		group.GET("/jobs/:id", h.GetIndexJob)
+		group.POST("/jobs/:id/cancel", h.CancelIndexJob)
 	}
 }
 
@@ -51,7 +81,68 @@ func (h *CodeAnalyzerHandler) IndexRepository(c *gin.Context) {
 		return
 	}
 
-	response, err := h.service.IndexRepository(request.URL)
+	if _, err := source.Detect(request.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.ValidateRef(request.Ref); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Stored credentials can only be used by the users they are shared with, which the
+	// service checks for the credential given and for the one the repository already has
+	if _, exists := c.Get("user_id"); !exists && request.CredentialID != 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication is required to index with a credential"})
+		return
+	}
+
+	response, err := h.service.IndexRepository(requestUserID(c), c.GetString("role"), request.URL, request.Kind, request.Ref, request.CredentialID)
+	if errors.Is(err, service.ErrBudgetExceeded) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(credentialErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UploadRepository handles the upload of a repository as a .tar.gz or .zip archive, sent
+// as the archive field of a multipart form along with the name to index it under
+func (h *CodeAnalyzerHandler) UploadRepository(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxArchiveUploadSize)
+
+	name := c.PostForm("name")
+	if !source.ValidName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and may only contain letters, digits, dots, dashes and underscores"})
+		return
+	}
+
+	file, err := c.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archive file is required"})
+		return
+	}
+	archive, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive file"})
+		return
+	}
+	defer archive.Close()
+
+	response, err := h.service.UploadRepository(requestUserID(c), name, archive)
+	if errors.Is(err, source.ErrUnsupportedArchive) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrBudgetExceeded) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -70,7 +161,13 @@ func (h *CodeAnalyzerHandler) GetRepositoryIndex(c *gin.Context) {
 
 	filePath := c.Query("file_path")
 
-	response, err := h.service.GetRepositoryIndex(url, filePath)
+	ref := c.Query("ref")
+	if err := models.ValidateRef(ref); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.GetRepositoryIndex(url, filePath, ref)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -79,6 +176,194 @@ func (h *CodeAnalyzerHandler) GetRepositoryIndex(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// FindSymbolUsages handles the request to find all usages of a symbol, or of a field or
+// method of it given as Type.Member
+func (h *CodeAnalyzerHandler) FindSymbolUsages(c *gin.Context) {
+	url := c.Query("url")
+	if url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL is required"})
+		return
+	}
+
+	symbol := c.Query("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Symbol is required"})
+		return
+	}
+
+	ref := c.Query("ref")
+	if err := models.ValidateRef(ref); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.FindSymbolUsages(url, symbol, c.Query("package"), ref)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetIndexJob handles the request to get the status and progress of an indexing job
+func (h *CodeAnalyzerHandler) GetIndexJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.service.GetIndexJob(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// GetFunctionFlow handles the request for the statement tree and control-flow graph of a function
+func (h *CodeAnalyzerHandler) GetFunctionFlow(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid function ID"})
+		return
+	}
+
+	flow, err := h.service.GetFunctionFlow(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if flow == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Function not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, flow)
+}
+
+// CancelIndexJob handles the request to cancel an indexing job
+func (h *CodeAnalyzerHandler) CancelIndexJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	// Jobs can only be cancelled by the users who requested them or may index their repository
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication is required to cancel a job"})
+		return
+	}
+
+	job, err := h.service.CancelIndexJob(requestUserID(c), c.GetString("role"), id)
+	if errors.Is(err, service.ErrIndexJobForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// GenerateInsightsRequest represents a request to generate the insights of a repository
+type GenerateInsightsRequest struct {
+	Model     string `json:"model,omitempty"`      // Model to generate with; the default if empty
+	MaxTokens int    `json:"max_tokens,omitempty"` // Tokens regeneration stops at; no cap if 0
+}
+
+// GenerateRepositoryInsights handles the request to generate the missing or stale insights of a
+// repository, from its functions up to the repository, as a job
+func (h *CodeAnalyzerHandler) GenerateRepositoryInsights(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repository ID"})
+		return
+	}
+
+	var request GenerateInsightsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	job, err := h.service.GenerateRepositoryInsights(requestUserID(c), id, request.Model)
+	respondInsightsJob(c, job, err)
+}
+
+// RegenerateStaleInsights handles the request to regenerate the insights of a repository whose
+// inputs changed since they were generated, as a job optionally capped to a number of tokens
+func (h *CodeAnalyzerHandler) RegenerateStaleInsights(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repository ID"})
+		return
+	}
+
+	var request GenerateInsightsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+	if request.MaxTokens < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_tokens cannot be negative"})
+		return
+	}
+
+	job, err := h.service.RegenerateStaleInsights(requestUserID(c), id, request.Model, request.MaxTokens)
+	respondInsightsJob(c, job, err)
+}
+
+// QueueRepositoryInsights queues a job generating the missing or stale insights of a repository
+// and responds with it, for the insight API to generate the insights of files and repositories
+func (h *CodeAnalyzerHandler) QueueRepositoryInsights(c *gin.Context, repoID int64, model string) {
+	job, err := h.service.GenerateRepositoryInsights(requestUserID(c), repoID, model)
+	respondInsightsJob(c, job, err)
+}
+
+// respondInsightsJob responds with a job queued to generate insights, or why it was not
+func respondInsightsJob(c *gin.Context, job *models.IndexJob, err error) {
+	if errors.Is(err, service.ErrBudgetExceeded) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrInsightsUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
 // AnalyzeFileRequest represents a request to analyze a single file
 type AnalyzeFileRequest struct {
 	FilePath string `json:"file_path" binding:"required"`
@@ -101,3 +386,91 @@ func (h *CodeAnalyzerHandler) AnalyzeFile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, analysis)
 }
+
+// CreateCredential handles the request to store a credential for private repositories
+func (h *CodeAnalyzerHandler) CreateCredential(c *gin.Context) {
+	var request models.CreateCredentialRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := request.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	credential, err := h.service.CreateCredential(fmt.Sprint(userID), c.GetString("role"), &request)
+	if err != nil {
+		c.JSON(credentialErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// ListCredentials handles the request to list the credentials of the caller
+func (h *CodeAnalyzerHandler) ListCredentials(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	credentials, err := h.service.ListCredentials(fmt.Sprint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// DeleteCredential handles the request to delete a credential
+func (h *CodeAnalyzerHandler) DeleteCredential(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.service.DeleteCredential(fmt.Sprint(userID), c.GetString("role"), id); err != nil {
+		c.JSON(credentialErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AddOrganizationMember handles the request to let a user index with the credentials of an organization
+func (h *CodeAnalyzerHandler) AddOrganizationMember(c *gin.Context) {
+	member, err := h.service.AddOrganizationMember(c.Param("organization"), c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveOrganizationMember handles the request to remove a user from an organization
+func (h *CodeAnalyzerHandler) RemoveOrganizationMember(c *gin.Context) {
+	if err := h.service.RemoveOrganizationMember(c.Param("organization"), c.Param("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// credentialErrorStatus gets the status of a failed credential operation
+func credentialErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCredentialNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrCredentialForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrCredentialHost):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrCredentialsDisabled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
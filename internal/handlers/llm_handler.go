@@ -5,7 +5,8 @@ import (
 	"net/http"
 
 	"cred.com/hack25/backend/internal/service"
-	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/gin-gonic/gin"
 )
@@ -37,9 +38,14 @@ func (h *LLMHandler) Chat(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "messages cannot be empty"})
 		return
 	}
+	if _, err := cache.ParseMode(req.Cache); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Process chat request
-	resp, err := h.llmService.Chat(c.Request.Context(), req)
+	// Process chat request, charged to the user making it
+	ctx := usage.WithAttribution(c.Request.Context(), usage.Attribution{UserID: requestUserID(c), Feature: usage.FeatureChat})
+	resp, err := h.llmService.Chat(ctx, req)
 	if err != nil {
 		logger.Errorf("Chat error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process chat request"})
@@ -89,8 +95,9 @@ func (h *LLMHandler) StreamChat(c *gin.Context) {
 		}
 	}
 
-	// Stream the response
-	err := h.llmService.StreamChat(c.Request.Context(), req, sendEvent)
+	// Stream the response, charged to the user requesting it
+	ctx := usage.WithAttribution(c.Request.Context(), usage.Attribution{UserID: requestUserID(c), Feature: usage.FeatureChat})
+	err := h.llmService.StreamChat(ctx, req, sendEvent)
 	if err != nil && err != io.EOF {
 		logger.Errorf("Stream chat error: %v", err)
 		// We've already started sending events, so we can't change the status code now
@@ -114,8 +121,9 @@ func (h *LLMHandler) Embedding(c *gin.Context) {
 		return
 	}
 
-	// Generate embedding
-	embedding, err := h.llmService.GenerateEmbedding(c.Request.Context(), req.Text, req.ModelName)
+	// Generate embedding, charged to the user requesting it
+	ctx := usage.WithAttribution(c.Request.Context(), usage.Attribution{UserID: requestUserID(c), Feature: usage.FeatureEmbedding})
+	embedding, err := h.llmService.GenerateEmbedding(ctx, req.Text, req.ModelName)
 	if err != nil {
 		logger.Errorf("Embedding error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate embedding"})
@@ -127,8 +135,8 @@ func (h *LLMHandler) Embedding(c *gin.Context) {
 
 // Models returns a list of available models
 func (h *LLMHandler) Models(c *gin.Context) {
-	// Get the list of default models
-	models := interfaces.DefaultModels()
+	// Get the list of models, with those served locally
+	models := h.llmService.ListModels(c.Request.Context())
 
 	// Format for response
 	var modelList []map[string]interface{}
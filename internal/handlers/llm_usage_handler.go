@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/internal/service"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// LLMUsageHandler handles HTTP requests for LLM usage and budgets
+type LLMUsageHandler struct {
+	usageService *service.LLMUsageService
+}
+
+// NewLLMUsageHandler creates a new LLM usage handler
+func NewLLMUsageHandler(usageService *service.LLMUsageService) *LLMUsageHandler {
+	return &LLMUsageHandler{
+		usageService: usageService,
+	}
+}
+
+// GetUsage aggregates the usage and cost of LLM calls, grouped by user, repository, feature,
+// model or day, over a period given as RFC 3339 times or dates. Users other than admins only
+// see their own usage.
+func (h *LLMUsageHandler) GetUsage(c *gin.Context) {
+	query := models.LLMUsageQuery{
+		GroupBy: c.DefaultQuery("group_by", models.UsageByFeature),
+		UserID:  c.Query("user_id"),
+		Feature: c.Query("feature"),
+		Model:   c.Query("model"),
+	}
+	if c.GetString("role") != "admin" {
+		query.UserID = requestUserID(c)
+	}
+
+	var err error
+	if repoID := c.Query("repository_id"); repoID != "" {
+		if query.RepositoryID, err = strconv.ParseInt(repoID, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid repository_id"})
+			return
+		}
+	}
+	if query.From, err = parseUsageTime(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	if query.To, err = parseUsageTime(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.usageService.GetUsage(query)
+	if err != nil {
+		logger.Errorf("Failed to get LLM usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get LLM usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ListBudgets lists the budgets of users and repositories, with what they spent this month
+func (h *LLMUsageHandler) ListBudgets(c *gin.Context) {
+	budgets, err := h.usageService.ListBudgets()
+	if err != nil {
+		logger.Errorf("Failed to list LLM budgets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
+
+// SetBudget sets the monthly budget of a user or repository
+func (h *LLMUsageHandler) SetBudget(c *gin.Context) {
+	var request models.SetLLMBudgetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if err := request.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.usageService.SetBudget(&request)
+	if err != nil {
+		logger.Errorf("Failed to set LLM budget: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+// DeleteBudget deletes a budget
+func (h *LLMUsageHandler) DeleteBudget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget ID"})
+		return
+	}
+
+	err = h.usageService.DeleteBudget(id)
+	if errors.Is(err, service.ErrBudgetNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Errorf("Failed to delete LLM budget: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete budget"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// requestUserID gets the ID of the authenticated user of a request, empty if it is anonymous
+func requestUserID(c *gin.Context) string {
+	if userID, exists := c.Get("user_id"); exists {
+		return fmt.Sprint(userID)
+	}
+	return ""
+}
+
+// parseUsageTime parses a time given as RFC 3339 or as a date, zero if empty
+func parseUsageTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -188,6 +188,16 @@ type FileInsight struct {
 	Patterns         []CodingPattern     `json:"patterns,omitempty"`
 }
 
+// PackageInsight – role of a package, summarised from its files.
+type PackageInsight struct {
+	Responsibilities Narrative        `json:"responsibilities"`
+	API              []string         `json:"api"`          // exported funcs, structs
+	Dependencies     []FrameworkUsage `json:"dependencies"` // imports
+	DesignPatterns   []DesignPattern  `json:"design_patterns,omitempty"`
+	Patterns         []CodingPattern  `json:"patterns,omitempty"`
+	Quality          []QualityMetric  `json:"quality,omitempty"`
+}
+
 // RepositoryInsight – birds‑eye view.
 type RepositoryInsight struct {
 	Domain         KnowledgeRef        `json:"domain"`
@@ -210,21 +220,24 @@ const (
 	SymbolInsightType     InsightType = "symbol"
 	StructInsightType     InsightType = "struct"
 	FileInsightType       InsightType = "file"
+	PackageInsightType    InsightType = "package" // path is the package import path
 	RepositoryInsightType InsightType = "repository"
 )
 
 type InsightRecord struct {
-	ID           int64       `json:"id" db:"id"`
-	RepositoryID int64       `json:"repository_id" db:"repository_id"`
-	FileID       *int64      `json:"file_id,omitempty" db:"file_id"`
-	FunctionID   *int64      `json:"function_id,omitempty" db:"function_id"`
-	SymbolID     *int64      `json:"symbol_id,omitempty" db:"symbol_id"`
-	Path         string      `json:"path,omitempty" db:"path"`
-	Type         InsightType `json:"type" db:"type"`
-	Data         string      `json:"data" db:"data"` // raw JSON
-	Model        string      `json:"model" db:"model"`
-	CreatedAt    time.Time   `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time   `json:"updated_at" db:"updated_at"`
+	ID            int64       `json:"id" db:"id"`
+	RepositoryID  int64       `json:"repository_id" db:"repository_id"`
+	FileID        *int64      `json:"file_id,omitempty" db:"file_id"`
+	FunctionID    *int64      `json:"function_id,omitempty" db:"function_id"`
+	SymbolID      *int64      `json:"symbol_id,omitempty" db:"symbol_id"`
+	Path          string      `json:"path,omitempty" db:"path"`
+	Type          InsightType `json:"type" db:"type"`
+	Data          string      `json:"data" db:"data"` // raw JSON
+	Model         string      `json:"model" db:"model"`
+	PromptVersion string      `json:"prompt_version,omitempty" db:"prompt_version"` // Of the prompt templates; empty if unknown
+	InputHash     string      `json:"input_hash,omitempty" db:"input_hash"`         // Hash of what the insight was generated from; empty if unknown
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 ////////////////////////////////////////////////////////////////////////////////
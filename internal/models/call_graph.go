@@ -1,14 +1,17 @@
 package models
 
+import "strings"
+
 // CallGraphNode represents a node in the call graph (a function/method)
 type CallGraphNode struct {
-	ID         string `json:"id"`                  // Unique identifier (usually package.function or package.receiver.method)
-	Package    string `json:"package"`             // Package name
-	Function   string `json:"function"`            // Function/method name
-	Receiver   string `json:"receiver,omitempty"`  // For methods, the receiver type
-	FilePath   string `json:"file_path,omitempty"` // File path containing the function
-	Line       int    `json:"line,omitempty"`      // Line number where function starts
-	IsExternal bool   `json:"is_external"`         // Whether it's an external function (stdlib or third-party)
+	ID         string `json:"id"`                   // Unique identifier (usually package.function or package.receiver.method)
+	Package    string `json:"package"`              // Package name
+	Function   string `json:"function"`             // Function/method name
+	Receiver   string `json:"receiver,omitempty"`   // For methods, the receiver type
+	FilePath   string `json:"file_path,omitempty"`  // File path containing the function
+	Line       int    `json:"line,omitempty"`       // Line number where function starts
+	IsExternal bool   `json:"is_external"`          // Whether it's an external function (stdlib or third-party)
+	Unresolved bool   `json:"unresolved,omitempty"` // Whether it's the callee of calls the linker could not resolve
 }
 
 // CallGraphEdge represents an edge in the call graph (a function call)
@@ -18,6 +21,7 @@ type CallGraphEdge struct {
 	Line       int    `json:"line,omitempty"`       // Line number where the call occurs
 	Parameters string `json:"parameters,omitempty"` // JSON string of parameters
 	Count      int    `json:"count"`                // Number of times this call occurs
+	Kind       string `json:"kind,omitempty"`       // "static" or "dynamic" (interface dispatch)
 }
 
 // CallGraph represents a complete call graph for a repository or file
@@ -99,11 +103,19 @@ func BuildCallGraph(functions []RepositoryFunction, calls []FunctionCall, fileMa
 		}
 		sourceID = sourceNode.ID
 
-		// Create or get target node
+		// Create or get target node, preferring the resolved callee when there is one
 		targetID := call.CalleePackage + "." + call.CalleeName
+		var targetNode *CallGraphNode
+		if call.CalleeID != nil {
+			targetNode = nodeMap[*call.CalleeID]
+		}
+		if targetNode != nil {
+			targetID = targetNode.ID
+		}
 
-		// For external calls that we don't have function info for
-		if call.CalleeID == nil {
+		// For calls that we don't have function info for: external ones, calls the
+		// linker could not resolve, and calls not linked yet (which count as external)
+		if targetNode == nil {
 			if _, ok := externalNodes[targetID]; !ok {
 				externalNodes[targetID] = true
 
@@ -115,7 +127,8 @@ func BuildCallGraph(functions []RepositoryFunction, calls []FunctionCall, fileMa
 					Package:    call.CalleePackage,
 					Function:   split.FunctionName,
 					Receiver:   split.ReceiverName,
-					IsExternal: true,
+					IsExternal: call.ExternalKind != ExternalUnresolved && (call.ExternalKind != "" || call.Confidence == nil),
+					Unresolved: call.ExternalKind == ExternalUnresolved,
 				})
 			}
 		}
@@ -131,6 +144,7 @@ func BuildCallGraph(functions []RepositoryFunction, calls []FunctionCall, fileMa
 				Line:       call.Line,
 				Parameters: call.Parameters,
 				Count:      1,
+				Kind:       call.CallKind,
 			}
 		} else {
 			callDetails[sourceID][targetID].Count = callCounts[sourceID][targetID]
@@ -160,7 +174,18 @@ type FunctionNameParts struct {
 // SplitFunctionName attempts to split a function name into receiver and function parts
 func SplitFunctionName(name string) FunctionNameParts {
 	// Handle simple case with no dot
-	if len(name) == 0 || name[0] == '(' {
+	if len(name) == 0 {
+		return FunctionNameParts{FunctionName: name}
+	}
+
+	// Handle pointer receiver format: (*Type).Method
+	if name[0] == '(' {
+		if end := strings.Index(name, ")."); end > 0 {
+			return FunctionNameParts{
+				ReceiverName: name[1:end],
+				FunctionName: name[end+2:],
+			}
+		}
 		return FunctionNameParts{FunctionName: name}
 	}
 
@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func TestBuildCallGraphUnresolvedCalls(t *testing.T) {
+	files := map[int64]RepositoryFile{1: {ID: 1, Package: "svc", FilePath: "svc/svc.go"}}
+	functions := []RepositoryFunction{{ID: 10, FileID: 1, Name: "Run"}}
+
+	exact, unresolved := ConfidenceExact, ConfidenceUnresolved
+	calls := []FunctionCall{
+		{CallerID: 10, CalleePackage: "fmt", CalleeName: "Println", Confidence: &exact, ExternalKind: ExternalStdlib},
+		{CallerID: 10, CalleeName: "s.handler", Confidence: &unresolved, ExternalKind: ExternalUnresolved},
+		{CallerID: 10, CalleeName: "pending"},
+	}
+
+	graph := BuildCallGraph(functions, calls, files)
+
+	nodes := make(map[string]CallGraphNode)
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+	}
+	if node := nodes["svc.Run"]; node.IsExternal || node.Unresolved {
+		t.Errorf("Expected svc.Run to be a function of the repository, got %+v", node)
+	}
+	if node := nodes["fmt.Println"]; !node.IsExternal || node.Unresolved {
+		t.Errorf("Expected fmt.Println to be external, got %+v", node)
+	}
+	if node := nodes[".s.handler"]; node.IsExternal || !node.Unresolved {
+		t.Errorf("Expected s.handler to be unresolved, got %+v", node)
+	}
+	if node := nodes[".pending"]; !node.IsExternal || node.Unresolved {
+		t.Errorf("Expected calls not linked yet to count as external, got %+v", node)
+	}
+	if len(graph.Edges) != 3 {
+		t.Errorf("Expected 3 edges, got %d", len(graph.Edges))
+	}
+}
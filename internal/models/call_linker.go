@@ -0,0 +1,177 @@
+package models
+
+import (
+	"go/types"
+	"strings"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+)
+
+// External call kinds
+const (
+	ExternalStdlib     = "stdlib"
+	ExternalThirdParty = "third_party"
+	ExternalBuiltin    = "builtin"
+	// ExternalUnresolved marks calls the linker could not resolve, which later links skip
+	ExternalUnresolved = "unresolved"
+)
+
+// Resolution confidences, from a type-checked callee down to a match on the method name only
+const (
+	ConfidenceExact         = 1.0 // Callee qualified by the type checker, or an external package
+	ConfidenceImport        = 0.9 // pkg.Func where pkg is an import of the caller's file
+	ConfidenceSamePackage   = 0.9 // Func declared in the caller's package
+	ConfidenceMethodPackage = 0.6 // x.Method with a single method of that name in the caller's package
+	ConfidenceMethodRepo    = 0.4 // x.Method with a single method of that name in the repository
+	ConfidenceUnresolved    = 0.0
+)
+
+// CallResolution is the outcome of linking a function call to its callee
+type CallResolution struct {
+	CalleeID      *int64
+	CalleePackage string
+	Confidence    float64
+	ExternalKind  string
+}
+
+// CallLinker resolves function calls against the functions of a repository once all its
+// files are stored, using package import paths, receivers and the import aliases of each file
+type CallLinker struct {
+	filePackages map[int64]string            // file ID -> package import path
+	localPackage map[string]bool             // import paths of the repository's packages
+	functions    map[string]int64            // qualified name -> function ID
+	methods      map[string][]linkedMethod   // method name -> methods
+	imports      map[int64]map[string]string // file ID -> import name -> import path
+}
+
+// linkedMethod is a method of the repository, indexed by name
+type linkedMethod struct {
+	id          int64
+	packagePath string
+}
+
+// NewCallLinker indexes the files, functions and imports of a repository
+func NewCallLinker(files []RepositoryFile, functions []RepositoryFunction, deps []FileDependency) *CallLinker {
+	l := &CallLinker{
+		filePackages: make(map[int64]string),
+		localPackage: make(map[string]bool),
+		functions:    make(map[string]int64),
+		methods:      make(map[string][]linkedMethod),
+		imports:      make(map[int64]map[string]string),
+	}
+
+	packageNames := make(map[string]string)
+	for _, file := range files {
+		l.filePackages[file.ID] = file.PackagePath
+		l.localPackage[file.PackagePath] = true
+		packageNames[file.PackagePath] = file.Package
+	}
+
+	for _, fn := range functions {
+		pkgPath, ok := l.filePackages[fn.FileID]
+		if !ok {
+			continue
+		}
+		l.functions[models.QualifiedFunctionName(pkgPath, fn.Receiver, fn.Name)] = fn.ID
+		if fn.Receiver != "" {
+			l.methods[fn.Name] = append(l.methods[fn.Name], linkedMethod{id: fn.ID, packagePath: pkgPath})
+		}
+	}
+
+	for _, dep := range deps {
+		if l.imports[dep.FileID] == nil {
+			l.imports[dep.FileID] = make(map[string]string)
+		}
+		l.imports[dep.FileID][dep.Alias] = dep.ImportPath
+		// The alias recorded for an unnamed import is the last path element, which can
+		// differ from the package name (e.g. gopkg.in/yaml.v3); local packages know theirs
+		if name, ok := packageNames[dep.ImportPath]; ok && name != dep.Alias {
+			if _, taken := l.imports[dep.FileID][name]; !taken {
+				l.imports[dep.FileID][name] = dep.ImportPath
+			}
+		}
+	}
+
+	return l
+}
+
+// Resolve links a call made from a function of the given file
+func (l *CallLinker) Resolve(call FunctionCall, callerFileID int64) CallResolution {
+	name, pkgPath := call.CalleeName, call.CalleePackage
+
+	// Type-checked calls carry the callee's import path
+	if pkgPath != "" {
+		if !l.localPackage[pkgPath] {
+			return external(pkgPath)
+		}
+		if id, ok := l.functions[pkgPath+"."+name]; ok {
+			return resolved(id, pkgPath, ConfidenceExact)
+		}
+		// Interface methods and function values have no declaration to link to
+		return unresolved(pkgPath)
+	}
+
+	callerPackage := l.filePackages[callerFileID]
+
+	// Unqualified call: a function of the same package or a builtin
+	if !strings.Contains(name, ".") {
+		if id, ok := l.functions[callerPackage+"."+name]; ok {
+			return resolved(id, callerPackage, ConfidenceSamePackage)
+		}
+		if types.Universe.Lookup(name) != nil {
+			return CallResolution{Confidence: ConfidenceExact, ExternalKind: ExternalBuiltin}
+		}
+		return unresolved("")
+	}
+
+	parts := strings.Split(name, ".")
+	member := parts[len(parts)-1]
+
+	// pkg.Func through an import of the caller's file
+	if importPath, ok := l.imports[callerFileID][parts[0]]; ok && len(parts) == 2 {
+		if !l.localPackage[importPath] {
+			return external(importPath)
+		}
+		if id, ok := l.functions[importPath+"."+member]; ok {
+			return resolved(id, importPath, ConfidenceImport)
+		}
+		return unresolved(importPath)
+	}
+
+	// x.Method on a value whose type is unknown: match the method name, preferring the caller's package
+	var inPackage []linkedMethod
+	for _, method := range l.methods[member] {
+		if method.packagePath == callerPackage {
+			inPackage = append(inPackage, method)
+		}
+	}
+	switch {
+	case len(inPackage) == 1:
+		return resolved(inPackage[0].id, callerPackage, ConfidenceMethodPackage)
+	case len(inPackage) == 0 && len(l.methods[member]) == 1:
+		method := l.methods[member][0]
+		return resolved(method.id, method.packagePath, ConfidenceMethodRepo)
+	}
+	return unresolved("")
+}
+
+// resolved is a call linked to a function of the repository
+func resolved(id int64, pkgPath string, confidence float64) CallResolution {
+	return CallResolution{CalleeID: &id, CalleePackage: pkgPath, Confidence: confidence}
+}
+
+// unresolved is a call the linker could not link to a function, with the package of its
+// callee when known
+func unresolved(pkgPath string) CallResolution {
+	return CallResolution{CalleePackage: pkgPath, Confidence: ConfidenceUnresolved, ExternalKind: ExternalUnresolved}
+}
+
+// external classifies a call into a package outside the repository
+func external(pkgPath string) CallResolution {
+	kind := ExternalThirdParty
+	// Standard library import paths have no dot in their first element
+	if first, _, _ := strings.Cut(pkgPath, "/"); !strings.Contains(first, ".") {
+		kind = ExternalStdlib
+	}
+	return CallResolution{CalleePackage: pkgPath, Confidence: ConfidenceExact, ExternalKind: kind}
+}
@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestCallLinkerResolve(t *testing.T) {
+	files := []RepositoryFile{
+		{ID: 1, Package: "svc", PackagePath: "example.com/app/svc"},
+		{ID: 2, Package: "store", PackagePath: "example.com/app/store"},
+	}
+	functions := []RepositoryFunction{
+		{ID: 10, FileID: 1, Name: "Run", Receiver: "*Service"},
+		{ID: 11, FileID: 1, Name: "helper"},
+		{ID: 20, FileID: 2, Name: "New"},
+		{ID: 21, FileID: 2, Name: "Get", Receiver: "*Store"},
+	}
+	deps := []FileDependency{
+		{FileID: 1, ImportPath: "example.com/app/store", Alias: "db"},
+		{FileID: 1, ImportPath: "fmt", Alias: "fmt"},
+		{FileID: 1, ImportPath: "github.com/sirupsen/logrus", Alias: "logrus"},
+	}
+	linker := NewCallLinker(files, functions, deps)
+
+	testCases := []struct {
+		name       string
+		call       FunctionCall
+		calleeID   int64
+		confidence float64
+		external   string
+	}{
+		{"type-checked method", FunctionCall{CalleePackage: "example.com/app/store", CalleeName: "(*Store).Get"}, 21, ConfidenceExact, ""},
+		{"type-checked stdlib", FunctionCall{CalleePackage: "strings", CalleeName: "ToUpper"}, 0, ConfidenceExact, ExternalStdlib},
+		{"import alias", FunctionCall{CalleeName: "db.New"}, 20, ConfidenceImport, ""},
+		{"same package", FunctionCall{CalleeName: "helper"}, 11, ConfidenceSamePackage, ""},
+		{"builtin", FunctionCall{CalleeName: "len"}, 0, ConfidenceExact, ExternalBuiltin},
+		{"stdlib import", FunctionCall{CalleeName: "fmt.Println"}, 0, ConfidenceExact, ExternalStdlib},
+		{"third-party import", FunctionCall{CalleeName: "logrus.Info"}, 0, ConfidenceExact, ExternalThirdParty},
+		{"method name", FunctionCall{CalleeName: "s.repo.Get"}, 21, ConfidenceMethodRepo, ""},
+		{"unknown", FunctionCall{CalleeName: "s.handler"}, 0, ConfidenceUnresolved, ExternalUnresolved},
+		{"type-checked interface method", FunctionCall{CalleePackage: "example.com/app/svc", CalleeName: "Getter.Get"}, 0, ConfidenceUnresolved, ExternalUnresolved},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := linker.Resolve(tc.call, 1)
+
+			var calleeID int64
+			if res.CalleeID != nil {
+				calleeID = *res.CalleeID
+			}
+			if calleeID != tc.calleeID || res.Confidence != tc.confidence || res.ExternalKind != tc.external {
+				t.Errorf("Resolve(%s) = (%d, %v, %q), want (%d, %v, %q)", tc.call.CalleeName,
+					calleeID, res.Confidence, res.ExternalKind, tc.calleeID, tc.confidence, tc.external)
+			}
+		})
+	}
+}
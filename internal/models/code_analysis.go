@@ -1,5 +1,10 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 // CodeAnalysisRequest represents a request to analyze a GitHub repository
 type CodeAnalysisRequest struct {
 	RepoURL   string `json:"repo_url" binding:"required"`
@@ -62,8 +67,126 @@ type WorkflowStepInfo struct {
 
 // RepositoryAnalysisResult represents the analysis result for a repository
 type RepositoryAnalysisResult struct {
-	RepoURL string               `json:"repo_url"`
-	Owner   string               `json:"owner"`
-	Name    string               `json:"name"`
-	Files   []FileAnalysisResult `json:"files"`
+	RepositoryID string               `json:"repository_id,omitempty"` // Set once the result is stored
+	RepoURL      string               `json:"repo_url"`
+	Owner        string               `json:"owner"`
+	Name         string               `json:"name"`
+	Files        []FileAnalysisResult `json:"files"`
+}
+
+// Types of workflow steps
+const (
+	StepTypeExternalSystem = "external_system"
+	StepTypeDatabase       = "database"
+	StepTypeLogic          = "logic"
+	StepTypeFunctionCall   = "function_call"
+)
+
+// stepTypeAliases maps the other ways the analysis names a step type to the type
+var stepTypeAliases = map[string]string{
+	"external":        StepTypeExternalSystem,
+	"external_api":    StepTypeExternalSystem,
+	"external_call":   StepTypeExternalSystem,
+	"external_system": StepTypeExternalSystem,
+	"api_call":        StepTypeExternalSystem,
+	"http_call":       StepTypeExternalSystem,
+	"db":              StepTypeDatabase,
+	"database":        StepTypeDatabase,
+	"database_call":   StepTypeDatabase,
+	"logic":           StepTypeLogic,
+	"business_logic":  StepTypeLogic,
+	"function":        StepTypeFunctionCall,
+	"function_call":   StepTypeFunctionCall,
+	"method_call":     StepTypeFunctionCall,
+}
+
+// NormalizeStepType converts a step type as written by the analysis, such as
+// "External System", to one of the step types. Types it does not know are kept, in
+// snake case.
+func NormalizeStepType(stepType string) string {
+	normalized := strings.Join(strings.FieldsFunc(strings.ToLower(stepType), func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-' || r == '/'
+	}), "_")
+	if known, ok := stepTypeAliases[normalized]; ok {
+		return known
+	}
+	return normalized
+}
+
+// IsStepType checks whether a step type filter is one of the step types
+func IsStepType(stepType string) bool {
+	switch stepType {
+	case StepTypeExternalSystem, StepTypeDatabase, StepTypeLogic, StepTypeFunctionCall:
+		return true
+	}
+	return false
+}
+
+// AnalyzedRepository is a repository whose analysis is stored in the code_analysis schema
+type AnalyzedRepository struct {
+	ID         string     `json:"id" db:"id"`
+	RepoURL    string     `json:"repo_url" db:"repo_url"`
+	Owner      string     `json:"owner" db:"owner"`
+	Name       string     `json:"name" db:"name"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	AnalyzedAt *time.Time `json:"analyzed_at,omitempty" db:"analyzed_at"`
+}
+
+// WorkflowStep is a stored workflow step of a file
+type WorkflowStep struct {
+	ID           string   `json:"id" db:"id"`
+	FilePath     string   `json:"file_path" db:"file_path"`
+	WorkflowName string   `json:"workflow_name" db:"workflow_name"`
+	Position     int      `json:"position" db:"position"`
+	Name         string   `json:"name" db:"name"`
+	StepType     string   `json:"step_type" db:"step_type"`
+	TypeDetails  string   `json:"type_details" db:"type_details"`
+	Description  string   `json:"description" db:"description"`
+	Dependencies []string `json:"dependencies" db:"-"`
+	InputVars    []string `json:"input_vars" db:"-"`
+	OutputVars   []string `json:"output_vars" db:"-"`
+}
+
+// Workflow is a workflow of a file with its steps in order
+type Workflow struct {
+	Name     string         `json:"name"`
+	FilePath string         `json:"file_path"`
+	Steps    []WorkflowStep `json:"steps"`
+}
+
+// WorkflowsResponse lists the workflows of an analyzed repository
+type WorkflowsResponse struct {
+	Repository *AnalyzedRepository `json:"repository"`
+	Workflows  []Workflow          `json:"workflows"`
+}
+
+// WorkflowStepsResponse lists the workflow steps of an analyzed repository
+type WorkflowStepsResponse struct {
+	Repository *AnalyzedRepository `json:"repository"`
+	Steps      []WorkflowStep      `json:"steps"`
+}
+
+// GroupWorkflows groups workflow steps, ordered by file and workflow, into workflows
+func GroupWorkflows(steps []WorkflowStep) []Workflow {
+	workflows := []Workflow{}
+	for _, step := range steps {
+		n := len(workflows)
+		if n == 0 || workflows[n-1].FilePath != step.FilePath || workflows[n-1].Name != step.WorkflowName {
+			workflows = append(workflows, Workflow{Name: step.WorkflowName, FilePath: step.FilePath})
+			n++
+		}
+		workflows[n-1].Steps = append(workflows[n-1].Steps, step)
+	}
+	return workflows
+}
+
+// HasStepType checks whether a workflow has a step of a type
+func (w Workflow) HasStepType(stepType string) bool {
+	for _, step := range w.Steps {
+		if step.StepType == stepType {
+			return true
+		}
+	}
+	return false
 }
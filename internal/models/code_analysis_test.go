@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestNormalizeStepType(t *testing.T) {
+	for stepType, want := range map[string]string{
+		"External System": StepTypeExternalSystem,
+		"external-api":    StepTypeExternalSystem,
+		"Database":        StepTypeDatabase,
+		"DB":              StepTypeDatabase,
+		" logic ":         StepTypeLogic,
+		"Function Call":   StepTypeFunctionCall,
+		"function_call":   StepTypeFunctionCall,
+		"Message Queue":   "message_queue",
+	} {
+		if got := NormalizeStepType(stepType); got != want {
+			t.Errorf("NormalizeStepType(%q) = %q, want %q", stepType, got, want)
+		}
+	}
+	if IsStepType("message_queue") || !IsStepType(StepTypeDatabase) {
+		t.Error("Expected only the known step types to be step types")
+	}
+}
+
+func TestGroupWorkflows(t *testing.T) {
+	steps := []WorkflowStep{
+		{FilePath: "a.go", WorkflowName: "Login", Name: "load user", StepType: StepTypeDatabase},
+		{FilePath: "a.go", WorkflowName: "Login", Name: "check password", StepType: StepTypeLogic},
+		{FilePath: "a.go", WorkflowName: "Logout", Name: "clear session", StepType: StepTypeDatabase},
+		{FilePath: "b.go", WorkflowName: "Login", Name: "call idp", StepType: StepTypeExternalSystem},
+	}
+
+	workflows := GroupWorkflows(steps)
+	if len(workflows) != 3 {
+		t.Fatalf("Expected 3 workflows, got %d", len(workflows))
+	}
+	if w := workflows[0]; w.FilePath != "a.go" || w.Name != "Login" || len(w.Steps) != 2 || w.Steps[1].Name != "check password" {
+		t.Errorf("Unexpected first workflow: %+v", w)
+	}
+	if w := workflows[2]; w.FilePath != "b.go" || w.Name != "Login" || len(w.Steps) != 1 {
+		t.Errorf("Expected workflows of the same name in other files to be kept apart, got %+v", w)
+	}
+	if !workflows[0].HasStepType(StepTypeLogic) || workflows[1].HasStepType(StepTypeLogic) {
+		t.Error("Expected HasStepType to look at the steps of the workflow only")
+	}
+
+	if workflows := GroupWorkflows(nil); workflows == nil || len(workflows) != 0 {
+		t.Errorf("Expected no workflows, got %v", workflows)
+	}
+}
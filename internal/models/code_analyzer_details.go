@@ -11,17 +11,27 @@ type FunctionCall struct {
 	CalleeName    string    `json:"callee_name" db:"callee_name"`
 	CalleePackage string    `json:"callee_package" db:"callee_package"`
 	CalleeID      *int64    `json:"callee_id,omitempty" db:"callee_id"`
+	CallKind      string    `json:"call_kind" db:"call_kind"`                   // "static" or "dynamic"
+	Confidence    *float64  `json:"confidence,omitempty" db:"confidence"`       // How certain the callee resolution is, 0..1
+	ExternalKind  string    `json:"external_kind,omitempty" db:"external_kind"` // "stdlib", "third_party" or "builtin" for calls outside the repository, "unresolved" for calls the linker could not resolve
 	Line          int       `json:"line" db:"line"`
 	Parameters    string    `json:"parameters" db:"parameters"` // JSON string
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// CallerFunctionCall is a function call together with the file of the calling function
+type CallerFunctionCall struct {
+	FunctionCall
+	CallerFileID int64 `json:"caller_file_id" db:"caller_file_id"`
+}
+
 // FunctionReference represents a reference to a function in the code
 type FunctionReference struct {
 	ID             int64     `json:"id" db:"id"`
 	FunctionID     int64     `json:"function_id" db:"function_id"`
-	ReferenceType  string    `json:"reference_type" db:"reference_type"` // "declaration", "usage", "modification"
+	Member         string    `json:"member,omitempty" db:"member"`       // Field or method of the symbol referenced, if any
+	ReferenceType  string    `json:"reference_type" db:"reference_type"` // "declaration", "read", "write", "address_taken", "call"
 	FileID         int64     `json:"file_id" db:"file_id"`
 	Line           int       `json:"line" db:"line"`
 	ColumnPosition int       `json:"column_position" db:"column_position"`
@@ -47,14 +57,15 @@ type FunctionStatement struct {
 	
 	// Temporary fields used during conversion, not stored in DB
 	FunctionIndex    int  `json:"-" db:"-"`  // Index in the functions slice for lookup
-	ParentIndex      int  `json:"-" db:"-"`  // Index in the statements slice for parent lookup
+	ParentIndex      int  `json:"-" db:"-"`  // Index in the statements slice for parent lookup, -1 for top-level statements
 }
 
 // SymbolReference represents a reference to a symbol in the code
 type SymbolReference struct {
 	ID             int64     `json:"id" db:"id"`
 	SymbolID       int64     `json:"symbol_id" db:"symbol_id"`
-	ReferenceType  string    `json:"reference_type" db:"reference_type"` // "declaration", "usage", "modification"
+	Member         string    `json:"member,omitempty" db:"member"`       // Field or method of the symbol referenced, if any
+	ReferenceType  string    `json:"reference_type" db:"reference_type"` // "declaration", "read", "write", "address_taken", "call"
 	FileID         int64     `json:"file_id" db:"file_id"`
 	Line           int       `json:"line" db:"line"`
 	ColumnPosition int       `json:"column_position" db:"column_position"`
@@ -63,6 +74,24 @@ type SymbolReference struct {
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// SymbolUsage is a reference to a symbol together with the symbol and the file it occurs in
+type SymbolUsage struct {
+	SymbolReference
+	SymbolName  string `json:"symbol_name" db:"symbol_name"`
+	SymbolKind  string `json:"symbol_kind" db:"symbol_kind"`
+	PackagePath string `json:"package_path" db:"package_path"` // Package declaring the symbol
+	FilePath    string `json:"file_path" db:"file_path"`       // File containing the reference
+}
+
+// SymbolUsagesResponse lists the usages of a symbol, or of a field or method of it
+type SymbolUsagesResponse struct {
+	Repository *Repository         `json:"repository"`
+	Snapshot   *RepositorySnapshot `json:"snapshot,omitempty"`
+	Symbol     string              `json:"symbol"`
+	Package    string              `json:"package,omitempty"`
+	Usages     []SymbolUsage       `json:"usages"`
+}
+
 // ExtendedRepositoryFunction includes the base RepositoryFunction with its related entities
 type ExtendedRepositoryFunction struct {
 	Function   RepositoryFunction  `json:"function"`
@@ -0,0 +1,336 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Kinds of basic blocks of a control-flow graph
+const (
+	FlowBlockEntry = "entry" // Where the function starts
+	FlowBlockExit  = "exit"  // Where the function returns or panics
+	FlowBlockBody  = "body"
+	FlowBlockLoop  = "loop" // Loop header, evaluating the loop condition
+)
+
+// Kinds of control-flow edges
+const (
+	FlowEdgeNext    = "next"    // Falls through to the next block
+	FlowEdgeTrue    = "true"    // The condition holds: then branch, or another loop iteration
+	FlowEdgeFalse   = "false"   // The condition does not hold: else branch, or loop exit
+	FlowEdgeCase    = "case"    // A case of a switch or select is taken
+	FlowEdgeDefault = "default" // No case of a switch matches
+	FlowEdgeBack    = "back"    // Loop back-edge, at the end of an iteration or on continue
+	FlowEdgeBreak   = "break"
+	FlowEdgeReturn  = "return"
+	FlowEdgePanic   = "panic"
+)
+
+// FlowStatement is a statement of a basic block
+type FlowStatement struct {
+	StatementID int64  `json:"statement_id,omitempty"`
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Line        int    `json:"line"`
+}
+
+// BasicBlock is a run of statements executed one after the other. Only its last statement
+// branches.
+type BasicBlock struct {
+	ID         int             `json:"id"`
+	Kind       string          `json:"kind"`
+	Statements []FlowStatement `json:"statements"`
+}
+
+// FlowEdge is a transfer of control between two basic blocks
+type FlowEdge struct {
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Kind  string `json:"kind"`
+	Label string `json:"label,omitempty"` // Condition or case the edge is taken on
+}
+
+// ControlFlowGraph is the control-flow graph of a function
+type ControlFlowGraph struct {
+	Entry  int          `json:"entry"`
+	Exit   int          `json:"exit"`
+	Blocks []BasicBlock `json:"blocks"`
+	Edges  []FlowEdge   `json:"edges"`
+}
+
+// FunctionFlowResponse is the statement tree and control-flow graph of a function
+type FunctionFlowResponse struct {
+	Function    *RepositoryFunction `json:"function"`
+	Statements  []FunctionStatement `json:"statements"`
+	ControlFlow *ControlFlowGraph   `json:"control_flow"`
+}
+
+// flowTarget is a loop, switch or select that break and continue statements leave
+type flowTarget struct {
+	label      string
+	breakTo    int // Block after it, created when first jumped to
+	continueTo int // Loop header, -1 for switches and selects
+}
+
+// flowBuilder builds a control-flow graph from a statement tree
+type flowBuilder struct {
+	graph   *ControlFlowGraph
+	targets []*flowTarget
+	label   string // Label of the statement about to be built
+}
+
+// BuildControlFlowGraph derives the control-flow graph of a function from its statement
+// tree. Goto statements are kept in their block but not followed.
+func BuildControlFlowGraph(statements []FunctionStatement) *ControlFlowGraph {
+	b := &flowBuilder{graph: &ControlFlowGraph{Blocks: []BasicBlock{}, Edges: []FlowEdge{}}}
+	b.graph.Entry = b.newBlock(FlowBlockEntry)
+	b.graph.Exit = b.newBlock(FlowBlockExit)
+
+	if end := b.buildList(statements, b.graph.Entry); end >= 0 {
+		b.addEdge(end, b.graph.Exit, FlowEdgeNext, "")
+	}
+	return b.graph
+}
+
+// buildList builds a list of statements starting in a block, returning the block control
+// continues in after them, or -1 when it does not
+func (b *flowBuilder) buildList(statements []FunctionStatement, block int) int {
+	for _, stmt := range statements {
+		if block < 0 {
+			// Code after a return, break or continue is unreachable, but still shown
+			block = b.newBlock(FlowBlockBody)
+		}
+		block = b.build(stmt, block)
+	}
+	return block
+}
+
+// build builds a statement in a block, returning the block control continues in after it,
+// or -1 when it does not
+func (b *flowBuilder) build(stmt FunctionStatement, block int) int {
+	label := b.label
+	b.label = ""
+
+	switch stmt.StatementType {
+	case "block":
+		return b.buildList(stmt.Children, block)
+
+	case "labeled":
+		if len(stmt.Children) == 0 {
+			return block
+		}
+		b.label = stmt.Text
+		return b.build(stmt.Children[0], block)
+
+	case "if_statement":
+		return b.buildIf(stmt, block)
+
+	case "for_loop", "range_loop":
+		return b.buildLoop(stmt, block, label)
+
+	case "switch", "type_switch", "select":
+		return b.buildSwitch(stmt, block, label)
+
+	case "return":
+		b.appendStatement(block, stmt)
+		b.addEdge(block, b.graph.Exit, FlowEdgeReturn, "")
+		return -1
+
+	case "break", "continue":
+		b.appendStatement(block, stmt)
+		target := b.findTarget(branchLabel(stmt), stmt.StatementType == "continue")
+		if target == nil {
+			return block
+		}
+		if stmt.StatementType == "continue" {
+			b.addEdge(block, target.continueTo, FlowEdgeBack, "")
+		} else {
+			b.addEdge(block, b.resolve(&target.breakTo), FlowEdgeBreak, "")
+		}
+		return -1
+
+	case "function_call":
+		b.appendStatement(block, stmt)
+		if calls := decodeStrings(stmt.Calls); len(calls) > 0 && calls[0] == "panic" {
+			b.addEdge(block, b.graph.Exit, FlowEdgePanic, "")
+			return -1
+		}
+		return block
+
+	default:
+		b.appendStatement(block, stmt)
+		return block
+	}
+}
+
+// buildIf builds an if statement, or an else-if clause, ending the block with its condition
+func (b *flowBuilder) buildIf(stmt FunctionStatement, block int) int {
+	b.appendStatement(block, stmt)
+	condition := conditionLabel(stmt)
+
+	var then []FunctionStatement
+	var elseClause *FunctionStatement
+	for i, child := range stmt.Children {
+		switch child.StatementType {
+		case "block":
+			then = child.Children
+		case "else_clause":
+			elseClause = &stmt.Children[i]
+		}
+	}
+
+	join := -1
+	thenStart := b.newBlock(FlowBlockBody)
+	b.addEdge(block, thenStart, FlowEdgeTrue, condition)
+	if end := b.buildList(then, thenStart); end >= 0 {
+		b.addEdge(end, b.resolve(&join), FlowEdgeNext, "")
+	}
+
+	if elseClause == nil {
+		b.addEdge(block, b.resolve(&join), FlowEdgeFalse, condition)
+		return join
+	}
+
+	elseStart := b.newBlock(FlowBlockBody)
+	b.addEdge(block, elseStart, FlowEdgeFalse, condition)
+	var end int
+	if len(decodeStrings(elseClause.Conditions)) > 0 {
+		// else if
+		end = b.buildIf(*elseClause, elseStart)
+	} else {
+		end = b.buildList(elseClause.Children, elseStart)
+	}
+	if end >= 0 {
+		b.addEdge(end, b.resolve(&join), FlowEdgeNext, "")
+	}
+	return join
+}
+
+// buildLoop builds a for or range loop: a header evaluating its condition, its body
+// branching back to the header, and the block after it
+func (b *flowBuilder) buildLoop(stmt FunctionStatement, block int, label string) int {
+	header := b.newBlock(FlowBlockLoop)
+	b.addEdge(block, header, FlowEdgeNext, "")
+	b.appendStatement(header, stmt)
+	condition := conditionLabel(stmt)
+
+	target := &flowTarget{label: label, breakTo: -1, continueTo: header}
+	b.targets = append(b.targets, target)
+	body := b.newBlock(FlowBlockBody)
+	b.addEdge(header, body, FlowEdgeTrue, condition)
+	if end := b.buildList(stmt.Children, body); end >= 0 {
+		b.addEdge(end, header, FlowEdgeBack, "")
+	}
+	b.targets = b.targets[:len(b.targets)-1]
+
+	// A loop without a condition only ends on break
+	if stmt.StatementType == "range_loop" || condition != "" {
+		b.addEdge(header, b.resolve(&target.breakTo), FlowEdgeFalse, condition)
+	}
+	return target.breakTo
+}
+
+// buildSwitch builds a switch, type switch or select, branching from the block to each of
+// its clauses
+func (b *flowBuilder) buildSwitch(stmt FunctionStatement, block int, label string) int {
+	b.appendStatement(block, stmt)
+
+	target := &flowTarget{label: label, breakTo: -1, continueTo: -1}
+	b.targets = append(b.targets, target)
+
+	// Clauses get their blocks up front, for fallthrough to jump to the next one
+	starts := make([]int, len(stmt.Children))
+	for i := range stmt.Children {
+		starts[i] = b.newBlock(FlowBlockBody)
+	}
+
+	hasDefault := false
+	for i, clause := range stmt.Children {
+		kind := FlowEdgeCase
+		if clause.StatementType == "default" {
+			kind, hasDefault = FlowEdgeDefault, true
+		}
+		b.addEdge(block, starts[i], kind, clause.Text)
+
+		end := b.buildList(clause.Children, starts[i])
+		if end < 0 {
+			continue
+		}
+		if n := len(clause.Children); n > 0 && clause.Children[n-1].StatementType == "fallthrough" && i+1 < len(starts) {
+			b.addEdge(end, starts[i+1], FlowEdgeNext, "fallthrough")
+		} else {
+			b.addEdge(end, b.resolve(&target.breakTo), FlowEdgeNext, "")
+		}
+	}
+	b.targets = b.targets[:len(b.targets)-1]
+
+	// A switch without a default clause may match no case; a select without one waits
+	if !hasDefault && stmt.StatementType != "select" {
+		b.addEdge(block, b.resolve(&target.breakTo), FlowEdgeDefault, "")
+	}
+	return target.breakTo
+}
+
+// findTarget finds the loop, switch or select a break or continue statement leaves: the
+// one with its label, or the innermost one
+func (b *flowBuilder) findTarget(label string, loop bool) *flowTarget {
+	for i := len(b.targets) - 1; i >= 0; i-- {
+		target := b.targets[i]
+		if loop && target.continueTo < 0 {
+			continue
+		}
+		if label == "" || target.label == label {
+			return target
+		}
+	}
+	return nil
+}
+
+// newBlock adds an empty block to the graph
+func (b *flowBuilder) newBlock(kind string) int {
+	id := len(b.graph.Blocks)
+	b.graph.Blocks = append(b.graph.Blocks, BasicBlock{ID: id, Kind: kind, Statements: []FlowStatement{}})
+	return id
+}
+
+// resolve gets a block that is only created when first jumped to
+func (b *flowBuilder) resolve(block *int) int {
+	if *block < 0 {
+		*block = b.newBlock(FlowBlockBody)
+	}
+	return *block
+}
+
+// addEdge adds an edge between two blocks
+func (b *flowBuilder) addEdge(from, to int, kind, label string) {
+	b.graph.Edges = append(b.graph.Edges, FlowEdge{From: from, To: to, Kind: kind, Label: label})
+}
+
+// appendStatement appends a statement to a block
+func (b *flowBuilder) appendStatement(block int, stmt FunctionStatement) {
+	b.graph.Blocks[block].Statements = append(b.graph.Blocks[block].Statements, FlowStatement{
+		StatementID: stmt.ID,
+		Type:        stmt.StatementType,
+		Text:        stmt.Text,
+		Line:        stmt.Line,
+	})
+}
+
+// branchLabel gets the label of a break or continue statement, if any
+func branchLabel(stmt FunctionStatement) string {
+	return strings.TrimSpace(strings.TrimPrefix(stmt.Text, stmt.StatementType))
+}
+
+// conditionLabel gets the conditions of a statement as a single label
+func conditionLabel(stmt FunctionStatement) string {
+	return strings.Join(decodeStrings(stmt.Conditions), ", ")
+}
+
+// decodeStrings decodes a JSON array of strings, such as the conditions of a statement
+func decodeStrings(data string) []string {
+	var values []string
+	if data != "" {
+		_ = json.Unmarshal([]byte(data), &values)
+	}
+	return values
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/goanalyzer"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const flowSource = `package sample
+
+func Handle(items []int) error {
+	if len(items) == 0 {
+		return errEmpty
+	}
+outer:
+	for _, item := range items {
+		switch {
+		case item < 0:
+			continue outer
+		case item == 0:
+			break outer
+		}
+		process(item)
+	}
+	return nil
+}
+`
+
+func TestBuildControlFlowGraph(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+	path := filepath.Join(t.TempDir(), "sample.go")
+	if err := os.WriteFile(path, []byte(flowSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	analysis, err := goanalyzer.New().AnalyzeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	functions, _, statements, _, _, _ := FileAnalysisToRepositoryModels(analysis, 1, 1)
+	if len(functions) != 1 {
+		t.Fatalf("got %d functions, want 1", len(functions))
+	}
+
+	want := []FlowEdge{
+		{0, 2, FlowEdgeTrue, "len(items) == 0"},
+		{2, 1, FlowEdgeReturn, ""},
+		{0, 3, FlowEdgeFalse, "len(items) == 0"},
+		{3, 4, FlowEdgeNext, ""},
+		{4, 5, FlowEdgeTrue, "range items"},
+		{5, 6, FlowEdgeCase, "case item < 0"},
+		{6, 4, FlowEdgeBack, ""},
+		{5, 7, FlowEdgeCase, "case item == 0"},
+		{7, 8, FlowEdgeBreak, ""},
+		{5, 9, FlowEdgeDefault, ""},
+		{9, 4, FlowEdgeBack, ""},
+		{4, 8, FlowEdgeFalse, "range items"},
+		{8, 1, FlowEdgeReturn, ""},
+	}
+	graph := BuildControlFlowGraph(functions[0].Statements)
+	if !reflect.DeepEqual(graph.Edges, want) {
+		t.Errorf("edges = %v, want %v", graph.Edges, want)
+	}
+	if graph.Blocks[4].Kind != FlowBlockLoop || len(graph.Blocks) != 10 {
+		t.Errorf("blocks = %v", graph.Blocks)
+	}
+
+	// Storing the flattened statements and nesting them again gives back the same tree
+	for i := range statements {
+		statements[i].ID = int64(i + 1)
+		if statements[i].FunctionIndex != 0 {
+			t.Fatalf("statement %d has function index %d", i, statements[i].FunctionIndex)
+		}
+		if parent := statements[i].ParentIndex; parent >= 0 {
+			if parent >= i {
+				t.Fatalf("statement %d comes before its parent %d", i, parent)
+			}
+			statements[i].ParentStatementID = &statements[parent].ID
+		}
+	}
+	nested := BuildControlFlowGraph(NestStatements(statements))
+	if !reflect.DeepEqual(nested.Edges, want) {
+		t.Errorf("edges of nested statements = %v, want %v", nested.Edges, want)
+	}
+}
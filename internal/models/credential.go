@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Credential owner types
+const (
+	CredentialOwnerUser         = "user"
+	CredentialOwnerOrganization = "organization"
+)
+
+// Credential kinds
+const (
+	CredentialGitHubPAT = "github_pat" // Personal access token, sent over HTTPS
+	CredentialDeployKey = "deploy_key" // SSH private key
+	CredentialBasicAuth = "basic_auth" // Username and password, sent over HTTPS
+)
+
+// RepositoryCredential is a stored credential for private repositories. Its secret is
+// encrypted at rest and never returned by the API.
+type RepositoryCredential struct {
+	ID              int64      `json:"id" db:"id"`
+	OwnerType       string     `json:"owner_type" db:"owner_type"` // "user" or "organization"
+	OwnerID         string     `json:"owner_id" db:"owner_id"`     // User ID or organization name
+	Name            string     `json:"name" db:"name"`
+	Kind            string     `json:"kind" db:"kind"`
+	Host            string     `json:"host" db:"host"` // Host the credential may be sent to
+	Username        string     `json:"username,omitempty" db:"username"`
+	EncryptedSecret []byte     `json:"-" db:"encrypted_secret"`
+	CreatedBy       string     `json:"created_by" db:"created_by"`
+	LastUsedAt      *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// SecretBinding is the data the secret of a credential is bound to when encrypted, so a
+// secret copied to another owner or host in the database no longer decrypts
+func (c *RepositoryCredential) SecretBinding() []byte {
+	return []byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s", c.OwnerType, c.OwnerID, c.Name, c.Host))
+}
+
+// UsableBy reports whether a user, of a role and member of organizations, may index with a
+// credential: their own, one of their organizations', or any credential for admins
+func (c *RepositoryCredential) UsableBy(userID, role string, organizations []string) bool {
+	if role == "admin" {
+		return true
+	}
+	switch c.OwnerType {
+	case CredentialOwnerUser:
+		return c.OwnerID == userID
+	case CredentialOwnerOrganization:
+		for _, organization := range organizations {
+			if organization == c.OwnerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OrganizationMember is a user who may index with the credentials of an organization
+type OrganizationMember struct {
+	Organization string    `json:"organization" db:"organization"`
+	UserID       string    `json:"user_id" db:"user_id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// CredentialSecret is the secret part of a credential, encrypted as a whole
+type CredentialSecret struct {
+	Token    string `json:"token,omitempty"`
+	Password string `json:"password,omitempty"`
+	SSHKey   string `json:"ssh_key,omitempty"`
+}
+
+// CreateCredentialRequest is used to store a credential
+type CreateCredentialRequest struct {
+	OwnerType string `json:"owner_type"` // "user" by default, or "organization"
+	OwnerID   string `json:"owner_id"`   // Organization name; user credentials belong to the caller
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // "github_pat", "deploy_key" or "basic_auth"
+	Host      string `json:"host"` // e.g. "github.com"; the credential is only sent to this host
+	Username  string `json:"username,omitempty"`
+	Token     string `json:"token,omitempty"`    // For github_pat
+	Password  string `json:"password,omitempty"` // For basic_auth
+	SSHKey    string `json:"ssh_key,omitempty"`  // PEM private key, for deploy_key
+}
+
+// Validate checks a credential request, defaulting it to a user credential
+func (r *CreateCredentialRequest) Validate() error {
+	if r.OwnerType == "" {
+		r.OwnerType = CredentialOwnerUser
+	}
+	switch r.OwnerType {
+	case CredentialOwnerUser:
+	case CredentialOwnerOrganization:
+		if r.OwnerID == "" {
+			return fmt.Errorf("owner_id is required for organization credentials")
+		}
+	default:
+		return fmt.Errorf("invalid owner_type %q", r.OwnerType)
+	}
+
+	if r.Name == "" || len(r.Name) > 255 {
+		return fmt.Errorf("name is required")
+	}
+	r.Host = strings.ToLower(strings.TrimSpace(r.Host))
+	if r.Host == "" || strings.ContainsAny(r.Host, "/@: ") {
+		return fmt.Errorf("host must be a host name, such as github.com")
+	}
+
+	switch r.Kind {
+	case CredentialGitHubPAT:
+		if r.Token == "" {
+			return fmt.Errorf("token is required for %s credentials", r.Kind)
+		}
+	case CredentialDeployKey:
+		if !strings.Contains(r.SSHKey, "PRIVATE KEY") {
+			return fmt.Errorf("ssh_key must be a PEM private key for %s credentials", r.Kind)
+		}
+	case CredentialBasicAuth:
+		if r.Username == "" || r.Password == "" {
+			return fmt.Errorf("username and password are required for %s credentials", r.Kind)
+		}
+	default:
+		return fmt.Errorf("invalid kind %q", r.Kind)
+	}
+	return nil
+}
+
+// Secret gets the secret of a credential request, only keeping what its kind uses
+func (r *CreateCredentialRequest) Secret() CredentialSecret {
+	switch r.Kind {
+	case CredentialGitHubPAT:
+		return CredentialSecret{Token: r.Token}
+	case CredentialDeployKey:
+		return CredentialSecret{SSHKey: r.SSHKey}
+	default:
+		return CredentialSecret{Password: r.Password}
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Index job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Kinds of jobs run by the index workers
+const (
+	JobKindIndex      = "index"      // Indexing a ref of a repository
+	JobKindInsights   = "insights"   // Generating the missing or stale insights of a repository bottom-up
+	JobKindRegenerate = "regenerate" // Regenerating only the stale insights of a repository, up to a number of tokens
+)
+
+// Phases of a running index job
+const (
+	JobPhaseFetch   = "fetch"   // Cloning or pulling the repository
+	JobPhaseAnalyze = "analyze" // Analyzing files and generating their insights
+	JobPhaseLink    = "link"    // Linking calls and references across files
+)
+
+// Phases of a running insights job, one for each level of insights generated
+const (
+	JobPhaseFunctions  = "functions"  // Functions and structs without an insight
+	JobPhaseFiles      = "files"      // Files, from the insights of their functions and structs
+	JobPhasePackages   = "packages"   // Packages, from the insights of their files
+	JobPhaseRepository = "repository" // The repository, from the insights of its packages
+)
+
+// IndexJob is a queued or running indexing of a repository, or another job of a kind run by the
+// index workers. The files of jobs generating insights are the items of their current phase.
+type IndexJob struct {
+	ID              int64      `json:"id" db:"id"`
+	RepositoryID    int64      `json:"repository_id" db:"repository_id"`
+	Kind            string     `json:"kind" db:"kind"`
+	Model           string     `json:"model,omitempty" db:"model"`                 // Model insights jobs generate with; the default if empty
+	Ref             string     `json:"ref,omitempty" db:"ref"`                     // Branch, tag or commit indexed; the default branch if empty
+	RequestedBy     string     `json:"requested_by,omitempty" db:"requested_by"`   // User whose budget the LLM calls are charged to
+	CredentialID    *int64     `json:"credential_id,omitempty" db:"credential_id"` // Credential the requester was authorized to fetch with
+	SnapshotID      *int64     `json:"snapshot_id,omitempty" db:"snapshot_id"`     // Snapshot indexed, once the ref is resolved
+	Status          string     `json:"status" db:"status"`
+	Phase           string     `json:"phase" db:"phase"`
+	FilesTotal      int        `json:"files_total" db:"files_total"`
+	FilesDone       int        `json:"files_done" db:"files_done"`
+	LLMCalls        int        `json:"llm_calls" db:"llm_calls"`
+	TokensUsed      int        `json:"tokens_used" db:"tokens_used"`         // Tokens of the LLM calls of the job
+	MaxTokens       int        `json:"max_tokens,omitempty" db:"max_tokens"` // Tokens regenerate jobs stop at; no cap if 0
+	Attempts        int        `json:"attempts" db:"attempts"`
+	CancelRequested bool       `json:"cancel_requested" db:"cancel_requested"`
+	WorkerID        string     `json:"worker_id,omitempty" db:"worker_id"`
+	Error           string     `json:"error,omitempty" db:"error"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Finished reports whether the job reached a final status
+func (j *IndexJob) Finished() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
@@ -14,6 +14,7 @@ type LLMChatRequest struct {
 	Temperature *float32     `json:"temperature,omitempty"`
 	TopP        *float32     `json:"top_p,omitempty"`
 	Stream      bool         `json:"stream,omitempty"`
+	Cache       string       `json:"cache,omitempty"` // "bypass" or "refresh" the response cache, used by default
 }
 
 // LLMChatResponse represents a response from chatting with an LLM
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Budget scopes
+const (
+	BudgetScopeUser       = "user"
+	BudgetScopeRepository = "repository"
+)
+
+// Groupings of LLM usage
+const (
+	UsageByUser       = "user"
+	UsageByRepository = "repository"
+	UsageByFeature    = "feature"
+	UsageByModel      = "model"
+	UsageByDay        = "day"
+)
+
+// LLMUsage is the usage of an LLM call and what it cost
+type LLMUsage struct {
+	ID               int64     `json:"id" db:"id"`
+	UserID           string    `json:"user_id,omitempty" db:"user_id"`
+	RepositoryID     *int64    `json:"repository_id,omitempty" db:"repository_id"`
+	Feature          string    `json:"feature" db:"feature"`
+	Model            string    `json:"model" db:"model"`
+	PromptTokens     int       `json:"prompt_tokens" db:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens" db:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd" db:"cost_usd"`
+	Estimated        bool      `json:"estimated" db:"estimated"` // Tokens estimated as the provider did not report them
+	Cached           bool      `json:"cached" db:"cached"`       // Answered from the cache, at no cost
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// LLMUsageQuery selects the LLM usage to aggregate and how to group it
+type LLMUsageQuery struct {
+	GroupBy      string    // "user", "repository", "feature", "model" or "day"
+	UserID       string    // Only the calls of a user, if set
+	RepositoryID int64     // Only the calls for a repository, if set
+	Feature      string    // Only the calls for a feature, if set
+	Model        string    // Only the calls to a model, if set
+	From         time.Time // Calls made at or after
+	To           time.Time // Calls made before
+}
+
+// Validate checks the grouping of the query
+func (q *LLMUsageQuery) Validate() error {
+	switch q.GroupBy {
+	case UsageByUser, UsageByRepository, UsageByFeature, UsageByModel, UsageByDay:
+		return nil
+	}
+	return fmt.Errorf("group_by must be one of user, repository, feature, model or day")
+}
+
+// LLMUsageSummary is the usage of the LLM calls of a group
+type LLMUsageSummary struct {
+	Key              string  `json:"key" db:"key"` // User, repository, feature, model or day of the group
+	Calls            int64   `json:"calls" db:"calls"`
+	CachedCalls      int64   `json:"cached_calls" db:"cached_calls"` // Calls answered from the cache
+	PromptTokens     int64   `json:"prompt_tokens" db:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens" db:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd" db:"cost_usd"`
+}
+
+// LLMUsageReport is the usage of the LLM calls of a period, in total and by group
+type LLMUsageReport struct {
+	GroupBy string            `json:"group_by"`
+	From    time.Time         `json:"from"`
+	To      time.Time         `json:"to"`
+	Total   LLMUsageSummary   `json:"total"`
+	Groups  []LLMUsageSummary `json:"groups"`
+}
+
+// LLMBudget is the monthly spending limit of a user or repository. No new index jobs are
+// queued for them once they spent it.
+type LLMBudget struct {
+	ID              int64     `json:"id" db:"id"`
+	Scope           string    `json:"scope" db:"scope"`       // "user" or "repository"
+	ScopeID         string    `json:"scope_id" db:"scope_id"` // User ID or repository ID
+	MonthlyLimitUSD float64   `json:"monthly_limit_usd" db:"monthly_limit_usd"`
+	SpentUSD        float64   `json:"spent_usd" db:"-"` // Spent in the current month
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Exceeded reports whether the spending of the month reached the limit
+func (b *LLMBudget) Exceeded() bool {
+	return b.SpentUSD >= b.MonthlyLimitUSD
+}
+
+// SetLLMBudgetRequest is used to set the budget of a user or repository
+type SetLLMBudgetRequest struct {
+	Scope           string  `json:"scope"`    // "user" or "repository"
+	ScopeID         string  `json:"scope_id"` // User ID or repository ID
+	MonthlyLimitUSD float64 `json:"monthly_limit_usd"`
+}
+
+// Validate checks the scope and limit of the budget
+func (r *SetLLMBudgetRequest) Validate() error {
+	switch r.Scope {
+	case BudgetScopeUser:
+	case BudgetScopeRepository:
+		if _, err := strconv.ParseInt(r.ScopeID, 10, 64); err != nil {
+			return fmt.Errorf("scope_id of a repository budget must be a repository ID")
+		}
+	default:
+		return fmt.Errorf("scope must be %q or %q", BudgetScopeUser, BudgetScopeRepository)
+	}
+	if r.ScopeID == "" {
+		return fmt.Errorf("scope_id is required")
+	}
+	if r.MonthlyLimitUSD < 0 {
+		return fmt.Errorf("monthly_limit_usd cannot be negative")
+	}
+	return nil
+}
+
+// MonthStart returns the start of the month of a time, in UTC, when monthly budgets reset
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
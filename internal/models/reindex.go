@@ -0,0 +1,195 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Kinds of change to a file between two indexed commits
+const (
+	FileAdded    = "added"
+	FileModified = "modified"
+	FileRenamed  = "renamed"
+	FileDeleted  = "deleted"
+)
+
+// FileChange is a file changed since a repository was last indexed. Paths are relative to
+// the repository root; OldPath is only set for renamed files.
+type FileChange struct {
+	Status  string `json:"status"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+}
+
+// ParseGitNameStatus parses the output of `git diff --name-status -z`. Copies are reported
+// as additions and type changes as modifications.
+func ParseGitNameStatus(output string) []FileChange {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+
+	var changes []FileChange
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return changes
+			}
+			oldPath, path := fields[i+1], fields[i+2]
+			i += 2
+			if status[0] == 'C' {
+				changes = append(changes, FileChange{Status: FileAdded, Path: path})
+			} else {
+				changes = append(changes, FileChange{Status: FileRenamed, Path: path, OldPath: oldPath})
+			}
+		default:
+			if i+1 >= len(fields) {
+				return changes
+			}
+			path := fields[i+1]
+			i++
+			switch status[0] {
+			case 'A':
+				changes = append(changes, FileChange{Status: FileAdded, Path: path})
+			case 'D':
+				changes = append(changes, FileChange{Status: FileDeleted, Path: path})
+			default: // M, T
+				changes = append(changes, FileChange{Status: FileModified, Path: path})
+			}
+		}
+	}
+	return changes
+}
+
+// FilterFileChanges keeps the changes to files matching keep. A rename between a kept and
+// a dropped path becomes the addition or deletion of the kept one.
+func FilterFileChanges(changes []FileChange, keep func(path string) bool) []FileChange {
+	var filtered []FileChange
+	for _, change := range changes {
+		if change.Status != FileRenamed {
+			if keep(change.Path) {
+				filtered = append(filtered, change)
+			}
+			continue
+		}
+
+		switch keepNew, keepOld := keep(change.Path), keep(change.OldPath); {
+		case keepNew && keepOld:
+			filtered = append(filtered, change)
+		case keepNew:
+			filtered = append(filtered, FileChange{Status: FileAdded, Path: change.Path})
+		case keepOld:
+			filtered = append(filtered, FileChange{Status: FileDeleted, Path: change.OldPath})
+		}
+	}
+	return filtered
+}
+
+// FullReindexChanges lists the changes that bring the stored files of a repository in line
+// with the files currently in it, when there is no indexed commit to diff against
+func FullReindexChanges(stored []RepositoryFile, current []string) []FileChange {
+	storedPaths := make(map[string]bool, len(stored))
+	for _, file := range stored {
+		storedPaths[file.FilePath] = true
+	}
+
+	var changes []FileChange
+	currentPaths := make(map[string]bool, len(current))
+	for _, path := range current {
+		currentPaths[path] = true
+		if storedPaths[path] {
+			changes = append(changes, FileChange{Status: FileModified, Path: path})
+		} else {
+			changes = append(changes, FileChange{Status: FileAdded, Path: path})
+		}
+	}
+	for _, file := range stored {
+		if !currentPaths[file.FilePath] {
+			changes = append(changes, FileChange{Status: FileDeleted, Path: file.FilePath})
+		}
+	}
+	return changes
+}
+
+// HashFunctionBody hashes the code of a function, so insights are only regenerated for
+// functions whose code changed
+func HashFunctionBody(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReindexPool holds the stored functions and symbols of the files of a package being
+// re-indexed. Re-analyzed functions and symbols take the stored ones they replace out of the
+// pool, keeping their IDs so insights, calls and references pointing at them survive; what
+// is left in the pool no longer exists.
+type ReindexPool struct {
+	functions map[string][]RepositoryFunction
+	symbols   map[string][]RepositorySymbol
+}
+
+// NewReindexPool creates a pool of stored functions and symbols
+func NewReindexPool(functions []RepositoryFunction, symbols []RepositorySymbol) *ReindexPool {
+	p := &ReindexPool{
+		functions: make(map[string][]RepositoryFunction),
+		symbols:   make(map[string][]RepositorySymbol),
+	}
+	for _, fn := range functions {
+		key := reindexFunctionKey(fn)
+		p.functions[key] = append(p.functions[key], fn)
+	}
+	for _, sym := range symbols {
+		key := reindexSymbolKey(sym)
+		p.symbols[key] = append(p.symbols[key], sym)
+	}
+	return p
+}
+
+// TakeFunction removes the stored function with the receiver type and name of fn from the pool
+func (p *ReindexPool) TakeFunction(fn RepositoryFunction) (RepositoryFunction, bool) {
+	key := reindexFunctionKey(fn)
+	stored := p.functions[key]
+	if len(stored) == 0 {
+		return RepositoryFunction{}, false
+	}
+	p.functions[key] = stored[1:]
+	return stored[0], true
+}
+
+// TakeSymbol removes the stored symbol with the name and kind of sym from the pool
+func (p *ReindexPool) TakeSymbol(sym RepositorySymbol) (RepositorySymbol, bool) {
+	key := reindexSymbolKey(sym)
+	stored := p.symbols[key]
+	if len(stored) == 0 {
+		return RepositorySymbol{}, false
+	}
+	p.symbols[key] = stored[1:]
+	return stored[0], true
+}
+
+// Remaining returns the stored functions and symbols nothing replaced
+func (p *ReindexPool) Remaining() ([]RepositoryFunction, []RepositorySymbol) {
+	var functions []RepositoryFunction
+	for _, stored := range p.functions {
+		functions = append(functions, stored...)
+	}
+	var symbols []RepositorySymbol
+	for _, stored := range p.symbols {
+		symbols = append(symbols, stored...)
+	}
+	return functions, symbols
+}
+
+// reindexFunctionKey identifies a function within its package; init functions share a key
+// and are matched in order
+func reindexFunctionKey(fn RepositoryFunction) string {
+	return functionLocalName(fn)
+}
+
+// reindexSymbolKey identifies a symbol within its package
+func reindexSymbolKey(sym RepositorySymbol) string {
+	return sym.Kind + ":" + sym.Name
+}
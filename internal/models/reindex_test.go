@@ -0,0 +1,124 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGitNameStatus(t *testing.T) {
+	output := "M\x00api/handler.go\x00A\x00api/new.go\x00D\x00old.go\x00R087\x00a/x.go\x00b/x.go\x00C100\x00c.go\x00d.go\x00T\x00link.go\x00"
+
+	changes := ParseGitNameStatus(output)
+	expected := []FileChange{
+		{Status: FileModified, Path: "api/handler.go"},
+		{Status: FileAdded, Path: "api/new.go"},
+		{Status: FileDeleted, Path: "old.go"},
+		{Status: FileRenamed, Path: "b/x.go", OldPath: "a/x.go"},
+		{Status: FileAdded, Path: "d.go"},
+		{Status: FileModified, Path: "link.go"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+
+	if changes := ParseGitNameStatus(""); len(changes) != 0 {
+		t.Errorf("Expected no changes for empty output, got %+v", changes)
+	}
+}
+
+func TestFilterFileChanges(t *testing.T) {
+	isGo := func(path string) bool { return strings.HasSuffix(path, ".go") }
+
+	changes := FilterFileChanges([]FileChange{
+		{Status: FileModified, Path: "README.md"},
+		{Status: FileModified, Path: "main.go"},
+		{Status: FileRenamed, Path: "b.go", OldPath: "a.go"},
+		{Status: FileRenamed, Path: "gen.go", OldPath: "gen.go.tmpl"},
+		{Status: FileRenamed, Path: "old.go.bak", OldPath: "old.go"},
+	}, isGo)
+
+	expected := []FileChange{
+		{Status: FileModified, Path: "main.go"},
+		{Status: FileRenamed, Path: "b.go", OldPath: "a.go"},
+		{Status: FileAdded, Path: "gen.go"},
+		{Status: FileDeleted, Path: "old.go"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestFullReindexChanges(t *testing.T) {
+	stored := []RepositoryFile{{ID: 1, FilePath: "main.go"}, {ID: 2, FilePath: "gone.go"}}
+
+	changes := FullReindexChanges(stored, []string{"main.go", "new.go"})
+	expected := []FileChange{
+		{Status: FileModified, Path: "main.go"},
+		{Status: FileAdded, Path: "new.go"},
+		{Status: FileDeleted, Path: "gone.go"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestReindexPool(t *testing.T) {
+	pool := NewReindexPool(
+		[]RepositoryFunction{
+			{ID: 1, FileID: 1, Name: "Run", Receiver: "*Server", BodyHash: "a"},
+			{ID: 2, FileID: 1, Name: "Run"},
+			{ID: 3, FileID: 2, Name: "init"},
+			{ID: 4, FileID: 2, Name: "init"},
+			{ID: 5, FileID: 2, Name: "removed"},
+		},
+		[]RepositorySymbol{
+			{ID: 10, FileID: 1, Name: "Server", Kind: "struct"},
+			{ID: 11, FileID: 1, Name: "Timeout", Kind: "constant"},
+		},
+	)
+
+	// Methods match by receiver type and name, whether the receiver is a pointer or not
+	if fn, ok := pool.TakeFunction(RepositoryFunction{Name: "Run", Receiver: "Server"}); !ok || fn.ID != 1 {
+		t.Errorf("Expected method to match function 1, got %+v (%v)", fn, ok)
+	}
+	if fn, ok := pool.TakeFunction(RepositoryFunction{Name: "Run"}); !ok || fn.ID != 2 {
+		t.Errorf("Expected function to match function 2, got %+v (%v)", fn, ok)
+	}
+	if _, ok := pool.TakeFunction(RepositoryFunction{Name: "Run"}); ok {
+		t.Error("Expected a function to be taken only once")
+	}
+
+	// Functions sharing a name match in order
+	for _, want := range []int64{3, 4} {
+		if fn, ok := pool.TakeFunction(RepositoryFunction{Name: "init"}); !ok || fn.ID != want {
+			t.Errorf("Expected init to match function %d, got %+v (%v)", want, fn, ok)
+		}
+	}
+
+	// Symbols match by kind and name
+	if _, ok := pool.TakeSymbol(RepositorySymbol{Name: "Server", Kind: "interface"}); ok {
+		t.Error("Expected a symbol of another kind not to match")
+	}
+	if sym, ok := pool.TakeSymbol(RepositorySymbol{Name: "Server", Kind: "struct"}); !ok || sym.ID != 10 {
+		t.Errorf("Expected struct to match symbol 10, got %+v (%v)", sym, ok)
+	}
+
+	functions, symbols := pool.Remaining()
+	if len(functions) != 1 || functions[0].ID != 5 {
+		t.Errorf("Expected function 5 to remain, got %+v", functions)
+	}
+	if len(symbols) != 1 || symbols[0].ID != 11 {
+		t.Errorf("Expected symbol 11 to remain, got %+v", symbols)
+	}
+}
+
+func TestHashFunctionBody(t *testing.T) {
+	a := HashFunctionBody("func f() {}")
+	if a != HashFunctionBody("func f() {}") {
+		t.Error("Expected equal code to hash the same")
+	}
+	if a == HashFunctionBody("func f() { return }") {
+		t.Error("Expected changed code to hash differently")
+	}
+}
@@ -12,14 +12,15 @@ import (
 // Repository represents a code repository that has been indexed
 type Repository struct {
 	ID               int64      `json:"id" db:"id"`
-	Kind             string     `json:"kind" db:"kind"`                 // "github", "gitlab", etc.
-	URL              string     `json:"url" db:"url"`                   // Original URL
-	Name             string     `json:"name" db:"name"`                 // Repository name
-	Owner            string     `json:"owner" db:"owner"`               // Repository owner/organization
-	LocalPath        string     `json:"local_path" db:"local_path"`     // Where it's stored locally
-	LastIndexed      *time.Time `json:"last_indexed" db:"last_indexed"` // When it was last analyzed
-	IndexStatus      string     `json:"index_status" db:"index_status"` // "in_progress", "completed", "failed"
-	IndexStatusError string     `json:"index_error" db:"index_error"`   // Error message if indexing failed
+	Kind             string     `json:"kind" db:"kind"`                             // "github", "gitlab", etc.
+	URL              string     `json:"url" db:"url"`                               // Original URL
+	Name             string     `json:"name" db:"name"`                             // Repository name
+	Owner            string     `json:"owner" db:"owner"`                           // Repository owner/organization
+	LocalPath        string     `json:"local_path" db:"local_path"`                 // Where it's stored locally
+	LastIndexed      *time.Time `json:"last_indexed" db:"last_indexed"`             // When it was last analyzed
+	IndexStatus      string     `json:"index_status" db:"index_status"`             // "in_progress", "completed", "failed"
+	IndexStatusError string     `json:"index_error" db:"index_error"`               // Error message if indexing failed
+	CredentialID     *int64     `json:"credential_id,omitempty" db:"credential_id"` // Stored credential it is fetched with
 	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -28,8 +29,10 @@ type Repository struct {
 type RepositoryFile struct {
 	ID           int64     `json:"id" db:"id"`
 	RepositoryID int64     `json:"repository_id" db:"repository_id"`
-	FilePath     string    `json:"file_path" db:"file_path"` // Relative path within repo
-	Package      string    `json:"package" db:"package"`     // Go package name
+	SnapshotID   int64     `json:"snapshot_id" db:"snapshot_id"`
+	FilePath     string    `json:"file_path" db:"file_path"`       // Relative path within repo
+	Package      string    `json:"package" db:"package"`           // Go package name
+	PackagePath  string    `json:"package_path" db:"package_path"` // Go package import path
 	LastAnalyzed time.Time `json:"last_analyzed" db:"last_analyzed"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
@@ -39,6 +42,7 @@ type RepositoryFile struct {
 type RepositoryFunction struct {
 	ID            int64               `json:"id" db:"id"`
 	RepositoryID  int64               `json:"repository_id" db:"repository_id"`
+	SnapshotID    int64               `json:"snapshot_id" db:"snapshot_id"`
 	FileID        int64               `json:"file_id" db:"file_id"`
 	Name          string              `json:"name" db:"name"`                     // Function name
 	Kind          string              `json:"kind" db:"kind"`                     // "function" or "method"
@@ -52,6 +56,7 @@ type RepositoryFunction struct {
 	CalledBy      string              `json:"called_by" db:"called_by"`           // JSON array of functions calling this
 	References    string              `json:"references" db:"references"`         // JSON array of references
 	StatementInfo string              `json:"statement_info" db:"statement_info"` // JSON of parsed statement info
+	BodyHash      string              `json:"body_hash" db:"body_hash"`           // Hash of the code, to detect changed functions
 	CreatedAt     time.Time           `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time           `json:"updated_at" db:"updated_at"`
 	Statements    []FunctionStatement `json:"-" db:"-"`
@@ -61,6 +66,7 @@ type RepositoryFunction struct {
 type RepositorySymbol struct {
 	ID           int64     `json:"id" db:"id"`
 	RepositoryID int64     `json:"repository_id" db:"repository_id"`
+	SnapshotID   int64     `json:"snapshot_id" db:"snapshot_id"`
 	FileID       int64     `json:"file_id" db:"file_id"`
 	Name         string    `json:"name" db:"name"`
 	Kind         string    `json:"kind" db:"kind"`             // "variable", "constant", "type", "struct", "interface"
@@ -77,13 +83,18 @@ type RepositorySymbol struct {
 
 // IndexRepositoryRequest is used to request repository indexing
 type IndexRepositoryRequest struct {
-	URL string `json:"url" validate:"required"`
+	URL          string `json:"url" validate:"required"`
+	Kind         string `json:"kind,omitempty"`          // Source kind: github, git, gitlab, bitbucket or local; detected from the URL if empty
+	Ref          string `json:"ref,omitempty"`           // Branch, tag or commit to index; the default branch if empty
+	CredentialID int64  `json:"credential_id,omitempty"` // Stored credential to fetch a private repository with
 }
 
 // IndexRepositoryResponse is the response for a repository indexing request
 type IndexRepositoryResponse struct {
 	ID          int64  `json:"id"`
+	JobID       int64  `json:"job_id,omitempty"` // Job indexing the repository in the background
 	URL         string `json:"url"`
+	Ref         string `json:"ref,omitempty"`
 	IndexStatus string `json:"index_status"`
 	Message     string `json:"message"`
 }
@@ -92,6 +103,7 @@ type IndexRepositoryResponse struct {
 type GetIndexRequest struct {
 	URL      string `json:"url" validate:"required"`
 	FilePath string `json:"file_path,omitempty"`
+	Ref      string `json:"ref,omitempty"` // Indexed branch, tag or commit; the default branch if empty
 }
 
 // IndexedFunction represents a function with additional metadata like insights
@@ -118,6 +130,7 @@ type IndexedFile struct {
 // GetIndexResponse is the response for a get index request
 type GetIndexResponse struct {
 	Repository      *Repository             `json:"repository"`
+	Snapshot        *RepositorySnapshot     `json:"snapshot,omitempty"`          // Indexed commit the files are from
 	IndexedFilesMap map[string]*IndexedFile `json:"indexed_files_map,omitempty"` // Map of file path to IndexedFile
 
 	// Legacy fields - kept for backward compatibility
@@ -154,27 +167,18 @@ func FileAnalysisToRepositoryModels(analysis *models.FileAnalysis, repoID int64,
 			Parameters:   string(paramsJSON),
 			Results:      string(resultsJSON),
 			CodeBlock:    fn.CodeBlock,
+			BodyHash:     HashFunctionBody(fn.CodeBlock),
 			Line:         fn.Position.Line,
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
 
-		repoFn.Statements = convertStatements(fn.StatementAnalysis, nil)
+		repoFn.Statements = convertStatements(fn.StatementAnalysis)
 		functions = append(functions, repoFn)
 
-		// We'll need to associate statements with this function later
-		// Store the index of this function for reference when we have its ID
-		fnIndex := len(functions) - 1
-
-		// Convert statement analysis to function statements
-		convertedStatements := convertStatements(fn.StatementAnalysis, nil)
-		if len(convertedStatements) > 0 {
-			// Store the function index so we can update with the real function ID later
-			for i := range convertedStatements {
-				convertedStatements[i].FunctionIndex = fnIndex
-			}
-			statements = append(statements, convertedStatements...)
-		}
+		// Flatten the statement tree, keeping the index of the function to set its ID once it
+		// is stored, and the index of each parent to link the statements once they are stored
+		statements = flattenStatements(statements, repoFn.Statements, len(functions)-1, -1)
 	}
 
 	// Convert constants
@@ -259,11 +263,13 @@ func FileAnalysisToRepositoryModels(analysis *models.FileAnalysis, repoID int64,
 
 	// Convert function calls
 	for _, call := range analysis.Calls {
-		// Find caller function index
+		// Find caller function index; calls of closures, named like "main$1" by the call
+		// graph builder, are stored as calls of their enclosing function
+		callerName, _, _ := strings.Cut(call.Caller, "$")
 		callerIndex := -1
 		for i, fn := range functions {
 			// Match function by name and line number
-			if call.Caller == fn.Name {
+			if callerName == fn.Name {
 				callerIndex = i
 				break
 			}
@@ -277,10 +283,25 @@ func FileAnalysisToRepositoryModels(analysis *models.FileAnalysis, repoID int64,
 		// Convert parameters to JSON
 		paramsJSON, _ := json.Marshal(call.Parameters)
 
+		// Type-checked calls carry a fully qualified callee such as pkg/path.(*Type).Method
+		calleeName := call.Callee
+		var calleePackage string
+		if call.CalleePath != "" {
+			calleePackage = call.CalleePackage
+			calleeName = strings.TrimPrefix(call.CalleePath, call.CalleePackage+".")
+		}
+
+		// Syntax-only calls carry no kind and are recorded as static
+		callKind := call.Kind
+		if callKind == "" {
+			callKind = models.CallKindStatic
+		}
+
 		fnCall := FunctionCall{
 			CallerID:      0, // Will be set after function IDs are assigned
-			CalleeName:    call.Callee,
-			CalleePackage: call.CalleePath,
+			CalleeName:    calleeName,
+			CalleePackage: calleePackage,
+			CallKind:      callKind,
 			Line:          call.Position.Line,
 			Parameters:    string(paramsJSON),
 			CreatedAt:     time.Now(),
@@ -297,11 +318,16 @@ func FileAnalysisToRepositoryModels(analysis *models.FileAnalysis, repoID int64,
 
 	// Convert function references
 	for _, ref := range analysis.References {
+		// Only references to the file's own package can be to one of its functions
+		if ref.Package != "" && ref.Package != analysis.PackagePath {
+			continue
+		}
+
 		// Find referenced function index
 		functionIndex := -1
 		for i, fn := range functions {
-			// Match function by name
-			if ref.Symbol == fn.Name {
+			// Match function by name, and methods by receiver type and name
+			if ref.LocalName() == functionLocalName(fn) {
 				functionIndex = i
 				break
 			}
@@ -353,8 +379,23 @@ func FileAnalysisToRepositoryModels(analysis *models.FileAnalysis, repoID int64,
 	return functions, symbols, statements, calls, references, dependencies
 }
 
-// convertStatements recursively converts StatementInfo to FunctionStatement models
-func convertStatements(stmtInfos []models.StatementInfo, parentID *int64) []FunctionStatement {
+// functionLocalName returns the package-relative name references use for a function:
+// its name, or Type.Method for methods
+func functionLocalName(fn RepositoryFunction) string {
+	if fn.Receiver == "" {
+		return fn.Name
+	}
+
+	// Drop the pointer and type parameters of the receiver: *List[T] -> List
+	receiver := strings.TrimPrefix(fn.Receiver, "*")
+	if i := strings.Index(receiver, "["); i >= 0 {
+		receiver = receiver[:i]
+	}
+	return receiver + "." + fn.Name
+}
+
+// convertStatements recursively converts StatementInfo to a tree of FunctionStatement models
+func convertStatements(stmtInfos []models.StatementInfo) []FunctionStatement {
 	var statements []FunctionStatement
 
 	for _, stmt := range stmtInfos {
@@ -363,41 +404,64 @@ func convertStatements(stmtInfos []models.StatementInfo, parentID *int64) []Func
 		variablesJSON, _ := json.Marshal(stmt.Variables)
 		callsJSON, _ := json.Marshal(stmt.Calls)
 
-		// Create statement
-		repoStmt := FunctionStatement{
-			// FunctionID will be set later when we have actual function IDs
-			StatementType:     stmt.Type,
-			Text:              stmt.Text,
-			Line:              stmt.Position.Line,
-			Conditions:        string(conditionsJSON),
-			Variables:         string(variablesJSON),
-			Calls:             string(callsJSON),
-			ParentStatementID: parentID,
-			CreatedAt:         time.Now(),
-			UpdatedAt:         time.Now(),
-			// Temporary field to track parentage before DB insertion
-			FunctionIndex: -1, // Will be set by the caller
-		}
-
-		statements = append(statements, repoStmt)
+		statements = append(statements, FunctionStatement{
+			// FunctionID and ParentStatementID are set once the function and parent are stored
+			StatementType: stmt.Type,
+			Text:          stmt.Text,
+			Line:          stmt.Position.Line,
+			Conditions:    string(conditionsJSON),
+			Variables:     string(variablesJSON),
+			Calls:         string(callsJSON),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+			Children:      convertStatements(stmt.SubStatements),
+		})
+	}
 
-		// Set this statement as the parent for its sub-statements
-		stmtIndex := len(statements) - 1
+	return statements
+}
 
-		// Process nested statements
-		if len(stmt.SubStatements) > 0 {
-			// Use a placeholder ID that will be replaced after DB insertion
-			placeholderID := int64(-(stmtIndex + 1)) // Negative to ensure it doesn't conflict with real IDs
-			childStmts := convertStatements(stmt.SubStatements, &placeholderID)
+// flattenStatements appends a statement tree to a list in pre-order, so that parents come
+// before their children, setting the index of the function and of the parent of each
+func flattenStatements(list []FunctionStatement, tree []FunctionStatement, fnIndex, parentIndex int) []FunctionStatement {
+	for _, stmt := range tree {
+		children := stmt.Children
+		stmt.Children = nil
+		stmt.FunctionIndex = fnIndex
+		stmt.ParentIndex = parentIndex
+		list = append(list, stmt)
+		list = flattenStatements(list, children, fnIndex, len(list)-1)
+	}
+	return list
+}
 
-			// Associate with the same function
-			for i := range childStmts {
-				childStmts[i].ParentIndex = stmtIndex
-			}
+// NestStatements builds the statement trees of functions from their stored statements,
+// linked by parent ID. Siblings keep the order they are listed in.
+func NestStatements(stmts []FunctionStatement) []FunctionStatement {
+	byParent := make(map[int64][]int)
+	ids := make(map[int64]bool, len(stmts))
+	for _, stmt := range stmts {
+		ids[stmt.ID] = true
+	}
 
-			statements = append(statements, childStmts...)
+	var roots []int
+	for i, stmt := range stmts {
+		if stmt.ParentStatementID == nil || !ids[*stmt.ParentStatementID] {
+			roots = append(roots, i)
+			continue
 		}
+		byParent[*stmt.ParentStatementID] = append(byParent[*stmt.ParentStatementID], i)
 	}
 
-	return statements
+	var build func(indexes []int) []FunctionStatement
+	build = func(indexes []int) []FunctionStatement {
+		tree := make([]FunctionStatement, 0, len(indexes))
+		for _, i := range indexes {
+			stmt := stmts[i]
+			stmt.Children = build(byParent[stmt.ID])
+			tree = append(tree, stmt)
+		}
+		return tree
+	}
+	return build(roots)
 }
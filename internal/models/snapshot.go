@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RepositorySnapshot is the index of a repository at one commit. Every indexed branch, tag
+// or commit resolves to a snapshot; refs at the same commit share it.
+type RepositorySnapshot struct {
+	ID               int64      `json:"id" db:"id"`
+	RepositoryID     int64      `json:"repository_id" db:"repository_id"`
+	CommitSHA        string     `json:"commit_sha" db:"commit_sha"`         // Commit being indexed
+	IndexedCommit    string     `json:"indexed_commit" db:"indexed_commit"` // Commit the stored index reflects
+	IndexStatus      string     `json:"index_status" db:"index_status"`     // "in_progress", "completed", "failed", "cancelled"
+	IndexStatusError string     `json:"index_error" db:"index_error"`       // Error message if indexing failed
+	LastIndexed      *time.Time `json:"last_indexed" db:"last_indexed"`
+	Refs             []string   `json:"refs,omitempty" db:"-"` // Refs resolving to the snapshot
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ValidateRef checks that a ref can be passed to git as a branch, tag or commit. The empty
+// ref stands for the default branch.
+func ValidateRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if len(ref) > 255 {
+		return fmt.Errorf("ref is too long")
+	}
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/") ||
+		strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock") ||
+		strings.Contains(ref, "..") || strings.Contains(ref, "//") || strings.Contains(ref, "@{") {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	for _, r := range ref {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\", r) {
+			return fmt.Errorf("invalid ref %q", ref)
+		}
+	}
+	return nil
+}
+
+// IsCommitPrefix reports whether a ref may be an abbreviated or full commit SHA
+func IsCommitPrefix(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, r := range ref {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// RefCheckoutPath is where a ref of a repository is checked out. The default branch uses the
+// repository's own checkout; other refs get one each, so they can be indexed side by side.
+func RefCheckoutPath(localPath, ref string) string {
+	if ref == "" {
+		return localPath
+	}
+	return filepath.Join(filepath.Dir(localPath), filepath.Base(localPath)+"@"+url.PathEscape(ref))
+}
@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestValidateRef(t *testing.T) {
+	for _, ref := range []string{"", "main", "release/1.4", "v1.4.0", "3f2a9c1", "feature/JIRA-12_fix"} {
+		if err := ValidateRef(ref); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", ref, err)
+		}
+	}
+	for _, ref := range []string{"-upload-pack=x", "a..b", "main:other", "HEAD@{1}", "a b", "release/", "v1.lock", "x~1", "x^"} {
+		if err := ValidateRef(ref); err == nil {
+			t.Errorf("Expected %q to be invalid", ref)
+		}
+	}
+}
+
+func TestIsCommitPrefix(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"3f2a9c1": true,
+		"3f2a9c1e0b7d4a6f8c2e1d3b5a7f9e0c2d4b6a8f": true,
+		"3f2a9c":  false,
+		"v1.4.0":  false,
+		"3F2A9C1": false,
+	} {
+		if got := IsCommitPrefix(ref); got != want {
+			t.Errorf("IsCommitPrefix(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func TestRefCheckoutPath(t *testing.T) {
+	if got := RefCheckoutPath("/tmp/acme/api", ""); got != "/tmp/acme/api" {
+		t.Errorf("Expected the default branch to use the repository checkout, got %q", got)
+	}
+	if got := RefCheckoutPath("/tmp/acme/api", "release/1.4"); got != "/tmp/acme/api@release%2F1.4" {
+		t.Errorf("Expected a checkout next to the repository, got %q", got)
+	}
+	if RefCheckoutPath("/tmp/acme/api", "a/b") == RefCheckoutPath("/tmp/acme/api", "a_b") {
+		t.Error("Expected distinct refs to get distinct checkouts")
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+)
+
+// SymbolLinker resolves the references found in the files of a repository to its symbols
+// once they are all stored. References to a field or method are linked to the declaring
+// type with the member set.
+type SymbolLinker struct {
+	filePackages map[int64]string // file ID -> package import path
+	symbols      map[string]int64 // package path + "." + name -> symbol ID
+}
+
+// NewSymbolLinker indexes the symbols of a repository by the import path of their package
+func NewSymbolLinker(files []RepositoryFile, symbols []RepositorySymbol) *SymbolLinker {
+	l := &SymbolLinker{
+		filePackages: make(map[int64]string),
+		symbols:      make(map[string]int64),
+	}
+
+	for _, file := range files {
+		l.filePackages[file.ID] = file.PackagePath
+	}
+
+	for _, sym := range symbols {
+		pkgPath, ok := l.filePackages[sym.FileID]
+		if !ok {
+			continue
+		}
+		// Symbols declared inside functions may share the name of a package-level one;
+		// keep the first, which comes from the earliest line of the file
+		key := pkgPath + "." + sym.Name
+		if _, taken := l.symbols[key]; !taken {
+			l.symbols[key] = sym.ID
+		}
+	}
+
+	return l
+}
+
+// Link converts the references found in a file into symbol references. References to
+// functions, to local symbols and to packages outside the repository are dropped.
+func (l *SymbolLinker) Link(fileID int64, refs []models.ReferenceInfo) []SymbolReference {
+	var linked []SymbolReference
+	for _, ref := range refs {
+		pkgPath := ref.Package
+		if pkgPath == "" {
+			pkgPath = l.filePackages[fileID]
+		}
+
+		name, member, _ := strings.Cut(ref.LocalName(), ".")
+		symbolID, ok := l.symbols[pkgPath+"."+name]
+		if !ok {
+			continue
+		}
+
+		linked = append(linked, SymbolReference{
+			SymbolID:       symbolID,
+			Member:         member,
+			ReferenceType:  ref.RefType,
+			FileID:         fileID,
+			Line:           ref.Position.Line,
+			ColumnPosition: ref.Position.Column,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		})
+	}
+	return linked
+}
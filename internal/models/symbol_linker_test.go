@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+)
+
+func TestSymbolLinkerLink(t *testing.T) {
+	files := []RepositoryFile{
+		{ID: 1, Package: "config", PackagePath: "example.com/app/config"},
+		{ID: 2, Package: "svc", PackagePath: "example.com/app/svc"},
+	}
+	symbols := []RepositorySymbol{
+		{ID: 10, FileID: 1, Name: "DefaultTimeout", Kind: "constant"},
+		{ID: 11, FileID: 1, Name: "Config", Kind: "struct"},
+	}
+	linker := NewSymbolLinker(files, symbols)
+
+	refs := []models.ReferenceInfo{
+		{Symbol: "example.com/app/config.DefaultTimeout", Package: "example.com/app/config", RefType: models.RefRead},
+		{Symbol: "example.com/app/config.Config.Timeout", Package: "example.com/app/config", RefType: models.RefWrite},
+		{Symbol: "example.com/app/config.(*Config).Reset", Package: "example.com/app/config", RefType: models.RefCall},
+		{Symbol: "fmt.Println", Package: "fmt", RefType: models.RefCall},
+		{Symbol: "run", RefType: models.RefCall},
+	}
+
+	linked := linker.Link(2, refs)
+	if len(linked) != 3 {
+		t.Fatalf("Expected 3 linked references, got %d: %+v", len(linked), linked)
+	}
+
+	expected := []struct {
+		symbolID int64
+		member   string
+		refType  string
+	}{
+		{10, "", models.RefRead},
+		{11, "Timeout", models.RefWrite},
+		{11, "Reset", models.RefCall},
+	}
+	for i, want := range expected {
+		got := linked[i]
+		if got.SymbolID != want.symbolID || got.Member != want.member || got.ReferenceType != want.refType || got.FileID != 2 {
+			t.Errorf("Reference %d = (%d, %q, %q, file %d), want (%d, %q, %q, file 2)", i,
+				got.SymbolID, got.Member, got.ReferenceType, got.FileID, want.symbolID, want.member, want.refType)
+		}
+	}
+
+	// References without a package are to the referencing file's package
+	local := linker.Link(1, []models.ReferenceInfo{{Symbol: "Config.Name", RefType: models.RefRead}})
+	if len(local) != 1 || local[0].SymbolID != 11 || local[0].Member != "Name" {
+		t.Errorf("Expected a reference to Config.Name, got %+v", local)
+	}
+}
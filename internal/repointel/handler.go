@@ -1,27 +1,37 @@
 package repointel
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
-	"github.com/gorilla/mux"
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// InsightJobQueue queues a job generating the missing or stale insights of a repository with
+// GenerateHierarchy, and responds with the job or why it was not queued
+type InsightJobQueue func(c *gin.Context, repoID int64, modelName string)
+
 // Handler handles HTTP requests for repository intelligence
 type Handler struct {
-	service    *Service
-	repository *Repository
+	service       *Service
+	repository    *Repository
+	queueInsights InsightJobQueue
 }
 
-// NewHandler creates a new repository intelligence handler
-func NewHandler(service *Service, repository *Repository) *Handler {
+// NewHandler creates a new repository intelligence handler, generating the insights of files
+// and repositories with the jobs of a queue
+func NewHandler(service *Service, repository *Repository, queue InsightJobQueue) *Handler {
 	return &Handler{
-		service:    service,
-		repository: repository,
+		service:       service,
+		repository:    repository,
+		queueInsights: queue,
 	}
 }
 
@@ -30,310 +40,618 @@ func (h *Handler) log() *logrus.Entry {
 	return logger.Log.WithField("component", "repointel-handler")
 }
 
-// RegisterRoutes registers the routes for the handler
-func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/api/repointel/function/{repoId}/{functionId}", h.GetFunctionInsight).Methods("GET")
-	router.HandleFunc("/api/repointel/function/{repoId}/{functionId}", h.GenerateFunctionInsight).Methods("POST")
-
-	router.HandleFunc("/api/repointel/symbol/{repoId}/{symbolId}", h.GetSymbolInsight).Methods("GET")
-	router.HandleFunc("/api/repointel/symbol/{repoId}/{symbolId}", h.GenerateSymbolInsight).Methods("POST")
+// generateInsightRequest is the optional body of the requests generating insights
+type generateInsightRequest struct {
+	ModelName string `json:"model_name"`
+}
 
-	router.HandleFunc("/api/repointel/struct/{repoId}/{symbolId}", h.GetStructInsight).Methods("GET")
-	router.HandleFunc("/api/repointel/struct/{repoId}/{symbolId}", h.GenerateStructInsight).Methods("POST")
+// reviewInsightRequest is the body of the requests reviewing an insight
+type reviewInsightRequest struct {
+	InsightID int64           `json:"insight_id"` // The current insight if 0
+	Status    string          `json:"status" binding:"required"`
+	Insight   json.RawMessage `json:"insight"` // Curated insight of edited reviews
+	Comment   string          `json:"comment"`
+}
 
-	router.HandleFunc("/api/repointel/repo/{repoId}/insights", h.ListInsights).Methods("GET")
+// RegisterRoutes registers the routes for the handler under /api/v1/insights
+func (h *Handler) RegisterRoutes(router *gin.Engine, middlewares ...gin.HandlerFunc) {
+	group := router.Group("/api/v1/insights")
+	group.Use(middlewares...)
+	{
+		group.GET("/function/:repoId/:functionId", h.GetFunctionInsight)
+		group.POST("/function/:repoId/:functionId", h.GenerateFunctionInsight)
+		group.GET("/function/:repoId/:functionId/revisions", h.ListFunctionInsightRevisions)
+		group.GET("/function/:repoId/:functionId/diff", h.DiffFunctionInsight)
+		group.POST("/function/:repoId/:functionId/review", h.ReviewFunctionInsight)
+		group.GET("/function/:repoId/:functionId/reviews", h.ListFunctionInsightReviews)
+
+		group.GET("/symbol/:repoId/:symbolId", h.GetSymbolInsight)
+		group.POST("/symbol/:repoId/:symbolId", h.GenerateSymbolInsight)
+
+		group.GET("/struct/:repoId/:symbolId", h.GetStructInsight)
+		group.POST("/struct/:repoId/:symbolId", h.GenerateStructInsight)
+		group.GET("/struct/:repoId/:symbolId/revisions", h.ListStructInsightRevisions)
+		group.GET("/struct/:repoId/:symbolId/diff", h.DiffStructInsight)
+
+		group.GET("/file/:repoId/:fileId", h.GetFileInsight)
+		group.POST("/file/:repoId/:fileId", h.GenerateFileInsight)
+
+		group.GET("/package/:repoId", h.GetPackageInsight)
+
+		group.GET("/repo/:repoId", h.GetRepositoryInsight)
+		group.POST("/repo/:repoId", h.GenerateRepositoryInsight)
+		group.GET("/repo/:repoId/insights", h.ListInsights)
+		group.GET("/repo/:repoId/stale", h.ListStaleInsights)
+		group.GET("/repo/:repoId/examples", h.ExportFunctionInsightExamples)
+	}
 }
 
 // GetFunctionInsight handles GET requests for function insights
-func (h *Handler) GetFunctionInsight(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
-	functionIDStr := vars["functionId"]
+func (h *Handler) GetFunctionInsight(c *gin.Context) {
+	repoID, functionID, ok := parseIDs(c, "functionId", "function")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
+	insight, err := h.repository.GetFunctionInsight(repoID, functionID)
 	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to get function insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get function insight"})
+		return
+	}
+
+	if insight == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Function insight not found"})
 		return
 	}
 
-	functionID, err := strconv.ParseInt(functionIDStr, 10, 64)
+	c.JSON(http.StatusOK, insight)
+}
+
+// GenerateFunctionInsight handles POST requests to generate function insights. They are
+// generated with the missing or stale insights of the repository by a job, which the response
+// is, for the file and package of the function to be summarized from its insight.
+func (h *Handler) GenerateFunctionInsight(c *gin.Context) {
+	repoID, functionID, ok := parseIDs(c, "functionId", "function")
+	if !ok {
+		return
+	}
+
+	req, ok := bindGenerateRequest(c)
+	if !ok {
+		return
+	}
+
+	function, err := h.service.codeAnalyzerRepo.GetFunctionByID(functionID)
 	if err != nil {
-		http.Error(w, "Invalid function ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to get function")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get function"})
+		return
+	}
+	if function == nil || function.RepositoryID != repoID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Function not found"})
 		return
 	}
 
-	insight, err := h.repository.GetFunctionInsight(repoID, functionID)
+	h.queueInsights(c, repoID, req.ModelName)
+}
+
+// GetSymbolInsight handles GET requests for symbol insights
+func (h *Handler) GetSymbolInsight(c *gin.Context) {
+	repoID, symbolID, ok := parseIDs(c, "symbolId", "symbol")
+	if !ok {
+		return
+	}
+
+	insight, err := h.repository.GetSymbolInsight(repoID, symbolID)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to get function insight")
-		http.Error(w, "Failed to get function insight", http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to get symbol insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get symbol insight"})
 		return
 	}
 
 	if insight == nil {
-		http.Error(w, "Function insight not found", http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Symbol insight not found"})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insight)
+	c.JSON(http.StatusOK, insight)
 }
 
-// GenerateFunctionInsight handles POST requests to generate function insights
-func (h *Handler) GenerateFunctionInsight(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
-	functionIDStr := vars["functionId"]
+// GenerateSymbolInsight handles POST requests to generate symbol insights
+func (h *Handler) GenerateSymbolInsight(c *gin.Context) {
+	repoID, symbolID, ok := parseIDs(c, "symbolId", "symbol")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+	req, ok := bindGenerateRequest(c)
+	if !ok {
 		return
 	}
 
-	functionID, err := strconv.ParseInt(functionIDStr, 10, 64)
+	// Generate the insight
+	insight, err := h.service.GenerateSymbolInsight(requestContext(c), repoID, symbolID, req.ModelName)
 	if err != nil {
-		http.Error(w, "Invalid function ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to generate symbol insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate symbol insight: %v", err)})
 		return
 	}
 
-	// Parse request body for optional model name
-	var req struct {
-		ModelName string `json:"model_name"`
+	// Save the insight
+	if !h.saveInsight(c, &InsightRecord{
+		RepositoryID: repoID,
+		SymbolID:     &symbolID,
+		Type:         InsightTypeSymbol,
+		Model:        req.ModelName,
+	}, insight) {
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil && err.Error() != "EOF" {
-		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+	c.JSON(http.StatusOK, insight)
+}
+
+// GetStructInsight handles GET requests for struct insights
+func (h *Handler) GetStructInsight(c *gin.Context) {
+	repoID, symbolID, ok := parseIDs(c, "symbolId", "symbol")
+	if !ok {
 		return
 	}
 
-	// Create insights manager and generate the insight
-	insightsManager := NewInsightsManager(h.service, h.repository)
-	insight, err := insightsManager.GenerateAndSaveFunctionInsight(repoID, functionID, req.ModelName)
+	insight, err := h.repository.GetStructInsight(repoID, symbolID)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to generate and save function insight")
-		http.Error(w, fmt.Sprintf("Failed to generate function insight: %v", err), http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to get struct insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get struct insight"})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insight)
+	if insight == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Struct insight not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, insight)
 }
 
-// GetSymbolInsight handles GET requests for symbol insights
-func (h *Handler) GetSymbolInsight(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
-	symbolIDStr := vars["symbolId"]
+// GenerateStructInsight handles POST requests to generate struct insights
+func (h *Handler) GenerateStructInsight(c *gin.Context) {
+	repoID, symbolID, ok := parseIDs(c, "symbolId", "symbol")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+	req, ok := bindGenerateRequest(c)
+	if !ok {
 		return
 	}
 
-	symbolID, err := strconv.ParseInt(symbolIDStr, 10, 64)
+	// Generate the insight
+	insight, err := h.service.GenerateStructInsight(requestContext(c), repoID, symbolID, req.ModelName)
 	if err != nil {
-		http.Error(w, "Invalid symbol ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to generate struct insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate struct insight: %v", err)})
 		return
 	}
 
-	insight, err := h.repository.GetSymbolInsight(repoID, symbolID)
+	// Save the insight
+	if !h.saveInsight(c, &InsightRecord{
+		RepositoryID: repoID,
+		SymbolID:     &symbolID,
+		Type:         InsightTypeStruct,
+		Model:        req.ModelName,
+	}, insight) {
+		return
+	}
+
+	c.JSON(http.StatusOK, insight)
+}
+
+// GetFileInsight handles GET requests for file insights
+func (h *Handler) GetFileInsight(c *gin.Context) {
+	repoID, fileID, ok := parseIDs(c, "fileId", "file")
+	if !ok {
+		return
+	}
+
+	insight, err := h.repository.GetFileInsight(repoID, fileID)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to get symbol insight")
-		http.Error(w, "Failed to get symbol insight", http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to get file insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file insight"})
 		return
 	}
 
 	if insight == nil {
-		http.Error(w, "Symbol insight not found", http.StatusNotFound)
+		c.JSON(http.StatusNotFound, gin.H{"error": "File insight not found"})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insight)
+	c.JSON(http.StatusOK, insight)
 }
 
-// GenerateSymbolInsight handles POST requests to generate symbol insights
-func (h *Handler) GenerateSymbolInsight(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
-	symbolIDStr := vars["symbolId"]
+// GenerateFileInsight handles POST requests to generate file insights. Files are summarized
+// from the insights of their functions and structs, so the insights of the repository are
+// generated bottom-up by a job, which the response is.
+func (h *Handler) GenerateFileInsight(c *gin.Context) {
+	repoID, fileID, ok := parseIDs(c, "fileId", "file")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+	req, ok := bindGenerateRequest(c)
+	if !ok {
 		return
 	}
 
-	symbolID, err := strconv.ParseInt(symbolIDStr, 10, 64)
+	file, err := h.service.codeAnalyzerRepo.GetRepositoryFileByID(repoID, fileID)
 	if err != nil {
-		http.Error(w, "Invalid symbol ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to get file")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file"})
+		return
+	}
+	if file == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
 
-	// Parse request body for optional model name
-	var req struct {
-		ModelName string `json:"model_name"`
+	h.queueInsights(c, repoID, req.ModelName)
+}
+
+// GetPackageInsight handles GET requests for package insights, the package being given by its
+// import path in the path query parameter
+func (h *Handler) GetPackageInsight(c *gin.Context) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil && err.Error() != "EOF" {
-		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+	pkgPath := c.Query("path")
+	if pkgPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Package path is required"})
 		return
 	}
 
-	// Generate the insight
-	insight, err := h.service.GenerateSymbolInsight(repoID, symbolID, req.ModelName)
+	insight, err := h.repository.GetPackageInsight(repoID, pkgPath)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to generate symbol insight")
-		http.Error(w, fmt.Sprintf("Failed to generate symbol insight: %v", err), http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to get package insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get package insight"})
 		return
 	}
 
-	// Save the insight
-	insightJSON, err := json.Marshal(insight)
-	if err != nil {
-		h.log().WithError(err).Error("Failed to marshal symbol insight")
-		http.Error(w, "Failed to marshal symbol insight", http.StatusInternalServerError)
+	if insight == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Package insight not found"})
 		return
 	}
 
-	insightRecord := &InsightRecord{
-		RepositoryID: repoID,
-		SymbolID:     &symbolID,
-		Type:         InsightTypeSymbol,
-		Data:         string(insightJSON),
-		Model:        req.ModelName,
+	c.JSON(http.StatusOK, insight)
+}
+
+// GetRepositoryInsight handles GET requests for the insight of a whole repository
+func (h *Handler) GetRepositoryInsight(c *gin.Context) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
+		return
 	}
 
-	err = h.repository.SaveInsight(insightRecord)
+	insight, err := h.repository.GetRepositoryInsight(repoID)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to save symbol insight")
-		http.Error(w, "Failed to save symbol insight", http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to get repository insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get repository insight"})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insight)
+	if insight == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository insight not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, insight)
 }
 
-// GetStructInsight handles GET requests for struct insights
-func (h *Handler) GetStructInsight(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
-	symbolIDStr := vars["symbolId"]
+// GenerateRepositoryInsight handles POST requests to generate the insight of a whole
+// repository, which is summarized from the insights of its packages, so the insights of the
+// repository are generated bottom-up by a job, which the response is
+func (h *Handler) GenerateRepositoryInsight(c *gin.Context) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
+		return
+	}
+
+	req, ok := bindGenerateRequest(c)
+	if !ok {
+		return
+	}
+
+	h.queueInsights(c, repoID, req.ModelName)
+}
+
+// ListInsights handles GET requests to list all insights for a repository
+func (h *Handler) ListInsights(c *gin.Context) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
+	insights, err := h.repository.ListInsightsByRepository(repoID)
 	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to list insights")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list insights"})
+		return
+	}
+
+	c.JSON(http.StatusOK, insights)
+}
+
+// ListStaleInsights handles GET requests to list the insights of a repository whose inputs
+// changed since they were generated
+func (h *Handler) ListStaleInsights(c *gin.Context) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
 		return
 	}
 
-	symbolID, err := strconv.ParseInt(symbolIDStr, 10, 64)
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	stale, err := insightsManager.ListStaleInsights(repoID)
 	if err != nil {
-		http.Error(w, "Invalid symbol ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to list stale insights")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list stale insights"})
 		return
 	}
 
-	insight, err := h.repository.GetStructInsight(repoID, symbolID)
+	c.JSON(http.StatusOK, gin.H{"stale": stale, "count": len(stale)})
+}
+
+// ListFunctionInsightRevisions handles GET requests to list the revisions of the insight of a
+// function across the commits of its repository, oldest first
+func (h *Handler) ListFunctionInsightRevisions(c *gin.Context) {
+	repoID, functionID, ok := parseIDs(c, "functionId", "function")
+	if !ok {
+		return
+	}
+
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	revisions, err := insightsManager.ListFunctionInsightRevisions(repoID, functionID)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to get struct insight")
-		http.Error(w, "Failed to get struct insight", http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to list function insight revisions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list function insight revisions"})
 		return
 	}
 
-	if insight == nil {
-		http.Error(w, "Struct insight not found", http.StatusNotFound)
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions, "count": len(revisions)})
+}
+
+// DiffFunctionInsight handles GET requests to diff two revisions of the insight of a function,
+// given by number in the from and to query parameters, the current one and the one before it
+// by default
+func (h *Handler) DiffFunctionInsight(c *gin.Context) {
+	repoID, functionID, ok := parseIDs(c, "functionId", "function")
+	if !ok {
+		return
+	}
+	from, to, ok := parseRevisions(c)
+	if !ok {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insight)
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	diff, err := insightsManager.DiffFunctionInsight(repoID, functionID, from, to)
+	h.respondDiff(c, diff, err, InsightTypeFunction)
 }
 
-// GenerateStructInsight handles POST requests to generate struct insights
-func (h *Handler) GenerateStructInsight(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
-	symbolIDStr := vars["symbolId"]
+// ListStructInsightRevisions handles GET requests to list the revisions of the insight of a
+// struct across the commits of its repository, oldest first
+func (h *Handler) ListStructInsightRevisions(c *gin.Context) {
+	repoID, symbolID, ok := parseIDs(c, "symbolId", "symbol")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	revisions, err := insightsManager.ListStructInsightRevisions(repoID, symbolID)
 	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to list struct insight revisions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list struct insight revisions"})
 		return
 	}
 
-	symbolID, err := strconv.ParseInt(symbolIDStr, 10, 64)
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions, "count": len(revisions)})
+}
+
+// DiffStructInsight handles GET requests to diff two revisions of the insight of a struct, given
+// by number in the from and to query parameters, the current one and the one before it by
+// default
+func (h *Handler) DiffStructInsight(c *gin.Context) {
+	repoID, symbolID, ok := parseIDs(c, "symbolId", "symbol")
+	if !ok {
+		return
+	}
+	from, to, ok := parseRevisions(c)
+	if !ok {
+		return
+	}
+
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	diff, err := insightsManager.DiffStructInsight(repoID, symbolID, from, to)
+	h.respondDiff(c, diff, err, InsightTypeStruct)
+}
+
+// respondDiff responds with the diff of two revisions of an insight, or the error diffing them
+func (h *Handler) respondDiff(c *gin.Context, diff *InsightDiff, err error, insightType InsightType) {
+	if errors.Is(err, ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Revision of %s insight not found", insightType)})
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid symbol ID", http.StatusBadRequest)
+		h.log().WithError(err).Errorf("Failed to diff %s insight revisions", insightType)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to diff %s insight revisions", insightType)})
 		return
 	}
 
-	// Parse request body for optional model name
-	var req struct {
-		ModelName string `json:"model_name"`
+	c.JSON(http.StatusOK, diff)
+}
+
+// ReviewFunctionInsight handles POST requests of users approving, rejecting or editing an insight
+// of a function, its current one unless the request gives the ID of another
+func (h *Handler) ReviewFunctionInsight(c *gin.Context) {
+	repoID, functionID, ok := parseIDs(c, "functionId", "function")
+	if !ok {
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
-	if err != nil && err.Error() != "EOF" {
-		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required to review insights"})
 		return
 	}
 
-	// Generate the insight
-	insight, err := h.service.GenerateStructInsight(repoID, symbolID, req.ModelName)
-	if err != nil {
-		h.log().WithError(err).Error("Failed to generate struct insight")
-		http.Error(w, fmt.Sprintf("Failed to generate struct insight: %v", err), http.StatusInternalServerError)
+	var req reviewInsightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
 		return
 	}
 
-	// Save the insight
-	insightJSON, err := json.Marshal(insight)
-	if err != nil {
-		h.log().WithError(err).Error("Failed to marshal struct insight")
-		http.Error(w, "Failed to marshal struct insight", http.StatusInternalServerError)
+	review := &InsightReview{
+		InsightID:  req.InsightID,
+		Status:     req.Status,
+		Curated:    req.Insight,
+		Comment:    req.Comment,
+		ReviewedBy: fmt.Sprint(userID),
+	}
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	err := insightsManager.ReviewFunctionInsight(repoID, functionID, review)
+	switch {
+	case errors.Is(err, ErrInvalidReview):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrInsightNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Function insight not found"})
+		return
+	case err != nil:
+		h.log().WithError(err).Error("Failed to review function insight")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review function insight"})
 		return
 	}
 
-	insightRecord := &InsightRecord{
-		RepositoryID: repoID,
-		SymbolID:     &symbolID,
-		Type:         InsightTypeStruct,
-		Data:         string(insightJSON),
-		Model:        req.ModelName,
+	c.JSON(http.StatusOK, review)
+}
+
+// ListFunctionInsightReviews handles GET requests to list the reviews of the insights of a
+// function, with their generated and curated versions
+func (h *Handler) ListFunctionInsightReviews(c *gin.Context) {
+	repoID, functionID, ok := parseIDs(c, "functionId", "function")
+	if !ok {
+		return
 	}
 
-	err = h.repository.SaveInsight(insightRecord)
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	reviews, err := insightsManager.ListFunctionInsightReviews(repoID, functionID)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to save struct insight")
-		http.Error(w, "Failed to save struct insight", http.StatusInternalServerError)
+		h.log().WithError(err).Error("Failed to list function insight reviews")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list function insight reviews"})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insight)
+	c.JSON(http.StatusOK, gin.H{"reviews": reviews, "count": len(reviews)})
 }
 
-// ListInsights handles GET requests to list all insights for a repository
-func (h *Handler) ListInsights(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	repoIDStr := vars["repoId"]
+// ExportFunctionInsightExamples handles GET requests to export the corrections of the function
+// insights of a repository as few-shot examples
+func (h *Handler) ExportFunctionInsightExamples(c *gin.Context) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
+		return
+	}
 
-	repoID, err := strconv.ParseInt(repoIDStr, 10, 64)
+	insightsManager := NewInsightsManager(h.service, h.repository)
+	examples, err := insightsManager.ExportFunctionInsightExamples(repoID)
 	if err != nil {
-		http.Error(w, "Invalid repository ID", http.StatusBadRequest)
+		h.log().WithError(err).Error("Failed to export function insight examples")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export function insight examples"})
 		return
 	}
 
-	insights, err := h.repository.ListInsightsByRepository(repoID)
+	c.JSON(http.StatusOK, gin.H{"examples": examples, "count": len(examples)})
+}
+
+// saveInsight saves an insight as the data of its record, responding with an error if it fails
+func (h *Handler) saveInsight(c *gin.Context, record *InsightRecord, insight interface{}) bool {
+	if record.Model == "" {
+		record.Model = h.service.defaultModel
+	}
+	insightJSON, err := json.Marshal(insight)
 	if err != nil {
-		h.log().WithError(err).Error("Failed to list insights")
-		http.Error(w, "Failed to list insights", http.StatusInternalServerError)
-		return
+		h.log().WithError(err).Errorf("Failed to marshal %s insight", record.Type)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to marshal %s insight", record.Type)})
+		return false
 	}
+	record.Data = string(insightJSON)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(insights)
+	if err := h.repository.SaveInsight(record); err != nil {
+		h.log().WithError(err).Errorf("Failed to save %s insight", record.Type)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save %s insight", record.Type)})
+		return false
+	}
+	return true
+}
+
+// parseID parses an ID of a path parameter, responding with a bad request if it is invalid
+func parseID(c *gin.Context, param, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s ID", name)})
+		return 0, false
+	}
+	return id, true
+}
+
+// parseIDs parses the repository ID and the ID of an item of the repository from the path
+func parseIDs(c *gin.Context, param, name string) (int64, int64, bool) {
+	repoID, ok := parseID(c, "repoId", "repository")
+	if !ok {
+		return 0, 0, false
+	}
+	id, ok := parseID(c, param, name)
+	if !ok {
+		return 0, 0, false
+	}
+	return repoID, id, true
+}
+
+// parseRevisions parses the optional from and to revision numbers of a diff, 0 when not given
+func parseRevisions(c *gin.Context) (int, int, bool) {
+	revisions := [2]int{}
+	for i, param := range []string{"from", "to"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		revision, err := strconv.Atoi(value)
+		if err != nil || revision < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s revision", param)})
+			return 0, 0, false
+		}
+		revisions[i] = revision
+	}
+	return revisions[0], revisions[1], true
+}
+
+// bindGenerateRequest binds the optional body of a request generating an insight
+func bindGenerateRequest(c *gin.Context) (generateInsightRequest, bool) {
+	var req generateInsightRequest
+	if c.Request.ContentLength == 0 {
+		return req, true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
+		return req, false
+	}
+	return req, true
+}
+
+// requestContext returns the context of a request, with its LLM usage attributed to its user
+func requestContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if userID, exists := c.Get("user_id"); exists {
+		ctx = usage.WithAttribution(ctx, usage.Attribution{UserID: fmt.Sprint(userID)})
+	}
+	return ctx
 }
@@ -0,0 +1,513 @@
+package repointel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/llm/usage"
+	"github.com/sirupsen/logrus"
+)
+
+// errTokensSpent stops a generation that used the tokens it was allowed
+var errTokensSpent = errors.New("token budget spent")
+
+// HierarchyProgress is told the progress of the generation of the insights of a repository,
+// one level of the hierarchy after the other
+type HierarchyProgress interface {
+	// SetPhase records the level being generated, with the number of its insights to generate
+	SetPhase(phase string, total int)
+	// SetDone records the number of insights of the level generated so far
+	SetDone(done int)
+	// LLMCall records an insight generated with the LLM
+	LLMCall()
+}
+
+// HierarchyOptions selects the insights GenerateHierarchy generates, and with what
+type HierarchyOptions struct {
+	Model     string // The default model if empty
+	StaleOnly bool   // Only regenerate the stale insights, leaving the missing ones missing
+	MaxTokens int    // Stop once the LLM calls used this many tokens; no cap if 0
+}
+
+// GenerateHierarchy generates the insights of a repository bottom-up: those of its functions
+// and structs, then of its files from them, of its packages from those of their files, and of
+// the repository from those of its packages. Only the insights missing or whose inputs changed
+// are generated, and each is saved as soon as it is, so that a generation that was interrupted
+// resumes where it stopped. Insights that fail to generate are left out of the level above
+// rather than failing the generation, and running out of tokens ends it early.
+func (im *InsightsManager) GenerateHierarchy(ctx context.Context, repoID int64, opts HierarchyOptions, progress HierarchyProgress) error {
+	if opts.Model == "" {
+		opts.Model = im.service.defaultModel
+	}
+	meter := usage.MeterFromContext(ctx)
+	if meter == nil {
+		meter = &usage.Meter{}
+		ctx = usage.WithMeter(ctx, meter)
+	}
+
+	run := &hierarchyRun{
+		im:       im,
+		ctx:      ctx,
+		opts:     opts,
+		meter:    meter,
+		progress: progress,
+		log: im.logger.WithFields(logrus.Fields{
+			"repo_id":    repoID,
+			"model_name": opts.Model,
+		}),
+	}
+
+	err := run.generate(repoID)
+	if errors.Is(err, errTokensSpent) {
+		run.log.WithField("tokens", meter.Tokens()).Info("Insight generation stopped at its token budget")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	run.log.WithField("tokens", meter.Tokens()).Info("Insight hierarchy generated")
+	return nil
+}
+
+// hierarchyRun is a generation of the insights of a repository
+type hierarchyRun struct {
+	im       *InsightsManager
+	ctx      context.Context
+	opts     HierarchyOptions
+	meter    *usage.Meter
+	progress HierarchyProgress
+	log      *logrus.Entry
+}
+
+// hierarchyItem is an insight to generate at a level of the hierarchy
+type hierarchyItem struct {
+	name     string
+	generate func(ctx context.Context) error
+}
+
+// generate generates the levels of the hierarchy of a repository in turn, each from the
+// insights of the level below as they are once it was generated
+func (r *hierarchyRun) generate(repoID int64) error {
+	h, err := r.im.loadHierarchy(repoID)
+	if err != nil {
+		return err
+	}
+	model := r.opts.Model
+
+	// Functions and structs
+	var items []hierarchyItem
+	for _, function := range h.functions {
+		inputHash := h.functionHash(function)
+		if !r.wanted(h.functionInsights[function.ID], inputHash) {
+			continue
+		}
+		functionID := function.ID
+		items = append(items, hierarchyItem{name: functionName(function), generate: func(ctx context.Context) error {
+			insight, err := r.im.service.GenerateFunctionInsight(ctx, repoID, functionID, model)
+			if err != nil {
+				return err
+			}
+			return r.im.repo.SaveFunctionInsight(repoID, functionID, insight, model, inputHash)
+		}})
+	}
+	for _, symbol := range h.structs {
+		inputHash := structInputHash(symbol)
+		if !r.wanted(h.structInsights[symbol.ID], inputHash) {
+			continue
+		}
+		symbolID := symbol.ID
+		items = append(items, hierarchyItem{name: "struct " + symbol.Name, generate: func(ctx context.Context) error {
+			insight, err := r.im.service.GenerateStructInsight(ctx, repoID, symbolID, model)
+			if err != nil {
+				return err
+			}
+			return r.im.saveInsight(&InsightRecord{
+				RepositoryID: repoID,
+				SymbolID:     &symbolID,
+				Type:         InsightTypeStruct,
+				Model:        model,
+				InputHash:    inputHash,
+			}, insight)
+		}})
+	}
+	if err := r.generateLevel(models.JobPhaseFunctions, items); err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		if err := h.reloadFunctionInsights(r.im); err != nil {
+			return err
+		}
+	}
+
+	// Files, from the insights of their functions and structs
+	items = nil
+	for i := range h.files {
+		file := &h.files[i]
+		parts := h.fileParts(file.ID)
+		inputHash := summaryInputHash(parts)
+		if len(parts) == 0 || !r.wanted(h.fileInsights[file.ID], inputHash) {
+			continue
+		}
+		fileID := file.ID
+		items = append(items, hierarchyItem{name: file.FilePath, generate: func(ctx context.Context) error {
+			insight, err := r.im.service.SummarizeFile(ctx, h.repo, file, formatParts(parts), model)
+			if err != nil {
+				return err
+			}
+			return r.im.saveInsight(&InsightRecord{
+				RepositoryID: repoID,
+				FileID:       &fileID,
+				Path:         file.FilePath,
+				Type:         InsightTypeFile,
+				Model:        model,
+				InputHash:    inputHash,
+			}, insight)
+		}})
+	}
+	if err := r.generateLevel(models.JobPhaseFiles, items); err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		if err := h.reloadFileInsights(r.im); err != nil {
+			return err
+		}
+	}
+
+	// Packages, from the insights of their files
+	items = nil
+	for _, pkgPath := range h.packagePaths() {
+		parts := h.packageParts(pkgPath)
+		inputHash := summaryInputHash(parts)
+		if len(parts) == 0 || !r.wanted(h.packageInsights[pkgPath], inputHash) {
+			continue
+		}
+		pkgPath := pkgPath
+		items = append(items, hierarchyItem{name: pkgPath, generate: func(ctx context.Context) error {
+			insight, err := r.im.service.SummarizePackage(ctx, h.repo, pkgPath, formatParts(parts), model)
+			if err != nil {
+				return err
+			}
+			return r.im.saveInsight(&InsightRecord{
+				RepositoryID: repoID,
+				Path:         pkgPath,
+				Type:         InsightTypePackage,
+				Model:        model,
+				InputHash:    inputHash,
+			}, insight)
+		}})
+	}
+	if err := r.generateLevel(models.JobPhasePackages, items); err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		if err := h.reloadPackageInsights(r.im); err != nil {
+			return err
+		}
+	}
+
+	// The repository, from the insights of its packages
+	items = nil
+	parts := h.repositoryParts()
+	inputHash := summaryInputHash(parts)
+	if len(parts) > 0 && r.wanted(h.repoInsight, inputHash) {
+		items = append(items, hierarchyItem{name: h.repo.Name, generate: func(ctx context.Context) error {
+			insight, err := r.im.service.SummarizeRepository(ctx, h.repo, formatParts(parts), model)
+			if err != nil {
+				return err
+			}
+			return r.im.saveInsight(&InsightRecord{
+				RepositoryID: repoID,
+				Type:         InsightTypeRepository,
+				Model:        model,
+				InputHash:    inputHash,
+			}, insight)
+		}})
+	}
+	return r.generateLevel(models.JobPhaseRepository, items)
+}
+
+// wanted reports whether an insight is to be generated: if it is stale, or missing unless only
+// stale insights are regenerated
+func (r *hierarchyRun) wanted(record InsightRecord, inputHash string) bool {
+	if record.ID == 0 {
+		return !r.opts.StaleOnly
+	}
+	return record.InputHash != inputHash
+}
+
+// generateLevel generates the insights of a level of the hierarchy, logging those that fail.
+// It stops when the context is done or the tokens of the generation are spent.
+func (r *hierarchyRun) generateLevel(phase string, items []hierarchyItem) error {
+	r.progress.SetPhase(phase, len(items))
+	for i, item := range items {
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		if r.opts.MaxTokens > 0 && r.meter.Tokens() >= r.opts.MaxTokens {
+			return errTokensSpent
+		}
+
+		if err := item.generate(r.ctx); err != nil {
+			r.log.WithError(err).WithFields(logrus.Fields{
+				"phase": phase,
+				"item":  item.name,
+			}).Error("Failed to generate insight")
+		} else {
+			r.progress.LLMCall()
+		}
+		r.progress.SetDone(i + 1)
+	}
+	return nil
+}
+
+// insightPart is the insight of a part of an item of the level above it in the hierarchy
+type insightPart struct {
+	name   string
+	record InsightRecord
+}
+
+// hierarchy is what the insights of a repository are generated from, level by level, with the
+// latest insights of each level
+type hierarchy struct {
+	repo            *models.Repository
+	files           []models.RepositoryFile
+	functions       []models.RepositoryFunction
+	structs         []models.RepositorySymbol
+	calls           map[int64][]models.FunctionCall       // By caller
+	functionsByFile map[int64][]models.RepositoryFunction // By file ID
+	structsByFile   map[int64][]models.RepositorySymbol   // By file ID
+	filesByPackage  map[string][]models.RepositoryFile    // By import path
+
+	functionInsights map[int64]InsightRecord  // By function ID
+	structInsights   map[int64]InsightRecord  // By symbol ID
+	fileInsights     map[int64]InsightRecord  // By file ID
+	packageInsights  map[string]InsightRecord // By import path
+	repoInsight      InsightRecord
+}
+
+// loadHierarchy loads the functions, structs, files and packages of the default snapshot of a
+// repository, with their latest insights
+func (im *InsightsManager) loadHierarchy(repoID int64) (*hierarchy, error) {
+	codeRepo := im.service.codeAnalyzerRepo
+	repo, err := codeRepo.GetRepositoryByID(repoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository: %w", err)
+	}
+	if repo == nil {
+		return nil, fmt.Errorf("repository %d not found", repoID)
+	}
+
+	h := &hierarchy{
+		repo:            repo,
+		calls:           make(map[int64][]models.FunctionCall),
+		functionsByFile: make(map[int64][]models.RepositoryFunction),
+		structsByFile:   make(map[int64][]models.RepositorySymbol),
+		filesByPackage:  make(map[string][]models.RepositoryFile),
+	}
+
+	if h.files, err = codeRepo.GetRepositoryFiles(repoID); err != nil {
+		return nil, fmt.Errorf("failed to get repository files: %w", err)
+	}
+	if h.functions, err = codeRepo.GetRepositoryFunctions(repoID, 0); err != nil {
+		return nil, fmt.Errorf("failed to get repository functions: %w", err)
+	}
+	symbols, err := codeRepo.GetRepositorySymbols(repoID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository symbols: %w", err)
+	}
+	calls, err := codeRepo.GetRepositoryFunctionCalls(repoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository function calls: %w", err)
+	}
+
+	for _, symbol := range symbols {
+		if symbol.Kind == "struct" {
+			h.structs = append(h.structs, symbol)
+			h.structsByFile[symbol.FileID] = append(h.structsByFile[symbol.FileID], symbol)
+		}
+	}
+	for _, function := range h.functions {
+		h.functionsByFile[function.FileID] = append(h.functionsByFile[function.FileID], function)
+	}
+	for _, call := range calls {
+		h.calls[call.CallerID] = append(h.calls[call.CallerID], call)
+	}
+	for _, file := range h.files {
+		pkgPath := packagePath(file)
+		h.filesByPackage[pkgPath] = append(h.filesByPackage[pkgPath], file)
+	}
+
+	if err := h.reloadFunctionInsights(im); err != nil {
+		return nil, err
+	}
+	if err := h.reloadFileInsights(im); err != nil {
+		return nil, err
+	}
+	if err := h.reloadPackageInsights(im); err != nil {
+		return nil, err
+	}
+	repoInsights, err := im.latestInsights(repoID, InsightTypeRepository)
+	if err != nil {
+		return nil, err
+	}
+	h.repoInsight = repoInsights[0]
+
+	return h, nil
+}
+
+// reloadFunctionInsights loads the latest insights of the functions and structs
+func (h *hierarchy) reloadFunctionInsights(im *InsightsManager) error {
+	records, err := im.repo.ListLatestFunctionInsights(h.repo.ID)
+	if err != nil {
+		return err
+	}
+	h.functionInsights = make(map[int64]InsightRecord, len(records))
+	for _, record := range records {
+		if record.FunctionID != nil {
+			h.functionInsights[*record.FunctionID] = record
+		}
+	}
+
+	h.structInsights, err = im.latestInsights(h.repo.ID, InsightTypeStruct)
+	return err
+}
+
+// reloadFileInsights loads the latest insights of the files
+func (h *hierarchy) reloadFileInsights(im *InsightsManager) error {
+	var err error
+	h.fileInsights, err = im.latestInsights(h.repo.ID, InsightTypeFile)
+	return err
+}
+
+// reloadPackageInsights loads the latest insights of the packages
+func (h *hierarchy) reloadPackageInsights(im *InsightsManager) error {
+	records, err := im.repo.ListLatestInsights(h.repo.ID, InsightTypePackage)
+	if err != nil {
+		return err
+	}
+	h.packageInsights = make(map[string]InsightRecord, len(records))
+	for _, record := range records {
+		h.packageInsights[record.Path] = record
+	}
+	return nil
+}
+
+// functionHash hashes the inputs of the insight of a function
+func (h *hierarchy) functionHash(function models.RepositoryFunction) string {
+	return functionInputHash(function, h.calls[function.ID])
+}
+
+// fileParts returns the insights of the functions and structs of a file, in the order they
+// are declared
+func (h *hierarchy) fileParts(fileID int64) []insightPart {
+	var parts []insightPart
+	for _, function := range h.functionsByFile[fileID] {
+		if record, ok := h.functionInsights[function.ID]; ok {
+			parts = append(parts, insightPart{name: functionName(function), record: record})
+		}
+	}
+	for _, symbol := range h.structsByFile[fileID] {
+		if record, ok := h.structInsights[symbol.ID]; ok {
+			parts = append(parts, insightPart{name: "struct " + symbol.Name, record: record})
+		}
+	}
+	return parts
+}
+
+// packagePaths returns the import paths of the packages, sorted
+func (h *hierarchy) packagePaths() []string {
+	paths := make([]string, 0, len(h.filesByPackage))
+	for pkgPath := range h.filesByPackage {
+		paths = append(paths, pkgPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// packageParts returns the insights of the files of a package, by path
+func (h *hierarchy) packageParts(pkgPath string) []insightPart {
+	var parts []insightPart
+	for _, file := range h.filesByPackage[pkgPath] {
+		if record, ok := h.fileInsights[file.ID]; ok {
+			parts = append(parts, insightPart{name: "file " + file.FilePath, record: record})
+		}
+	}
+	return parts
+}
+
+// repositoryParts returns the insights of the packages of the repository, by import path
+func (h *hierarchy) repositoryParts() []insightPart {
+	var parts []insightPart
+	for _, pkgPath := range h.packagePaths() {
+		if record, ok := h.packageInsights[pkgPath]; ok {
+			parts = append(parts, insightPart{name: "package " + pkgPath, record: record})
+		}
+	}
+	return parts
+}
+
+// latestInsights gets the latest insights of a type of a repository, keyed by the ID of the
+// file or symbol they are of, or by 0 for the insight of the repository
+func (im *InsightsManager) latestInsights(repoID int64, insightType InsightType) (map[int64]InsightRecord, error) {
+	records, err := im.repo.ListLatestInsights(repoID, insightType)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]InsightRecord, len(records))
+	for _, record := range records {
+		var id int64
+		switch {
+		case record.FileID != nil && insightType == InsightTypeFile:
+			id = *record.FileID
+		case record.SymbolID != nil:
+			id = *record.SymbolID
+		}
+		if existing, ok := byID[id]; !ok || existing.CreatedAt.Before(record.CreatedAt) {
+			byID[id] = record
+		}
+	}
+	return byID, nil
+}
+
+// saveInsight saves an insight as the data of its record
+func (im *InsightsManager) saveInsight(record *InsightRecord, insight interface{}) error {
+	data, err := json.Marshal(insight)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s insight: %w", record.Type, err)
+	}
+	record.Data = string(data)
+	return im.repo.SaveInsight(record)
+}
+
+// formatParts formats insights as the parts of the prompt summarizing them, each headed by
+// what it is of
+func formatParts(parts []insightPart) []string {
+	formatted := make([]string, len(parts))
+	for i, part := range parts {
+		formatted[i] = "### " + part.name + "\n" + part.record.Data
+	}
+	return formatted
+}
+
+// functionName returns the name of a function as it is declared, with its receiver if it is a
+// method
+func functionName(function models.RepositoryFunction) string {
+	if function.Receiver != "" {
+		return fmt.Sprintf("func (%s) %s", function.Receiver, function.Name)
+	}
+	return "func " + function.Name
+}
+
+// packagePath returns the import path of the package of a file, or its directory if the path
+// is unknown
+func packagePath(file models.RepositoryFile) string {
+	if file.PackagePath != "" {
+		return file.PackagePath
+	}
+	return path.Dir(file.FilePath)
+}
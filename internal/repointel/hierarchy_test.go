@@ -0,0 +1,173 @@
+package repointel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/internal/repository"
+	"cred.com/hack25/backend/pkg/database"
+	"cred.com/hack25/backend/pkg/llm/structured"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatParts(t *testing.T) {
+	parts := []insightPart{
+		{name: "func Run", record: InsightRecord{Data: `{"a":1}`}},
+		{name: "struct Config", record: InsightRecord{Data: `{"b":2}`}},
+	}
+
+	assert.Equal(t, []string{"### func Run\n{\"a\":1}", "### struct Config\n{\"b\":2}"}, formatParts(parts))
+}
+
+func TestFunctionName(t *testing.T) {
+	assert.Equal(t, "func Run", functionName(models.RepositoryFunction{Name: "Run"}))
+	assert.Equal(t, "func (*Server) Run", functionName(models.RepositoryFunction{Name: "Run", Receiver: "*Server"}))
+}
+
+func TestPackagePath(t *testing.T) {
+	assert.Equal(t, "example.com/app/pkg/api", packagePath(models.RepositoryFile{FilePath: "pkg/api/api.go", PackagePath: "example.com/app/pkg/api"}))
+	assert.Equal(t, "pkg/api", packagePath(models.RepositoryFile{FilePath: "pkg/api/api.go"}))
+}
+
+// schemaLLM answers structured calls with the smallest response conforming to their schema,
+// counting them
+type schemaLLM struct {
+	calls atomic.Int32
+}
+
+func (l *schemaLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.calls.Add(1)
+	var req structured.LiteLLMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ResponseFormat == nil || req.ResponseFormat.JSONSchema == nil {
+		http.Error(w, "a json_schema response format is expected", http.StatusBadRequest)
+		return
+	}
+	var schema map[string]interface{}
+	_ = json.Unmarshal(req.ResponseFormat.JSONSchema.Schema, &schema)
+	content, _ := json.Marshal(minimalInstance(schema))
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{"message": map[string]string{"content": string(content)}}},
+		"usage":   map[string]int{"prompt_tokens": 90, "completion_tokens": 10, "total_tokens": 100},
+	})
+}
+
+// minimalInstance returns the smallest value conforming to a schema, with only its required
+// properties
+func minimalInstance(schema map[string]interface{}) interface{} {
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	switch schema["type"] {
+	case "object":
+		object := map[string]interface{}{}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			property, _ := properties[name.(string)].(map[string]interface{})
+			object[name.(string)] = minimalInstance(property)
+		}
+		return object
+	case "array":
+		return []interface{}{}
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	}
+	return "x"
+}
+
+// countingProgress counts the insights a generation reports it generated
+type countingProgress struct {
+	llmCalls int
+}
+
+func (p *countingProgress) SetPhase(phase string, total int) {}
+func (p *countingProgress) SetDone(done int)                 {}
+func (p *countingProgress) LLMCall()                         { p.llmCalls++ }
+
+// setupHierarchy indexes a repository of a package of one file with two functions, returning
+// it with an insights manager generating with a fake LLM
+func setupHierarchy(t *testing.T) (*InsightsManager, *schemaLLM, int64) {
+	db := setupTestDB(t)
+	require.NoError(t, (&database.DB{Conn: db.DB}).Migrate(context.Background()))
+	logger.Init(logrus.WarnLevel, "repointel-test")
+	codeRepo := repository.NewCodeAnalyzerRepository(db.DB)
+
+	name := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	indexed := &models.Repository{Kind: "local", URL: "/tmp/" + name, Name: name, IndexStatus: "completed"}
+	require.NoError(t, codeRepo.CreateRepository(indexed))
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM code_analyzer.repositories WHERE id = $1`, indexed.ID)
+	})
+	snapshot := &models.RepositorySnapshot{RepositoryID: indexed.ID, IndexStatus: "completed"}
+	require.NoError(t, codeRepo.CreateSnapshot(snapshot))
+	file := &models.RepositoryFile{RepositoryID: indexed.ID, SnapshotID: snapshot.ID, FilePath: "main.go", Package: "main", PackagePath: "example.com/app", LastAnalyzed: time.Now()}
+	require.NoError(t, codeRepo.CreateRepositoryFile(file))
+	var functions []models.RepositoryFunction
+	for i, code := range []string{"func run() { serve() }", "func serve() {}"} {
+		functions = append(functions, models.RepositoryFunction{
+			RepositoryID: indexed.ID, FileID: file.ID, Name: []string{"run", "serve"}[i], Kind: "function", Line: i + 1,
+			CodeBlock: code, BodyHash: models.HashFunctionBody(code),
+		})
+	}
+	require.NoError(t, codeRepo.BatchCreateFunctions(functions))
+
+	llm := &schemaLLM{}
+	server := httptest.NewServer(llm)
+	t.Cleanup(server.Close)
+	im := NewInsightsManager(NewService(codeRepo, server.URL, "key", "gpt-4o"), NewRepository(db.DB))
+	return im, llm, indexed.ID
+}
+
+func TestGenerateHierarchySkipsUpToDateInsights(t *testing.T) {
+	im, llm, repoID := setupHierarchy(t)
+
+	// Two functions, their file, its package and the repository
+	progress := &countingProgress{}
+	require.NoError(t, im.GenerateHierarchy(context.Background(), repoID, HierarchyOptions{}, progress))
+	assert.Equal(t, 5, progress.llmCalls)
+	assert.Equal(t, int32(5), llm.calls.Load())
+
+	stale, err := im.ListStaleInsights(repoID)
+	require.NoError(t, err)
+	assert.Empty(t, stale)
+
+	progress = &countingProgress{}
+	require.NoError(t, im.GenerateHierarchy(context.Background(), repoID, HierarchyOptions{}, progress))
+	assert.Zero(t, progress.llmCalls, "insights whose inputs did not change are not generated again")
+	assert.Equal(t, int32(5), llm.calls.Load())
+}
+
+func TestGenerateHierarchyResumesAfterPartialRun(t *testing.T) {
+	im, llm, repoID := setupHierarchy(t)
+
+	// The first insight spends the tokens of the run
+	progress := &countingProgress{}
+	require.NoError(t, im.GenerateHierarchy(context.Background(), repoID, HierarchyOptions{MaxTokens: 1}, progress))
+	assert.Equal(t, 1, progress.llmCalls)
+	records, err := im.repo.ListLatestFunctionInsights(repoID)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	// The next run generates the rest, without the insight already saved
+	progress = &countingProgress{}
+	require.NoError(t, im.GenerateHierarchy(context.Background(), repoID, HierarchyOptions{}, progress))
+	assert.Equal(t, 4, progress.llmCalls)
+	assert.Equal(t, int32(5), llm.calls.Load())
+
+	insight, err := im.repo.GetRepositoryInsight(repoID)
+	require.NoError(t, err)
+	assert.NotNil(t, insight)
+}
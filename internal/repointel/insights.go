@@ -1,6 +1,7 @@
 package repointel
 
 import (
+	"context"
 	"fmt"
 
 	"cred.com/hack25/backend/pkg/logger"
@@ -24,22 +25,30 @@ func NewInsightsManager(service *Service, repo *Repository) *InsightsManager {
 }
 
 // GenerateAndSaveFunctionInsight generates and saves an insight for a function
-func (im *InsightsManager) GenerateAndSaveFunctionInsight(repoID int64, functionID int64, modelName string) (*FunctionInsight, error) {
+func (im *InsightsManager) GenerateAndSaveFunctionInsight(ctx context.Context, repoID int64, functionID int64, modelName string) (*FunctionInsight, error) {
 	im.logger.WithFields(logrus.Fields{
 		"repo_id":     repoID,
 		"function_id": functionID,
 		"model_name":  modelName,
 	}).Debug("Generating function insight")
+	if modelName == "" {
+		modelName = im.service.defaultModel
+	}
 
 	// Generate the insight
-	insight, err := im.service.GenerateFunctionInsight(repoID, functionID, modelName)
+	insight, err := im.service.GenerateFunctionInsight(ctx, repoID, functionID, modelName)
 	if err != nil {
 		im.logger.WithError(err).Error("Failed to generate function insight")
 		return nil, fmt.Errorf("failed to generate function insight: %w", err)
 	}
 
-	// Save the insight
-	err = im.repo.SaveFunctionInsight(repoID, functionID, insight, modelName)
+	// Save the insight, with the hash of what it was generated from
+	inputHash, err := im.functionInputHash(functionID)
+	if err != nil {
+		im.logger.WithError(err).Error("Failed to hash function insight inputs")
+		return nil, fmt.Errorf("failed to hash function insight inputs: %w", err)
+	}
+	err = im.repo.SaveFunctionInsight(repoID, functionID, insight, modelName, inputHash)
 	if err != nil {
 		im.logger.WithError(err).Error("Failed to save function insight")
 		return nil, fmt.Errorf("failed to save function insight: %w", err)
@@ -53,18 +62,23 @@ func (im *InsightsManager) GenerateAndSaveFunctionInsight(repoID int64, function
 	return insight, nil
 }
 
-// GetFunctionInsights retrieves insights for a specific function
+// GetFunctionInsights retrieves the insight of a function to use, if it has one: the one
+// reviewers curated, or else its current one unless they rejected it. Its revisions are listed
+// by ListFunctionInsightRevisions.
 func (im *InsightsManager) GetFunctionInsights(repoID int64, functionID int64) ([]*FunctionInsight, error) {
 	im.logger.WithFields(logrus.Fields{
 		"repo_id":     repoID,
 		"function_id": functionID,
 	}).Debug("Retrieving function insights")
 
-	record, err := im.repo.GetFunctionInsight(repoID, functionID)
+	record, err := im.repo.GetPreferredFunctionInsight(repoID, functionID)
 	if err != nil {
 		im.logger.WithError(err).Error("Failed to retrieve function insights")
 		return nil, fmt.Errorf("failed to retrieve function insights: %w", err)
 	}
 
+	if record == nil {
+		return nil, nil
+	}
 	return []*FunctionInsight{record}, nil
 }
@@ -11,6 +11,7 @@ type FunctionInsight = insights.FunctionInsight
 type SymbolInsight = insights.SymbolInsight
 type StructInsight = insights.StructInsight
 type FileInsight = insights.FileInsight
+type PackageInsight = insights.PackageInsight
 type RepositoryInsight = insights.RepositoryInsight
 type InsightRecord = insights.InsightRecord
 type LLMRequest = insights.LLMRequest
@@ -23,5 +24,6 @@ const (
 	InsightTypeSymbol     = insights.SymbolInsightType
 	InsightTypeStruct     = insights.StructInsightType
 	InsightTypeFile       = insights.FileInsightType
+	InsightTypePackage    = insights.PackageInsightType
 	InsightTypeRepository = insights.RepositoryInsightType
 )
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"time"
 
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/llm/structured"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
@@ -29,8 +31,12 @@ func (r *Repository) log() *logrus.Entry {
 	return logger.Log.WithField("component", "repointel-repository")
 }
 
-// SaveInsight saves an insight to the database
+// SaveInsight saves an insight to the database as the current revision of its item, generated
+// with the current prompts unless its record says otherwise
 func (r *Repository) SaveInsight(insight *InsightRecord) error {
+	if insight.PromptVersion == "" {
+		insight.PromptVersion = structured.PromptVersion
+	}
 	r.log().WithFields(logrus.Fields{
 		"repository_id": insight.RepositoryID,
 		"type":          insight.Type,
@@ -45,9 +51,11 @@ func (r *Repository) SaveInsight(insight *InsightRecord) error {
 			path,
 			type, 
 			data,
-			model
+			model,
+			prompt_version,
+			input_hash
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -61,6 +69,8 @@ func (r *Repository) SaveInsight(insight *InsightRecord) error {
 		insight.Type,
 		insight.Data,
 		insight.Model,
+		insight.PromptVersion,
+		insight.InputHash,
 	).Scan(&insight.ID, &insight.CreatedAt, &insight.UpdatedAt)
 
 	if err != nil {
@@ -71,8 +81,9 @@ func (r *Repository) SaveInsight(insight *InsightRecord) error {
 	return nil
 }
 
-// SaveFunctionInsight saves a function insight to the function_insights table
-func (r *Repository) SaveFunctionInsight(repositoryID, functionID int64, insight *FunctionInsight, model string) error {
+// SaveFunctionInsight saves a function insight to the function_insights table as its current
+// revision, with the hash of the inputs it was generated with the current prompts from
+func (r *Repository) SaveFunctionInsight(repositoryID, functionID int64, insight *FunctionInsight, model, inputHash string) error {
 	r.log().WithFields(logrus.Fields{
 		"repository_id": repositoryID,
 		"function_id":   functionID,
@@ -90,9 +101,12 @@ func (r *Repository) SaveFunctionInsight(repositoryID, functionID int64, insight
 			repository_id, 
 			function_id, 
 			data,
-			model
+			model,
+			prompt_version,
+			input_hash,
+			body_hash
 		)
-		VALUES ($1, $2, $3, $4)
+		SELECT $1, $2, $3, $4, $5, $6, COALESCE((SELECT body_hash FROM code_analyzer.repository_functions WHERE id = $2), '')
 		RETURNING id
 	`
 
@@ -103,6 +117,8 @@ func (r *Repository) SaveFunctionInsight(repositoryID, functionID int64, insight
 		functionID,
 		dataJSON,
 		model,
+		structured.PromptVersion,
+		inputHash,
 	).Scan(&id)
 
 	if err != nil {
@@ -175,7 +191,7 @@ func (r *Repository) GetSymbolInsight(repositoryID int64, symbolID int64) (*Symb
 
 	var record InsightRecord
 	query := `
-		SELECT id, repository_id, file_id, function_id, symbol_id, type, data, model_name, created_at, updated_at
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
 		FROM code_analyzer.insights
 		WHERE repository_id = $1 AND symbol_id = $2 AND type = $3
 		ORDER BY created_at DESC
@@ -210,7 +226,7 @@ func (r *Repository) GetStructInsight(repositoryID int64, symbolID int64) (*Stru
 
 	var record InsightRecord
 	query := `
-		SELECT id, repository_id, file_id, function_id, symbol_id, type, data, model_name, created_at, updated_at
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
 		FROM code_analyzer.insights
 		WHERE repository_id = $1 AND symbol_id = $2 AND type = $3
 		ORDER BY created_at DESC
@@ -245,7 +261,7 @@ func (r *Repository) GetFileInsight(repositoryID int64, fileID int64) (*FileInsi
 
 	var record InsightRecord
 	query := `
-		SELECT id, repository_id, file_id, function_id, symbol_id, type, data, model_name, created_at, updated_at
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
 		FROM code_analyzer.insights
 		WHERE repository_id = $1 AND file_id = $2 AND type = $3 AND function_id IS NULL AND symbol_id IS NULL
 		ORDER BY created_at DESC
@@ -279,7 +295,7 @@ func (r *Repository) GetRepositoryInsight(repositoryID int64) (*RepositoryInsigh
 
 	var record InsightRecord
 	query := `
-		SELECT id, repository_id, file_id, function_id, symbol_id, type, data, model_name, created_at, updated_at
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
 		FROM code_analyzer.insights
 		WHERE repository_id = $1 AND type = $2 AND file_id IS NULL AND function_id IS NULL AND symbol_id IS NULL
 		ORDER BY created_at DESC
@@ -313,7 +329,7 @@ func (r *Repository) ListInsightsByRepository(repositoryID int64) ([]InsightReco
 
 	var records []InsightRecord
 	query := `
-		SELECT id, repository_id, file_id, function_id, symbol_id, type, data, model_name, created_at, updated_at
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
 		FROM code_analyzer.insights
 		WHERE repository_id = $1
 		ORDER BY created_at DESC
@@ -337,7 +353,7 @@ func (r *Repository) GetFunctionInsights(repositoryID int64, functionID int64) (
 
 	var records []InsightRecord
 	query := `
-		SELECT id, repository_id, file_id, function_id, symbol_id, type, data, model_name, created_at, updated_at
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
 		FROM code_analyzer.insights
 		WHERE repository_id = $1 AND function_id = $2 AND type = $3
 		ORDER BY created_at DESC
@@ -351,3 +367,362 @@ func (r *Repository) GetFunctionInsights(repositoryID int64, functionID int64) (
 
 	return records, nil
 }
+
+// GetPackageInsight retrieves the latest insight of a package, by its import path
+func (r *Repository) GetPackageInsight(repositoryID int64, pkgPath string) (*PackageInsight, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"package_path":  pkgPath,
+	}).Debug("Getting package insight")
+
+	var record InsightRecord
+	query := `
+		SELECT id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
+		FROM code_analyzer.insights
+		WHERE repository_id = $1 AND type = $2 AND path = $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	err := r.DB.Get(&record, query, repositoryID, InsightTypePackage, pkgPath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			r.log().Debug("Package insight not found")
+			return nil, nil
+		}
+		r.log().WithField("error", err).Error("Failed to get package insight")
+		return nil, fmt.Errorf("failed to get package insight: %w", err)
+	}
+
+	var insight PackageInsight
+	if err := json.Unmarshal([]byte(record.Data), &insight); err != nil {
+		r.log().WithField("error", err).Error("Failed to unmarshal package insight")
+		return nil, fmt.Errorf("failed to unmarshal package insight: %w", err)
+	}
+
+	return &insight, nil
+}
+
+// ListLatestInsights lists the latest insight of a type of each file, function, symbol or path
+// of a repository
+func (r *Repository) ListLatestInsights(repositoryID int64, insightType InsightType) ([]InsightRecord, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"type":          insightType,
+	}).Debug("Listing latest insights")
+
+	var records []InsightRecord
+	query := `
+		SELECT DISTINCT ON (COALESCE(file_id, 0), COALESCE(function_id, 0), COALESCE(symbol_id, 0), COALESCE(path, ''))
+			id, repository_id, file_id, function_id, symbol_id, COALESCE(path, '') AS path, type, data, model, prompt_version, input_hash, created_at, updated_at
+		FROM code_analyzer.insights
+		WHERE repository_id = $1 AND type = $2
+		ORDER BY COALESCE(file_id, 0), COALESCE(function_id, 0), COALESCE(symbol_id, 0), COALESCE(path, ''), created_at DESC
+	`
+
+	err := r.DB.Select(&records, query, repositoryID, insightType)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to list latest insights")
+		return nil, fmt.Errorf("failed to list latest insights: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListLatestFunctionInsights lists the latest insight of each function of a repository, as
+// records of the function_insights table
+func (r *Repository) ListLatestFunctionInsights(repositoryID int64) ([]InsightRecord, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+	}).Debug("Listing latest function insights")
+
+	var records []InsightRecord
+	query := `
+		SELECT DISTINCT ON (function_id)
+			id, repository_id, function_id, 'function' AS type, data::text AS data, model, prompt_version, input_hash, created_at, updated_at
+		FROM code_analyzer.function_insights
+		WHERE repository_id = $1
+		ORDER BY function_id, created_at DESC
+	`
+
+	err := r.DB.Select(&records, query, repositoryID)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to list latest function insights")
+		return nil, fmt.Errorf("failed to list latest function insights: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListFunctionInsightRevisions lists the insights of a function, oldest first, along with those of
+// the functions of the same file path, receiver and name in the other snapshots of its repository
+func (r *Repository) ListFunctionInsightRevisions(repositoryID, functionID int64) ([]InsightRevision, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"function_id":   functionID,
+	}).Debug("Listing function insight revisions")
+
+	var revisions []InsightRevision
+	query := `
+		SELECT
+			i.id, i.repository_id, i.function_id, 'function' AS type, i.data::text AS data, i.model, i.prompt_version, i.input_hash, i.created_at, i.updated_at,
+			s.commit_sha
+		FROM code_analyzer.repository_functions target
+		JOIN code_analyzer.repository_files target_file ON target_file.id = target.file_id
+		JOIN code_analyzer.repository_files f ON f.repository_id = target_file.repository_id AND f.file_path = target_file.file_path
+		JOIN code_analyzer.repository_functions fn ON fn.file_id = f.id AND fn.name = target.name AND COALESCE(fn.receiver, '') = COALESCE(target.receiver, '')
+		JOIN code_analyzer.repository_snapshots s ON s.id = fn.snapshot_id
+		JOIN code_analyzer.function_insights i ON i.function_id = fn.id
+		WHERE target.repository_id = $1 AND target.id = $2
+		ORDER BY i.created_at, i.id
+	`
+
+	err := r.DB.Select(&revisions, query, repositoryID, functionID)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to list function insight revisions")
+		return nil, fmt.Errorf("failed to list function insight revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// ListStructInsightRevisions lists the insights of a struct, oldest first, along with those of the
+// structs of the same file path and name in the other snapshots of its repository
+func (r *Repository) ListStructInsightRevisions(repositoryID, symbolID int64) ([]InsightRevision, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"symbol_id":     symbolID,
+	}).Debug("Listing struct insight revisions")
+
+	var revisions []InsightRevision
+	query := `
+		SELECT
+			i.id, i.repository_id, i.file_id, i.function_id, i.symbol_id, COALESCE(i.path, '') AS path, i.type, i.data, i.model, i.prompt_version, i.input_hash, i.created_at, i.updated_at,
+			s.commit_sha
+		FROM code_analyzer.repository_symbols target
+		JOIN code_analyzer.repository_files target_file ON target_file.id = target.file_id
+		JOIN code_analyzer.repository_files f ON f.repository_id = target_file.repository_id AND f.file_path = target_file.file_path
+		JOIN code_analyzer.repository_symbols sym ON sym.file_id = f.id AND sym.name = target.name
+		JOIN code_analyzer.repository_snapshots s ON s.id = sym.snapshot_id
+		JOIN code_analyzer.insights i ON i.symbol_id = sym.id AND i.type = $3
+		WHERE target.repository_id = $1 AND target.id = $2
+		ORDER BY i.created_at, i.id
+	`
+
+	err := r.DB.Select(&revisions, query, repositoryID, symbolID, InsightTypeStruct)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to list struct insight revisions")
+		return nil, fmt.Errorf("failed to list struct insight revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetFunctionInsightRecord retrieves an insight of a function by ID, or its current insight if
+// insightID is 0
+func (r *Repository) GetFunctionInsightRecord(repositoryID, functionID, insightID int64) (*InsightRecord, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"function_id":   functionID,
+		"insight_id":    insightID,
+	}).Debug("Getting function insight record")
+
+	var record InsightRecord
+	query := `
+		SELECT id, repository_id, function_id, 'function' AS type, data::text AS data, model, prompt_version, input_hash, created_at, updated_at
+		FROM code_analyzer.function_insights
+		WHERE repository_id = $1 AND function_id = $2 AND ($3 = 0 OR id = $3)
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	err := r.DB.Get(&record, query, repositoryID, functionID, insightID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			r.log().Debug("Function insight record not found")
+			return nil, nil
+		}
+		r.log().WithField("error", err).Error("Failed to get function insight record")
+		return nil, fmt.Errorf("failed to get function insight record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// GetPreferredFunctionInsight retrieves the insight reviewers curated most recently for the current
+// code of a function, reviewed on it or on a function of the repository with the same code. Reviews
+// of insights generated from code the function no longer has do not apply. Without one, it
+// retrieves its latest insight, unless reviewers rejected that insight, here or where it was copied from.
+func (r *Repository) GetPreferredFunctionInsight(repositoryID, functionID int64) (*FunctionInsight, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"function_id":   functionID,
+	}).Debug("Getting preferred function insight")
+
+	var data []byte
+	query := `
+		SELECT COALESCE(r.data, i.data)
+		FROM code_analyzer.function_insight_reviews r
+		JOIN code_analyzer.function_insights i ON i.id = r.function_insight_id
+		JOIN code_analyzer.repository_functions target ON target.id = $2
+		WHERE r.repository_id = $1 AND r.status IN ($3, $4)
+			AND target.body_hash <> '' AND i.body_hash = target.body_hash
+		ORDER BY r.updated_at DESC
+		LIMIT 1
+	`
+
+	err := r.DB.Get(&data, query, repositoryID, functionID, ReviewApproved, ReviewEdited)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		r.log().WithField("error", err).Error("Failed to get curated function insight")
+		return nil, fmt.Errorf("failed to get curated function insight: %w", err)
+	}
+
+	if data == nil {
+		var row struct {
+			Data     []byte `db:"data"`
+			Rejected bool   `db:"rejected"`
+		}
+		query = `
+			SELECT i.data, EXISTS (
+				SELECT 1
+				FROM code_analyzer.function_insight_reviews r
+				JOIN code_analyzer.function_insights ri ON ri.id = r.function_insight_id
+				WHERE r.repository_id = i.repository_id AND r.status = $3 AND ri.data = i.data
+			) AS rejected
+			FROM code_analyzer.function_insights i
+			WHERE i.repository_id = $1 AND i.function_id = $2
+			ORDER BY i.created_at DESC
+			LIMIT 1
+		`
+
+		err = r.DB.Get(&row, query, repositoryID, functionID, ReviewRejected)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				r.log().Debug("Function insight not found")
+				return nil, nil
+			}
+			r.log().WithField("error", err).Error("Failed to get function insight")
+			return nil, fmt.Errorf("failed to get function insight: %w", err)
+		}
+		if row.Rejected {
+			r.log().Debug("Function insight rejected")
+			return nil, nil
+		}
+		data = row.Data
+	}
+
+	var insight FunctionInsight
+	if err := json.Unmarshal(data, &insight); err != nil {
+		r.log().WithError(err).Error("Failed to unmarshal function insight data")
+		return nil, fmt.Errorf("failed to unmarshal function insight data: %w", err)
+	}
+
+	return &insight, nil
+}
+
+// SaveFunctionInsightReview saves the review of a function insight, replacing its previous one
+func (r *Repository) SaveFunctionInsightReview(review *InsightReview) error {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": review.RepositoryID,
+		"insight_id":    review.InsightID,
+		"status":        review.Status,
+	}).Info("Saving function insight review")
+
+	// Only edited reviews have a curated insight
+	var curated interface{}
+	if len(review.Curated) > 0 {
+		curated = []byte(review.Curated)
+	}
+
+	query := `
+		INSERT INTO code_analyzer.function_insight_reviews (repository_id, function_insight_id, status, data, comment, reviewed_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (function_insight_id)
+		DO UPDATE SET status = $3, data = $4, comment = $5, reviewed_by = $6, updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.DB.QueryRow(
+		query,
+		review.RepositoryID,
+		review.InsightID,
+		review.Status,
+		curated,
+		review.Comment,
+		review.ReviewedBy,
+	).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt)
+
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to save function insight review")
+		return fmt.Errorf("failed to save function insight review: %w", err)
+	}
+
+	return nil
+}
+
+// ListFunctionInsightReviews lists the reviews of the insights of a function, latest first
+func (r *Repository) ListFunctionInsightReviews(repositoryID, functionID int64) ([]InsightReview, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"function_id":   functionID,
+	}).Debug("Listing function insight reviews")
+
+	var reviews []InsightReview
+	query := `
+		SELECT r.id, r.repository_id, r.function_insight_id, i.function_id, r.status, i.data AS generated, r.data AS curated,
+			r.comment, r.reviewed_by, r.created_at, r.updated_at
+		FROM code_analyzer.function_insight_reviews r
+		JOIN code_analyzer.function_insights i ON i.id = r.function_insight_id
+		WHERE r.repository_id = $1 AND i.function_id = $2
+		ORDER BY r.updated_at DESC
+	`
+
+	err := r.DB.Select(&reviews, query, repositoryID, functionID)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to list function insight reviews")
+		return nil, fmt.Errorf("failed to list function insight reviews: %w", err)
+	}
+
+	return reviews, nil
+}
+
+// FunctionInsightExamples lists the insights of functions reviewers edited in a repository, latest
+// first, with the code of their functions, as few-shot examples. All of them if limit is 0. Edits
+// of insights generated from code the function no longer has are left out, so that every example
+// pairs an insight with the code it describes.
+func (r *Repository) FunctionInsightExamples(repositoryID int64, limit int) ([]structured.FewShotExample, error) {
+	r.log().WithFields(logrus.Fields{
+		"repository_id": repositoryID,
+		"limit":         limit,
+	}).Debug("Listing function insight examples")
+
+	var rows []struct {
+		models.RepositoryFunction
+		Insight string `db:"insight"`
+	}
+	query := `
+		SELECT fn.name, COALESCE(fn.receiver, '') AS receiver, COALESCE(fn.code_block, '') AS code_block, r.data::text AS insight
+		FROM code_analyzer.function_insight_reviews r
+		JOIN code_analyzer.function_insights i ON i.id = r.function_insight_id
+		JOIN code_analyzer.repository_functions fn ON fn.id = i.function_id
+		WHERE r.repository_id = $1 AND r.status = $2 AND fn.body_hash <> '' AND i.body_hash = fn.body_hash
+		ORDER BY r.updated_at DESC
+		LIMIT NULLIF($3, 0)
+	`
+
+	err := r.DB.Select(&rows, query, repositoryID, ReviewEdited, limit)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to list function insight examples")
+		return nil, fmt.Errorf("failed to list function insight examples: %w", err)
+	}
+
+	examples := make([]structured.FewShotExample, len(rows))
+	for i, row := range rows {
+		examples[i] = structured.FewShotExample{
+			Function: functionName(row.RepositoryFunction),
+			Code:     row.CodeBlock,
+			Insight:  row.Insight,
+		}
+	}
+	return examples, nil
+}
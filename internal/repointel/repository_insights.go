@@ -48,9 +48,10 @@ func (r *InsightsRepository) SaveFunctionInsight(repoID int64, functionID int64,
 			repository_id, 
 			function_id, 
 			data,
-			model
+			model,
+			body_hash
 		)
-		VALUES ($1, $2, $3, $4)
+		SELECT $1, $2, $3, $4, COALESCE((SELECT body_hash FROM code_analyzer.repository_functions WHERE id = $2), '')
 		RETURNING id
 	`
 
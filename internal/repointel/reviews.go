@@ -0,0 +1,119 @@
+package repointel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/structured"
+)
+
+var (
+	// ErrInvalidReview is returned when reviewing an insight with an unknown status, or with a
+	// curated insight that does not fit the status
+	ErrInvalidReview = errors.New("invalid insight review")
+
+	// ErrInsightNotFound is returned when reviewing an insight that does not exist
+	ErrInsightNotFound = errors.New("insight not found")
+)
+
+// Statuses of the review of an insight
+const (
+	ReviewApproved = "approved" // The generated insight is right
+	ReviewRejected = "rejected" // The generated insight is wrong, and not to be used
+	ReviewEdited   = "edited"   // The generated insight was corrected into a curated one
+)
+
+// InsightReview is the review of a generated function insight by a user. The generated insight
+// is kept as is, and the curated one is stored alongside it.
+type InsightReview struct {
+	ID           int64           `json:"id" db:"id"`
+	RepositoryID int64           `json:"repository_id" db:"repository_id"`
+	InsightID    int64           `json:"insight_id" db:"function_insight_id"`
+	FunctionID   int64           `json:"function_id" db:"function_id"`
+	Status       string          `json:"status" db:"status"`
+	Generated    json.RawMessage `json:"generated" db:"generated"`
+	Curated      json.RawMessage `json:"curated,omitempty" db:"curated"` // Of edited reviews
+	Comment      string          `json:"comment,omitempty" db:"comment"`
+	ReviewedBy   string          `json:"reviewed_by" db:"reviewed_by"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// ReviewFunctionInsight records the review of an insight of a function, its current one unless
+// the review says which, replacing any previous review of it. The curated insight of edited
+// reviews must be a function insight, and other reviews have none.
+func (im *InsightsManager) ReviewFunctionInsight(repoID, functionID int64, review *InsightReview) error {
+	if err := validateReview(review); err != nil {
+		return err
+	}
+
+	record, err := im.repo.GetFunctionInsightRecord(repoID, functionID, review.InsightID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrInsightNotFound
+	}
+
+	review.RepositoryID = repoID
+	review.InsightID = record.ID
+	review.FunctionID = functionID
+	review.Generated = json.RawMessage(record.Data)
+	if err := im.repo.SaveFunctionInsightReview(review); err != nil {
+		return err
+	}
+
+	im.logger.WithField("insight_id", review.InsightID).WithField("status", review.Status).Info("Function insight reviewed")
+	return nil
+}
+
+// ListFunctionInsightReviews lists the reviews of the insights of a function, latest first
+func (im *InsightsManager) ListFunctionInsightReviews(repoID, functionID int64) ([]InsightReview, error) {
+	return im.repo.ListFunctionInsightReviews(repoID, functionID)
+}
+
+// ExportFunctionInsightExamples lists the corrections reviewers made to the function insights of
+// a repository, as the few-shot examples the prompts of its insights include
+func (im *InsightsManager) ExportFunctionInsightExamples(repoID int64) ([]structured.FewShotExample, error) {
+	return im.repo.FunctionInsightExamples(repoID, 0)
+}
+
+// validateReview checks the status of a review and its curated insight, which is normalized
+// into the fields of a function insight
+func validateReview(review *InsightReview) error {
+	if review.ReviewedBy == "" {
+		return fmt.Errorf("%w: reviewer is required", ErrInvalidReview)
+	}
+
+	switch review.Status {
+	case ReviewApproved, ReviewRejected:
+		if len(review.Curated) > 0 && !bytes.Equal(review.Curated, []byte("null")) {
+			return fmt.Errorf("%w: only edited reviews have a curated insight", ErrInvalidReview)
+		}
+		review.Curated = nil
+
+	case ReviewEdited:
+		if len(review.Curated) == 0 {
+			return fmt.Errorf("%w: edited reviews need a curated insight", ErrInvalidReview)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(review.Curated))
+		decoder.DisallowUnknownFields()
+		var insight FunctionInsight
+		if err := decoder.Decode(&insight); err != nil {
+			return fmt.Errorf("%w: curated insight is not a function insight: %v", ErrInvalidReview, err)
+		}
+		curated, err := json.Marshal(insight)
+		if err != nil {
+			return fmt.Errorf("failed to marshal curated insight: %w", err)
+		}
+		review.Curated = curated
+
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidReview, review.Status)
+	}
+
+	return nil
+}
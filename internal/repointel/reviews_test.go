@@ -0,0 +1,120 @@
+package repointel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/internal/insights"
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/internal/repository"
+	"cred.com/hack25/backend/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReview(t *testing.T) {
+	review := &InsightReview{Status: ReviewApproved, ReviewedBy: "user-1"}
+	require.NoError(t, validateReview(review))
+	assert.Nil(t, review.Curated)
+
+	review = &InsightReview{Status: ReviewRejected, Curated: json.RawMessage("null"), ReviewedBy: "user-1"}
+	require.NoError(t, validateReview(review))
+	assert.Nil(t, review.Curated, "a null insight is no insight")
+}
+
+func TestValidateEditedReviewNormalizesInsight(t *testing.T) {
+	review := &InsightReview{
+		Status:     ReviewEdited,
+		Curated:    json.RawMessage(`{"intent": {"goal": "authenticate users"}, "database": [{"engine": "postgres", "action": "select", "purpose": "load the user"}]}`),
+		ReviewedBy: "user-1",
+	}
+	require.NoError(t, validateReview(review))
+
+	var insight FunctionInsight
+	require.NoError(t, json.Unmarshal(review.Curated, &insight))
+	assert.Equal(t, "authenticate users", insight.Intent.Goal)
+	require.Len(t, insight.Database, 1)
+	assert.Equal(t, "postgres", insight.Database[0].Engine)
+	assert.Contains(t, string(review.Curated), `"params":null`, "curated insights have the fields of function insights")
+}
+
+func TestValidateReviewRejectsInvalidReviews(t *testing.T) {
+	reviews := map[string]*InsightReview{
+		"no reviewer":               {Status: ReviewApproved},
+		"unknown status":            {Status: "maybe", ReviewedBy: "user-1"},
+		"approved with insight":     {Status: ReviewApproved, Curated: json.RawMessage(`{"notes": "x"}`), ReviewedBy: "user-1"},
+		"edited without insight":    {Status: ReviewEdited, ReviewedBy: "user-1"},
+		"edited with unknown field": {Status: ReviewEdited, Curated: json.RawMessage(`{"intnet": {}}`), ReviewedBy: "user-1"},
+		"edited with invalid JSON":  {Status: ReviewEdited, Curated: json.RawMessage(`{"notes": `), ReviewedBy: "user-1"},
+	}
+
+	for name, review := range reviews {
+		assert.ErrorIs(t, validateReview(review), ErrInvalidReview, name)
+	}
+}
+
+func TestCuratedInsightOnlyAppliesToReviewedCode(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, (&database.DB{Conn: db.DB}).Migrate(context.Background()))
+	codeRepo := repository.NewCodeAnalyzerRepository(db.DB)
+	repo := NewRepository(db.DB)
+
+	name := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	indexed := &models.Repository{Kind: "local", URL: "/tmp/" + name, Name: name, IndexStatus: "completed"}
+	require.NoError(t, codeRepo.CreateRepository(indexed))
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM code_analyzer.repositories WHERE id = $1`, indexed.ID)
+	})
+	snapshot := &models.RepositorySnapshot{RepositoryID: indexed.ID, IndexStatus: "completed"}
+	require.NoError(t, codeRepo.CreateSnapshot(snapshot))
+	file := &models.RepositoryFile{RepositoryID: indexed.ID, SnapshotID: snapshot.ID, FilePath: "main.go", Package: "main", LastAnalyzed: time.Now()}
+	require.NoError(t, codeRepo.CreateRepositoryFile(file))
+
+	code := "func run() { serve() }"
+	functions := []models.RepositoryFunction{{
+		RepositoryID: indexed.ID, FileID: file.ID, Name: "run", Kind: "function", Line: 1,
+		CodeBlock: code, BodyHash: models.HashFunctionBody(code),
+	}}
+	require.NoError(t, codeRepo.BatchCreateFunctions(functions))
+	functionID := functions[0].ID
+
+	generated := &FunctionInsight{Intent: insights.Narrative{Goal: "generated"}}
+	require.NoError(t, repo.SaveFunctionInsight(indexed.ID, functionID, generated, "gpt-4o", "a"))
+	revisions, err := repo.ListFunctionInsightRevisions(indexed.ID, functionID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	require.NoError(t, repo.SaveFunctionInsightReview(&InsightReview{
+		RepositoryID: indexed.ID,
+		InsightID:    revisions[0].ID,
+		Status:       ReviewEdited,
+		Curated:      json.RawMessage(`{"intent": {"goal": "curated"}}`),
+		ReviewedBy:   "user-1",
+	}))
+
+	insight, err := repo.GetPreferredFunctionInsight(indexed.ID, functionID)
+	require.NoError(t, err)
+	require.NotNil(t, insight)
+	assert.Equal(t, "curated", insight.Intent.Goal)
+	examples, err := repo.FunctionInsightExamples(indexed.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, examples, 1)
+
+	// The function keeps its ID when its code is edited, and its insight is regenerated
+	code = "func run() { serveTLS() }"
+	_, err = db.Exec(`UPDATE code_analyzer.repository_functions SET code_block = $1, body_hash = $2 WHERE id = $3`,
+		code, models.HashFunctionBody(code), functionID)
+	require.NoError(t, err)
+	regenerated := &FunctionInsight{Intent: insights.Narrative{Goal: "regenerated"}}
+	require.NoError(t, repo.SaveFunctionInsight(indexed.ID, functionID, regenerated, "gpt-4o", "b"))
+
+	insight, err = repo.GetPreferredFunctionInsight(indexed.ID, functionID)
+	require.NoError(t, err)
+	require.NotNil(t, insight)
+	assert.Equal(t, "regenerated", insight.Intent.Goal, "reviews of the previous code no longer apply")
+	examples, err = repo.FunctionInsightExamples(indexed.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, examples, "edits of insights of the previous code are not examples for the current code")
+}
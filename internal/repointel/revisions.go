@@ -0,0 +1,228 @@
+package repointel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ErrRevisionNotFound is returned when diffing revisions of an insight that do not exist
+var ErrRevisionNotFound = errors.New("insight revision not found")
+
+// Kinds of changes between two revisions of an insight
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldChanged = "changed"
+)
+
+// InsightRevision is one of the insights generated for a function or struct over time, in the
+// snapshot of the commit the function or struct was indexed at. The latest one is current.
+type InsightRevision struct {
+	InsightRecord
+	Revision  int    `json:"revision" db:"-"` // From 1, oldest first
+	CommitSHA string `json:"commit_sha" db:"commit_sha"`
+	Current   bool   `json:"current" db:"-"`
+}
+
+// FieldChange is a change of a field of an insight between two revisions. Fields are named by
+// their JSON path, such as intent.goal; elements added to or removed from lists, such as the
+// database operations of a function, are changes of the list itself.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Change string      `json:"change"`
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// InsightDiff is what changed in the insight of a function or struct between two revisions
+type InsightDiff struct {
+	From    InsightRevision `json:"from"`
+	To      InsightRevision `json:"to"`
+	Changes []FieldChange   `json:"changes"`
+}
+
+// ListFunctionInsightRevisions lists the revisions of the insight of a function, oldest first,
+// following the function across the commits of its repository by file path and name
+func (im *InsightsManager) ListFunctionInsightRevisions(repoID, functionID int64) ([]InsightRevision, error) {
+	revisions, err := im.repo.ListFunctionInsightRevisions(repoID, functionID)
+	if err != nil {
+		return nil, err
+	}
+	return numberRevisions(revisions), nil
+}
+
+// ListStructInsightRevisions lists the revisions of the insight of a struct, oldest first,
+// following the struct across the commits of its repository by file path and name
+func (im *InsightsManager) ListStructInsightRevisions(repoID, symbolID int64) ([]InsightRevision, error) {
+	revisions, err := im.repo.ListStructInsightRevisions(repoID, symbolID)
+	if err != nil {
+		return nil, err
+	}
+	return numberRevisions(revisions), nil
+}
+
+// DiffFunctionInsight diffs two revisions of the insight of a function, by number. A revision
+// of 0 is the current one for to, and the one before to for from.
+func (im *InsightsManager) DiffFunctionInsight(repoID, functionID int64, from, to int) (*InsightDiff, error) {
+	revisions, err := im.ListFunctionInsightRevisions(repoID, functionID)
+	if err != nil {
+		return nil, err
+	}
+	return diffRevisions(revisions, from, to, func() interface{} { return &FunctionInsight{} })
+}
+
+// DiffStructInsight diffs two revisions of the insight of a struct, by number. A revision of 0 is
+// the current one for to, and the one before to for from.
+func (im *InsightsManager) DiffStructInsight(repoID, symbolID int64, from, to int) (*InsightDiff, error) {
+	revisions, err := im.ListStructInsightRevisions(repoID, symbolID)
+	if err != nil {
+		return nil, err
+	}
+	return diffRevisions(revisions, from, to, func() interface{} { return &StructInsight{} })
+}
+
+// numberRevisions numbers revisions listed oldest first, the last being current
+func numberRevisions(revisions []InsightRevision) []InsightRevision {
+	for i := range revisions {
+		revisions[i].Revision = i + 1
+		revisions[i].Current = i == len(revisions)-1
+	}
+	return revisions
+}
+
+// diffRevisions diffs two numbered revisions, decoding their data into what newInsight returns
+// so that both are compared with the fields of the same type
+func diffRevisions(revisions []InsightRevision, from, to int, newInsight func() interface{}) (*InsightDiff, error) {
+	if to == 0 {
+		to = len(revisions)
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || from > len(revisions) || to < 1 || to > len(revisions) {
+		return nil, ErrRevisionNotFound
+	}
+	fromRevision, toRevision := revisions[from-1], revisions[to-1]
+
+	fromInsight, toInsight := newInsight(), newInsight()
+	if err := json.Unmarshal([]byte(fromRevision.Data), fromInsight); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal insight revision %d: %w", from, err)
+	}
+	if err := json.Unmarshal([]byte(toRevision.Data), toInsight); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal insight revision %d: %w", to, err)
+	}
+
+	changes, err := diffInsights(fromInsight, toInsight)
+	if err != nil {
+		return nil, err
+	}
+	return &InsightDiff{From: fromRevision, To: toRevision, Changes: changes}, nil
+}
+
+// diffInsights lists the fields changed from one insight to another, compared as JSON
+func diffInsights(from, to interface{}) ([]FieldChange, error) {
+	fromValue, err := jsonValue(from)
+	if err != nil {
+		return nil, err
+	}
+	toValue, err := jsonValue(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	diffValues("", fromValue, toValue, &changes)
+	return changes, nil
+}
+
+// jsonValue returns the generic JSON value of an insight
+func jsonValue(insight interface{}) (interface{}, error) {
+	data, err := json.Marshal(insight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal insight: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal insight: %w", err)
+	}
+	return value, nil
+}
+
+// diffValues appends the changes from one JSON value to another at a path. Objects are diffed
+// field by field, and lists by the elements added and removed, whatever their order.
+func diffValues(path string, from, to interface{}, changes *[]FieldChange) {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if fromIsObject && toIsObject {
+		keys := make([]string, 0, len(fromObject)+len(toObject))
+		for key := range fromObject {
+			keys = append(keys, key)
+		}
+		for key := range toObject {
+			if _, ok := fromObject[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			diffValues(field, fromObject[key], toObject[key], changes)
+		}
+		return
+	}
+
+	fromList, fromIsList := from.([]interface{})
+	toList, toIsList := to.([]interface{})
+	if (fromIsList || from == nil) && (toIsList || to == nil) && (fromIsList || toIsList) {
+		removed, added := diffLists(fromList, toList)
+		for _, element := range removed {
+			*changes = append(*changes, FieldChange{Field: path, Change: FieldRemoved, From: element})
+		}
+		for _, element := range added {
+			*changes = append(*changes, FieldChange{Field: path, Change: FieldAdded, To: element})
+		}
+		return
+	}
+
+	switch {
+	case reflect.DeepEqual(from, to):
+	case from == nil:
+		*changes = append(*changes, FieldChange{Field: path, Change: FieldAdded, To: to})
+	case to == nil:
+		*changes = append(*changes, FieldChange{Field: path, Change: FieldRemoved, From: from})
+	default:
+		*changes = append(*changes, FieldChange{Field: path, Change: FieldChanged, From: from, To: to})
+	}
+}
+
+// diffLists returns the elements of one list missing from another, and those of the other
+// missing from the first, each element matching one equal element at most
+func diffLists(from, to []interface{}) (removed, added []interface{}) {
+	matched := make([]bool, len(to))
+	for _, element := range from {
+		found := false
+		for i, other := range to {
+			if !matched[i] && reflect.DeepEqual(element, other) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, element)
+		}
+	}
+	for i, element := range to {
+		if !matched[i] {
+			added = append(added, element)
+		}
+	}
+	return removed, added
+}
@@ -0,0 +1,102 @@
+package repointel
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cred.com/hack25/backend/internal/insights"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// revision returns a revision of an insight with data
+func revision(t *testing.T, id int64, insight interface{}) InsightRevision {
+	data, err := json.Marshal(insight)
+	require.NoError(t, err)
+	return InsightRevision{InsightRecord: InsightRecord{ID: id, Data: string(data)}}
+}
+
+func TestNumberRevisions(t *testing.T) {
+	revisions := numberRevisions([]InsightRevision{{}, {}, {}})
+
+	assert.Equal(t, []int{1, 2, 3}, []int{revisions[0].Revision, revisions[1].Revision, revisions[2].Revision})
+	assert.False(t, revisions[0].Current)
+	assert.False(t, revisions[1].Current)
+	assert.True(t, revisions[2].Current)
+	assert.Empty(t, numberRevisions(nil))
+}
+
+func TestDiffFunctionInsightRevisions(t *testing.T) {
+	users := insights.DatabaseOp{Engine: "postgres", Table: "users", Action: "select", Purpose: "load the user"}
+	audit := insights.DatabaseOp{Engine: "postgres", Table: "audit", Action: "insert", Purpose: "record the login"}
+	revisions := numberRevisions([]InsightRevision{
+		revision(t, 10, FunctionInsight{
+			Intent:   insights.Narrative{Problem: "users log in", Goal: "authenticate users"},
+			Database: []insights.DatabaseOp{users},
+		}),
+		revision(t, 11, FunctionInsight{
+			Intent:   insights.Narrative{Problem: "users log in", Goal: "authenticate and audit users"},
+			Database: []insights.DatabaseOp{audit, users},
+			Notes:    "audited",
+		}),
+	})
+
+	diff, err := diffRevisions(revisions, 0, 0, func() interface{} { return &FunctionInsight{} })
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(10), diff.From.ID)
+	assert.Equal(t, int64(11), diff.To.ID)
+	require.Len(t, diff.Changes, 3)
+	assert.Equal(t, "database", diff.Changes[0].Field)
+	assert.Equal(t, FieldAdded, diff.Changes[0].Change)
+	assert.Equal(t, "audit", diff.Changes[0].To.(map[string]interface{})["table"])
+	assert.Equal(t, FieldChange{Field: "intent.goal", Change: FieldChanged, From: "authenticate users", To: "authenticate and audit users"}, diff.Changes[1])
+	assert.Equal(t, FieldChange{Field: "notes", Change: FieldAdded, To: "audited"}, diff.Changes[2])
+
+	// Diffing backwards reverses the changes
+	diff, err = diffRevisions(revisions, 2, 1, func() interface{} { return &FunctionInsight{} })
+	require.NoError(t, err)
+	require.Len(t, diff.Changes, 3)
+	assert.Equal(t, FieldRemoved, diff.Changes[0].Change)
+	assert.Equal(t, FieldRemoved, diff.Changes[2].Change)
+}
+
+func TestDiffStructInsightRevisions(t *testing.T) {
+	revisions := numberRevisions([]InsightRevision{
+		revision(t, 1, StructInsight{
+			Concept: insights.KnowledgeRef{Concept: "User"},
+			Fields:  []insights.IOParam{{Name: "ID", Type: "int64", Meaning: "identifier"}},
+		}),
+		revision(t, 2, StructInsight{
+			Concept: insights.KnowledgeRef{Concept: "Account"},
+			Fields:  []insights.IOParam{{Name: "ID", Type: "int64", Meaning: "identifier"}},
+		}),
+	})
+
+	diff, err := diffRevisions(revisions, 1, 2, func() interface{} { return &StructInsight{} })
+	require.NoError(t, err)
+	assert.Equal(t, []FieldChange{{Field: "concept.concept", Change: FieldChanged, From: "User", To: "Account"}}, diff.Changes)
+
+	diff, err = diffRevisions(revisions, 2, 2, func() interface{} { return &StructInsight{} })
+	require.NoError(t, err)
+	assert.Empty(t, diff.Changes)
+}
+
+func TestDiffRevisionsNotFound(t *testing.T) {
+	newInsight := func() interface{} { return &FunctionInsight{} }
+	single := numberRevisions([]InsightRevision{revision(t, 1, FunctionInsight{})})
+
+	_, err := diffRevisions(nil, 0, 0, newInsight)
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+	_, err = diffRevisions(single, 0, 0, newInsight)
+	assert.ErrorIs(t, err, ErrRevisionNotFound, "the only revision has none before it")
+	_, err = diffRevisions(single, 1, 2, newInsight)
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+}
+
+func TestDiffListsMatchesEachElementOnce(t *testing.T) {
+	removed, added := diffLists([]interface{}{"a", "a", "b"}, []interface{}{"b", "a", "c"})
+
+	assert.Equal(t, []interface{}{"a"}, removed)
+	assert.Equal(t, []interface{}{"c"}, added)
+}
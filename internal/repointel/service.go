@@ -1,9 +1,16 @@
 package repointel
 
 import (
+	"context"
+
 	"cred.com/hack25/backend/internal/insights"
+	"cred.com/hack25/backend/internal/models"
 	"cred.com/hack25/backend/internal/repository"
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/resilience"
 	"cred.com/hack25/backend/pkg/llm/structured"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/sirupsen/logrus"
 )
@@ -56,22 +63,61 @@ func (s *Service) log() *logrus.Entry {
 	return logger.Log.WithField("component", "repointel-service")
 }
 
+// SetGuard sets the guard of the LLM requests of the service, for them to share the limits
+// and circuit of the other clients of the provider
+func (s *Service) SetGuard(guard *resilience.Guard) {
+	s.structuredService.SetGuard(guard)
+}
+
+// SetFallbackPolicy sets the models the LLM calls of the service fall back to when they fail
+func (s *Service) SetFallbackPolicy(policy *interfaces.FallbackPolicy) {
+	s.structuredService.SetFallbackPolicy(policy)
+}
+
+// SetExampleSource sets where the few-shot examples of the prompts generating the insights of
+// functions come from
+func (s *Service) SetExampleSource(source structured.ExampleSource) {
+	s.structuredService.SetExampleSource(source)
+}
+
+// SetUsageRecorder sets the recorder of the usage of the LLM calls of the service
+func (s *Service) SetUsageRecorder(recorder usage.Recorder) {
+	s.structuredService.SetUsageRecorder(recorder)
+}
+
+// SetCache sets the cache of the responses of the LLM calls of the service
+func (s *Service) SetCache(responses *cache.Cache) {
+	s.structuredService.SetCache(responses)
+}
+
 // GenerateFunctionInsight generates insights for a function
-func (s *Service) GenerateFunctionInsight(repoID int64, functionID int64, modelName string) (*insights.FunctionInsight, error) {
+func (s *Service) GenerateFunctionInsight(ctx context.Context, repoID int64, functionID int64, modelName string) (*insights.FunctionInsight, error) {
 	// Delegate to structured service
-	return s.structuredService.GenerateFunctionInsight(repoID, functionID, modelName)
+	return s.structuredService.GenerateFunctionInsight(ctx, repoID, functionID, modelName)
 }
 
 // GenerateSymbolInsight generates insights for a symbol
-func (s *Service) GenerateSymbolInsight(repoID int64, symbolID int64, modelName string) (*insights.SymbolInsight, error) {
+func (s *Service) GenerateSymbolInsight(ctx context.Context, repoID int64, symbolID int64, modelName string) (*insights.SymbolInsight, error) {
 	// Delegate to structured service
-	return s.structuredService.GenerateSymbolInsight(repoID, symbolID, modelName)
+	return s.structuredService.GenerateSymbolInsight(ctx, repoID, symbolID, modelName)
 }
 
 // GenerateStructInsight generates insights for a struct
-func (s *Service) GenerateStructInsight(repoID int64, symbolID int64, modelName string) (*insights.StructInsight, error) {
+func (s *Service) GenerateStructInsight(ctx context.Context, repoID int64, symbolID int64, modelName string) (*insights.StructInsight, error) {
+	// Delegate to structured service
+	return s.structuredService.GenerateStructInsight(ctx, repoID, symbolID, modelName)
+}
+
+// GenerateFileInsight generates insights for a file
+func (s *Service) GenerateFileInsight(ctx context.Context, repoID int64, fileID int64, modelName string) (*insights.FileInsight, error) {
+	// Delegate to structured service
+	return s.structuredService.GenerateFileInsight(ctx, repoID, fileID, modelName)
+}
+
+// GenerateRepositoryInsight generates insights for a whole repository
+func (s *Service) GenerateRepositoryInsight(ctx context.Context, repoID int64, modelName string) (*insights.RepositoryInsight, error) {
 	// Delegate to structured service
-	return s.structuredService.GenerateStructInsight(repoID, symbolID, modelName)
+	return s.structuredService.GenerateRepositoryInsight(ctx, repoID, modelName)
 }
 
 // // prepareFunctionPrompt prepares the prompt for function analysis
@@ -1678,3 +1724,21 @@ func (s *Service) GenerateStructInsight(repoID int64, symbolID int64, modelName
 
 // 	return items
 // }
+
+// SummarizeFile generates the insight of a file from the insights of its functions and structs
+func (s *Service) SummarizeFile(ctx context.Context, repo *models.Repository, file *models.RepositoryFile, parts []string, modelName string) (*insights.FileInsight, error) {
+	// Delegate to structured service
+	return s.structuredService.SummarizeFile(ctx, repo, file, parts, modelName)
+}
+
+// SummarizePackage generates the insight of a package from the insights of its files
+func (s *Service) SummarizePackage(ctx context.Context, repo *models.Repository, pkgPath string, parts []string, modelName string) (*insights.PackageInsight, error) {
+	// Delegate to structured service
+	return s.structuredService.SummarizePackage(ctx, repo, pkgPath, parts, modelName)
+}
+
+// SummarizeRepository generates the insight of a repository from the insights of its packages
+func (s *Service) SummarizeRepository(ctx context.Context, repo *models.Repository, parts []string, modelName string) (*insights.RepositoryInsight, error) {
+	// Delegate to structured service
+	return s.structuredService.SummarizeRepository(ctx, repo, parts, modelName)
+}
@@ -1,6 +1,7 @@
 package repointel
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -91,7 +92,7 @@ func TestGenerateFunctionInsight_RealAPI(t *testing.T) {
 	functionID = functions[0].ID
 
 	// Call the method being tested
-	insight, err := service.GenerateFunctionInsight(repoID, functionID, modelName)
+	insight, err := service.GenerateFunctionInsight(context.Background(), repoID, functionID, modelName)
 	t.Logf("Generated insight: %+v", insight)
 	// Assert
 	require.NoError(t, err, "Should not return an error")
@@ -138,7 +139,7 @@ func TestGenerateFunctionInsight_RealAPI(t *testing.T) {
 // 	modelName := "" // Use default model
 
 // 	// Call the method being tested
-// 	insight, err := service.GenerateFunctionInsight(repoID, functionID, modelName)
+// 	insight, err := service.GenerateFunctionInsight(context.Background(), repoID, functionID, modelName)
 
 // 	// Assertions
 // 	require.NoError(t, err, "Should not return an error")
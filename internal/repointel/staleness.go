@@ -0,0 +1,198 @@
+package repointel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/llm/structured"
+)
+
+// Reasons an insight is stale
+const (
+	StaleReasonChanged = "changed" // What it was generated from changed
+	StaleReasonUnknown = "unknown" // It was generated before its inputs were recorded
+	StaleReasonParts   = "parts"   // Insights it summarizes are stale, and will change once regenerated
+)
+
+// StaleInsight is an insight of a repository that no longer describes what it was generated from
+type StaleInsight struct {
+	InsightID   int64       `json:"insight_id"`
+	Type        InsightType `json:"type"`
+	FunctionID  *int64      `json:"function_id,omitempty"`
+	SymbolID    *int64      `json:"symbol_id,omitempty"`
+	FileID      *int64      `json:"file_id,omitempty"`
+	Path        string      `json:"path,omitempty"` // Of files, and import path of packages
+	Name        string      `json:"name,omitempty"` // Of functions and structs
+	Reason      string      `json:"reason"`
+	Model       string      `json:"model"`
+	GeneratedAt time.Time   `json:"generated_at"`
+}
+
+// ListStaleInsights lists the insights of a repository whose inputs changed since they were
+// generated, bottom-up. Insights summarizing stale insights are stale as well. Items without
+// an insight are not listed.
+func (im *InsightsManager) ListStaleInsights(repoID int64) ([]StaleInsight, error) {
+	h, err := im.loadHierarchy(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []StaleInsight
+	staleFunctions := make(map[int64]bool)
+	for _, function := range h.functions {
+		record, ok := h.functionInsights[function.ID]
+		if !ok {
+			continue
+		}
+		if reason := staleReason(record, h.functionHash(function), false); reason != "" {
+			functionID := function.ID
+			stale = append(stale, newStaleInsight(record, reason, StaleInsight{FunctionID: &functionID, Name: functionName(function)}))
+			staleFunctions[function.ID] = true
+		}
+	}
+	staleStructs := make(map[int64]bool)
+	for _, symbol := range h.structs {
+		record, ok := h.structInsights[symbol.ID]
+		if !ok {
+			continue
+		}
+		if reason := staleReason(record, structInputHash(symbol), false); reason != "" {
+			symbolID := symbol.ID
+			stale = append(stale, newStaleInsight(record, reason, StaleInsight{SymbolID: &symbolID, Name: symbol.Name}))
+			staleStructs[symbol.ID] = true
+		}
+	}
+
+	staleFiles := make(map[int64]bool)
+	for _, file := range h.files {
+		record, ok := h.fileInsights[file.ID]
+		if !ok {
+			continue
+		}
+		partsStale := false
+		for _, function := range h.functionsByFile[file.ID] {
+			partsStale = partsStale || staleFunctions[function.ID]
+		}
+		for _, symbol := range h.structsByFile[file.ID] {
+			partsStale = partsStale || staleStructs[symbol.ID]
+		}
+		if reason := staleReason(record, summaryInputHash(h.fileParts(file.ID)), partsStale); reason != "" {
+			fileID := file.ID
+			stale = append(stale, newStaleInsight(record, reason, StaleInsight{FileID: &fileID, Path: file.FilePath}))
+			staleFiles[file.ID] = true
+		}
+	}
+
+	stalePackages := false
+	for _, pkgPath := range h.packagePaths() {
+		record, ok := h.packageInsights[pkgPath]
+		if !ok {
+			continue
+		}
+		partsStale := false
+		for _, file := range h.filesByPackage[pkgPath] {
+			partsStale = partsStale || staleFiles[file.ID]
+		}
+		if reason := staleReason(record, summaryInputHash(h.packageParts(pkgPath)), partsStale); reason != "" {
+			stale = append(stale, newStaleInsight(record, reason, StaleInsight{Path: pkgPath}))
+			stalePackages = true
+		}
+	}
+
+	if h.repoInsight.ID != 0 {
+		if reason := staleReason(h.repoInsight, summaryInputHash(h.repositoryParts()), stalePackages); reason != "" {
+			stale = append(stale, newStaleInsight(h.repoInsight, reason, StaleInsight{}))
+		}
+	}
+
+	return stale, nil
+}
+
+// newStaleInsight describes a stale insight, of what item says
+func newStaleInsight(record InsightRecord, reason string, item StaleInsight) StaleInsight {
+	item.InsightID = record.ID
+	item.Type = record.Type
+	item.Reason = reason
+	item.Model = record.Model
+	item.GeneratedAt = record.CreatedAt
+	return item
+}
+
+// staleReason returns why an insight is stale given the hash of its inputs and whether the
+// insights it summarizes are, or "" if it is not
+func staleReason(record InsightRecord, inputHash string, partsStale bool) string {
+	switch {
+	case record.InputHash == "":
+		return StaleReasonUnknown
+	case record.InputHash != inputHash:
+		return StaleReasonChanged
+	case partsStale:
+		return StaleReasonParts
+	}
+	return ""
+}
+
+// functionInputHash hashes what the insight of a function is generated from: its signature,
+// code and callees, and the version of the prompts
+func (im *InsightsManager) functionInputHash(functionID int64) (string, error) {
+	function, err := im.service.codeAnalyzerRepo.GetFunctionByID(functionID)
+	if err != nil {
+		return "", err
+	}
+	if function == nil {
+		return "", fmt.Errorf("function %d not found", functionID)
+	}
+	calls, err := im.service.codeAnalyzerRepo.GetFunctionCalls(functionID)
+	if err != nil {
+		return "", err
+	}
+	return functionInputHash(*function, calls), nil
+}
+
+// functionInputHash hashes the signature, code and callees of a function with the version of
+// the prompts
+func functionInputHash(function models.RepositoryFunction, calls []models.FunctionCall) string {
+	callees := make([]string, len(calls))
+	for i, call := range calls {
+		callees[i] = call.CalleeName
+		if call.CalleePackage != "" {
+			callees[i] = call.CalleePackage + "." + call.CalleeName
+		}
+	}
+	sort.Strings(callees)
+
+	return hashInputs("function", structured.PromptVersion,
+		function.Kind, function.Receiver, function.Name, function.Parameters, function.Results,
+		strings.Join(callees, "\n"), function.CodeBlock)
+}
+
+// structInputHash hashes the declaration of a struct with the version of the prompts
+func structInputHash(symbol models.RepositorySymbol) string {
+	return hashInputs("struct", structured.PromptVersion, symbol.Name, symbol.Type, symbol.Fields, symbol.Methods)
+}
+
+// summaryInputHash hashes the insights an insight summarizes, by the hashes of their own inputs,
+// with the version of the prompts. Regenerating an insight from the same inputs leaves the
+// insights summarizing it fresh.
+func summaryInputHash(parts []insightPart) string {
+	inputs := []string{"summary", structured.PromptVersion}
+	for _, part := range parts {
+		inputs = append(inputs, part.name, part.record.InputHash)
+	}
+	return hashInputs(inputs...)
+}
+
+// hashInputs returns the hex SHA-256 of inputs, each prefixed with its length so that they
+// cannot run into one another
+func hashInputs(inputs ...string) string {
+	h := sha256.New()
+	for _, input := range inputs {
+		fmt.Fprintf(h, "%d:%s", len(input), input)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
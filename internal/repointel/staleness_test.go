@@ -0,0 +1,52 @@
+package repointel
+
+import (
+	"testing"
+
+	"cred.com/hack25/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleReason(t *testing.T) {
+	assert.Equal(t, StaleReasonUnknown, staleReason(InsightRecord{ID: 1}, "abc", false), "insights without recorded inputs are stale")
+	assert.Equal(t, StaleReasonChanged, staleReason(InsightRecord{ID: 1, InputHash: "abc"}, "def", false))
+	assert.Equal(t, StaleReasonChanged, staleReason(InsightRecord{ID: 1, InputHash: "abc"}, "def", true))
+	assert.Equal(t, StaleReasonParts, staleReason(InsightRecord{ID: 1, InputHash: "abc"}, "abc", true))
+	assert.Empty(t, staleReason(InsightRecord{ID: 1, InputHash: "abc"}, "abc", false))
+}
+
+func TestFunctionInputHash(t *testing.T) {
+	function := models.RepositoryFunction{Name: "Run", Receiver: "*Server", Parameters: "ctx context.Context", Results: "error", CodeBlock: "return nil"}
+	calls := []models.FunctionCall{{CalleeName: "Println", CalleePackage: "fmt"}, {CalleeName: "listen"}}
+	hash := functionInputHash(function, calls)
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, functionInputHash(function, []models.FunctionCall{calls[1], calls[0]}), "callees are hashed regardless of order")
+
+	changed := function
+	changed.CodeBlock = "return errors.New(\"closed\")"
+	assert.NotEqual(t, hash, functionInputHash(changed, calls))
+	assert.NotEqual(t, hash, functionInputHash(function, calls[:1]))
+}
+
+func TestSummaryInputHash(t *testing.T) {
+	parts := []insightPart{
+		{name: "func Run", record: InsightRecord{ID: 1, InputHash: "a", Data: `{"a":1}`}},
+		{name: "struct Config", record: InsightRecord{ID: 2, InputHash: "b", Data: `{"b":2}`}},
+	}
+	hash := summaryInputHash(parts)
+
+	regenerated := []insightPart{
+		{name: "func Run", record: InsightRecord{ID: 3, InputHash: "a", Data: `{"a":3}`}},
+		parts[1],
+	}
+	assert.Equal(t, hash, summaryInputHash(regenerated), "regenerating parts from the same inputs keeps summaries fresh")
+
+	changed := []insightPart{parts[0], {name: "struct Config", record: InsightRecord{ID: 4, InputHash: "c"}}}
+	assert.NotEqual(t, hash, summaryInputHash(changed))
+	assert.NotEqual(t, hash, summaryInputHash(parts[:1]))
+}
+
+func TestHashInputsSeparatesInputs(t *testing.T) {
+	assert.NotEqual(t, hashInputs("ab", "c"), hashInputs("a", "bc"))
+}
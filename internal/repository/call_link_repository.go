@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// GetSnapshotFunctionNames gets the ID, file, name, receiver and body hash of every function
+// of a snapshot, without loading their calls, references and statements
+func (r *CodeAnalyzerRepository) GetSnapshotFunctionNames(snapshotID int64) ([]models.RepositoryFunction, error) {
+	r.log().WithField("snapshot_id", snapshotID).Debug("Getting snapshot function names")
+
+	var functions []models.RepositoryFunction
+	query := `
+		SELECT id, repository_id, snapshot_id, file_id, name, kind, receiver, line, body_hash
+		FROM code_analyzer.repository_functions
+		WHERE snapshot_id = $1
+	`
+
+	err := r.DB.Select(&functions, query, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"error":       err,
+		})).Error("Failed to get snapshot function names")
+		return nil, err
+	}
+
+	return functions, nil
+}
+
+// GetUnlinkedFunctionCalls gets the calls of a snapshot that have neither a callee ID
+// nor an external kind, together with the file of their caller. Calls marked unresolved
+// by a previous link have an external kind, and are not linked again.
+func (r *CodeAnalyzerRepository) GetUnlinkedFunctionCalls(snapshotID int64) ([]models.CallerFunctionCall, error) {
+	r.log().WithField("snapshot_id", snapshotID).Debug("Getting unlinked function calls")
+
+	var calls []models.CallerFunctionCall
+	query := `
+		SELECT fc.id, fc.caller_id, fc.callee_name, fc.callee_package, fc.callee_id, fc.call_kind,
+			fc.confidence, fc.external_kind, fc.line, fc.parameters, fc.created_at, fc.updated_at,
+			f.file_id AS caller_file_id
+		FROM code_analyzer.function_calls fc
+		JOIN code_analyzer.repository_functions f ON f.id = fc.caller_id
+		WHERE f.snapshot_id = $1 AND fc.callee_id IS NULL AND fc.external_kind = ''
+	`
+
+	err := r.DB.Select(&calls, query, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"error":       err,
+		})).Error("Failed to get unlinked function calls")
+		return nil, err
+	}
+
+	return calls, nil
+}
+
+// UpdateFunctionCallLink stores the outcome of linking a call to its callee
+func (r *CodeAnalyzerRepository) UpdateFunctionCallLink(call *models.FunctionCall) error {
+	query := `
+		UPDATE code_analyzer.function_calls
+		SET callee_id = $1, callee_package = $2, confidence = $3, external_kind = $4, updated_at = NOW()
+		WHERE id = $5
+	`
+
+	_, err := r.DB.Exec(query, call.CalleeID, call.CalleePackage, call.Confidence, call.ExternalKind, call.ID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    call.ID,
+			"error": err,
+		})).Error("Failed to update function call link")
+	}
+	return err
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// CodeAnalysisRepository handles interactions with the code_analysis tables, where the
+// results of the LLM analysis of repositories are stored
+type CodeAnalysisRepository struct {
+	DB *sqlx.DB
+}
+
+// NewCodeAnalysisRepository creates a new CodeAnalysisRepository
+func NewCodeAnalysisRepository(dbConn *sql.DB) *CodeAnalysisRepository {
+	return &CodeAnalysisRepository{
+		DB: sqlx.NewDb(dbConn, "postgres"),
+	}
+}
+
+// log returns a logrus entry with the repository context
+func (r *CodeAnalysisRepository) log() *logrus.Entry {
+	return logger.Log.WithField("component", "code-analysis-repository")
+}
+
+// SaveRepositoryAnalysis stores the analysis of a repository, replacing the files stored by
+// its previous analysis, and returns the repository record it is tied to
+func (r *CodeAnalysisRepository) SaveRepositoryAnalysis(result *models.RepositoryAnalysisResult) (*models.AnalyzedRepository, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_url": result.RepoURL,
+		"files":    len(result.Files),
+	})).Info("Saving repository analysis")
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to begin transaction for saving repository analysis")
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var repo models.AnalyzedRepository
+	query := `
+		INSERT INTO code_analysis.repositories (repo_url, owner, name, analyzed_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (repo_url) DO UPDATE
+		SET owner = EXCLUDED.owner, name = EXCLUDED.name, updated_at = NOW(), analyzed_at = NOW()
+		RETURNING id, repo_url, owner, name, created_at, updated_at, analyzed_at
+	`
+	if err := tx.Get(&repo, query, result.RepoURL, limit(result.Owner, 100), limit(result.Name, 100)); err != nil {
+		r.log().WithField("error", err).Error("Failed to save analyzed repository")
+		return nil, err
+	}
+
+	// Everything stored for the files cascades from them
+	if _, err := tx.Exec(`DELETE FROM code_analysis.files WHERE repository_id = $1`, repo.ID); err != nil {
+		r.log().WithField("error", err).Error("Failed to delete previous file analysis")
+		return nil, err
+	}
+
+	for _, file := range result.Files {
+		if err := r.saveFileAnalysis(tx, repo.ID, file); err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"path":  file.Path,
+				"error": err,
+			})).Error("Failed to save file analysis")
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// saveFileAnalysis stores the analysis of a file in a transaction
+func (r *CodeAnalysisRepository) saveFileAnalysis(tx *sqlx.Tx, repoID string, file models.FileAnalysisResult) error {
+	var fileID string
+	err := tx.QueryRow(`INSERT INTO code_analysis.files (repository_id, path) VALUES ($1, $2) RETURNING id`,
+		repoID, limit(file.Path, 1000)).Scan(&fileID)
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range file.Dependencies {
+		if _, err := tx.Exec(`INSERT INTO code_analysis.dependencies (file_id, name) VALUES ($1, $2)`,
+			fileID, limit(dep, 255)); err != nil {
+			return err
+		}
+	}
+	for _, v := range file.GlobalVars {
+		if _, err := tx.Exec(`INSERT INTO code_analysis.global_vars (file_id, name, type, value) VALUES ($1, $2, $3, $4)`,
+			fileID, limit(v.Name, 255), limit(v.Type, 100), v.Value); err != nil {
+			return err
+		}
+	}
+	for _, c := range file.Constants {
+		if _, err := tx.Exec(`INSERT INTO code_analysis.constants (file_id, name, type, value) VALUES ($1, $2, $3, $4)`,
+			fileID, limit(c.Name, 255), limit(c.Type, 100), c.Value); err != nil {
+			return err
+		}
+	}
+	if file.InitFunction != nil {
+		if _, err := tx.Exec(`INSERT INTO code_analysis.init_functions (file_id, functionality) VALUES ($1, $2)`,
+			fileID, file.InitFunction.Functionality); err != nil {
+			return err
+		}
+	}
+
+	for _, st := range file.Structs {
+		var structID string
+		if err := tx.QueryRow(`INSERT INTO code_analysis.structs (file_id, name) VALUES ($1, $2) RETURNING id`,
+			fileID, limit(st.Name, 255)).Scan(&structID); err != nil {
+			return err
+		}
+		for _, field := range st.Fields {
+			if _, err := tx.Exec(`INSERT INTO code_analysis.struct_fields (struct_id, name, type) VALUES ($1, $2, $3)`,
+				structID, limit(field.Name, 255), limit(field.Type, 100)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, method := range file.Methods {
+		var methodID string
+		if err := tx.QueryRow(`
+			INSERT INTO code_analysis.methods (file_id, name, receiver, functionality)
+			VALUES ($1, $2, $3, $4) RETURNING id
+		`, fileID, limit(method.Name, 255), limit(method.Receiver, 255), method.Functionality).Scan(&methodID); err != nil {
+			return err
+		}
+		for _, params := range []struct {
+			vars    []models.VariableInfo
+			isInput bool
+		}{{method.InputParams, true}, {method.OutputParams, false}} {
+			for _, param := range params.vars {
+				if _, err := tx.Exec(`
+					INSERT INTO code_analysis.method_params (method_id, name, type, is_input) VALUES ($1, $2, $3, $4)
+				`, methodID, limit(param.Name, 255), limit(param.Type, 100), params.isInput); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for i, step := range file.WorkflowSteps {
+		var stepID string
+		if err := tx.QueryRow(`
+			INSERT INTO code_analysis.workflow_steps
+				(file_id, name, step_type, type_details, description, workflow_name, position)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+		`, fileID, limit(step.Name, 255), limit(models.NormalizeStepType(step.Type), 100), step.TypeDetails,
+			step.Description, limit(step.WorkflowName, 255), i).Scan(&stepID); err != nil {
+			return err
+		}
+		for j, dep := range step.Dependencies {
+			if _, err := tx.Exec(`
+				INSERT INTO code_analysis.workflow_step_dependencies (workflow_step_id, dependency, position)
+				VALUES ($1, $2, $3)
+			`, stepID, limit(dep, 255), j); err != nil {
+				return err
+			}
+		}
+		for _, vars := range []struct {
+			names   []string
+			isInput bool
+		}{{step.InputVars, true}, {step.OutputVars, false}} {
+			for j, name := range vars.names {
+				if _, err := tx.Exec(`
+					INSERT INTO code_analysis.workflow_step_variables (workflow_step_id, variable_name, is_input, position)
+					VALUES ($1, $2, $3, $4)
+				`, stepID, limit(name, 255), vars.isInput, j); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetAnalyzedRepository gets an analyzed repository by its URL
+func (r *CodeAnalysisRepository) GetAnalyzedRepository(repoURL string) (*models.AnalyzedRepository, error) {
+	r.log().WithField("repo_url", repoURL).Debug("Getting analyzed repository")
+
+	var repo models.AnalyzedRepository
+	query := `
+		SELECT id, repo_url, owner, name, created_at, updated_at, analyzed_at
+		FROM code_analysis.repositories
+		WHERE repo_url = $1
+	`
+	if err := r.DB.Get(&repo, query, repoURL); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Repository not analyzed
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_url": repoURL,
+			"error":    err,
+		})).Error("Failed to get analyzed repository")
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// ListWorkflowSteps lists the workflow steps of a repository ordered by file, workflow and
+// position, only those of a type unless stepType is empty
+func (r *CodeAnalysisRepository) ListWorkflowSteps(repoID, stepType string) ([]models.WorkflowStep, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repository_id": repoID,
+		"step_type":     stepType,
+	})).Debug("Listing workflow steps")
+
+	steps := []models.WorkflowStep{}
+	query := `
+		SELECT ws.id, f.path AS file_path, COALESCE(ws.workflow_name, '') AS workflow_name, ws.position,
+			ws.name, ws.step_type, COALESCE(ws.type_details, '') AS type_details,
+			COALESCE(ws.description, '') AS description
+		FROM code_analysis.workflow_steps ws
+		JOIN code_analysis.files f ON f.id = ws.file_id
+		WHERE f.repository_id = $1 AND ($2::text = '' OR ws.step_type = $2)
+		ORDER BY f.path, ws.workflow_name, ws.position
+	`
+	if err := r.DB.Select(&steps, query, repoID, stepType); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repository_id": repoID,
+			"error":         err,
+		})).Error("Failed to list workflow steps")
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return steps, nil
+	}
+
+	byID := make(map[string]*models.WorkflowStep, len(steps))
+	ids := make([]string, len(steps))
+	for i := range steps {
+		steps[i].Dependencies, steps[i].InputVars, steps[i].OutputVars = []string{}, []string{}, []string{}
+		byID[steps[i].ID] = &steps[i]
+		ids[i] = steps[i].ID
+	}
+
+	var deps []struct {
+		StepID     string `db:"workflow_step_id"`
+		Dependency string `db:"dependency"`
+	}
+	query = `
+		SELECT workflow_step_id, dependency FROM code_analysis.workflow_step_dependencies
+		WHERE workflow_step_id = ANY($1::uuid[])
+		ORDER BY position
+	`
+	if err := r.DB.Select(&deps, query, pq.Array(ids)); err != nil {
+		r.log().WithField("error", err).Error("Failed to list workflow step dependencies")
+		return nil, err
+	}
+	for _, dep := range deps {
+		step := byID[dep.StepID]
+		step.Dependencies = append(step.Dependencies, dep.Dependency)
+	}
+
+	var vars []struct {
+		StepID  string `db:"workflow_step_id"`
+		Name    string `db:"variable_name"`
+		IsInput bool   `db:"is_input"`
+	}
+	query = `
+		SELECT workflow_step_id, variable_name, is_input FROM code_analysis.workflow_step_variables
+		WHERE workflow_step_id = ANY($1::uuid[])
+		ORDER BY position
+	`
+	if err := r.DB.Select(&vars, query, pq.Array(ids)); err != nil {
+		r.log().WithField("error", err).Error("Failed to list workflow step variables")
+		return nil, err
+	}
+	for _, v := range vars {
+		step := byID[v.StepID]
+		if v.IsInput {
+			step.InputVars = append(step.InputVars, v.Name)
+		} else {
+			step.OutputVars = append(step.OutputVars, v.Name)
+		}
+	}
+
+	return steps, nil
+}
+
+// limit truncates text written by the analysis to the size of the column it is stored in
+func limit(s string, size int) string {
+	runes := []rune(s)
+	if len(runes) <= size {
+		return s
+	}
+	return string(runes[:size])
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"cred.com/hack25/backend/internal/models"
+	analyzerModels "cred.com/hack25/backend/pkg/goanalyzer/models"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
@@ -43,8 +44,8 @@ func (r *CodeAnalyzerRepository) CreateRepository(repo *models.Repository) error
 	r.log().WithField("url", repo.URL).Info("Creating repository in database")
 
 	query := `
-		INSERT INTO code_analyzer.repositories (kind, url, name, owner, local_path, index_status)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO code_analyzer.repositories (kind, url, name, owner, local_path, index_status, credential_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -56,6 +57,7 @@ func (r *CodeAnalyzerRepository) CreateRepository(repo *models.Repository) error
 		repo.Owner,
 		repo.LocalPath,
 		repo.IndexStatus,
+		repo.CredentialID,
 	).Scan(&repo.ID, &repo.CreatedAt, &repo.UpdatedAt)
 
 	if err != nil {
@@ -99,7 +101,7 @@ func (r *CodeAnalyzerRepository) GetRepositoryByURL(url string) (*models.Reposit
 
 	var repo models.Repository
 	query := `
-		SELECT id, kind, url, name, owner, local_path, last_indexed, index_status, index_error, created_at, updated_at
+		SELECT id, kind, url, name, owner, local_path, last_indexed, index_status, index_error, credential_id, created_at, updated_at
 		FROM code_analyzer.repositories
 		WHERE url = $1
 	`
@@ -126,7 +128,7 @@ func (r *CodeAnalyzerRepository) GetRepositoryByID(id int64) (*models.Repository
 
 	var repo models.Repository
 	query := `
-		SELECT id, kind, url, name, owner, local_path, last_indexed, index_status, index_error, created_at, updated_at
+		SELECT id, kind, url, name, owner, local_path, last_indexed, index_status, index_error, credential_id, created_at, updated_at
 		FROM code_analyzer.repositories
 		WHERE id = $1
 	`
@@ -155,18 +157,20 @@ func (r *CodeAnalyzerRepository) CreateRepositoryFile(file *models.RepositoryFil
 	})).Debug("Creating repository file")
 
 	query := `
-		INSERT INTO code_analyzer.repository_files (repository_id, file_path, package, last_analyzed)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (repository_id, file_path) 
-		DO UPDATE SET package = $3, last_analyzed = $4, updated_at = NOW()
+		INSERT INTO code_analyzer.repository_files (repository_id, snapshot_id, file_path, package, package_path, last_analyzed)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (snapshot_id, file_path) 
+		DO UPDATE SET package = $4, package_path = $5, last_analyzed = $6, updated_at = NOW()
 		RETURNING id, created_at, updated_at
 	`
 
 	err := r.DB.QueryRow(
 		query,
 		file.RepositoryID,
+		file.SnapshotID,
 		file.FilePath,
 		file.Package,
+		file.PackagePath,
 		file.LastAnalyzed,
 	).Scan(&file.ID, &file.CreatedAt, &file.UpdatedAt)
 
@@ -180,15 +184,15 @@ func (r *CodeAnalyzerRepository) CreateRepositoryFile(file *models.RepositoryFil
 	return err
 }
 
-// GetRepositoryFiles gets all files for a repository
+// GetRepositoryFiles gets all files of the default snapshot of a repository
 func (r *CodeAnalyzerRepository) GetRepositoryFiles(repoID int64) ([]models.RepositoryFile, error) {
 	r.log().WithField("repo_id", repoID).Debug("Getting all files for repository")
 
 	var files []models.RepositoryFile
 	query := `
-		SELECT id, repository_id, file_path, package, last_analyzed, created_at, updated_at
+		SELECT id, repository_id, snapshot_id, file_path, package, package_path, last_analyzed, created_at, updated_at
 		FROM code_analyzer.repository_files
-		WHERE repository_id = $1
+		WHERE repository_id = $1 AND snapshot_id = ` + defaultSnapshotQuery + `
 		ORDER BY file_path
 	`
 
@@ -208,7 +212,7 @@ func (r *CodeAnalyzerRepository) GetRepositoryFiles(repoID int64) ([]models.Repo
 	return files, nil
 }
 
-// GetRepositoryFileByPath gets a specific file by path
+// GetRepositoryFileByPath gets a specific file of the default snapshot of a repository by path
 func (r *CodeAnalyzerRepository) GetRepositoryFileByPath(repoID int64, filePath string) (*models.RepositoryFile, error) {
 	r.log().WithFields(fieldsToLogrus(logger.Fields{
 		"repo_id":   repoID,
@@ -217,9 +221,9 @@ func (r *CodeAnalyzerRepository) GetRepositoryFileByPath(repoID int64, filePath
 
 	var file models.RepositoryFile
 	query := `
-		SELECT id, repository_id, file_path, package, last_analyzed, created_at, updated_at
+		SELECT id, repository_id, snapshot_id, file_path, package, package_path, last_analyzed, created_at, updated_at
 		FROM code_analyzer.repository_files
-		WHERE repository_id = $1 AND file_path = $2
+		WHERE repository_id = $1 AND snapshot_id = ` + defaultSnapshotQuery + ` AND file_path = $2
 	`
 
 	err := r.DB.Get(&file, query, repoID, filePath)
@@ -251,7 +255,7 @@ func (r *CodeAnalyzerRepository) GetRepositoryFileByID(repoID int64, fileID int6
 
 	var file models.RepositoryFile
 	query := `
-		SELECT id, repository_id, file_path, package, last_analyzed, created_at, updated_at
+		SELECT id, repository_id, snapshot_id, file_path, package, package_path, last_analyzed, created_at, updated_at
 		FROM code_analyzer.repository_files
 		WHERE repository_id = $1 AND id = $2
 	`
@@ -290,13 +294,14 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctions(functions []models.Reposit
 	// Prepare the function insert statement
 	fnStmt, err := tx.Prepare(`
 		INSERT INTO code_analyzer.repository_functions (
-			repository_id, file_id, name, kind, receiver, exported, parameters, results, code_block, line
+			repository_id, snapshot_id, file_id, name, kind, receiver, exported, parameters, results, code_block, line, body_hash
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		VALUES ($1, (SELECT snapshot_id FROM code_analyzer.repository_files WHERE id = $2),
+			$2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		ON CONFLICT (repository_id, file_id, name, line) 
 		DO UPDATE SET 
 			kind = $4, receiver = $5, exported = $6, parameters = $7, results = $8, code_block = $9,
-			updated_at = NOW()
+			body_hash = $11, updated_at = NOW()
 		RETURNING id
 	`)
 	if err != nil {
@@ -332,6 +337,7 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctions(functions []models.Reposit
 			resultsJSON,
 			fn.CodeBlock,
 			fn.Line,
+			fn.BodyHash,
 		).Scan(&functionID)
 		if err != nil {
 			r.log().WithFields(fieldsToLogrus(logger.Fields{
@@ -356,6 +362,12 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctions(functions []models.Reposit
 				calleePackage, _ := call["package"].(string)
 				line, _ := call["line"].(float64)
 
+				// Calls of syntax-only analysis carry no kind and are recorded as static
+				callKind, _ := call["call_kind"].(string)
+				if callKind == "" {
+					callKind = analyzerModels.CallKindStatic
+				}
+
 				var paramsJSON []byte
 				if params, ok := call["parameters"]; ok {
 					paramsJSON, _ = json.Marshal(params)
@@ -363,11 +375,11 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctions(functions []models.Reposit
 
 				_, err = tx.Exec(`
 					INSERT INTO code_analyzer.function_calls (
-						caller_id, callee_name, callee_package, line, parameters
+						caller_id, callee_name, callee_package, line, parameters, call_kind
 					)
-					VALUES ($1, $2, $3, $4, $5)
-					ON CONFLICT (caller_id, callee_name, line) DO NOTHING
-				`, functionID, calleeName, calleePackage, int(line), paramsJSON)
+					VALUES ($1, $2, $3, $4, $5, $6)
+					ON CONFLICT (caller_id, callee_package, callee_name, line) DO NOTHING
+				`, functionID, calleeName, calleePackage, int(line), paramsJSON, callKind)
 
 				if err != nil {
 					r.log().WithFields(fieldsToLogrus(logger.Fields{
@@ -413,63 +425,6 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctions(functions []models.Reposit
 				}
 			}
 		}
-
-		r.log().WithFields(fieldsToLogrus(logger.Fields{
-			"function_id":    functionID,
-			"statement_info": fn.StatementInfo,
-			"statements":     fn.Statements,
-		})).Info("Processing function statements")
-
-		// Process function statements if available
-		// recursively process statements and their children
-		var processStatements func(statements []models.FunctionStatement, parentID *int64) error
-		processStatements = func(statements []models.FunctionStatement, parentID *int64) error {
-			for _, stmt := range statements {
-				// Set the parent ID if provided
-				stmt.ParentStatementID = parentID
-
-				r.log().WithFields(fieldsToLogrus(logger.Fields{
-					"function_id": functionID,
-					"stmt_type":   stmt.StatementType,
-					"line":        stmt.Line,
-					"parent_id":   parentID,
-					"text":        stmt.Text,
-				})).Info("Inserting function statement")
-
-				// Insert the statement
-				var newID int64
-				err = tx.QueryRow(`
-            INSERT INTO code_analyzer.function_statements (
-                function_id, statement_type, text, line, conditions, variables, calls, parent_statement_id
-            )
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-            RETURNING id
-        `, functionID, stmt.StatementType, stmt.Text, stmt.Line, stmt.Conditions, stmt.Variables, stmt.Calls, stmt.ParentStatementID).Scan(&newID)
-
-				if err != nil {
-					r.log().WithFields(fieldsToLogrus(logger.Fields{
-						"stmt_type": stmt.StatementType,
-						"line":      stmt.Line,
-						"error":     err,
-					})).Error("Failed to insert function statement")
-					continue // Continue with other statements
-				}
-
-				// Process children if any
-				if len(stmt.Children) > 0 {
-					if err := processStatements(stmt.Children, &newID); err != nil {
-						return err
-					}
-				}
-
-			}
-			return nil
-		}
-
-		// Start processing from root statements
-		if err := processStatements(fn.Statements, nil); err != nil {
-			r.log().WithField("error", err).Error("Failed to process function statements")
-		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -495,9 +450,10 @@ func (r *CodeAnalyzerRepository) BatchCreateSymbols(symbols []models.RepositoryS
 	// Prepare the symbol insert statement
 	symStmt, err := tx.Prepare(`
 		INSERT INTO code_analyzer.repository_symbols (
-			repository_id, file_id, name, kind, type, value, exported, fields, methods, line
+			repository_id, snapshot_id, file_id, name, kind, type, value, exported, fields, methods, line
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		VALUES ($1, (SELECT snapshot_id FROM code_analyzer.repository_files WHERE id = $2),
+			$2, $3, $4, $5, $6, $7, $8, $9, $10)
 		ON CONFLICT (repository_id, file_id, name, line) 
 		DO UPDATE SET 
 			kind = $4, type = $5, value = $6, exported = $7, fields = $8, methods = $9,
@@ -591,7 +547,8 @@ func (r *CodeAnalyzerRepository) BatchCreateSymbols(symbols []models.RepositoryS
 	return nil
 }
 
-// GetRepositoryFunctions gets functions for a repository or specific file
+// GetRepositoryFunctions gets functions for a specific file, or for the default snapshot of a
+// repository when no file is given
 func (r *CodeAnalyzerRepository) GetRepositoryFunctions(repoID int64, fileID int64) ([]models.RepositoryFunction, error) {
 	r.log().WithFields(fieldsToLogrus(logger.Fields{
 		"repo_id": repoID,
@@ -604,8 +561,8 @@ func (r *CodeAnalyzerRepository) GetRepositoryFunctions(repoID int64, fileID int
 
 	if fileID > 0 {
 		query = `
-			SELECT id, repository_id, file_id, name, kind, receiver, exported, 
-				parameters, results, code_block, line, created_at, updated_at
+			SELECT id, repository_id, snapshot_id, file_id, name, kind, receiver, exported, 
+				parameters, results, code_block, line, body_hash, created_at, updated_at
 			FROM code_analyzer.repository_functions
 			WHERE repository_id = $1 AND file_id = $2
 			ORDER BY line
@@ -613,10 +570,10 @@ func (r *CodeAnalyzerRepository) GetRepositoryFunctions(repoID int64, fileID int
 		args = []interface{}{repoID, fileID}
 	} else {
 		query = `
-			SELECT id, repository_id, file_id, name, kind, receiver, exported, 
-				parameters, results, code_block, line, created_at, updated_at
+			SELECT id, repository_id, snapshot_id, file_id, name, kind, receiver, exported, 
+				parameters, results, code_block, line, body_hash, created_at, updated_at
 			FROM code_analyzer.repository_functions
-			WHERE repository_id = $1
+			WHERE repository_id = $1 AND snapshot_id = ` + defaultSnapshotQuery + `
 			ORDER BY file_id, line
 		`
 		args = []interface{}{repoID}
@@ -637,7 +594,7 @@ func (r *CodeAnalyzerRepository) GetRepositoryFunctions(repoID int64, fileID int
 		// Load calls
 		var calls []models.FunctionCall
 		callsQuery := `
-			SELECT id, caller_id, callee_name, callee_package, callee_id, line, parameters, created_at, updated_at
+			SELECT id, caller_id, callee_name, callee_package, callee_id, call_kind, confidence, external_kind, line, parameters, created_at, updated_at
 			FROM code_analyzer.function_calls
 			WHERE caller_id = $1
 			ORDER BY line
@@ -701,7 +658,8 @@ func (r *CodeAnalyzerRepository) GetRepositoryFunctions(repoID int64, fileID int
 	return functions, nil
 }
 
-// GetRepositorySymbols gets symbols for a repository or specific file
+// GetRepositorySymbols gets symbols for a specific file, or for the default snapshot of a
+// repository when no file is given
 func (r *CodeAnalyzerRepository) GetRepositorySymbols(repoID int64, fileID int64) ([]models.RepositorySymbol, error) {
 	r.log().WithFields(fieldsToLogrus(logger.Fields{
 		"repo_id": repoID,
@@ -714,7 +672,7 @@ func (r *CodeAnalyzerRepository) GetRepositorySymbols(repoID int64, fileID int64
 
 	if fileID > 0 {
 		query = `
-			SELECT id, repository_id, file_id, name, kind, type, value, exported, 
+			SELECT id, repository_id, snapshot_id, file_id, name, kind, type, value, exported, 
 				fields, methods, line, created_at, updated_at
 			FROM code_analyzer.repository_symbols
 			WHERE repository_id = $1 AND file_id = $2
@@ -723,10 +681,10 @@ func (r *CodeAnalyzerRepository) GetRepositorySymbols(repoID int64, fileID int64
 		args = []interface{}{repoID, fileID}
 	} else {
 		query = `
-			SELECT id, repository_id, file_id, name, kind, type, value, exported, 
+			SELECT id, repository_id, snapshot_id, file_id, name, kind, type, value, exported, 
 				fields, methods, line, created_at, updated_at
 			FROM code_analyzer.repository_symbols
-			WHERE repository_id = $1
+			WHERE repository_id = $1 AND snapshot_id = ` + defaultSnapshotQuery + `
 			ORDER BY file_id, line
 		`
 		args = []interface{}{repoID}
@@ -746,7 +704,7 @@ func (r *CodeAnalyzerRepository) GetRepositorySymbols(repoID int64, fileID int64
 	for i := range symbols {
 		var refs []models.SymbolReference
 		refsQuery := `
-			SELECT id, symbol_id, reference_type, file_id, line, column_position, context, created_at, updated_at
+			SELECT id, symbol_id, member, reference_type, file_id, line, column_position, context, created_at, updated_at
 			FROM code_analyzer.symbol_references
 			WHERE symbol_id = $1
 			ORDER BY line, column_position
@@ -777,7 +735,7 @@ func (r *CodeAnalyzerRepository) GetFunctionCalls(functionID int64) ([]models.Fu
 
 	var calls []models.FunctionCall
 	query := `
-		SELECT id, caller_id, callee_name, callee_package, callee_id, line, parameters, created_at, updated_at
+		SELECT id, caller_id, callee_name, callee_package, callee_id, call_kind, confidence, external_kind, line, parameters, created_at, updated_at
 		FROM code_analyzer.function_calls
 		WHERE caller_id = $1
 		ORDER BY line
@@ -795,6 +753,33 @@ func (r *CodeAnalyzerRepository) GetFunctionCalls(functionID int64) ([]models.Fu
 	return calls, nil
 }
 
+// GetRepositoryFunctionCalls gets the calls made by all functions of the default snapshot of a
+// repository
+func (r *CodeAnalyzerRepository) GetRepositoryFunctionCalls(repoID int64) ([]models.FunctionCall, error) {
+	r.log().WithField("repo_id", repoID).Debug("Getting repository function calls")
+
+	var calls []models.FunctionCall
+	query := `
+		SELECT c.id, c.caller_id, c.callee_name, c.callee_package, c.callee_id, c.call_kind, c.confidence, c.external_kind,
+			c.line, c.parameters, c.created_at, c.updated_at
+		FROM code_analyzer.function_calls c
+		JOIN code_analyzer.repository_functions fn ON fn.id = c.caller_id
+		WHERE fn.repository_id = $1 AND fn.snapshot_id = ` + defaultSnapshotQuery + `
+		ORDER BY c.caller_id, c.line
+	`
+
+	err := r.DB.Select(&calls, query, repoID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_id": repoID,
+			"error":   err,
+		})).Error("Failed to get repository function calls")
+		return nil, err
+	}
+
+	return calls, nil
+}
+
 // GetFunctionReferences gets all references to a function
 func (r *CodeAnalyzerRepository) GetFunctionReferences(functionID int64) ([]models.FunctionReference, error) {
 	r.log().WithField("function_id", functionID).Debug("Getting function references")
@@ -829,7 +814,7 @@ func (r *CodeAnalyzerRepository) GetFunctionStatements(functionID int64) ([]mode
 			   parent_statement_id, created_at, updated_at
 		FROM code_analyzer.function_statements
 		WHERE function_id = $1
-		ORDER BY line
+		ORDER BY line, id
 	`
 
 	err := r.DB.Select(&stmts, query, functionID)
@@ -850,7 +835,7 @@ func (r *CodeAnalyzerRepository) GetSymbolReferences(symbolID int64) ([]models.S
 
 	var refs []models.SymbolReference
 	query := `
-		SELECT id, symbol_id, reference_type, file_id, line, column_position, context, created_at, updated_at
+		SELECT id, symbol_id, member, reference_type, file_id, line, column_position, context, created_at, updated_at
 		FROM code_analyzer.symbol_references
 		WHERE symbol_id = $1
 		ORDER BY line, column_position
@@ -921,7 +906,9 @@ func (r *CodeAnalyzerRepository) AddFunctionStatement(stmt *models.FunctionState
 	return err
 }
 
-// BatchCreateFunctionStatements adds multiple function statements in a transaction
+// BatchCreateFunctionStatements adds multiple function statements in a transaction. Statements
+// are listed parents first: those without a parent ID are linked to the statement at their
+// ParentIndex once it is stored.
 func (r *CodeAnalyzerRepository) BatchCreateFunctionStatements(statements []models.FunctionStatement) error {
 	if len(statements) == 0 {
 		return nil
@@ -933,45 +920,34 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctionStatements(statements []mode
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
+	stmt, err := tx.Preparex(`
+		INSERT INTO code_analyzer.function_statements (
+			function_id, statement_type, text, line, conditions, variables, calls, parent_statement_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to prepare function statement insert")
+		return err
+	}
+	defer stmt.Close()
 
 	for i := range statements {
-		conditionsJSON, err := json.Marshal(statements[i].Conditions)
-		if err != nil {
-			return err
+		if parent := statements[i].ParentIndex; statements[i].ParentStatementID == nil && parent >= 0 && parent < i {
+			statements[i].ParentStatementID = &statements[parent].ID
 		}
 
-		variablesJSON, err := json.Marshal(statements[i].Variables)
-		if err != nil {
-			return err
-		}
-
-		callsJSON, err := json.Marshal(statements[i].Calls)
-		if err != nil {
-			return err
-		}
-
-		query := `
-			INSERT INTO code_analyzer.function_statements (
-				function_id, statement_type, text, line, conditions, variables, calls, parent_statement_id
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id, created_at, updated_at
-		`
-
-		err = tx.QueryRow(
-			query,
+		// Conditions, variables and calls are already JSON
+		err = stmt.QueryRow(
 			statements[i].FunctionID,
 			statements[i].StatementType,
 			statements[i].Text,
 			statements[i].Line,
-			conditionsJSON,
-			variablesJSON,
-			callsJSON,
+			jsonOrNull(statements[i].Conditions),
+			jsonOrNull(statements[i].Variables),
+			jsonOrNull(statements[i].Calls),
 			statements[i].ParentStatementID,
 		).Scan(&statements[i].ID, &statements[i].CreatedAt, &statements[i].UpdatedAt)
 
@@ -988,6 +964,14 @@ func (r *CodeAnalyzerRepository) BatchCreateFunctionStatements(statements []mode
 	return tx.Commit()
 }
 
+// jsonOrNull passes a JSON column as is, or as NULL when empty
+func jsonOrNull(data string) interface{} {
+	if data == "" {
+		return nil
+	}
+	return data
+}
+
 // AddFunctionCall adds a new function call to the database
 func (r *CodeAnalyzerRepository) AddFunctionCall(call *models.FunctionCall) error {
 	r.log().WithFields(fieldsToLogrus(logger.Fields{
@@ -1004,10 +988,10 @@ func (r *CodeAnalyzerRepository) AddFunctionCall(call *models.FunctionCall) erro
 
 	query := `
 		INSERT INTO code_analyzer.function_calls (
-			caller_id, callee_name, callee_package, callee_id, line, parameters
-		) VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (caller_id, callee_name, line) DO UPDATE
-		SET callee_package = $3, callee_id = $4, parameters = $6, updated_at = NOW()
+			caller_id, callee_name, callee_package, callee_id, line, parameters, call_kind
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (caller_id, callee_package, callee_name, line) DO UPDATE
+		SET callee_id = $4, parameters = $6, call_kind = $7, updated_at = NOW()
 		RETURNING id, created_at, updated_at
 	`
 
@@ -1019,6 +1003,7 @@ func (r *CodeAnalyzerRepository) AddFunctionCall(call *models.FunctionCall) erro
 		call.CalleeID,
 		call.Line,
 		paramsJSON,
+		call.CallKind,
 	).Scan(&call.ID, &call.CreatedAt, &call.UpdatedAt)
 
 	if err != nil {
@@ -1174,10 +1159,10 @@ func (r *CodeAnalyzerRepository) AddSymbolReference(ref *models.SymbolReference)
 
 	query := `
 		INSERT INTO code_analyzer.symbol_references (
-			symbol_id, reference_type, file_id, line, column_position, context
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			symbol_id, reference_type, file_id, line, column_position, context, member
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (symbol_id, file_id, line, column_position) DO UPDATE
-		SET reference_type = $2, context = $6, updated_at = NOW()
+		SET reference_type = $2, context = $6, member = $7, updated_at = NOW()
 		RETURNING id, created_at, updated_at
 	`
 
@@ -1189,6 +1174,7 @@ func (r *CodeAnalyzerRepository) AddSymbolReference(ref *models.SymbolReference)
 		ref.Line,
 		ref.ColumnPosition,
 		ref.Context,
+		ref.Member,
 	).Scan(&ref.ID, &ref.CreatedAt, &ref.UpdatedAt)
 
 	if err != nil {
@@ -1224,10 +1210,10 @@ func (r *CodeAnalyzerRepository) BatchAddSymbolReferences(refs []models.SymbolRe
 	for i := range refs {
 		query := `
 			INSERT INTO code_analyzer.symbol_references (
-				symbol_id, reference_type, file_id, line, column_position, context
-			) VALUES ($1, $2, $3, $4, $5, $6)
+				symbol_id, reference_type, file_id, line, column_position, context, member
+			) VALUES ($1, $2, $3, $4, $5, $6, $7)
 			ON CONFLICT (symbol_id, file_id, line, column_position) DO UPDATE
-			SET reference_type = $2, context = $6, updated_at = NOW()
+			SET reference_type = $2, context = $6, member = $7, updated_at = NOW()
 			RETURNING id, created_at, updated_at
 		`
 
@@ -1239,6 +1225,7 @@ func (r *CodeAnalyzerRepository) BatchAddSymbolReferences(refs []models.SymbolRe
 			refs[i].Line,
 			refs[i].ColumnPosition,
 			refs[i].Context,
+			refs[i].Member,
 		).Scan(&refs[i].ID, &refs[i].CreatedAt, &refs[i].UpdatedAt)
 
 		if err != nil {
@@ -1265,33 +1252,10 @@ func (r *CodeAnalyzerRepository) GetNestedFunctionStatements(functionID int64) (
 		return nil, err
 	}
 
-	// Build a map for quick lookup by ID
-	stmtMap := make(map[int64]*models.FunctionStatement, len(stmts))
-	for i := range stmts {
-		stmtMap[stmts[i].ID] = &stmts[i]
-		// Initialize children slice
-		stmts[i].Children = []models.FunctionStatement{}
-	}
-
-	// Create the hierarchy
-	rootStmts := []models.FunctionStatement{}
-	for i := range stmts {
-		if stmts[i].ParentStatementID == nil {
-			// This is a root statement
-			rootStmts = append(rootStmts, stmts[i])
-		} else {
-			// This is a child statement
-			parent, exists := stmtMap[*stmts[i].ParentStatementID]
-			if exists {
-				parent.Children = append(parent.Children, stmts[i])
-			}
-		}
-	}
-
-	return rootStmts, nil
+	return models.NestStatements(stmts), nil
 }
 
-// GetFunctionByRepoAndName gets a function by repository ID and function name
+// GetFunctionByRepoAndName gets a function of the default snapshot of a repository by name
 func (r *CodeAnalyzerRepository) GetFunctionByRepoAndName(repoID int64, name string) (*models.RepositoryFunction, error) {
 	r.log().WithFields(fieldsToLogrus(logger.Fields{
 		"repo_id": repoID,
@@ -1300,10 +1264,10 @@ func (r *CodeAnalyzerRepository) GetFunctionByRepoAndName(repoID int64, name str
 
 	var fn models.RepositoryFunction
 	query := `
-		SELECT id, repository_id, file_id, name, kind, receiver, exported, parameters, results, 
+		SELECT id, repository_id, snapshot_id, file_id, name, kind, receiver, exported, parameters, results, 
 		       code_block, line, created_at, updated_at
 		FROM code_analyzer.repository_functions
-		WHERE repository_id = $1 AND name = $2
+		WHERE repository_id = $1 AND snapshot_id = ` + defaultSnapshotQuery + ` AND name = $2
 		LIMIT 1
 	`
 
@@ -1327,7 +1291,33 @@ func (r *CodeAnalyzerRepository) GetFunctionByRepoAndName(repoID int64, name str
 	return &fn, nil
 }
 
-// GetSymbolByRepoAndName gets a symbol by repository ID and symbol name
+// GetFunctionByID gets a function by its ID, whichever snapshot it is in
+func (r *CodeAnalyzerRepository) GetFunctionByID(id int64) (*models.RepositoryFunction, error) {
+	r.log().WithField("function_id", id).Debug("Getting function by ID")
+
+	var fn models.RepositoryFunction
+	query := `
+		SELECT id, repository_id, snapshot_id, file_id, name, kind, receiver, exported, parameters, results,
+		       code_block, line, body_hash, created_at, updated_at
+		FROM code_analyzer.repository_functions
+		WHERE id = $1
+	`
+
+	if err := r.DB.Get(&fn, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Function not found
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"function_id": id,
+			"error":       err,
+		})).Error("Error getting function by ID")
+		return nil, err
+	}
+
+	return &fn, nil
+}
+
+// GetSymbolByRepoAndName gets a symbol of the default snapshot of a repository by name
 func (r *CodeAnalyzerRepository) GetSymbolByRepoAndName(repoID int64, name string) (*models.RepositorySymbol, error) {
 	r.log().WithFields(fieldsToLogrus(logger.Fields{
 		"repo_id": repoID,
@@ -1336,10 +1326,10 @@ func (r *CodeAnalyzerRepository) GetSymbolByRepoAndName(repoID int64, name strin
 
 	var symbol models.RepositorySymbol
 	query := `
-		SELECT id, repository_id, file_id, name, kind, type, value, exported, fields, methods,
+		SELECT id, repository_id, snapshot_id, file_id, name, kind, type, value, exported, fields, methods,
 		       line, created_at, updated_at
 		FROM code_analyzer.repository_symbols
-		WHERE repository_id = $1 AND name = $2
+		WHERE repository_id = $1 AND snapshot_id = ` + defaultSnapshotQuery + ` AND name = $2
 		LIMIT 1
 	`
 
@@ -1363,6 +1353,36 @@ func (r *CodeAnalyzerRepository) GetSymbolByRepoAndName(repoID int64, name strin
 	return &symbol, nil
 }
 
+// GetFunctionFileID gets the ID of the file declaring a function, whichever snapshot it is
+// in, or 0 if there is no such function
+func (r *CodeAnalyzerRepository) GetFunctionFileID(functionID int64) (int64, error) {
+	var fileID int64
+	err := r.DB.Get(&fileID, `SELECT file_id FROM code_analyzer.repository_functions WHERE id = $1`, functionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"function_id": functionID,
+			"error":       err,
+		})).Error("Error getting function file")
+		return 0, err
+	}
+	return fileID, nil
+}
+
+// GetSymbolFileID gets the ID of the file declaring a symbol, whichever snapshot it is in,
+// or 0 if there is no such symbol
+func (r *CodeAnalyzerRepository) GetSymbolFileID(symbolID int64) (int64, error) {
+	var fileID int64
+	err := r.DB.Get(&fileID, `SELECT file_id FROM code_analyzer.repository_symbols WHERE id = $1`, symbolID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"symbol_id": symbolID,
+			"error":     err,
+		})).Error("Error getting symbol file")
+		return 0, err
+	}
+	return fileID, nil
+}
+
 // RemoveRepositoryData removes all data for a repository
 func (r *CodeAnalyzerRepository) RemoveRepositoryData(repoID int64) error {
 	r.log().WithField("repo_id", repoID).Info("Removing all data for repository")
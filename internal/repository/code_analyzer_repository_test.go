@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/database"
+	"cred.com/hack25/backend/pkg/logger"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestDB connects to the database of TEST_DB_URL and migrates its schema, skipping the
+// test when it is not set
+func setupTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dbConnectionString := os.Getenv("TEST_DB_URL")
+	if dbConnectionString == "" {
+		t.Skip("Skipping test: TEST_DB_URL not set")
+	}
+	logger.Init(logrus.InfoLevel, "repository-test")
+
+	conn, err := sql.Open("postgres", dbConnectionString)
+	require.NoError(t, err, "Failed to connect to test database")
+	t.Cleanup(func() { conn.Close() })
+
+	db := &database.DB{Conn: conn}
+	require.NoError(t, db.Migrate(context.Background()), "Failed to migrate test database")
+	return conn
+}
+
+// createTestFile creates a repository with a snapshot and a file in it, removed when the test ends
+func createTestFile(t *testing.T, repo *CodeAnalyzerRepository) *models.RepositoryFile {
+	t.Helper()
+
+	name := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	repository := &models.Repository{Kind: "local", URL: "/tmp/" + name, Name: name, IndexStatus: "completed"}
+	require.NoError(t, repo.CreateRepository(repository))
+	t.Cleanup(func() {
+		repo.DB.Exec(`DELETE FROM code_analyzer.repositories WHERE id = $1`, repository.ID)
+	})
+
+	snapshot := &models.RepositorySnapshot{RepositoryID: repository.ID, CommitSHA: "", IndexStatus: "completed"}
+	require.NoError(t, repo.CreateSnapshot(snapshot))
+
+	file := &models.RepositoryFile{
+		RepositoryID: repository.ID,
+		SnapshotID:   snapshot.ID,
+		FilePath:     "main.go",
+		Package:      "main",
+		PackagePath:  "example.com/app",
+		LastAnalyzed: time.Now(),
+	}
+	require.NoError(t, repo.CreateRepositoryFile(file))
+	return file
+}
+
+func TestBatchCreateFunctionsCallKind(t *testing.T) {
+	repo := NewCodeAnalyzerRepository(setupTestDB(t))
+	file := createTestFile(t, repo)
+
+	functions := []models.RepositoryFunction{{
+		RepositoryID: file.RepositoryID,
+		FileID:       file.ID,
+		Name:         "run",
+		Kind:         "function",
+		Line:         3,
+		Calls: `[
+			{"callee": "Get", "package": "example.com/app/svc", "line": 4, "parameters": ["id"], "call_kind": "dynamic"},
+			{"callee": "Println", "package": "fmt", "line": 5, "parameters": []}
+		]`,
+	}}
+	require.NoError(t, repo.BatchCreateFunctions(functions))
+
+	calls, err := repo.GetFunctionCalls(functions[0].ID)
+	require.NoError(t, err)
+	require.Len(t, calls, 2)
+	assert.Equal(t, "Get", calls[0].CalleeName)
+	assert.Equal(t, "dynamic", calls[0].CallKind)
+	assert.Equal(t, "Println", calls[1].CalleeName)
+	assert.Equal(t, "static", calls[1].CallKind, "calls without a kind are static")
+}
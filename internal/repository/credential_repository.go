@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// credentialColumns are the columns selected for a credential
+const credentialColumns = `id, owner_type, owner_id, name, kind, host, username, encrypted_secret, created_by,
+	last_used_at, created_at, updated_at`
+
+// CreateCredential stores a credential, its secret already encrypted
+func (r *CodeAnalyzerRepository) CreateCredential(credential *models.RepositoryCredential) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"owner_type": credential.OwnerType,
+		"owner_id":   credential.OwnerID,
+		"name":       credential.Name,
+		"kind":       credential.Kind,
+	})).Info("Creating repository credential")
+
+	query := `
+		INSERT INTO code_analyzer.repository_credentials
+			(owner_type, owner_id, name, kind, host, username, encrypted_secret, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.DB.QueryRow(query, credential.OwnerType, credential.OwnerID, credential.Name, credential.Kind,
+		credential.Host, credential.Username, credential.EncryptedSecret, credential.CreatedBy,
+	).Scan(&credential.ID, &credential.CreatedAt, &credential.UpdatedAt)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to create repository credential")
+	}
+	return err
+}
+
+// GetCredential gets a credential by its ID
+func (r *CodeAnalyzerRepository) GetCredential(id int64) (*models.RepositoryCredential, error) {
+	r.log().WithField("id", id).Debug("Getting repository credential")
+
+	var credential models.RepositoryCredential
+	query := `SELECT ` + credentialColumns + ` FROM code_analyzer.repository_credentials WHERE id = $1`
+	if err := r.DB.Get(&credential, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Credential not found
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to get repository credential")
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// ListCredentials lists the credentials of a user along with those of the organizations
+// they are a member of
+func (r *CodeAnalyzerRepository) ListCredentials(userID string) ([]models.RepositoryCredential, error) {
+	r.log().WithField("user_id", userID).Debug("Listing repository credentials")
+
+	var credentials []models.RepositoryCredential
+	query := `
+		SELECT ` + credentialColumns + `
+		FROM code_analyzer.repository_credentials
+		WHERE (owner_type = 'user' AND owner_id = $1)
+			OR (owner_type = 'organization' AND owner_id IN (
+				SELECT organization FROM code_analyzer.organization_members WHERE user_id = $1
+			))
+		ORDER BY owner_type DESC, owner_id, name
+	`
+	if err := r.DB.Select(&credentials, query, userID); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"user_id": userID,
+			"error":   err,
+		})).Error("Failed to list repository credentials")
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// DeleteCredential deletes a credential; repositories fetched with it are left without one
+func (r *CodeAnalyzerRepository) DeleteCredential(id int64) error {
+	r.log().WithField("id", id).Info("Deleting repository credential")
+
+	_, err := r.DB.Exec(`DELETE FROM code_analyzer.repository_credentials WHERE id = $1`, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to delete repository credential")
+	}
+	return err
+}
+
+// TouchCredential records that a credential was used to fetch a repository
+func (r *CodeAnalyzerRepository) TouchCredential(id int64) error {
+	_, err := r.DB.Exec(`UPDATE code_analyzer.repository_credentials SET last_used_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to record repository credential use")
+	}
+	return err
+}
+
+// SetRepositoryCredential sets the credential a repository is fetched with
+func (r *CodeAnalyzerRepository) SetRepositoryCredential(repoID int64, credentialID *int64) error {
+	r.log().WithField("repo_id", repoID).Info("Setting repository credential")
+
+	query := `UPDATE code_analyzer.repositories SET credential_id = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.DB.Exec(query, credentialID, repoID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_id": repoID,
+			"error":   err,
+		})).Error("Failed to set repository credential")
+	}
+	return err
+}
+
+// AddOrganizationMember makes a user a member of an organization, doing nothing if they are already
+func (r *CodeAnalyzerRepository) AddOrganizationMember(member *models.OrganizationMember) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"organization": member.Organization,
+		"user_id":      member.UserID,
+	})).Info("Adding organization member")
+
+	query := `
+		INSERT INTO code_analyzer.organization_members (organization, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (organization, user_id) DO UPDATE SET organization = EXCLUDED.organization
+		RETURNING created_at
+	`
+	err := r.DB.QueryRow(query, member.Organization, member.UserID).Scan(&member.CreatedAt)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to add organization member")
+	}
+	return err
+}
+
+// RemoveOrganizationMember removes a user from an organization
+func (r *CodeAnalyzerRepository) RemoveOrganizationMember(organization, userID string) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"organization": organization,
+		"user_id":      userID,
+	})).Info("Removing organization member")
+
+	query := `DELETE FROM code_analyzer.organization_members WHERE organization = $1 AND user_id = $2`
+	if _, err := r.DB.Exec(query, organization, userID); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"organization": organization,
+			"user_id":      userID,
+			"error":        err,
+		})).Error("Failed to remove organization member")
+		return err
+	}
+	return nil
+}
+
+// ListUserOrganizations lists the organizations a user is a member of
+func (r *CodeAnalyzerRepository) ListUserOrganizations(userID string) ([]string, error) {
+	var organizations []string
+	query := `SELECT organization FROM code_analyzer.organization_members WHERE user_id = $1 ORDER BY organization`
+	if err := r.DB.Select(&organizations, query, userID); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"user_id": userID,
+			"error":   err,
+		})).Error("Failed to list user organizations")
+		return nil, err
+	}
+	return organizations, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCredentialsOrganizationMembers(t *testing.T) {
+	repo := NewCodeAnalyzerRepository(setupTestDB(t))
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	organization, member, outsider := "acme-"+suffix, "member-"+suffix, "outsider-"+suffix
+	credential := &models.RepositoryCredential{
+		OwnerType:       models.CredentialOwnerOrganization,
+		OwnerID:         organization,
+		Name:            "ci",
+		Kind:            models.CredentialGitHubPAT,
+		Host:            "github.com",
+		EncryptedSecret: []byte("sealed"),
+		CreatedBy:       "admin",
+	}
+	require.NoError(t, repo.CreateCredential(credential))
+	t.Cleanup(func() {
+		repo.DeleteCredential(credential.ID)
+		repo.DB.Exec(`DELETE FROM code_analyzer.organization_members WHERE organization = $1`, organization)
+	})
+	require.NoError(t, repo.AddOrganizationMember(&models.OrganizationMember{Organization: organization, UserID: member}))
+
+	credentials, err := repo.ListCredentials(member)
+	require.NoError(t, err)
+	require.Len(t, credentials, 1)
+	assert.Equal(t, credential.ID, credentials[0].ID)
+
+	credentials, err = repo.ListCredentials(outsider)
+	require.NoError(t, err)
+	assert.Empty(t, credentials, "organization credentials are not listed to non-members")
+
+	organizations, err := repo.ListUserOrganizations(outsider)
+	require.NoError(t, err)
+	assert.False(t, credential.UsableBy(outsider, "user", organizations), "non-members cannot index with organization credentials")
+
+	require.NoError(t, repo.RemoveOrganizationMember(organization, member))
+	credentials, err = repo.ListCredentials(member)
+	require.NoError(t, err)
+	assert.Empty(t, credentials, "removed members no longer list organization credentials")
+}
@@ -133,3 +133,27 @@ func (r *CodeAnalyzerRepository) GetFileDependencies(repoID int64, fileID int64)
 
 	return deps, nil
 }
+
+// GetSnapshotFileDependencies gets the dependencies of every file of a snapshot
+func (r *CodeAnalyzerRepository) GetSnapshotFileDependencies(snapshotID int64) ([]models.FileDependency, error) {
+	r.log().WithField("snapshot_id", snapshotID).Debug("Getting snapshot file dependencies")
+
+	var deps []models.FileDependency
+	query := `
+		SELECT d.id, d.repository_id, d.file_id, d.import_path, d.alias, d.is_stdlib, d.created_at, d.updated_at
+		FROM code_analyzer.file_dependencies d
+		JOIN code_analyzer.repository_files f ON f.id = d.file_id
+		WHERE f.snapshot_id = $1
+	`
+
+	err := r.DB.Select(&deps, query, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"error":       err,
+		})).Error("Failed to get snapshot file dependencies")
+		return nil, err
+	}
+
+	return deps, nil
+}
@@ -0,0 +1,351 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/lib/pq"
+)
+
+// indexJobColumns are the columns selected for an index job
+const indexJobColumns = `id, repository_id, kind, model, ref, requested_by, credential_id, snapshot_id, status, phase, files_total, files_done, llm_calls, tokens_used, max_tokens, attempts,
+	cancel_requested, worker_id, error, created_at, started_at, finished_at, updated_at`
+
+// CreateIndexJob queues a new job for a repository, indexing it unless it is of another kind
+func (r *CodeAnalyzerRepository) CreateIndexJob(job *models.IndexJob) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_id": job.RepositoryID,
+		"kind":    job.Kind,
+		"ref":     job.Ref,
+	})).Info("Creating index job")
+
+	if job.Status == "" {
+		job.Status = models.JobStatusQueued
+	}
+	if job.Kind == "" {
+		job.Kind = models.JobKindIndex
+	}
+
+	query := `
+		INSERT INTO code_analyzer.index_jobs (repository_id, kind, model, max_tokens, ref, requested_by, credential_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.DB.QueryRow(query, job.RepositoryID, job.Kind, job.Model, job.MaxTokens, job.Ref, job.RequestedBy, job.CredentialID, job.Status).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_id": job.RepositoryID,
+			"error":   err,
+		})).Error("Failed to create index job")
+	}
+	return err
+}
+
+// GetIndexJob gets an index job by its ID
+func (r *CodeAnalyzerRepository) GetIndexJob(id int64) (*models.IndexJob, error) {
+	r.log().WithField("id", id).Debug("Getting index job")
+
+	var job models.IndexJob
+	query := `SELECT ` + indexJobColumns + ` FROM code_analyzer.index_jobs WHERE id = $1`
+
+	err := r.DB.Get(&job, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Job not found
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to get index job")
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetActiveIndexJob gets the queued or running job of a kind for a ref of a repository, if any
+func (r *CodeAnalyzerRepository) GetActiveIndexJob(repoID int64, kind, ref string) (*models.IndexJob, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_id": repoID,
+		"kind":    kind,
+		"ref":     ref,
+	})).Debug("Getting active index job")
+
+	var job models.IndexJob
+	query := `
+		SELECT ` + indexJobColumns + `
+		FROM code_analyzer.index_jobs
+		WHERE repository_id = $1 AND kind = $2 AND ref = $3 AND status IN ('queued', 'running')
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	err := r.DB.Get(&job, query, repoID, kind, ref)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No active job
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_id": repoID,
+			"error":   err,
+		})).Error("Failed to get active index job")
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// indexJobLock is the class of the advisory locks claims take on repositories
+const indexJobLock = `hashtext('code_analyzer.index_jobs')`
+
+// ClaimIndexJob marks the oldest queued job as running by a worker and returns it, or nil
+// when the queue is empty. Concurrent workers never claim the same job, and jobs wait while
+// another ref of their repository is being indexed, as refs at one commit share a snapshot:
+// a claim holds an advisory lock on the repository, and only checks for running jobs once it
+// has it, so that it sees the jobs claimed before it.
+func (r *CodeAnalyzerRepository) ClaimIndexJob(workerID string) (*models.IndexJob, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to begin transaction for index job claim")
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var repoIDs []int64
+	query := `
+		SELECT repository_id FROM code_analyzer.index_jobs
+		WHERE status = 'queued'
+		GROUP BY repository_id
+		ORDER BY MIN(created_at), MIN(id)
+	`
+	if err := tx.Select(&repoIDs, query); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"worker_id": workerID,
+			"error":     err,
+		})).Error("Failed to list queued index jobs")
+		return nil, err
+	}
+
+	claimQuery := `
+		UPDATE code_analyzer.index_jobs
+		SET status = 'running', worker_id = $1, attempts = attempts + 1, error = '',
+			started_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM code_analyzer.index_jobs j
+			WHERE repository_id = $2 AND status = 'queued' AND NOT EXISTS (
+				SELECT 1 FROM code_analyzer.index_jobs running
+				WHERE running.repository_id = j.repository_id AND running.status = 'running'
+			)
+			ORDER BY created_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + indexJobColumns
+
+	for _, repoID := range repoIDs {
+		// Repositories another worker is claiming a job of are skipped
+		var locked bool
+		if err := tx.Get(&locked, `SELECT pg_try_advisory_xact_lock(`+indexJobLock+`, $1::int)`, repoID); err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"repo_id": repoID,
+				"error":   err,
+			})).Error("Failed to lock repository for index job claim")
+			return nil, err
+		}
+		if !locked {
+			continue
+		}
+
+		var job models.IndexJob
+		err := tx.Get(&job, claimQuery, workerID, repoID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // Another ref of the repository is being indexed
+		}
+		if err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"worker_id": workerID,
+				"error":     err,
+			})).Error("Failed to claim index job")
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			r.log().WithField("error", err).Error("Failed to commit index job claim")
+			return nil, err
+		}
+
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":        job.ID,
+			"repo_id":   job.RepositoryID,
+			"worker_id": workerID,
+			"attempt":   job.Attempts,
+		})).Info("Claimed index job")
+		return &job, nil
+	}
+
+	return nil, nil // Queue is empty
+}
+
+// UpdateIndexJobProgress stores the progress of a running job and reports whether its
+// cancellation was requested
+func (r *CodeAnalyzerRepository) UpdateIndexJobProgress(job *models.IndexJob) (bool, error) {
+	query := `
+		UPDATE code_analyzer.index_jobs
+		SET phase = $1, files_total = $2, files_done = $3, llm_calls = $4, tokens_used = $5, snapshot_id = $6, updated_at = NOW()
+		WHERE id = $7
+		RETURNING cancel_requested
+	`
+
+	var cancelRequested bool
+	err := r.DB.QueryRow(query, job.Phase, job.FilesTotal, job.FilesDone, job.LLMCalls, job.TokensUsed, job.SnapshotID, job.ID).Scan(&cancelRequested)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    job.ID,
+			"error": err,
+		})).Error("Failed to update index job progress")
+		return false, err
+	}
+
+	return cancelRequested, nil
+}
+
+// FinishIndexJob sets the final status of a job
+func (r *CodeAnalyzerRepository) FinishIndexJob(id int64, status string, errorMsg string) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"id":     id,
+		"status": status,
+	})).Info("Finishing index job")
+
+	query := `
+		UPDATE code_analyzer.index_jobs
+		SET status = $1, error = $2, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $3
+	`
+
+	_, err := r.DB.Exec(query, status, errorMsg, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to finish index job")
+	}
+	return err
+}
+
+// RequeueIndexJob puts a running job back in the queue, e.g. when its worker shuts down
+func (r *CodeAnalyzerRepository) RequeueIndexJob(id int64) error {
+	r.log().WithField("id", id).Info("Requeuing index job")
+
+	query := `
+		UPDATE code_analyzer.index_jobs
+		SET status = 'queued', worker_id = '', updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`
+
+	_, err := r.DB.Exec(query, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to requeue index job")
+	}
+	return err
+}
+
+// RequestIndexJobCancel requests the cancellation of a job. Queued jobs are cancelled at
+// once; running jobs stop at their next progress update. Returns nil if there is no such job.
+func (r *CodeAnalyzerRepository) RequestIndexJobCancel(id int64) (*models.IndexJob, error) {
+	r.log().WithField("id", id).Info("Requesting index job cancellation")
+
+	query := `
+		UPDATE code_analyzer.index_jobs
+		SET cancel_requested = TRUE,
+			status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END,
+			updated_at = NOW()
+		WHERE id = $1 AND status IN ('queued', 'running')
+	`
+
+	if _, err := r.DB.Exec(query, id); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to request index job cancellation")
+		return nil, err
+	}
+
+	return r.GetIndexJob(id)
+}
+
+// HeartbeatIndexJobs records that running jobs are still being worked on, so that other
+// servers do not recover them
+func (r *CodeAnalyzerRepository) HeartbeatIndexJobs(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `UPDATE code_analyzer.index_jobs SET updated_at = NOW() WHERE id = ANY($1) AND status = 'running'`
+	if _, err := r.DB.Exec(query, pq.Array(ids)); err != nil {
+		r.log().WithField("error", err).Error("Failed to record index job heartbeats")
+		return err
+	}
+	return nil
+}
+
+// RecoverIndexJobs handles the jobs left running by a process that stopped, whose progress and
+// heartbeats were not updated for longer than the lease: jobs with attempts left are queued
+// again, the others are failed, or cancelled if that was requested, along with the repository
+// and snapshot they index. Jobs other servers are running are left alone. Returns the number
+// of jobs requeued and finished.
+func (r *CodeAnalyzerRepository) RecoverIndexJobs(maxAttempts int, lease time.Duration) (int64, int64, error) {
+	failQuery := `
+		WITH finished AS (
+			UPDATE code_analyzer.index_jobs
+			SET status = CASE WHEN cancel_requested THEN 'cancelled' ELSE 'failed' END,
+				error = CASE WHEN cancel_requested THEN '' ELSE 'interrupted by a server restart' END,
+				finished_at = NOW(), updated_at = NOW()
+			WHERE status = 'running' AND updated_at < NOW() - $2 * INTERVAL '1 second'
+				AND (attempts >= $1 OR cancel_requested)
+			RETURNING repository_id, kind, snapshot_id, status, error
+		), snapshots AS (
+			UPDATE code_analyzer.repository_snapshots s
+			SET index_status = f.status, index_error = f.error, updated_at = NOW()
+			FROM finished f
+			WHERE s.id = f.snapshot_id
+		), repositories AS (
+			UPDATE code_analyzer.repositories r
+			SET index_status = f.status, index_error = f.error, updated_at = NOW()
+			FROM finished f
+			WHERE r.id = f.repository_id AND f.kind = 'index'
+		)
+		SELECT COUNT(*) FROM finished
+	`
+	var finished int64
+	if err := r.DB.QueryRow(failQuery, maxAttempts, lease.Seconds()).Scan(&finished); err != nil {
+		r.log().WithField("error", err).Error("Failed to finish interrupted index jobs")
+		return 0, 0, err
+	}
+
+	requeueQuery := `
+		UPDATE code_analyzer.index_jobs
+		SET status = 'queued', worker_id = '', updated_at = NOW()
+		WHERE status = 'running' AND updated_at < NOW() - $1 * INTERVAL '1 second'
+	`
+	result, err := r.DB.Exec(requeueQuery, lease.Seconds())
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to requeue interrupted index jobs")
+		return 0, finished, err
+	}
+	requeued, _ := result.RowsAffected()
+
+	if requeued > 0 || finished > 0 {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"requeued": requeued,
+			"finished": finished,
+		})).Info("Recovered interrupted index jobs")
+	}
+	return requeued, finished, nil
+}
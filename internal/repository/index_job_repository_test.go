@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createRunningJob queues a job for the repository of a test file and marks it running
+func createRunningJob(t *testing.T, repo *CodeAnalyzerRepository, repoID int64) *models.IndexJob {
+	t.Helper()
+
+	job := &models.IndexJob{RepositoryID: repoID, Kind: models.JobKindIndex}
+	require.NoError(t, repo.CreateIndexJob(job))
+	_, err := repo.DB.Exec(`UPDATE code_analyzer.index_jobs SET status = 'running', attempts = 1 WHERE id = $1`, job.ID)
+	require.NoError(t, err)
+	return job
+}
+
+func TestRecoverIndexJobsLeavesLiveJobs(t *testing.T) {
+	repo := NewCodeAnalyzerRepository(setupTestDB(t))
+	file := createTestFile(t, repo)
+	job := createRunningJob(t, repo, file.RepositoryID)
+
+	require.NoError(t, repo.HeartbeatIndexJobs([]int64{job.ID}))
+	_, _, err := repo.RecoverIndexJobs(3, time.Hour)
+	require.NoError(t, err)
+	recovered, err := repo.GetIndexJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusRunning, recovered.Status, "jobs within their lease are being run by another server")
+
+	_, err = repo.DB.Exec(`UPDATE code_analyzer.index_jobs SET updated_at = NOW() - INTERVAL '2 hours' WHERE id = $1`, job.ID)
+	require.NoError(t, err)
+	requeued, _, err := repo.RecoverIndexJobs(3, time.Hour)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, requeued, int64(1))
+	recovered, err = repo.GetIndexJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusQueued, recovered.Status, "jobs whose lease expired are queued again")
+}
+
+func TestRecoverIndexJobsCountsFinishedJobs(t *testing.T) {
+	repo := NewCodeAnalyzerRepository(setupTestDB(t))
+	file := createTestFile(t, repo)
+	first := createRunningJob(t, repo, file.RepositoryID)
+	second := createRunningJob(t, repo, file.RepositoryID)
+	_, err := repo.DB.Exec(`UPDATE code_analyzer.index_jobs SET attempts = 3, updated_at = NOW() - INTERVAL '2 hours' WHERE id IN ($1, $2)`,
+		first.ID, second.ID)
+	require.NoError(t, err)
+
+	_, finished, err := repo.RecoverIndexJobs(3, time.Hour)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, finished, int64(2), "both jobs of the repository are counted")
+	for _, id := range []int64{first.ID, second.ID} {
+		job, err := repo.GetIndexJob(id)
+		require.NoError(t, err)
+		assert.Equal(t, models.JobStatusFailed, job.Status)
+	}
+}
+
+func TestClaimIndexJobOneRefOfARepositoryAtATime(t *testing.T) {
+	repo := NewCodeAnalyzerRepository(setupTestDB(t))
+	file := createTestFile(t, repo)
+	for _, ref := range []string{"main", "v1", "v2", "v3"} {
+		require.NoError(t, repo.CreateIndexJob(&models.IndexJob{RepositoryID: file.RepositoryID, Kind: models.JobKindIndex, Ref: ref}))
+	}
+
+	// Workers claiming at once only get one job of the repository
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.ClaimIndexJob(fmt.Sprintf("%s-%d", t.Name(), i))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	var running int
+	err := repo.DB.Get(&running, `SELECT COUNT(*) FROM code_analyzer.index_jobs WHERE repository_id = $1 AND status = 'running'`, file.RepositoryID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, running)
+}
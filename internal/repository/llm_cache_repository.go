@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// LLMCacheRepository handles interactions with the table caching LLM responses. It is the
+// store of a cache.Cache.
+type LLMCacheRepository struct {
+	DB *sqlx.DB
+}
+
+// NewLLMCacheRepository creates a new LLMCacheRepository
+func NewLLMCacheRepository(dbConn *sql.DB) *LLMCacheRepository {
+	return &LLMCacheRepository{
+		DB: sqlx.NewDb(dbConn, "postgres"),
+	}
+}
+
+// log returns a logrus entry with the repository context
+func (r *LLMCacheRepository) log() *logrus.Entry {
+	return logger.Log.WithField("component", "llm-cache-repository")
+}
+
+// GetCachedResponse gets the response cached under a key, or nil if there is none
+func (r *LLMCacheRepository) GetCachedResponse(key string) (*cache.Entry, error) {
+	var entry cache.Entry
+	query := `
+		SELECT key, model, response, finish_reason, prompt_tokens, completion_tokens, created_at, expires_at
+		FROM code_analyzer.llm_cache
+		WHERE key = $1
+	`
+	err := r.DB.QueryRow(query, key).Scan(&entry.Key, &entry.Model, &entry.Response, &entry.FinishReason,
+		&entry.PromptTokens, &entry.CompletionTokens, &entry.CreatedAt, &entry.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Not cached
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"key":   key,
+			"error": err,
+		})).Error("Failed to get cached LLM response")
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// PutCachedResponse caches a response, replacing any cached under the same key
+func (r *LLMCacheRepository) PutCachedResponse(entry *cache.Entry) error {
+	query := `
+		INSERT INTO code_analyzer.llm_cache
+			(key, model, response, finish_reason, prompt_tokens, completion_tokens, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (key)
+		DO UPDATE SET model = $2, response = $3, finish_reason = $4, prompt_tokens = $5,
+			completion_tokens = $6, created_at = $7, expires_at = $8
+	`
+
+	_, err := r.DB.Exec(query, entry.Key, limit(entry.Model, 255), entry.Response, limit(entry.FinishReason, 50),
+		entry.PromptTokens, entry.CompletionTokens, entry.CreatedAt, entry.ExpiresAt)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"key":   entry.Key,
+			"model": entry.Model,
+			"error": err,
+		})).Error("Failed to cache LLM response")
+	}
+	return err
+}
+
+// DeleteExpiredResponses deletes the responses expired at a time, returning how many
+func (r *LLMCacheRepository) DeleteExpiredResponses(now time.Time) (int64, error) {
+	result, err := r.DB.Exec(`DELETE FROM code_analyzer.llm_cache WHERE expires_at <= $1`, now)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to delete expired LLM responses")
+		return 0, err
+	}
+	return result.RowsAffected()
+}
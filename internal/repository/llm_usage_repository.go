@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// usageGroupKeys are the expressions LLM usage is grouped by
+var usageGroupKeys = map[string]string{
+	models.UsageByUser:       "user_id",
+	models.UsageByRepository: "COALESCE(repository_id::text, '')",
+	models.UsageByFeature:    "feature",
+	models.UsageByModel:      "model",
+	models.UsageByDay:        "to_char(created_at, 'YYYY-MM-DD')",
+}
+
+// budgetColumns are the columns selected for a budget
+const budgetColumns = `id, scope, scope_id, monthly_limit_usd, created_at, updated_at`
+
+// LLMUsageRepository handles interactions with the tables recording the usage of LLM calls
+// and the budgets it is checked against
+type LLMUsageRepository struct {
+	DB *sqlx.DB
+}
+
+// NewLLMUsageRepository creates a new LLMUsageRepository
+func NewLLMUsageRepository(dbConn *sql.DB) *LLMUsageRepository {
+	return &LLMUsageRepository{
+		DB: sqlx.NewDb(dbConn, "postgres"),
+	}
+}
+
+// log returns a logrus entry with the repository context
+func (r *LLMUsageRepository) log() *logrus.Entry {
+	return logger.Log.WithField("component", "llm-usage-repository")
+}
+
+// CreateLLMUsage records the usage of an LLM call
+func (r *LLMUsageRepository) CreateLLMUsage(u *models.LLMUsage) error {
+	query := `
+		INSERT INTO code_analyzer.llm_usage
+			(user_id, repository_id, feature, model, prompt_tokens, completion_tokens, cost_usd, estimated, cached, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+
+	err := r.DB.QueryRow(query, u.UserID, u.RepositoryID, limit(u.Feature, 50), limit(u.Model, 255),
+		u.PromptTokens, u.CompletionTokens, u.CostUSD, u.Estimated, u.Cached, u.CreatedAt,
+	).Scan(&u.ID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"model":   u.Model,
+			"feature": u.Feature,
+			"error":   err,
+		})).Error("Failed to record LLM usage")
+	}
+	return err
+}
+
+// SummarizeLLMUsage aggregates the LLM usage selected by a query, in total and by group,
+// the costliest groups first
+func (r *LLMUsageRepository) SummarizeLLMUsage(q models.LLMUsageQuery) (*models.LLMUsageSummary, []models.LLMUsageSummary, error) {
+	key, ok := usageGroupKeys[q.GroupBy]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid usage grouping %q", q.GroupBy)
+	}
+
+	conditions := []string{"created_at >= $1", "created_at < $2"}
+	args := []interface{}{q.From, q.To}
+	if q.UserID != "" {
+		args = append(args, q.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if q.RepositoryID != 0 {
+		args = append(args, q.RepositoryID)
+		conditions = append(conditions, fmt.Sprintf("repository_id = $%d", len(args)))
+	}
+	if q.Feature != "" {
+		args = append(args, q.Feature)
+		conditions = append(conditions, fmt.Sprintf("feature = $%d", len(args)))
+	}
+	if q.Model != "" {
+		args = append(args, q.Model)
+		conditions = append(conditions, fmt.Sprintf("model = $%d", len(args)))
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var groups []models.LLMUsageSummary
+	query := `
+		SELECT ` + key + ` AS key, COUNT(*) AS calls,
+			COUNT(*) FILTER (WHERE cached) AS cached_calls,
+			COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+			COALESCE(SUM(cost_usd), 0) AS cost_usd
+		FROM code_analyzer.llm_usage
+		WHERE ` + where + `
+		GROUP BY 1
+		ORDER BY cost_usd DESC, key
+	`
+	if err := r.DB.Select(&groups, query, args...); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"group_by": q.GroupBy,
+			"error":    err,
+		})).Error("Failed to summarize LLM usage")
+		return nil, nil, err
+	}
+
+	total := models.LLMUsageSummary{Key: "total"}
+	for _, group := range groups {
+		total.Calls += group.Calls
+		total.CachedCalls += group.CachedCalls
+		total.PromptTokens += group.PromptTokens
+		total.CompletionTokens += group.CompletionTokens
+		total.CostUSD += group.CostUSD
+	}
+	return &total, groups, nil
+}
+
+// GetLLMSpend gets what the LLM calls of a user or repository cost since a time
+func (r *LLMUsageRepository) GetLLMSpend(scope, scopeID string, since time.Time) (float64, error) {
+	column := "user_id"
+	if scope == models.BudgetScopeRepository {
+		column = "repository_id::text"
+	}
+
+	var spent float64
+	query := `SELECT COALESCE(SUM(cost_usd), 0) FROM code_analyzer.llm_usage WHERE ` + column + ` = $1 AND created_at >= $2`
+	if err := r.DB.Get(&spent, query, scopeID, since); err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"scope":    scope,
+			"scope_id": scopeID,
+			"error":    err,
+		})).Error("Failed to get LLM spend")
+		return 0, err
+	}
+	return spent, nil
+}
+
+// SetLLMBudget creates or replaces the budget of a user or repository
+func (r *LLMUsageRepository) SetLLMBudget(budget *models.LLMBudget) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"scope":    budget.Scope,
+		"scope_id": budget.ScopeID,
+		"limit":    budget.MonthlyLimitUSD,
+	})).Info("Setting LLM budget")
+
+	query := `
+		INSERT INTO code_analyzer.llm_budgets (scope, scope_id, monthly_limit_usd)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scope, scope_id)
+		DO UPDATE SET monthly_limit_usd = $3, updated_at = NOW()
+		RETURNING ` + budgetColumns
+
+	err := r.DB.Get(budget, query, budget.Scope, budget.ScopeID, budget.MonthlyLimitUSD)
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to set LLM budget")
+	}
+	return err
+}
+
+// GetLLMBudget gets the budget of a user or repository, or nil if it has none
+func (r *LLMUsageRepository) GetLLMBudget(scope, scopeID string) (*models.LLMBudget, error) {
+	var budget models.LLMBudget
+	query := `SELECT ` + budgetColumns + ` FROM code_analyzer.llm_budgets WHERE scope = $1 AND scope_id = $2`
+	if err := r.DB.Get(&budget, query, scope, scopeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No budget
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"scope":    scope,
+			"scope_id": scopeID,
+			"error":    err,
+		})).Error("Failed to get LLM budget")
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// ListLLMBudgets lists the budgets of every user and repository
+func (r *LLMUsageRepository) ListLLMBudgets() ([]models.LLMBudget, error) {
+	var budgets []models.LLMBudget
+	query := `SELECT ` + budgetColumns + ` FROM code_analyzer.llm_budgets ORDER BY scope, scope_id`
+	if err := r.DB.Select(&budgets, query); err != nil {
+		r.log().WithField("error", err).Error("Failed to list LLM budgets")
+		return nil, err
+	}
+	return budgets, nil
+}
+
+// DeleteLLMBudget deletes a budget, returning whether it existed
+func (r *LLMUsageRepository) DeleteLLMBudget(id int64) (bool, error) {
+	r.log().WithField("id", id).Info("Deleting LLM budget")
+
+	result, err := r.DB.Exec(`DELETE FROM code_analyzer.llm_budgets WHERE id = $1`, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to delete LLM budget")
+		return false, err
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted > 0, nil
+}
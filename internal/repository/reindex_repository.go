@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/lib/pq"
+)
+
+// RenameRepositoryFile moves a stored file to its new path, keeping its ID
+func (r *CodeAnalyzerRepository) RenameRepositoryFile(fileID int64, filePath string) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"file_id":   fileID,
+		"file_path": filePath,
+	})).Debug("Renaming repository file")
+
+	query := `
+		UPDATE code_analyzer.repository_files
+		SET file_path = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	_, err := r.DB.Exec(query, filePath, fileID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"file_id": fileID,
+			"error":   err,
+		})).Error("Failed to rename repository file")
+	}
+	return err
+}
+
+// DeleteRepositoryFiles removes files and everything stored for them
+func (r *CodeAnalyzerRepository) DeleteRepositoryFiles(fileIDs []int64) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	r.log().WithField("count", len(fileIDs)).Info("Deleting repository files")
+
+	_, err := r.DB.Exec(`DELETE FROM code_analyzer.repository_files WHERE id = ANY($1)`, pq.Array(fileIDs))
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to delete repository files")
+	}
+	return err
+}
+
+// DeleteFunctions removes functions along with their calls, references, statements and
+// insights. Calls to them from other functions are unlinked rather than removed.
+func (r *CodeAnalyzerRepository) DeleteFunctions(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	r.log().WithField("count", len(ids)).Info("Deleting repository functions")
+
+	_, err := r.DB.Exec(`DELETE FROM code_analyzer.repository_functions WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to delete repository functions")
+	}
+	return err
+}
+
+// DeleteSymbols removes symbols along with their references and insights
+func (r *CodeAnalyzerRepository) DeleteSymbols(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	r.log().WithField("count", len(ids)).Info("Deleting repository symbols")
+
+	_, err := r.DB.Exec(`DELETE FROM code_analyzer.repository_symbols WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to delete repository symbols")
+	}
+	return err
+}
+
+// MoveFunctions moves stored functions to the file and line they were re-analyzed at, so
+// storing the re-analyzed functions updates their rows in place
+func (r *CodeAnalyzerRepository) MoveFunctions(functions []models.RepositoryFunction) error {
+	if len(functions) == 0 {
+		return nil
+	}
+	r.log().WithField("count", len(functions)).Debug("Moving repository functions")
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to begin transaction for moving functions")
+		return err
+	}
+	defer tx.Rollback()
+
+	// Park the rows on a line no function has first, so functions trading places don't
+	// collide on (file_id, name, line)
+	for _, fn := range functions {
+		if _, err := tx.Exec(`UPDATE code_analyzer.repository_functions SET line = -id WHERE id = $1`, fn.ID); err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"function_id": fn.ID,
+				"error":       err,
+			})).Error("Failed to move function")
+			return err
+		}
+	}
+	for _, fn := range functions {
+		query := `
+			UPDATE code_analyzer.repository_functions
+			SET file_id = $1, line = $2, updated_at = NOW()
+			WHERE id = $3
+		`
+		if _, err := tx.Exec(query, fn.FileID, fn.Line, fn.ID); err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"function_id": fn.ID,
+				"error":       err,
+			})).Error("Failed to move function")
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MoveSymbols moves stored symbols to the file and line they were re-analyzed at, so
+// storing the re-analyzed symbols updates their rows in place
+func (r *CodeAnalyzerRepository) MoveSymbols(symbols []models.RepositorySymbol) error {
+	if len(symbols) == 0 {
+		return nil
+	}
+	r.log().WithField("count", len(symbols)).Debug("Moving repository symbols")
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to begin transaction for moving symbols")
+		return err
+	}
+	defer tx.Rollback()
+
+	// Park the rows first, as for functions
+	for _, sym := range symbols {
+		if _, err := tx.Exec(`UPDATE code_analyzer.repository_symbols SET line = -id WHERE id = $1`, sym.ID); err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"symbol_id": sym.ID,
+				"error":     err,
+			})).Error("Failed to move symbol")
+			return err
+		}
+	}
+	for _, sym := range symbols {
+		query := `
+			UPDATE code_analyzer.repository_symbols
+			SET file_id = $1, line = $2, updated_at = NOW()
+			WHERE id = $3
+		`
+		if _, err := tx.Exec(query, sym.FileID, sym.Line, sym.ID); err != nil {
+			r.log().WithFields(fieldsToLogrus(logger.Fields{
+				"symbol_id": sym.ID,
+				"error":     err,
+			})).Error("Failed to move symbol")
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClearFileAnalysis removes what was derived from the code of files about to be stored
+// again: the statements and calls of their functions, the references made in them and
+// their imports. Functions and symbols themselves are kept.
+func (r *CodeAnalyzerRepository) ClearFileAnalysis(fileIDs []int64) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	r.log().WithField("count", len(fileIDs)).Debug("Clearing file analysis")
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		r.log().WithField("error", err).Error("Failed to begin transaction for clearing file analysis")
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM code_analyzer.function_statements WHERE function_id IN (
+			SELECT id FROM code_analyzer.repository_functions WHERE file_id = ANY($1))`,
+		`DELETE FROM code_analyzer.function_calls WHERE caller_id IN (
+			SELECT id FROM code_analyzer.repository_functions WHERE file_id = ANY($1))`,
+		`DELETE FROM code_analyzer.function_references WHERE file_id = ANY($1)`,
+		`DELETE FROM code_analyzer.symbol_references WHERE file_id = ANY($1)`,
+		`DELETE FROM code_analyzer.file_dependencies WHERE file_id = ANY($1)`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, pq.Array(fileIDs)); err != nil {
+			r.log().WithField("error", err).Error("Failed to clear file analysis")
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
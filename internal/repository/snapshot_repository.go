@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// defaultSnapshotQuery selects the snapshot of the repository $1 read when no ref is given:
+// the one of the default branch, or else the most recently indexed one
+const defaultSnapshotQuery = `(
+		SELECT s.id FROM code_analyzer.repository_snapshots s
+		LEFT JOIN code_analyzer.snapshot_refs sr ON sr.snapshot_id = s.id AND sr.ref = ''
+		WHERE s.repository_id = $1
+		ORDER BY sr.ref IS NULL, s.last_indexed DESC NULLS LAST, s.id DESC
+		LIMIT 1
+	)`
+
+// snapshotColumns are the columns selected for a snapshot
+const snapshotColumns = `id, repository_id, commit_sha, indexed_commit, index_status, index_error, last_indexed,
+	created_at, updated_at`
+
+// CreateSnapshot creates the snapshot of a repository at a commit, or returns the existing one
+func (r *CodeAnalyzerRepository) CreateSnapshot(snapshot *models.RepositorySnapshot) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_id": snapshot.RepositoryID,
+		"commit":  snapshot.CommitSHA,
+	})).Info("Creating repository snapshot")
+
+	query := `
+		INSERT INTO code_analyzer.repository_snapshots (repository_id, commit_sha, index_status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (repository_id, commit_sha)
+		DO UPDATE SET updated_at = NOW()
+		RETURNING ` + snapshotColumns
+
+	err := r.DB.Get(snapshot, query, snapshot.RepositoryID, snapshot.CommitSHA, snapshot.IndexStatus)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_id": snapshot.RepositoryID,
+			"commit":  snapshot.CommitSHA,
+			"error":   err,
+		})).Error("Failed to create repository snapshot")
+	}
+	return err
+}
+
+// getSnapshot runs a query selecting a single snapshot, returning nil if there is none
+func (r *CodeAnalyzerRepository) getSnapshot(query string, args ...interface{}) (*models.RepositorySnapshot, error) {
+	var snapshot models.RepositorySnapshot
+	if err := r.DB.Get(&snapshot, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Snapshot not found
+		}
+		r.log().WithField("error", err).Error("Failed to get repository snapshot")
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetSnapshotByCommit gets the snapshot of a repository at a commit
+func (r *CodeAnalyzerRepository) GetSnapshotByCommit(repoID int64, commit string) (*models.RepositorySnapshot, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_id": repoID,
+		"commit":  commit,
+	})).Debug("Getting snapshot by commit")
+
+	query := `
+		SELECT ` + snapshotColumns + `
+		FROM code_analyzer.repository_snapshots
+		WHERE repository_id = $1 AND commit_sha = $2
+	`
+	return r.getSnapshot(query, repoID, commit)
+}
+
+// GetRefSnapshot gets the snapshot a ref of a repository was last indexed into
+func (r *CodeAnalyzerRepository) GetRefSnapshot(repoID int64, ref string) (*models.RepositorySnapshot, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_id": repoID,
+		"ref":     ref,
+	})).Debug("Getting snapshot by ref")
+
+	query := `
+		SELECT s.id, s.repository_id, s.commit_sha, s.indexed_commit, s.index_status, s.index_error,
+			s.last_indexed, s.created_at, s.updated_at
+		FROM code_analyzer.snapshot_refs sr
+		JOIN code_analyzer.repository_snapshots s ON s.id = sr.snapshot_id
+		WHERE sr.repository_id = $1 AND sr.ref = $2
+	`
+	return r.getSnapshot(query, repoID, ref)
+}
+
+// ResolveSnapshot gets the snapshot to read for a ref of a repository: the snapshot the ref
+// was indexed into, or else the one at the commit the ref abbreviates. The empty ref reads
+// the default snapshot. Returns nil if nothing matches, or if a commit prefix is ambiguous.
+func (r *CodeAnalyzerRepository) ResolveSnapshot(repoID int64, ref string) (*models.RepositorySnapshot, error) {
+	var snapshot *models.RepositorySnapshot
+	var err error
+	if ref == "" {
+		query := `SELECT ` + snapshotColumns + ` FROM code_analyzer.repository_snapshots WHERE id = ` + defaultSnapshotQuery
+		snapshot, err = r.getSnapshot(query, repoID)
+	} else {
+		snapshot, err = r.GetRefSnapshot(repoID, ref)
+		if err == nil && snapshot == nil && models.IsCommitPrefix(ref) {
+			query := `
+				SELECT ` + snapshotColumns + `
+				FROM code_analyzer.repository_snapshots
+				WHERE repository_id = $1 AND commit_sha LIKE $2 || '%'
+				LIMIT 2
+			`
+			var matches []models.RepositorySnapshot
+			if err = r.DB.Select(&matches, query, repoID, ref); err == nil && len(matches) == 1 {
+				snapshot = &matches[0]
+			}
+		}
+	}
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+
+	err = r.DB.Select(&snapshot.Refs, `SELECT ref FROM code_analyzer.snapshot_refs WHERE snapshot_id = $1 ORDER BY ref`, snapshot.ID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshot.ID,
+			"error":       err,
+		})).Error("Failed to get snapshot refs")
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// CountSnapshotRefs counts the refs resolving to a snapshot
+func (r *CodeAnalyzerRepository) CountSnapshotRefs(snapshotID int64) (int, error) {
+	var count int
+	err := r.DB.Get(&count, `SELECT COUNT(*) FROM code_analyzer.snapshot_refs WHERE snapshot_id = $1`, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"error":       err,
+		})).Error("Failed to count snapshot refs")
+	}
+	return count, err
+}
+
+// SetSnapshotRef points a ref of a repository at a snapshot
+func (r *CodeAnalyzerRepository) SetSnapshotRef(repoID int64, ref string, snapshotID int64) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"repo_id":     repoID,
+		"ref":         ref,
+		"snapshot_id": snapshotID,
+	})).Info("Setting snapshot ref")
+
+	query := `
+		INSERT INTO code_analyzer.snapshot_refs (repository_id, ref, snapshot_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (repository_id, ref)
+		DO UPDATE SET snapshot_id = $3, updated_at = NOW()
+	`
+
+	_, err := r.DB.Exec(query, repoID, ref, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"repo_id": repoID,
+			"ref":     ref,
+			"error":   err,
+		})).Error("Failed to set snapshot ref")
+	}
+	return err
+}
+
+// AdvanceSnapshot moves a snapshot to a newer commit of its ref, so it is re-indexed in
+// place rather than kept alongside
+func (r *CodeAnalyzerRepository) AdvanceSnapshot(id int64, commit string) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"id":     id,
+		"commit": commit,
+	})).Info("Advancing repository snapshot")
+
+	query := `
+		UPDATE code_analyzer.repository_snapshots
+		SET commit_sha = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	_, err := r.DB.Exec(query, commit, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to advance repository snapshot")
+	}
+	return err
+}
+
+// UpdateSnapshotStatus updates the status of a snapshot
+func (r *CodeAnalyzerRepository) UpdateSnapshotStatus(id int64, status string, errorMsg string) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"id":     id,
+		"status": status,
+	})).Info("Updating snapshot status")
+
+	var lastIndexed *time.Time
+	if status == "completed" || status == "failed" {
+		now := time.Now()
+		lastIndexed = &now
+	}
+
+	query := `
+		UPDATE code_analyzer.repository_snapshots
+		SET index_status = $1, index_error = $2, last_indexed = COALESCE($3, last_indexed), updated_at = NOW()
+		WHERE id = $4
+	`
+
+	_, err := r.DB.Exec(query, status, errorMsg, lastIndexed, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to update snapshot status")
+	}
+	return err
+}
+
+// UpdateSnapshotIndexedCommit records the commit the stored index of a snapshot reflects
+func (r *CodeAnalyzerRepository) UpdateSnapshotIndexedCommit(id int64, commit string) error {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"id":     id,
+		"commit": commit,
+	})).Info("Updating snapshot indexed commit")
+
+	query := `
+		UPDATE code_analyzer.repository_snapshots
+		SET indexed_commit = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	_, err := r.DB.Exec(query, commit, id)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"id":    id,
+			"error": err,
+		})).Error("Failed to update snapshot indexed commit")
+	}
+	return err
+}
+
+// GetSnapshotFiles gets all files of a snapshot
+func (r *CodeAnalyzerRepository) GetSnapshotFiles(snapshotID int64) ([]models.RepositoryFile, error) {
+	r.log().WithField("snapshot_id", snapshotID).Debug("Getting all files for snapshot")
+
+	var files []models.RepositoryFile
+	query := `
+		SELECT id, repository_id, snapshot_id, file_path, package, package_path, last_analyzed, created_at, updated_at
+		FROM code_analyzer.repository_files
+		WHERE snapshot_id = $1
+		ORDER BY file_path
+	`
+
+	err := r.DB.Select(&files, query, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"error":       err,
+		})).Error("Failed to get snapshot files")
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// GetSnapshotFileByPath gets a specific file of a snapshot by path
+func (r *CodeAnalyzerRepository) GetSnapshotFileByPath(snapshotID int64, filePath string) (*models.RepositoryFile, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"snapshot_id": snapshotID,
+		"file_path":   filePath,
+	})).Debug("Getting snapshot file by path")
+
+	var file models.RepositoryFile
+	query := `
+		SELECT id, repository_id, snapshot_id, file_path, package, package_path, last_analyzed, created_at, updated_at
+		FROM code_analyzer.repository_files
+		WHERE snapshot_id = $1 AND file_path = $2
+	`
+
+	err := r.DB.Get(&file, query, snapshotID, filePath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // File not found
+		}
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"file_path":   filePath,
+			"error":       err,
+		})).Error("Error getting snapshot file by path")
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// CopyFunctionInsight gives a function the latest insight of a function of another snapshot
+// of its repository with the same code. Reports whether there was one to copy.
+func (r *CodeAnalyzerRepository) CopyFunctionInsight(repoID, functionID int64, bodyHash string) (bool, error) {
+	if bodyHash == "" {
+		return false, nil
+	}
+
+	query := `
+		INSERT INTO code_analyzer.function_insights (repository_id, function_id, data, model, prompt_version, input_hash, body_hash)
+		SELECT i.repository_id, $2, i.data, i.model, i.prompt_version, i.input_hash, i.body_hash
+		FROM code_analyzer.function_insights i
+		JOIN code_analyzer.repository_functions fn ON fn.id = i.function_id
+		WHERE i.repository_id = $1 AND fn.id <> $2 AND fn.body_hash = $3
+		ORDER BY i.created_at DESC
+		LIMIT 1
+	`
+
+	result, err := r.DB.Exec(query, repoID, functionID, bodyHash)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"function_id": functionID,
+			"error":       err,
+		})).Error("Failed to copy function insight")
+		return false, err
+	}
+	copied, _ := result.RowsAffected()
+	return copied > 0, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// GetSnapshotSymbolNames gets the ID, file, name and kind of every symbol of a snapshot,
+// without loading their references
+func (r *CodeAnalyzerRepository) GetSnapshotSymbolNames(snapshotID int64) ([]models.RepositorySymbol, error) {
+	r.log().WithField("snapshot_id", snapshotID).Debug("Getting snapshot symbol names")
+
+	var symbols []models.RepositorySymbol
+	query := `
+		SELECT id, repository_id, snapshot_id, file_id, name, kind, line
+		FROM code_analyzer.repository_symbols
+		WHERE snapshot_id = $1
+		ORDER BY file_id, line
+	`
+
+	err := r.DB.Select(&symbols, query, snapshotID)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"error":       err,
+		})).Error("Failed to get snapshot symbol names")
+		return nil, err
+	}
+
+	return symbols, nil
+}
+
+// GetSymbolUsages gets the references to the symbols of a snapshot with the given name, or
+// to one of their fields or methods when member is set. An empty package path matches the
+// symbols of every package.
+func (r *CodeAnalyzerRepository) GetSymbolUsages(snapshotID int64, name, member, pkgPath string) ([]models.SymbolUsage, error) {
+	r.log().WithFields(fieldsToLogrus(logger.Fields{
+		"snapshot_id": snapshotID,
+		"name":        name,
+		"member":      member,
+		"package":     pkgPath,
+	})).Debug("Getting symbol usages")
+
+	var usages []models.SymbolUsage
+	query := `
+		SELECT sr.id, sr.symbol_id, sr.member, sr.reference_type, sr.file_id, sr.line, sr.column_position,
+			sr.context, sr.created_at, sr.updated_at,
+			s.name AS symbol_name, s.kind AS symbol_kind, sf.package_path, rf.file_path
+		FROM code_analyzer.symbol_references sr
+		JOIN code_analyzer.repository_symbols s ON s.id = sr.symbol_id
+		JOIN code_analyzer.repository_files sf ON sf.id = s.file_id
+		JOIN code_analyzer.repository_files rf ON rf.id = sr.file_id
+		WHERE s.snapshot_id = $1 AND s.name = $2 AND sr.member = $3
+			AND ($4 = '' OR sf.package_path = $4)
+		ORDER BY rf.file_path, sr.line, sr.column_position
+	`
+
+	err := r.DB.Select(&usages, query, snapshotID, name, member, pkgPath)
+	if err != nil {
+		r.log().WithFields(fieldsToLogrus(logger.Fields{
+			"snapshot_id": snapshotID,
+			"name":        name,
+			"error":       err,
+		})).Error("Failed to get symbol usages")
+		return nil, err
+	}
+
+	return usages, nil
+}
@@ -32,7 +32,7 @@ func (r *UserRepository) Create(user *models.User) error {
 	}
 
 	query := `
-	INSERT INTO users (id, email, password, first_name, last_name, active, role, created_at, updated_at)
+	INSERT INTO users.users (id, email, password, first_name, last_name, active, role, created_at, updated_at)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
@@ -62,7 +62,7 @@ func (r *UserRepository) Create(user *models.User) error {
 func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 	query := `
 	SELECT id, email, password, first_name, last_name, active, role, created_at, updated_at, deleted_at
-	FROM users
+	FROM users.users
 	WHERE id = $1 AND deleted_at IS NULL
 	`
 
@@ -98,7 +98,7 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	query := `
 	SELECT id, email, password, first_name, last_name, active, role, created_at, updated_at, deleted_at
-	FROM users
+	FROM users.users
 	WHERE email = $1 AND deleted_at IS NULL
 	`
 
@@ -135,7 +135,7 @@ func (r *UserRepository) Update(user *models.User) error {
 	logger.Infof("Updating user with ID: %s", user.ID)
 
 	query := `
-	UPDATE users
+	UPDATE users.users
 	SET first_name = $1, last_name = $2, active = $3, role = $4, updated_at = $5
 	WHERE id = $6 AND deleted_at IS NULL
 	`
@@ -177,7 +177,7 @@ func (r *UserRepository) Delete(id uuid.UUID) error {
 	logger.Infof("Deleting user with ID: %s", id)
 
 	query := `
-	UPDATE users
+	UPDATE users.users
 	SET deleted_at = $1
 	WHERE id = $2 AND deleted_at IS NULL
 	`
@@ -207,7 +207,7 @@ func (r *UserRepository) Delete(id uuid.UUID) error {
 func (r *UserRepository) List(page, pageSize int) ([]models.User, int64, error) {
 	// Count total users
 	countQuery := `
-	SELECT COUNT(*) FROM users WHERE deleted_at IS NULL
+	SELECT COUNT(*) FROM users.users WHERE deleted_at IS NULL
 	`
 
 	var count int64
@@ -221,7 +221,7 @@ func (r *UserRepository) List(page, pageSize int) ([]models.User, int64, error)
 	offset := (page - 1) * pageSize
 	query := `
 	SELECT id, email, password, first_name, last_name, active, role, created_at, updated_at, deleted_at
-	FROM users
+	FROM users.users
 	WHERE deleted_at IS NULL
 	ORDER BY created_at DESC
 	LIMIT $1 OFFSET $2
@@ -262,7 +262,7 @@ func (r *UserRepository) List(page, pageSize int) ([]models.User, int64, error)
 // EmailExists checks if an email already exists
 func (r *UserRepository) EmailExists(email string) (bool, error) {
 	query := `
-	SELECT COUNT(*) FROM users WHERE email = $1 AND deleted_at IS NULL
+	SELECT COUNT(*) FROM users.users WHERE email = $1 AND deleted_at IS NULL
 	`
 
 	var count int64
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cred.com/hack25/backend/internal/models"
+)
+
+// linkFunctionCalls resolves the callee of every call of a snapshot that is not linked yet.
+// It runs after all files are stored, so calls into files processed later resolve as well.
+func (s *CodeAnalyzerService) linkFunctionCalls(snapshotID int64) error {
+	files, err := s.repo.GetSnapshotFiles(snapshotID)
+	if err != nil {
+		return fmt.Errorf("error getting snapshot files: %w", err)
+	}
+	functions, err := s.repo.GetSnapshotFunctionNames(snapshotID)
+	if err != nil {
+		return fmt.Errorf("error getting snapshot functions: %w", err)
+	}
+	deps, err := s.repo.GetSnapshotFileDependencies(snapshotID)
+	if err != nil {
+		return fmt.Errorf("error getting file dependencies: %w", err)
+	}
+	calls, err := s.repo.GetUnlinkedFunctionCalls(snapshotID)
+	if err != nil {
+		return fmt.Errorf("error getting function calls: %w", err)
+	}
+
+	linker := models.NewCallLinker(files, functions, deps)
+
+	linked, external, unresolved := 0, 0, 0
+	for _, call := range calls {
+		res := linker.Resolve(call.FunctionCall, call.CallerFileID)
+
+		call.CalleeID = res.CalleeID
+		call.Confidence = &res.Confidence
+		call.ExternalKind = res.ExternalKind
+		if call.CalleePackage == "" {
+			call.CalleePackage = res.CalleePackage
+		}
+
+		if err := s.repo.UpdateFunctionCallLink(&call.FunctionCall); err != nil {
+			s.logger.Warn("Error linking function call", "call_id", call.ID, "callee", call.CalleeName, "error", err)
+			continue
+		}
+
+		switch {
+		case res.CalleeID != nil:
+			linked++
+		case res.ExternalKind == models.ExternalUnresolved:
+			unresolved++
+		case res.ExternalKind != "":
+			external++
+		}
+	}
+
+	s.logger.Info("Function calls linked", "snapshot_id", snapshotID, "calls", len(calls), "linked", linked,
+		"external", external, "unresolved", unresolved)
+	return nil
+}
+
+// importPathOf derives the import path of the package containing a file from the go.mod
+// of its module. Files outside any module use their directory relative to the repository.
+func importPathOf(localPath, filePath string, modulePaths map[string]string) string {
+	dir := filepath.Dir(filePath)
+	for moduleDir := dir; strings.HasPrefix(moduleDir, localPath); moduleDir = filepath.Dir(moduleDir) {
+		modulePath, ok := modulePaths[moduleDir]
+		if !ok {
+			modulePath = readModulePath(filepath.Join(moduleDir, "go.mod"))
+			modulePaths[moduleDir] = modulePath
+		}
+
+		if modulePath != "" {
+			rel, err := filepath.Rel(moduleDir, dir)
+			if err != nil || rel == "." {
+				return modulePath
+			}
+			return modulePath + "/" + filepath.ToSlash(rel)
+		}
+
+		if moduleDir == localPath {
+			break
+		}
+	}
+
+	rel, err := filepath.Rel(localPath, dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// readModulePath returns the module path declared by a go.mod file, or "" if there is none
+func readModulePath(goModPath string) string {
+	f, err := os.Open(goModPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "module"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
@@ -10,19 +10,29 @@ import (
 
 	"cred.com/hack25/backend/internal/models"
 	"cred.com/hack25/backend/pkg/github"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
 )
 
+// CodeAnalysisRepository defines the interface for storing the analysis of repositories
+type CodeAnalysisRepository interface {
+	SaveRepositoryAnalysis(result *models.RepositoryAnalysisResult) (*models.AnalyzedRepository, error)
+	GetAnalyzedRepository(repoURL string) (*models.AnalyzedRepository, error)
+	ListWorkflowSteps(repoID, stepType string) ([]models.WorkflowStep, error)
+}
+
 // CodeAnalysisService handles code analysis operations
 type CodeAnalysisService struct {
 	githubClient github.Client
 	llmService   *LLMService
+	repo         CodeAnalysisRepository
 }
 
 // NewCodeAnalysisService creates a new code analysis service
-func NewCodeAnalysisService(llmService *LLMService) *CodeAnalysisService {
+func NewCodeAnalysisService(llmService *LLMService, repo CodeAnalysisRepository) *CodeAnalysisService {
 	return &CodeAnalysisService{
 		llmService: llmService,
+		repo:       repo,
 	}
 }
 
@@ -90,9 +100,54 @@ func (s *CodeAnalysisService) AnalyzeRepository(ctx context.Context, repoURL, au
 	})
 
 	logger.Infof("Analyzed %d files in repository %s/%s", len(processedFiles), repo.Owner, repo.Name)
+
+	stored, err := s.repo.SaveRepositoryAnalysis(result)
+	if err != nil {
+		logger.Errorf("Failed to store analysis of repository %s: %v", repoURL, err)
+		return nil, fmt.Errorf("failed to store repository analysis: %w", err)
+	}
+	result.RepositoryID = stored.ID
+
 	return result, nil
 }
 
+// ListWorkflows lists the workflows of an analyzed repository, only those with a step of a
+// type unless stepType is empty. Nil is returned if the repository was not analyzed.
+func (s *CodeAnalysisService) ListWorkflows(repoURL, stepType string) (*models.WorkflowsResponse, error) {
+	repo, err := s.repo.GetAnalyzedRepository(repoURL)
+	if err != nil || repo == nil {
+		return nil, err
+	}
+
+	steps, err := s.repo.ListWorkflowSteps(repo.ID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	workflows := []models.Workflow{}
+	for _, workflow := range models.GroupWorkflows(steps) {
+		if stepType == "" || workflow.HasStepType(stepType) {
+			workflows = append(workflows, workflow)
+		}
+	}
+	return &models.WorkflowsResponse{Repository: repo, Workflows: workflows}, nil
+}
+
+// ListWorkflowSteps lists the workflow steps of an analyzed repository, only those of a type
+// unless stepType is empty. Nil is returned if the repository was not analyzed.
+func (s *CodeAnalysisService) ListWorkflowSteps(repoURL, stepType string) (*models.WorkflowStepsResponse, error) {
+	repo, err := s.repo.GetAnalyzedRepository(repoURL)
+	if err != nil || repo == nil {
+		return nil, err
+	}
+
+	steps, err := s.repo.ListWorkflowSteps(repo.ID, stepType)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WorkflowStepsResponse{Repository: repo, Steps: steps}, nil
+}
+
 // analyzeCode analyzes code content using LLM
 func (s *CodeAnalysisService) analyzeCode(ctx context.Context, filePath, fileContent string) (*models.FileAnalysisResult, error) {
 	// Prepare prompt for LLM
@@ -133,7 +188,7 @@ Provide the analysis in JSON format.
 	}
 
 	// Send request to LLM
-	response, err := s.llmService.ChatWithModels(ctx, req)
+	response, err := s.llmService.ChatWithModels(usage.WithFeature(ctx, usage.FeatureFileAnalysis), req)
 	if err != nil {
 		return nil, fmt.Errorf("LLM analysis failed: %w", err)
 	}
@@ -2,9 +2,9 @@ package service
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -15,6 +15,8 @@ import (
 	"cred.com/hack25/backend/pkg/goanalyzer"
 	analyzerModels "cred.com/hack25/backend/pkg/goanalyzer/models"
 	"cred.com/hack25/backend/pkg/logger"
+	"cred.com/hack25/backend/pkg/secrets"
+	"cred.com/hack25/backend/pkg/source"
 	"github.com/sirupsen/logrus"
 )
 
@@ -86,26 +88,76 @@ type CodeAnalyzerRepository interface {
 	GetRepositoryByID(id int64) (*models.Repository, error)
 	CreateRepositoryFile(file *models.RepositoryFile) error
 	GetRepositoryFiles(repoID int64) ([]models.RepositoryFile, error)
-	GetRepositoryFileByPath(repoID int64, filePath string) (*models.RepositoryFile, error)
+	CreateSnapshot(snapshot *models.RepositorySnapshot) error
+	GetSnapshotByCommit(repoID int64, commit string) (*models.RepositorySnapshot, error)
+	GetRefSnapshot(repoID int64, ref string) (*models.RepositorySnapshot, error)
+	ResolveSnapshot(repoID int64, ref string) (*models.RepositorySnapshot, error)
+	CountSnapshotRefs(snapshotID int64) (int, error)
+	SetSnapshotRef(repoID int64, ref string, snapshotID int64) error
+	AdvanceSnapshot(id int64, commit string) error
+	UpdateSnapshotStatus(id int64, status string, errorMsg string) error
+	UpdateSnapshotIndexedCommit(id int64, commit string) error
+	GetSnapshotFiles(snapshotID int64) ([]models.RepositoryFile, error)
+	GetSnapshotFileByPath(snapshotID int64, filePath string) (*models.RepositoryFile, error)
 	BatchCreateFunctions(functions []models.RepositoryFunction) error
 	BatchCreateSymbols(symbols []models.RepositorySymbol) error
 	GetRepositoryFunctions(repoID int64, fileID int64) ([]models.RepositoryFunction, error)
 	GetRepositorySymbols(repoID int64, fileID int64) ([]models.RepositorySymbol, error)
 	BatchCreateFunctionStatements(statements []models.FunctionStatement) error
+	GetFunctionByID(id int64) (*models.RepositoryFunction, error)
+	GetNestedFunctionStatements(functionID int64) ([]models.FunctionStatement, error)
 	AddFunctionCall(call *models.FunctionCall) error
+	GetSnapshotFunctionNames(snapshotID int64) ([]models.RepositoryFunction, error)
+	GetUnlinkedFunctionCalls(snapshotID int64) ([]models.CallerFunctionCall, error)
+	UpdateFunctionCallLink(call *models.FunctionCall) error
+	GetSnapshotSymbolNames(snapshotID int64) ([]models.RepositorySymbol, error)
+	BatchAddSymbolReferences(refs []models.SymbolReference) error
+	GetSymbolUsages(snapshotID int64, name, member, pkgPath string) ([]models.SymbolUsage, error)
+	CopyFunctionInsight(repoID, functionID int64, bodyHash string) (bool, error)
+	RenameRepositoryFile(fileID int64, filePath string) error
+	DeleteRepositoryFiles(fileIDs []int64) error
+	DeleteFunctions(ids []int64) error
+	DeleteSymbols(ids []int64) error
+	MoveFunctions(functions []models.RepositoryFunction) error
+	MoveSymbols(symbols []models.RepositorySymbol) error
+	ClearFileAnalysis(fileIDs []int64) error
+	CreateIndexJob(job *models.IndexJob) error
+	GetIndexJob(id int64) (*models.IndexJob, error)
+	GetActiveIndexJob(repoID int64, kind, ref string) (*models.IndexJob, error)
+	ClaimIndexJob(workerID string) (*models.IndexJob, error)
+	UpdateIndexJobProgress(job *models.IndexJob) (bool, error)
+	FinishIndexJob(id int64, status string, errorMsg string) error
+	RequeueIndexJob(id int64) error
+	RequestIndexJobCancel(id int64) (*models.IndexJob, error)
+	HeartbeatIndexJobs(ids []int64) error
+	RecoverIndexJobs(maxAttempts int, lease time.Duration) (int64, int64, error)
 	AddFunctionReference(ref *models.FunctionReference) error
 	AddFileDependency(dep *models.FileDependency) error
 	BatchAddFileDependencies(deps []models.FileDependency) error
-	GetFileDependencies(repoID int64, fileID int64) ([]models.FileDependency, error)
+	GetSnapshotFileDependencies(snapshotID int64) ([]models.FileDependency, error)
+	CreateCredential(credential *models.RepositoryCredential) error
+	GetCredential(id int64) (*models.RepositoryCredential, error)
+	ListCredentials(userID string) ([]models.RepositoryCredential, error)
+	DeleteCredential(id int64) error
+	TouchCredential(id int64) error
+	SetRepositoryCredential(repoID int64, credentialID *int64) error
+	AddOrganizationMember(member *models.OrganizationMember) error
+	RemoveOrganizationMember(organization, userID string) error
+	ListUserOrganizations(userID string) ([]string, error)
 }
 
 // CodeAnalyzerService handles code analysis operations
 type CodeAnalyzerService struct {
 	repo                CodeAnalyzerRepository
 	analyzer            *goanalyzer.Analyzer
+	analyzerOptions     goanalyzer.Options
+	workers             *indexWorkerPool
+	sources             map[string]SourceProvider
+	credentialBox       *secrets.Box
 	workspaceDir        string
 	logger              *ServiceLogger
 	insightsManager     *repointel.InsightsManager
+	usageService        *LLMUsageService // Holds index jobs to budgets, if set
 	liteLLMBaseURL      string
 	liteLLMAPIKey       string
 	liteLLMDefaultModel string
@@ -130,9 +182,24 @@ func NewCodeAnalyzerService(repo CodeAnalyzerRepository, workspaceDir string, li
 	if liteLLMDefaultModel == "" {
 		liteLLMDefaultModel = os.Getenv("LITELLM_DEFAULT_MODEL")
 	}
+	// A call graph algorithm (cha, rta or vta) resolves dynamic calls more precisely
+	// than the default syntactic call walk
+	analyzer := goanalyzer.New()
+	var analyzerOptions goanalyzer.Options
+	if algorithm := os.Getenv("CALL_GRAPH_ALGORITHM"); algorithm != "" {
+		withCallGraph, err := goanalyzer.NewWithOptions(goanalyzer.Options{CallGraphAlgorithm: algorithm})
+		if err != nil {
+			log.Warn("Ignoring call graph algorithm", "algorithm", algorithm, "error", err)
+		} else {
+			analyzer = withCallGraph
+			analyzerOptions.CallGraphAlgorithm = algorithm
+		}
+	}
+
 	s := &CodeAnalyzerService{
 		repo:                repo,
-		analyzer:            goanalyzer.New(),
+		analyzer:            analyzer,
+		analyzerOptions:     analyzerOptions,
 		workspaceDir:        workspaceDir,
 		logger:              log,
 		liteLLMBaseURL:      liteLLMURL,
@@ -140,6 +207,7 @@ func NewCodeAnalyzerService(repo CodeAnalyzerRepository, workspaceDir string, li
 		liteLLMDefaultModel: liteLLMDefaultModel,
 		insightsManager:     insightsManager,
 	}
+	s.registerDefaultSourceProviders()
 
 	// Initialize insights components if LiteLLM credentials are provided
 	if liteLLMURL != "" && liteLLMAPIKey != "" && liteLLMDefaultModel != "" {
@@ -153,43 +221,113 @@ func NewCodeAnalyzerService(repo CodeAnalyzerRepository, workspaceDir string, li
 	return s
 }
 
-// IndexRepository starts the process of analyzing a repository
-func (s *CodeAnalyzerService) IndexRepository(url string) (*models.IndexRepositoryResponse, error) {
-	s.logger.Info("Starting repository indexing", "url", url)
+// IndexRepository queues the indexing of a branch, tag or commit of a repository, or of its
+// default branch when ref is empty, which the index workers run in the background. The kind
+// of source is detected from the URL unless given, and only applies to new repositories.
+// A stored credential is kept to fetch the repository with from then on. The credential given,
+// or else the one the repository is already fetched with, must pass AuthorizeCredential for the
+// user. The LLM calls of the job are charged to the user requesting it, if any.
+func (s *CodeAnalyzerService) IndexRepository(userID, role, url, kind, ref string, credentialID int64) (*models.IndexRepositoryResponse, error) {
+	s.logger.Info("Starting repository indexing", "url", url, "kind", kind, "ref", ref, "credential_id", credentialID, "user_id", userID)
 
-	// Parse the URL to extract owner/repo
-	parts := strings.Split(url, "/")
-	if len(parts) < 5 {
-		s.logger.Error("Invalid GitHub URL format", "url", url)
-		return nil, fmt.Errorf("invalid GitHub URL format")
+	if err := models.ValidateRef(ref); err != nil {
+		return nil, err
+	}
+
+	// Work out where the repository comes from
+	loc, err := source.Detect(url)
+	if err != nil {
+		s.logger.Error("Invalid repository URL", "url", url, "error", err)
+		return nil, err
+	}
+	if loc, err = loc.WithKind(kind); err != nil {
+		s.logger.Error("Invalid source kind", "url", url, "kind", kind, "error", err)
+		return nil, err
+	}
+	if s.sources[loc.Kind] == nil {
+		return nil, fmt.Errorf("unsupported source kind %q", loc.Kind)
+	}
+	s.logger.Debug("Parsed repository info", "kind", loc.Kind, "host", loc.Host, "owner", loc.Owner, "name", loc.Name)
+
+	// Local directories are indexed in place, other sources are fetched into the workspace
+	localPath := filepath.Join(s.workspaceDir, loc.Host, loc.Owner, loc.Name)
+	switch loc.Kind {
+	case source.KindLocal:
+		localPath = filepath.Clean(strings.TrimPrefix(url, "file://"))
+	case source.KindArchive:
+		localPath = filepath.Join(s.workspaceDir, source.KindArchive, loc.Name)
 	}
 
-	owner := parts[len(parts)-2]
-	name := parts[len(parts)-1]
-	s.logger.Debug("Parsed repository info", "owner", owner, "name", name)
+	repo := &models.Repository{
+		Kind:      loc.Kind,
+		URL:       url,
+		Name:      loc.Name,
+		Owner:     loc.Owner,
+		LocalPath: localPath,
+	}
+	if credentialID != 0 {
+		repo.CredentialID = &credentialID
+	}
+	return s.queueIndexing(repo, ref, userID, role)
+}
 
+// queueIndexing queues an index job for a ref of a repository, requested by a user, creating
+// the repository if it is new. A ref already queued or indexing keeps its job. No job is
+// queued once the user or repository spent its LLM budget.
+func (s *CodeAnalyzerService) queueIndexing(newRepo *models.Repository, ref, userID, role string) (*models.IndexRepositoryResponse, error) {
 	// Check if repository exists in database
-	existingRepo, err := s.repo.GetRepositoryByURL(url)
+	existingRepo, err := s.repo.GetRepositoryByURL(newRepo.URL)
 	if err != nil {
 		s.logger.Error("Error checking repository existence", "error", err)
 		return nil, fmt.Errorf("error checking repository: %w", err)
 	}
 
+	// The job fetches with the credential given, or else the one the repository is fetched
+	// with, only if the user may use it
+	credentialID := newRepo.CredentialID
+	if credentialID == nil && existingRepo != nil {
+		credentialID = existingRepo.CredentialID
+	}
+	if credentialID != nil {
+		if err := s.AuthorizeCredential(userID, role, *credentialID, newRepo.URL); err != nil {
+			s.logger.Warn("Credential refused for indexing", "url", newRepo.URL, "credential_id", *credentialID, "user_id", userID, "error", err)
+			return nil, err
+		}
+	}
+
+	repo := existingRepo
 	if existingRepo != nil {
 		s.logger.Info("Repository found in database", "id", existingRepo.ID, "status", existingRepo.IndexStatus)
 
-		// Repository already exists
-		// If already indexing, just return status
-		if existingRepo.IndexStatus == "in_progress" {
-			s.logger.Info("Repository indexing already in progress", "id", existingRepo.ID)
+		// A new credential replaces the one the repository was fetched with
+		if newRepo.CredentialID != nil && (existingRepo.CredentialID == nil || *existingRepo.CredentialID != *newRepo.CredentialID) {
+			if err := s.repo.SetRepositoryCredential(existingRepo.ID, newRepo.CredentialID); err != nil {
+				return nil, fmt.Errorf("error setting repository credential: %w", err)
+			}
+		}
+
+		// If the ref is already queued or indexing, just return its job
+		activeJob, err := s.repo.GetActiveIndexJob(existingRepo.ID, models.JobKindIndex, ref)
+		if err != nil {
+			s.logger.Error("Error checking active index job", "id", existingRepo.ID, "error", err)
+			return nil, fmt.Errorf("error checking index job: %w", err)
+		}
+		if activeJob != nil {
+			s.logger.Info("Repository indexing already in progress", "id", existingRepo.ID, "job_id", activeJob.ID)
 			return &models.IndexRepositoryResponse{
 				ID:          existingRepo.ID,
+				JobID:       activeJob.ID,
 				URL:         existingRepo.URL,
-				IndexStatus: existingRepo.IndexStatus,
+				Ref:         ref,
+				IndexStatus: "in_progress",
 				Message:     "Repository indexing in progress",
 			}, nil
 		}
 
+		if err := s.checkBudget(userID, existingRepo.ID); err != nil {
+			return nil, err
+		}
+
 		// Update status to in_progress
 		s.logger.Info("Updating repository status to in_progress", "id", existingRepo.ID)
 		err = s.repo.UpdateRepositoryStatus(existingRepo.ID, "in_progress", "")
@@ -197,309 +335,319 @@ func (s *CodeAnalyzerService) IndexRepository(url string) (*models.IndexReposito
 			s.logger.Error("Error updating repository status", "id", existingRepo.ID, "error", err)
 			return nil, fmt.Errorf("error updating repository status: %w", err)
 		}
+	} else {
+		if err := s.checkBudget(userID, 0); err != nil {
+			return nil, err
+		}
 
-		// Start analyzing in a goroutine
-		s.logger.Info("Starting repository processing in background", "id", existingRepo.ID)
-		s.processRepository(existingRepo.ID, existingRepo.Kind, url, owner, name, existingRepo.LocalPath)
-
-		return &models.IndexRepositoryResponse{
-			ID:          existingRepo.ID,
-			URL:         existingRepo.URL,
-			IndexStatus: "in_progress",
-			Message:     "Repository indexing completed",
-		}, nil
-	}
-
-	// Create a new repository entry
-	localPath := filepath.Join(s.workspaceDir, owner, name)
-	s.logger.Info("Creating new repository entry", "path", localPath)
+		// Create a new repository entry
+		s.logger.Info("Creating new repository entry", "kind", newRepo.Kind, "path", newRepo.LocalPath)
 
-	newRepo := &models.Repository{
-		Kind:        "github",
-		URL:         url,
-		Name:        name,
-		Owner:       owner,
-		LocalPath:   localPath,
-		IndexStatus: "in_progress",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
+		repo = newRepo
+		repo.IndexStatus = "in_progress"
+		repo.CreatedAt = time.Now()
+		repo.UpdatedAt = time.Now()
 
-	err = s.repo.CreateRepository(newRepo)
-	if err != nil {
-		s.logger.Error("Error creating repository", "error", err)
-		return nil, fmt.Errorf("error creating repository: %w", err)
+		err = s.repo.CreateRepository(repo)
+		if err != nil {
+			s.logger.Error("Error creating repository", "error", err)
+			return nil, fmt.Errorf("error creating repository: %w", err)
+		}
+		s.logger.Info("Repository created successfully", "id", repo.ID)
 	}
-	s.logger.Info("Repository created successfully", "id", newRepo.ID)
 
-	// Start analyzing in a goroutine
-	s.logger.Info("Starting repository processing in background", "id", newRepo.ID)
-	err = s.processRepository(newRepo.ID, newRepo.Kind, url, owner, name, localPath)
-	if err != nil {
-		s.logger.Error("Error processing repository", "error", err)
-		return nil, fmt.Errorf("error processing repository: %w", err)
+	// Queue the job; a worker picks it up outside of the request
+	job := &models.IndexJob{RepositoryID: repo.ID, Kind: models.JobKindIndex, Ref: ref, RequestedBy: userID, CredentialID: credentialID}
+	if err := s.repo.CreateIndexJob(job); err != nil {
+		s.logger.Error("Error creating index job", "id", repo.ID, "error", err)
+		s.repo.UpdateRepositoryStatus(repo.ID, "failed", fmt.Sprintf("Error queuing indexing: %v", err))
+		return nil, fmt.Errorf("error creating index job: %w", err)
 	}
+	s.logger.Info("Repository indexing queued", "id", repo.ID, "ref", ref, "job_id", job.ID)
+	s.wakeIndexWorkers()
 
 	return &models.IndexRepositoryResponse{
-		ID:          newRepo.ID,
-		URL:         newRepo.URL,
+		ID:          repo.ID,
+		JobID:       job.ID,
+		URL:         repo.URL,
+		Ref:         ref,
 		IndexStatus: "in_progress",
-		Message:     "Repository indexing completed",
+		Message:     "Repository indexing queued",
 	}, nil
 }
 
-// processRepository clones the repository and analyzes its code
-func (s *CodeAnalyzerService) processRepository(repoID int64, kind, url, owner, name, localPath string) error {
-	s.logger.Info("Processing repository", "id", repoID, "kind", kind, "url", url)
-	var err error
+// processRepository materializes the ref of an index job with the source provider of the
+// repository and analyzes its code. The repository status is left to the caller, which
+// knows whether the job was interrupted.
+func (s *CodeAnalyzerService) processRepository(run *jobRun, repo *models.Repository) error {
+	repoID, kind, url, ref := repo.ID, repo.Kind, repo.URL, run.job.Ref
+	localPath := models.RefCheckoutPath(repo.LocalPath, ref)
+	s.logger.Info("Processing repository", "id", repoID, "kind", kind, "url", url, "ref", ref)
+
+	run.setPhase(models.JobPhaseFetch)
+
+	provider := s.sources[kind]
+	if provider == nil {
+		s.logger.Error("No source provider for repository", "id", repoID, "kind", kind)
+		return fmt.Errorf("unsupported source kind %q", kind)
+	}
 
 	// Make sure the local directory exists
 	s.logger.Debug("Creating directory", "path", filepath.Dir(localPath))
-	if err = os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
-		errMsg := fmt.Sprintf("Error creating directories: %v", err)
-		s.logger.Error(errMsg, "path", filepath.Dir(localPath))
-		s.repo.UpdateRepositoryStatus(repoID, "failed", errMsg)
-		return err
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		s.logger.Error("Error creating directories", "path", filepath.Dir(localPath), "error", err)
+		return fmt.Errorf("error creating directories: %w", err)
 	}
 
-	// Clone or update repository
-	if _, err = os.Stat(localPath); os.IsNotExist(err) {
-		// Repository doesn't exist locally, clone it
-		s.logger.Info("Cloning repository", "url", url, "path", localPath)
-		err = s.cloneRepository(kind, url, localPath)
-		if err != nil {
-			errMsg := fmt.Sprintf("Error cloning repository: %v", err)
-			s.logger.Error(errMsg, "url", url)
-			s.repo.UpdateRepositoryStatus(repoID, "failed", errMsg)
-			return err
-		}
-		s.logger.Info("Repository cloned successfully", "path", localPath)
-	} else {
-		// Repository exists, update it
-		s.logger.Info("Updating existing repository", "path", localPath)
-		err = s.updateRepository(localPath)
-		if err != nil {
-			errMsg := fmt.Sprintf("Error updating repository: %v", err)
-			s.logger.Error(errMsg, "path", localPath)
-			s.repo.UpdateRepositoryStatus(repoID, "failed", errMsg)
-			return err
-		}
-		s.logger.Info("Repository updated successfully", "path", localPath)
+	credentials, err := s.sourceCredentials(repo, run.job)
+	if err != nil {
+		s.logger.Error("Error loading repository credential", "id", repoID, "error", err)
+		return fmt.Errorf("error loading repository credential: %w", err)
+	}
+
+	// Fetch the ref into its own directory, so refs can be indexed side by side. What the
+	// provider reports, such as the output of git, is redacted of the credential's secrets.
+	s.logger.Info("Fetching repository", "kind", kind, "url", url, "ref", ref, "path", localPath)
+	tree, err := provider.Fetch(run.ctx, source.Source{URL: url, Ref: ref, Credentials: credentials}, localPath)
+	if err != nil {
+		message := credentials.Redact(err.Error())
+		s.logger.Error("Error fetching repository", "url", url, "ref", ref, "error", message)
+		return fmt.Errorf("error fetching repository: %s", message)
 	}
+	s.logger.Info("Repository fetched successfully", "path", tree.Path, "commit", tree.Commit)
 
 	// Analyze the repository
-	s.logger.Info("Starting code analysis", "repoID", repoID, "path", localPath)
-	err = s.analyzeRepository(repoID, localPath)
+	s.logger.Info("Starting code analysis", "repoID", repoID, "path", tree.Path)
+	err = s.analyzeRepository(run, repo, tree)
 	if err != nil {
-		errMsg := fmt.Sprintf("Error analyzing repository: %v", err)
-		s.logger.Error(errMsg, "path", localPath)
-		s.repo.UpdateRepositoryStatus(repoID, "failed", errMsg)
-		return err
+		s.logger.Error("Error analyzing repository", "path", tree.Path, "error", err)
+		return fmt.Errorf("error analyzing repository: %w", err)
 	}
 	s.logger.Info("Repository analysis completed successfully", "repoID", repoID)
-
-	// Update status to completed
-	s.logger.Info("Updating repository status to completed", "repoID", repoID)
-	s.repo.UpdateRepositoryStatus(repoID, "completed", "")
 	return nil
 }
 
-// cloneRepository clones a repository from a remote URL
-func (s *CodeAnalyzerService) cloneRepository(kind, url, localPath string) error {
-	var gitURL string
-	switch kind {
-	// case "github":
-	// 	gitURL = url + ".git"
-	default:
-		gitURL = url
+// analyzeRepository analyzes the Go files of a fetched tree into the snapshot of its
+// commit: only those changed since the snapshot was last indexed, or all of them the first
+// time. It reports its progress to the job and stops between files once the job is
+// cancelled.
+func (s *CodeAnalyzerService) analyzeRepository(run *jobRun, repo *models.Repository, tree *source.Tree) error {
+	run.setPhase(models.JobPhaseAnalyze)
+	repoID, localPath, headCommit := repo.ID, tree.Path, tree.Commit
+
+	snapshot, err := s.selectSnapshot(repoID, run.job.Ref, headCommit)
+	if err != nil {
+		return fmt.Errorf("error selecting snapshot: %w", err)
 	}
-	s.logger.Debug("Determined git URL", "kind", kind, "url", gitURL)
+	run.setSnapshot(snapshot)
 
-	s.logger.Debug("Executing git clone command", "url", gitURL, "path", localPath)
-	cmd := exec.Command("git", "clone", gitURL, localPath)
-	output, err := cmd.CombinedOutput()
+	storedFiles, err := s.repo.GetSnapshotFiles(snapshot.ID)
 	if err != nil {
-		s.logger.Error("Git clone failed", "error", err, "output", string(output))
-		return fmt.Errorf("git clone failed: %w: %s", err, string(output))
+		return fmt.Errorf("error getting snapshot files: %w", err)
+	}
+	changes, err := s.planReindex(run.ctx, tree, snapshot.IndexedCommit, storedFiles)
+	if err != nil {
+		return err
 	}
-	return nil
-}
 
-// updateRepository pulls the latest changes from the remote
-func (s *CodeAnalyzerService) updateRepository(localPath string) error {
-	s.logger.Debug("Executing git pull command", "path", localPath)
-	cmd := exec.Command("git", "-C", localPath, "pull")
-	output, err := cmd.CombinedOutput()
+	s.logger.Info("Found Go files to analyze", "count", len(changes), "snapshot_id", snapshot.ID,
+		"from_commit", snapshot.IndexedCommit, "to_commit", headCommit)
+	run.setFilesTotal(len(changes))
+
+	// Each job gets its own analyzer, as analyzers keep the state of the files they analyzed
+	analyzer, err := goanalyzer.NewWithOptions(s.analyzerOptions)
 	if err != nil {
-		s.logger.Error("Git pull failed", "error", err, "output", string(output))
-		return fmt.Errorf("git pull failed: %w: %s", err, string(output))
+		return fmt.Errorf("error creating analyzer: %w", err)
 	}
-	return nil
-}
 
-// analyzeRepository analyzes all Go files in the repository
-func (s *CodeAnalyzerService) analyzeRepository(repoID int64, localPath string) error {
-	s.logger.Info("Finding Go files in repository", "path", localPath)
+	// Type-check the modules up front so calls and references resolve to qualified names;
+	// files that cannot be type-checked are still analyzed syntactically
+	if len(changes) > 0 {
+		if err := analyzer.TypeCheckModules(localPath); err != nil {
+			s.logger.Warn("Type-checking failed, using syntax-only analysis", "path", localPath, "error", err)
+		}
+	}
 
-	// Find all Go files
-	var goFiles []string
-	err := filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			s.logger.Error("Error accessing path during walk", "path", path, "error", err)
+	// What is stored, reconciled with the re-analyzed files package by package
+	storedFunctions, err := s.repo.GetSnapshotFunctionNames(snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("error getting snapshot functions: %w", err)
+	}
+	storedSymbols, err := s.repo.GetSnapshotSymbolNames(snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("error getting snapshot symbols: %w", err)
+	}
+	stored := newStoredIndex(storedFiles, storedFunctions, storedSymbols)
+
+	// Module paths by directory, used to derive the import path of each file's package
+	modulePaths := make(map[string]string)
+
+	// References by file ID, linked to symbols once every file is stored
+	fileRefs := make(map[int64][]analyzerModels.ReferenceInfo)
+
+	// Process each package
+	done := 0
+	for _, pkgChanges := range groupChangesByPackage(changes) {
+		if err := run.ctx.Err(); err != nil {
 			return err
 		}
-		if !info.IsDir() && strings.HasSuffix(path, ".go") {
-			// Exclude vendored files
-			if !strings.Contains(path, "/vendor/") && !strings.Contains(path, "/.git/") {
-				goFiles = append(goFiles, path)
-			}
+		if err := s.reindexPackage(run, analyzer, repoID, localPath, stored, pkgChanges, modulePaths, fileRefs); err != nil {
+			return err
 		}
-		return nil
-	})
-	if err != nil {
-		s.logger.Error("Error walking directory", "error", err)
-		return fmt.Errorf("error walking directory: %w", err)
+
+		done += len(pkgChanges)
+		run.setFilesDone(done)
+		s.logger.Debug("Analysis progress", "processed", done, "total", len(changes))
 	}
 
-	s.logger.Info("Found Go files to analyze", "count", len(goFiles))
+	run.setPhase(models.JobPhaseLink)
 
-	// Process each file
-	for i, filePath := range goFiles {
-		if i > 0 && i%100 == 0 {
-			s.logger.Info("Analysis progress", "processed", i, "total", len(goFiles))
-		}
+	// Link calls to their callees now that every function of the snapshot is stored,
+	// including the calls of unchanged files whose callee was removed
+	if err := s.linkFunctionCalls(snapshot.ID); err != nil {
+		s.logger.Warn("Error linking function calls", "snapshot_id", snapshot.ID, "error", err)
+	}
 
-		// Get relative path from repo root
-		relPath, err := filepath.Rel(localPath, filePath)
-		if err != nil {
-			s.logger.Warn("Unable to get relative path for file", "file", filePath, "error", err)
-			continue
+	// Link references to the symbols they use, which may be declared in any file
+	if err := s.linkSymbolReferences(snapshot.ID, fileRefs); err != nil {
+		s.logger.Warn("Error linking symbol references", "snapshot_id", snapshot.ID, "error", err)
+	}
+
+	// The next index of the snapshot only analyzes the files changed since this commit
+	if headCommit != "" {
+		if err := s.repo.UpdateSnapshotIndexedCommit(snapshot.ID, headCommit); err != nil {
+			return fmt.Errorf("error recording indexed commit: %w", err)
 		}
+	}
 
-		s.logger.Debug("Analyzing file", "file", relPath)
+	s.logger.Info("Repository analysis completed", "files_processed", len(changes))
+	return nil
+}
 
-		// Analyze the file
-		analysis, err := s.analyzer.AnalyzeFile(filePath)
-		if err != nil {
-			s.logger.Warn("Error analyzing file", "file", relPath, "error", err)
-			continue
-		}
-		s.logger.Debug("File analyzed successfully", "file", relPath, "package", analysis.Package)
-
-		// Create repository file entry
-		file := &models.RepositoryFile{
-			RepositoryID: repoID,
-			FilePath:     relPath,
-			Package:      analysis.Package,
-			LastAnalyzed: time.Now(),
-			CreatedAt:    time.Now(),
-			UpdatedAt:    time.Now(),
-		}
+// storeFileAnalysis stores the functions, symbols, calls, references and imports of a
+// re-analyzed file, and generates insights for its new and changed functions
+func (s *CodeAnalyzerService) storeFileAnalysis(run *jobRun, repoID int64, f *reindexedFile) error {
+	relPath, functions, symbols := f.relPath, f.functions, f.symbols
+	funcCalls, funcRefs, fileDeps := f.calls, f.refs, f.deps
+	var err error
 
-		err = s.repo.CreateRepositoryFile(file)
+	// Store functions and symbols
+	if len(functions) > 0 {
+		err = s.repo.BatchCreateFunctions(functions)
 		if err != nil {
-			s.logger.Error("Error creating file entry", "file", relPath, "error", err)
-			return fmt.Errorf("error creating file entry: %w", err)
+			s.logger.Error("Error creating function entries", "file", relPath, "error", err)
+			return fmt.Errorf("error creating function entries: %w", err)
 		}
-		s.logger.Debug("File entry created", "file", relPath, "fileID", file.ID)
+		s.logger.Debug("Function entries created", "file", relPath, "count", len(functions))
 
-		// Convert functions and symbols to repository models
-		functions, symbols, _, funcCalls, funcRefs, fileDeps := models.FileAnalysisToRepositoryModels(analysis, repoID, file.ID)
-		s.logger.Info("Extracted entities from file", "file", relPath, "functions", len(functions), "symbols", len(symbols),
-			"calls", len(funcCalls), "references", len(funcRefs), "dependencies", len(fileDeps))
-
-		// Store functions and symbols
-		if len(functions) > 0 {
-			err = s.repo.BatchCreateFunctions(functions)
-			if err != nil {
-				s.logger.Error("Error creating function entries", "file", relPath, "error", err)
-				return fmt.Errorf("error creating function entries: %w", err)
+		// Store the statement trees of the functions; the statements of kept functions were
+		// cleared along with the rest of the analysis of the file
+		if len(f.statements) > 0 {
+			for i := range f.statements {
+				f.statements[i].FunctionID = functions[f.statements[i].FunctionIndex].ID
 			}
-			s.logger.Debug("Function entries created", "file", relPath, "count", len(functions))
-
-			// Now process function calls and references using the real function IDs
-			if len(funcCalls) > 0 {
-				// Update caller IDs with real database IDs
-				for i := range funcCalls {
-					// The CallerID currently contains the index into the functions slice
-					fnIndex := funcCalls[i].CallerID
-					if fnIndex >= 0 && int(fnIndex) < len(functions) {
-						funcCalls[i].CallerID = functions[fnIndex].ID
-					}
-				}
+			if err := s.repo.BatchCreateFunctionStatements(f.statements); err != nil {
+				s.logger.Error("Error creating function statements", "file", relPath, "error", err)
+				return fmt.Errorf("error creating function statements: %w", err)
+			}
+			s.logger.Debug("Function statements created", "file", relPath, "count", len(f.statements))
+		}
 
-				// Store function calls in the database
-				for _, call := range funcCalls {
-					err = s.repo.AddFunctionCall(&call)
-					if err != nil {
-						s.logger.Warn("Error creating function call", "caller_id", call.CallerID, "callee", call.CalleeName, "error", err)
-						// Continue with other calls, don't fail the entire analysis
-					}
+		// Now process function calls and references using the real function IDs
+		if len(funcCalls) > 0 {
+			// Update caller IDs with real database IDs
+			for i := range funcCalls {
+				// The CallerID currently contains the index into the functions slice
+				fnIndex := funcCalls[i].CallerID
+				if fnIndex >= 0 && int(fnIndex) < len(functions) {
+					funcCalls[i].CallerID = functions[fnIndex].ID
 				}
-				s.logger.Debug("Function calls created", "file", relPath, "count", len(funcCalls))
 			}
 
-			// Process function references
-			if len(funcRefs) > 0 {
-				// Update function IDs with real database IDs
-				for i := range funcRefs {
-					// The FunctionID currently contains the index into the functions slice
-					fnIndex := funcRefs[i].FunctionID
-					if fnIndex >= 0 && int(fnIndex) < len(functions) {
-						funcRefs[i].FunctionID = functions[fnIndex].ID
-					}
+			// Store function calls in the database; callees are linked once all files are stored
+			for _, call := range funcCalls {
+				err = s.repo.AddFunctionCall(&call)
+				if err != nil {
+					s.logger.Warn("Error creating function call", "caller_id", call.CallerID, "callee", call.CalleeName, "error", err)
+					// Continue with other calls, don't fail the entire analysis
 				}
+			}
+			s.logger.Debug("Function calls created", "file", relPath, "count", len(funcCalls))
+		}
 
-				// Store function references in the database
-				for _, ref := range funcRefs {
-					err = s.repo.AddFunctionReference(&ref)
-					if err != nil {
-						s.logger.Warn("Error creating function reference", "function_id", ref.FunctionID, "type", ref.ReferenceType, "error", err)
-						// Continue with other references, don't fail the entire analysis
-					}
+		// Process function references
+		if len(funcRefs) > 0 {
+			// Update function IDs with real database IDs
+			for i := range funcRefs {
+				// The FunctionID currently contains the index into the functions slice
+				fnIndex := funcRefs[i].FunctionID
+				if fnIndex >= 0 && int(fnIndex) < len(functions) {
+					funcRefs[i].FunctionID = functions[fnIndex].ID
 				}
-				s.logger.Debug("Function references created", "file", relPath, "count", len(funcRefs))
 			}
 
-			// Store insights
-			for _, function := range functions {
-				s.logger.Info("Storing insights for repository", "file", relPath)
-				_, err = s.insightsManager.GenerateAndSaveFunctionInsight(repoID, function.ID, "gpt-4o")
+			// Store function references in the database
+			for _, ref := range funcRefs {
+				err = s.repo.AddFunctionReference(&ref)
 				if err != nil {
-					s.logger.Error("Error storing insights", "file", relPath, "error", err)
-					return fmt.Errorf("error storing insights: %w", err)
+					s.logger.Warn("Error creating function reference", "function_id", ref.FunctionID, "type", ref.ReferenceType, "error", err)
+					// Continue with other references, don't fail the entire analysis
 				}
-				s.logger.Debug("Insights stored", "file", relPath)
 			}
-
+			s.logger.Debug("Function references created", "file", relPath, "count", len(funcRefs))
 		}
 
-		if len(symbols) > 0 {
-			err = s.repo.BatchCreateSymbols(symbols)
+		// Store insights, keeping those of functions whose code did not change
+		for i, function := range functions {
+			if f.unchanged[i] {
+				continue
+			}
+
+			// The same code indexed in another snapshot already has an insight
+			copied, err := s.repo.CopyFunctionInsight(repoID, function.ID, function.BodyHash)
 			if err != nil {
-				s.logger.Error("Error creating symbol entries", "file", relPath, "error", err)
-				return fmt.Errorf("error creating symbol entries: %w", err)
+				s.logger.Warn("Error reusing function insight", "function_id", function.ID, "error", err)
+			} else if copied {
+				continue
 			}
-			s.logger.Debug("Symbol entries created", "file", relPath, "count", len(symbols))
-		}
 
-		// Store file dependencies
-		if len(fileDeps) > 0 {
-			s.logger.Info("Adding file dependencies", "file", relPath, "count", len(fileDeps),
-				"fileDependencies", fileDeps)
-			err = s.repo.BatchAddFileDependencies(fileDeps)
+			// The insight is generated with the configured default model
+			s.logger.Info("Storing insights for repository", "file", relPath)
+			_, err = s.insightsManager.GenerateAndSaveFunctionInsight(run.ctx, repoID, function.ID, "")
 			if err != nil {
-				s.logger.Error("Error creating file dependency entries", "file", relPath, "error", err)
-				// Don't fail the entire analysis for dependency errors, just log it
-				s.logger.Warn("Continuing analysis despite dependency errors")
-			} else {
-				s.logger.Debug("File dependency entries created", "file", relPath, "count", len(fileDeps))
+				// The LLM calls were already retried; the function is indexed without an insight
+				s.logger.Error("Error storing insights", "file", relPath, "function", function.Name, "error", err)
+				continue
 			}
+			run.llmCall()
+			s.logger.Debug("Insights stored", "file", relPath)
 		}
 
 	}
 
-	s.logger.Info("Repository analysis completed", "files_processed", len(goFiles))
+	if len(symbols) > 0 {
+		err = s.repo.BatchCreateSymbols(symbols)
+		if err != nil {
+			s.logger.Error("Error creating symbol entries", "file", relPath, "error", err)
+			return fmt.Errorf("error creating symbol entries: %w", err)
+		}
+		s.logger.Debug("Symbol entries created", "file", relPath, "count", len(symbols))
+	}
+
+	// Store file dependencies
+	if len(fileDeps) > 0 {
+		s.logger.Info("Adding file dependencies", "file", relPath, "count", len(fileDeps),
+			"fileDependencies", fileDeps)
+		err = s.repo.BatchAddFileDependencies(fileDeps)
+		if err != nil {
+			s.logger.Error("Error creating file dependency entries", "file", relPath, "error", err)
+			// Don't fail the entire analysis for dependency errors, just log it
+			s.logger.Warn("Continuing analysis despite dependency errors")
+		} else {
+			s.logger.Debug("File dependency entries created", "file", relPath, "count", len(fileDeps))
+		}
+	}
+
 	return nil
 }
 
@@ -525,9 +673,10 @@ func (s *CodeAnalyzerService) InitializeInsightsManager(dbConn *sql.DB) {
 	}
 }
 
-// GetRepositoryIndex retrieves the analysis for a repository or specific file
-func (s *CodeAnalyzerService) GetRepositoryIndex(url, filePath string) (*models.GetIndexResponse, error) {
-	s.logger.Info("Getting repository index", "url", url, "filePath", filePath)
+// GetRepositoryIndex retrieves the analysis for a repository or specific file at an indexed
+// branch, tag or commit, or at the default branch when ref is empty
+func (s *CodeAnalyzerService) GetRepositoryIndex(url, filePath, ref string) (*models.GetIndexResponse, error) {
+	s.logger.Info("Getting repository index", "url", url, "filePath", filePath, "ref", ref)
 
 	// Get repository by URL
 	repo, err := s.repo.GetRepositoryByURL(url)
@@ -548,10 +697,21 @@ func (s *CodeAnalyzerService) GetRepositoryIndex(url, filePath string) (*models.
 		Metadata:        make(map[string]interface{}),
 	}
 
+	// A repository whose first index has not stored anything yet has no files to return
+	snapshot, err := s.resolveSnapshot(repo, ref)
+	if errors.Is(err, errNotIndexed) && ref == "" && filePath == "" {
+		return response, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.Snapshot = snapshot
+	s.logger.Debug("Snapshot found", "snapshot_id", snapshot.ID, "commit", snapshot.CommitSHA)
+
 	// If a specific file was requested
 	if filePath != "" {
 		s.logger.Debug("Getting specific file", "filePath", filePath)
-		file, err := s.repo.GetRepositoryFileByPath(repo.ID, filePath)
+		file, err := s.repo.GetSnapshotFileByPath(snapshot.ID, filePath)
 		if err != nil {
 			s.logger.Error("Error retrieving file", "filePath", filePath, "error", err)
 			return nil, fmt.Errorf("error retrieving file: %w", err)
@@ -632,8 +792,8 @@ func (s *CodeAnalyzerService) GetRepositoryIndex(url, filePath string) (*models.
 			"functions", len(functions), "symbols", len(symbols))
 	} else {
 		// Get all files
-		s.logger.Debug("Getting all files for repository", "repoID", repo.ID)
-		files, err := s.repo.GetRepositoryFiles(repo.ID)
+		s.logger.Debug("Getting all files for snapshot", "snapshotID", snapshot.ID)
+		files, err := s.repo.GetSnapshotFiles(snapshot.ID)
 		if err != nil {
 			s.logger.Error("Error retrieving files", "error", err)
 			return nil, fmt.Errorf("error retrieving files: %w", err)
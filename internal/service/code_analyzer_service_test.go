@@ -101,7 +101,7 @@ func TestGetRepositoryIndex_RealDB(t *testing.T) {
 
 	// Test 1: Get entire repository index
 	t.Run("GetEntireRepositoryIndex", func(t *testing.T) {
-		response, err := service.GetRepositoryIndex(testRepo.URL, "")
+		response, err := service.GetRepositoryIndex(testRepo.URL, "", "")
 		assert.NoError(t, err, "Should not return an error")
 		responseJson, err := json.MarshalIndent(response, "", "  ")
 		t.Logf("Repository index response: %s", string(responseJson))
@@ -169,7 +169,7 @@ func TestGetRepositoryIndex_RealDB(t *testing.T) {
 			t.Logf("Testing with file: %s (ID: %d)", testFile.FilePath, testFile.ID)
 
 			// Get index for this specific file
-			response, err := service.GetRepositoryIndex(testRepo.URL, testFile.FilePath)
+			response, err := service.GetRepositoryIndex(testRepo.URL, testFile.FilePath, "")
 
 			// Check for errors
 			require.NoError(t, err, "Should not return an error")
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/secrets"
+	"cred.com/hack25/backend/pkg/source"
+)
+
+// Errors of credential operations, which the handlers turn into statuses
+var (
+	ErrCredentialsDisabled = errors.New("credentials store is not configured")
+	ErrCredentialNotFound  = errors.New("credential not found")
+	ErrCredentialForbidden = errors.New("credential belongs to another owner")
+	ErrCredentialHost      = errors.New("credential is for another host")
+)
+
+// SetCredentialsKey enables the credentials store, encrypting secrets with a base64-encoded
+// 32-byte key
+func (s *CodeAnalyzerService) SetCredentialsKey(key string) error {
+	box, err := secrets.NewBox(key)
+	if err != nil {
+		return err
+	}
+	s.credentialBox = box
+	return nil
+}
+
+// CreateCredential encrypts and stores a credential. User credentials belong to the caller;
+// organization credentials can only be stored by admins.
+func (s *CodeAnalyzerService) CreateCredential(userID, role string, request *models.CreateCredentialRequest) (*models.RepositoryCredential, error) {
+	if s.credentialBox == nil {
+		return nil, ErrCredentialsDisabled
+	}
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	ownerID := request.OwnerID
+	if request.OwnerType == models.CredentialOwnerUser {
+		ownerID = userID
+	} else if role != "admin" {
+		return nil, fmt.Errorf("only admins can store organization credentials: %w", ErrCredentialForbidden)
+	}
+
+	credential := &models.RepositoryCredential{
+		OwnerType: request.OwnerType,
+		OwnerID:   ownerID,
+		Name:      request.Name,
+		Kind:      request.Kind,
+		Host:      request.Host,
+		Username:  request.Username,
+		CreatedBy: userID,
+	}
+	secret, err := json.Marshal(request.Secret())
+	if err != nil {
+		return nil, err
+	}
+	if credential.EncryptedSecret, err = s.credentialBox.Seal(secret, credential.SecretBinding()); err != nil {
+		return nil, fmt.Errorf("error encrypting credential: %w", err)
+	}
+
+	if err := s.repo.CreateCredential(credential); err != nil {
+		s.logger.Error("Error storing credential", "owner_type", credential.OwnerType, "name", credential.Name, "error", err)
+		return nil, fmt.Errorf("error storing credential: %w", err)
+	}
+	s.logger.Info("Stored credential", "id", credential.ID, "owner_type", credential.OwnerType, "kind", credential.Kind, "host", credential.Host)
+	return credential, nil
+}
+
+// ListCredentials lists the credentials a user can index with: their own and those of the
+// organizations they are a member of. Secrets are never returned.
+func (s *CodeAnalyzerService) ListCredentials(userID string) ([]models.RepositoryCredential, error) {
+	credentials, err := s.repo.ListCredentials(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// DeleteCredential deletes a credential of the caller, or any credential for admins
+func (s *CodeAnalyzerService) DeleteCredential(userID, role string, id int64) error {
+	credential, err := s.repo.GetCredential(id)
+	if err != nil {
+		return fmt.Errorf("error getting credential: %w", err)
+	}
+	if credential == nil {
+		return ErrCredentialNotFound
+	}
+	if role != "admin" && (credential.OwnerType != models.CredentialOwnerUser || credential.OwnerID != userID) {
+		return ErrCredentialForbidden
+	}
+
+	if err := s.repo.DeleteCredential(id); err != nil {
+		return fmt.Errorf("error deleting credential: %w", err)
+	}
+	s.logger.Info("Deleted credential", "id", id)
+	return nil
+}
+
+// AuthorizeCredential checks that a user may index a repository URL with a credential: it
+// must be their own or that of an organization they are a member of, and be for the host
+// of the URL
+func (s *CodeAnalyzerService) AuthorizeCredential(userID, role string, id int64, url string) error {
+	credential, err := s.repo.GetCredential(id)
+	if err != nil {
+		return fmt.Errorf("error getting credential: %w", err)
+	}
+	if credential == nil {
+		return ErrCredentialNotFound
+	}
+	organizations, err := s.repo.ListUserOrganizations(userID)
+	if err != nil {
+		return fmt.Errorf("error getting organizations: %w", err)
+	}
+	if !credential.UsableBy(userID, role, organizations) {
+		return ErrCredentialForbidden
+	}
+
+	loc, err := source.Detect(url)
+	if err != nil {
+		return err
+	}
+	if loc.Host != credential.Host {
+		return fmt.Errorf("%w: %s is for %s, not %s", ErrCredentialHost, credential.Name, credential.Host, loc.Host)
+	}
+	return nil
+}
+
+// AddOrganizationMember lets a user index with the credentials of an organization
+func (s *CodeAnalyzerService) AddOrganizationMember(organization, userID string) (*models.OrganizationMember, error) {
+	if organization == "" || userID == "" {
+		return nil, errors.New("organization and user_id are required")
+	}
+	member := &models.OrganizationMember{Organization: organization, UserID: userID}
+	if err := s.repo.AddOrganizationMember(member); err != nil {
+		return nil, fmt.Errorf("error adding organization member: %w", err)
+	}
+	s.logger.Info("Added organization member", "organization", organization, "user_id", userID)
+	return member, nil
+}
+
+// RemoveOrganizationMember stops a user from indexing with the credentials of an organization.
+// Repositories they already indexed keep the credentials they were fetched with.
+func (s *CodeAnalyzerService) RemoveOrganizationMember(organization, userID string) error {
+	if err := s.repo.RemoveOrganizationMember(organization, userID); err != nil {
+		return fmt.Errorf("error removing organization member: %w", err)
+	}
+	s.logger.Info("Removed organization member", "organization", organization, "user_id", userID)
+	return nil
+}
+
+// sourceCredentials decrypts the credential the requester of an index job was authorized to
+// fetch its repository with, if any. It is only handed to the source provider, and only for
+// the host it was stored for.
+func (s *CodeAnalyzerService) sourceCredentials(repo *models.Repository, job *models.IndexJob) (*source.Credentials, error) {
+	if job.CredentialID == nil {
+		return nil, nil
+	}
+	if s.credentialBox == nil {
+		return nil, ErrCredentialsDisabled
+	}
+
+	credential, err := s.repo.GetCredential(*job.CredentialID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting credential: %w", err)
+	}
+	if credential == nil {
+		return nil, ErrCredentialNotFound
+	}
+	if loc, err := source.Detect(repo.URL); err != nil || loc.Host != credential.Host {
+		return nil, ErrCredentialHost
+	}
+
+	plaintext, err := s.credentialBox.Open(credential.EncryptedSecret, credential.SecretBinding())
+	if err != nil {
+		s.logger.Error("Error decrypting credential", "id", credential.ID, "error", err)
+		return nil, err
+	}
+	var secret models.CredentialSecret
+	if err := json.Unmarshal(plaintext, &secret); err != nil {
+		return nil, secrets.ErrDecrypt
+	}
+
+	if err := s.repo.TouchCredential(credential.ID); err != nil {
+		s.logger.Warn("Error recording credential use", "id", credential.ID, "error", err)
+	}
+	return &source.Credentials{
+		Username: credential.Username,
+		Password: secret.Password,
+		Token:    secret.Token,
+		SSHKey:   secret.SSHKey,
+	}, nil
+}
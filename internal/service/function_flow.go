@@ -0,0 +1,31 @@
+package service
+
+import (
+	"fmt"
+
+	"cred.com/hack25/backend/internal/models"
+)
+
+// GetFunctionFlow gets the statement tree of an indexed function along with its control-flow
+// graph, or nil if there is no such function
+func (s *CodeAnalyzerService) GetFunctionFlow(functionID int64) (*models.FunctionFlowResponse, error) {
+	function, err := s.repo.GetFunctionByID(functionID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting function: %w", err)
+	}
+	if function == nil {
+		return nil, nil
+	}
+
+	statements, err := s.repo.GetNestedFunctionStatements(functionID)
+	if err != nil {
+		s.logger.Error("Error getting function statements", "function_id", functionID, "error", err)
+		return nil, fmt.Errorf("error getting function statements: %w", err)
+	}
+
+	return &models.FunctionFlowResponse{
+		Function:    function,
+		Statements:  statements,
+		ControlFlow: models.BuildControlFlowGraph(statements),
+	}, nil
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/llm/usage"
+)
+
+// Causes a running job is stopped with
+var (
+	errJobCancelled   = errors.New("indexing cancelled")
+	errWorkerShutdown = errors.New("index workers shutting down")
+)
+
+// ErrIndexJobForbidden is returned when a user may not change a job
+var ErrIndexJobForbidden = errors.New("index job belongs to another user")
+
+// IndexJobConfig configures the workers that run index jobs
+type IndexJobConfig struct {
+	Workers      int           // Number of repositories indexed concurrently
+	MaxAttempts  int           // Times a job interrupted by restarts is started before it fails
+	PollInterval time.Duration // How often idle workers look for jobs queued by other servers
+	LeaseTimeout time.Duration // How long a running job may go without a heartbeat before it is recovered
+}
+
+// indexWorkerPool runs the queued index jobs
+type indexWorkerPool struct {
+	cfg     IndexJobConfig
+	wake    chan struct{}
+	stop    chan struct{}
+	drained chan struct{} // Closed once the workers stopped
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[int64]*jobRun
+}
+
+// jobRun is an index job being run by a worker. Its progress is stored on every change,
+// which is also when a cancellation requested through another server is noticed.
+type jobRun struct {
+	job      *models.IndexJob
+	snapshot *models.RepositorySnapshot // Set once the ref is resolved to a commit
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	meter    *usage.Meter // Counts the tokens of the LLM calls made with ctx
+	repo     CodeAnalyzerRepository
+	logger   *ServiceLogger
+}
+
+// setPhase records the phase the job entered
+func (r *jobRun) setPhase(phase string) {
+	r.job.Phase = phase
+	r.save()
+}
+
+// setSnapshot records the snapshot the job indexes into
+func (r *jobRun) setSnapshot(snapshot *models.RepositorySnapshot) {
+	r.snapshot = snapshot
+	r.job.SnapshotID = &snapshot.ID
+	r.save()
+}
+
+// setFilesTotal records the number of files to analyze
+func (r *jobRun) setFilesTotal(total int) {
+	r.job.FilesTotal = total
+	r.save()
+}
+
+// setFilesDone records the number of files analyzed
+func (r *jobRun) setFilesDone(done int) {
+	if r.job.FilesDone == done {
+		return
+	}
+	r.job.FilesDone = done
+	r.save()
+}
+
+// llmCall records an LLM call made by the job, with the tokens the job used so far
+func (r *jobRun) llmCall() {
+	r.job.LLMCalls++
+	r.job.TokensUsed = r.meter.Tokens()
+	r.save()
+}
+
+// save stores the progress of the job and stops it if its cancellation was requested
+func (r *jobRun) save() {
+	cancelRequested, err := r.repo.UpdateIndexJobProgress(r.job)
+	if err != nil {
+		r.logger.Warn("Error saving index job progress", "job_id", r.job.ID, "error", err)
+		return
+	}
+	if cancelRequested {
+		r.cancel(errJobCancelled)
+	}
+}
+
+// StartIndexWorkers settles the jobs a stopped process left running and starts the workers
+// that run queued jobs. Jobs with attempts left are resumed from the start, others fail.
+// Running jobs send heartbeats, so jobs of servers that stopped are recovered once their
+// lease expires, while those of servers still running them are left alone.
+func (s *CodeAnalyzerService) StartIndexWorkers(cfg IndexJobConfig) error {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = 2 * time.Minute
+	}
+
+	if _, err := s.recoverIndexJobs(cfg); err != nil {
+		return fmt.Errorf("error recovering index jobs: %w", err)
+	}
+
+	pool := &indexWorkerPool{
+		cfg:     cfg,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		drained: make(chan struct{}),
+		running: make(map[int64]*jobRun),
+	}
+	s.workers = pool
+
+	hostname, _ := os.Hostname()
+	for i := 0; i < cfg.Workers; i++ {
+		workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+		pool.wg.Add(1)
+		go s.runIndexWorker(pool, workerID)
+	}
+	go s.maintainIndexJobs(pool)
+
+	s.logger.Info("Index workers started", "workers", cfg.Workers)
+	return nil
+}
+
+// StopIndexWorkers stops claiming jobs and waits for the running ones to finish. Jobs still
+// running when the context is done are interrupted and queued again for the next start.
+func (s *CodeAnalyzerService) StopIndexWorkers(ctx context.Context) {
+	pool := s.workers
+	if pool == nil {
+		return
+	}
+	close(pool.stop)
+
+	done := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(pool.drained)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("Index workers drained")
+		return
+	case <-ctx.Done():
+	}
+
+	pool.mu.Lock()
+	for _, run := range pool.running {
+		run.cancel(errWorkerShutdown)
+	}
+	interrupted := len(pool.running)
+	pool.mu.Unlock()
+
+	s.logger.Warn("Interrupting running index jobs", "jobs", interrupted)
+	<-done
+}
+
+// recoverIndexJobs recovers the jobs whose lease expired and reports how many were queued again
+func (s *CodeAnalyzerService) recoverIndexJobs(cfg IndexJobConfig) (int64, error) {
+	requeued, finished, err := s.repo.RecoverIndexJobs(cfg.MaxAttempts, cfg.LeaseTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if requeued > 0 || finished > 0 {
+		s.logger.Info("Recovered interrupted index jobs", "requeued", requeued, "finished", finished)
+	}
+	return requeued, nil
+}
+
+// maintainIndexJobs sends the heartbeats of the jobs the pool runs and recovers the jobs of
+// stopped servers, several times per lease, until the workers stopped: jobs still running
+// while the pool drains keep their lease
+func (s *CodeAnalyzerService) maintainIndexJobs(pool *indexWorkerPool) {
+	ticker := time.NewTicker(pool.cfg.LeaseTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pool.drained:
+			return
+		case <-ticker.C:
+		}
+
+		pool.mu.Lock()
+		ids := make([]int64, 0, len(pool.running))
+		for id := range pool.running {
+			ids = append(ids, id)
+		}
+		pool.mu.Unlock()
+		if err := s.repo.HeartbeatIndexJobs(ids); err != nil {
+			s.logger.Warn("Error sending index job heartbeats", "jobs", len(ids), "error", err)
+		}
+
+		requeued, err := s.recoverIndexJobs(pool.cfg)
+		if err != nil {
+			s.logger.Error("Error recovering index jobs", "error", err)
+		}
+		if requeued > 0 {
+			s.wakeIndexWorkers()
+		}
+	}
+}
+
+// wakeIndexWorkers lets an idle worker claim a newly queued job without waiting for its next poll
+func (s *CodeAnalyzerService) wakeIndexWorkers() {
+	if s.workers == nil {
+		return
+	}
+	select {
+	case s.workers.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runIndexWorker claims and runs queued jobs until the pool stops
+func (s *CodeAnalyzerService) runIndexWorker(pool *indexWorkerPool, workerID string) {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case <-pool.stop:
+			return
+		default:
+		}
+
+		job, err := s.repo.ClaimIndexJob(workerID)
+		if err != nil {
+			s.logger.Error("Error claiming index job", "worker_id", workerID, "error", err)
+		}
+		if job != nil {
+			s.runIndexJob(pool, job)
+			continue
+		}
+
+		select {
+		case <-pool.stop:
+			return
+		case <-pool.wake:
+		case <-time.After(pool.cfg.PollInterval):
+		}
+	}
+}
+
+// finish records the final status of the job's snapshot, if it got one
+func (r *jobRun) finish(status string, errorMsg string) {
+	if r.snapshot != nil {
+		r.repo.UpdateSnapshotStatus(r.snapshot.ID, status, errorMsg)
+	}
+}
+
+// updateJobRepositoryStatus records how a job left the index of its repository. Jobs other
+// than indexing leave the index as it was.
+func (s *CodeAnalyzerService) updateJobRepositoryStatus(job *models.IndexJob, status string, errorMsg string) {
+	if job.Kind != "" && job.Kind != models.JobKindIndex {
+		return
+	}
+	s.repo.UpdateRepositoryStatus(job.RepositoryID, status, errorMsg)
+}
+
+// runIndexJob runs a claimed job, indexing its repository or generating its insights, and
+// records how the job ended
+func (s *CodeAnalyzerService) runIndexJob(pool *indexWorkerPool, job *models.IndexJob) {
+	// The LLM calls of the job are charged to its repository and the user who requested it
+	attribution := usage.Attribution{UserID: job.RequestedBy, RepositoryID: job.RepositoryID}
+	meter := &usage.Meter{}
+	ctx, cancel := context.WithCancelCause(usage.WithMeter(usage.WithAttribution(context.Background(), attribution), meter))
+	defer cancel(nil)
+
+	run := &jobRun{job: job, ctx: ctx, cancel: cancel, meter: meter, repo: s.repo, logger: s.logger}
+	pool.mu.Lock()
+	pool.running[job.ID] = run
+	pool.mu.Unlock()
+	defer func() {
+		pool.mu.Lock()
+		delete(pool.running, job.ID)
+		pool.mu.Unlock()
+	}()
+
+	s.logger.Info("Running index job", "job_id", job.ID, "repo_id", job.RepositoryID, "ref", job.Ref, "attempt", job.Attempts)
+
+	// A panic in the analysis fails the job rather than the server
+	defer func() {
+		if r := recover(); r != nil {
+			errMsg := fmt.Sprintf("indexing panicked: %v", r)
+			s.logger.Error("Index job panicked", "job_id", job.ID, "error", errMsg)
+			s.updateJobRepositoryStatus(job, "failed", errMsg)
+			run.finish("failed", errMsg)
+			s.repo.FinishIndexJob(job.ID, models.JobStatusFailed, errMsg)
+		}
+	}()
+
+	repo, err := s.repo.GetRepositoryByID(job.RepositoryID)
+	if err == nil && repo == nil {
+		err = fmt.Errorf("repository not found")
+	}
+	if err == nil {
+		switch job.Kind {
+		case models.JobKindInsights, models.JobKindRegenerate:
+			err = s.generateInsights(run)
+		default:
+			err = s.processRepository(run, repo)
+		}
+	}
+
+	switch cause := context.Cause(ctx); {
+	case err == nil:
+		s.logger.Info("Index job completed", "job_id", job.ID, "repo_id", job.RepositoryID)
+		s.updateJobRepositoryStatus(job, "completed", "")
+		run.finish("completed", "")
+		s.repo.FinishIndexJob(job.ID, models.JobStatusCompleted, "")
+	case errors.Is(cause, errJobCancelled):
+		s.logger.Info("Index job cancelled", "job_id", job.ID, "repo_id", job.RepositoryID)
+		s.updateJobRepositoryStatus(job, "cancelled", "")
+		run.finish("cancelled", "")
+		s.repo.FinishIndexJob(job.ID, models.JobStatusCancelled, "")
+	case errors.Is(cause, errWorkerShutdown):
+		// Resumed from the start by the next worker to claim it
+		s.logger.Info("Index job interrupted by shutdown", "job_id", job.ID, "repo_id", job.RepositoryID)
+		s.repo.RequeueIndexJob(job.ID)
+	default:
+		s.logger.Error("Index job failed", "job_id", job.ID, "repo_id", job.RepositoryID, "error", err)
+		s.updateJobRepositoryStatus(job, "failed", err.Error())
+		run.finish("failed", err.Error())
+		s.repo.FinishIndexJob(job.ID, models.JobStatusFailed, err.Error())
+	}
+}
+
+// GetIndexJob gets an index job with its progress, or nil if there is no such job
+func (s *CodeAnalyzerService) GetIndexJob(id int64) (*models.IndexJob, error) {
+	job, err := s.repo.GetIndexJob(id)
+	if err != nil {
+		s.logger.Error("Error retrieving index job", "job_id", id, "error", err)
+		return nil, fmt.Errorf("error retrieving index job: %w", err)
+	}
+	return job, nil
+}
+
+// CancelIndexJob cancels a queued job, or stops a running one at its next file. Finished jobs
+// are returned unchanged, and nil if there is no such job.
+func (s *CodeAnalyzerService) CancelIndexJob(userID, role string, id int64) (*models.IndexJob, error) {
+	s.logger.Info("Cancelling index job", "job_id", id, "user_id", userID)
+
+	job, err := s.GetIndexJob(id)
+	if err != nil || job == nil || job.Finished() {
+		return job, err
+	}
+	if err := s.authorizeIndexJob(userID, role, job); err != nil {
+		return nil, err
+	}
+
+	job, err = s.repo.RequestIndexJobCancel(id)
+	if err != nil {
+		s.logger.Error("Error cancelling index job", "job_id", id, "error", err)
+		return nil, fmt.Errorf("error cancelling index job: %w", err)
+	}
+	if job == nil {
+		return nil, nil
+	}
+
+	switch job.Status {
+	case models.JobStatusCancelled:
+		// The job was still queued
+		s.updateJobRepositoryStatus(job, "cancelled", "")
+	case models.JobStatusRunning:
+		// Jobs run by other servers stop at their next progress update
+		if pool := s.workers; pool != nil {
+			pool.mu.Lock()
+			if run, ok := pool.running[id]; ok {
+				run.cancel(errJobCancelled)
+			}
+			pool.mu.Unlock()
+		}
+	}
+
+	return job, nil
+}
+
+// authorizeIndexJob checks that a user may change a job: admins, the user who requested it, and
+// the users the credential of its repository is shared with
+func (s *CodeAnalyzerService) authorizeIndexJob(userID, role string, job *models.IndexJob) error {
+	if role == "admin" || (userID != "" && job.RequestedBy == userID) {
+		return nil
+	}
+
+	repo, err := s.repo.GetRepositoryByID(job.RepositoryID)
+	if err != nil {
+		return fmt.Errorf("error getting repository: %w", err)
+	}
+	if repo == nil || repo.CredentialID == nil {
+		return ErrIndexJobForbidden
+	}
+	err = s.AuthorizeCredential(userID, role, *repo.CredentialID, repo.URL)
+	if errors.Is(err, ErrCredentialNotFound) || errors.Is(err, ErrCredentialForbidden) || errors.Is(err, ErrCredentialHost) {
+		return ErrIndexJobForbidden
+	}
+	return err
+}
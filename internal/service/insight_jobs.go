@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/internal/repointel"
+)
+
+// ErrInsightsUnavailable is returned when insights are requested without an LLM configured to
+// generate them
+var ErrInsightsUnavailable = errors.New("insight generation is not configured")
+
+// GenerateRepositoryInsights queues a job generating the missing or stale insights of an indexed
+// repository bottom-up, from its functions and structs to the repository, with a model or the
+// default one. A job already queued or running for the repository is returned instead.
+func (s *CodeAnalyzerService) GenerateRepositoryInsights(userID string, repoID int64, model string) (*models.IndexJob, error) {
+	s.logger.Info("Queuing insight generation", "repo_id", repoID, "model", model)
+
+	if s.insightsManager == nil {
+		return nil, ErrInsightsUnavailable
+	}
+
+	repo, err := s.repo.GetRepositoryByID(repoID)
+	if err != nil {
+		s.logger.Error("Error retrieving repository", "repo_id", repoID, "error", err)
+		return nil, fmt.Errorf("error retrieving repository: %w", err)
+	}
+	if repo == nil {
+		return nil, nil
+	}
+
+	activeJob, err := s.repo.GetActiveIndexJob(repoID, models.JobKindInsights, "")
+	if err != nil {
+		s.logger.Error("Error checking active insights job", "repo_id", repoID, "error", err)
+		return nil, fmt.Errorf("error checking insights job: %w", err)
+	}
+	if activeJob != nil {
+		s.logger.Info("Insight generation already in progress", "repo_id", repoID, "job_id", activeJob.ID)
+		return activeJob, nil
+	}
+
+	if err := s.checkBudget(userID, repoID); err != nil {
+		return nil, err
+	}
+
+	job := &models.IndexJob{RepositoryID: repoID, Kind: models.JobKindInsights, Model: model, RequestedBy: userID}
+	if err := s.repo.CreateIndexJob(job); err != nil {
+		s.logger.Error("Error creating insights job", "repo_id", repoID, "error", err)
+		return nil, fmt.Errorf("error creating insights job: %w", err)
+	}
+	s.logger.Info("Insight generation queued", "repo_id", repoID, "job_id", job.ID)
+	s.wakeIndexWorkers()
+
+	return job, nil
+}
+
+// RegenerateStaleInsights queues a job regenerating the insights of a repository whose inputs
+// changed since they were generated, bottom-up, with a model or the default one. The job stops
+// once its LLM calls used maxTokens tokens, unless it is 0. A job already queued or running for
+// the repository is returned instead.
+func (s *CodeAnalyzerService) RegenerateStaleInsights(userID string, repoID int64, model string, maxTokens int) (*models.IndexJob, error) {
+	s.logger.Info("Queuing stale insight regeneration", "repo_id", repoID, "model", model, "max_tokens", maxTokens)
+
+	if s.insightsManager == nil {
+		return nil, ErrInsightsUnavailable
+	}
+
+	repo, err := s.repo.GetRepositoryByID(repoID)
+	if err != nil {
+		s.logger.Error("Error retrieving repository", "repo_id", repoID, "error", err)
+		return nil, fmt.Errorf("error retrieving repository: %w", err)
+	}
+	if repo == nil {
+		return nil, nil
+	}
+
+	activeJob, err := s.repo.GetActiveIndexJob(repoID, models.JobKindRegenerate, "")
+	if err != nil {
+		s.logger.Error("Error checking active regenerate job", "repo_id", repoID, "error", err)
+		return nil, fmt.Errorf("error checking regenerate job: %w", err)
+	}
+	if activeJob != nil {
+		s.logger.Info("Stale insight regeneration already in progress", "repo_id", repoID, "job_id", activeJob.ID)
+		return activeJob, nil
+	}
+
+	if err := s.checkBudget(userID, repoID); err != nil {
+		return nil, err
+	}
+
+	job := &models.IndexJob{RepositoryID: repoID, Kind: models.JobKindRegenerate, Model: model, MaxTokens: maxTokens, RequestedBy: userID}
+	if err := s.repo.CreateIndexJob(job); err != nil {
+		s.logger.Error("Error creating regenerate job", "repo_id", repoID, "error", err)
+		return nil, fmt.Errorf("error creating regenerate job: %w", err)
+	}
+	s.logger.Info("Stale insight regeneration queued", "repo_id", repoID, "job_id", job.ID)
+	s.wakeIndexWorkers()
+
+	return job, nil
+}
+
+// generateInsights runs an insights or regenerate job, its phases being the levels of insights
+// generated
+func (s *CodeAnalyzerService) generateInsights(run *jobRun) error {
+	if s.insightsManager == nil {
+		return ErrInsightsUnavailable
+	}
+	opts := repointel.HierarchyOptions{
+		Model:     run.job.Model,
+		StaleOnly: run.job.Kind == models.JobKindRegenerate,
+		MaxTokens: run.job.MaxTokens,
+	}
+	return s.insightsManager.GenerateHierarchy(run.ctx, run.job.RepositoryID, opts, insightsProgress{run})
+}
+
+// insightsProgress records the progress of the levels of an insights job as its phases, the
+// insights of each level being its files
+type insightsProgress struct {
+	run *jobRun
+}
+
+// SetPhase records the level of insights being generated, and how many it has to generate
+func (p insightsProgress) SetPhase(phase string, total int) {
+	p.run.job.Phase = phase
+	p.run.job.FilesTotal = total
+	p.run.job.FilesDone = 0
+	p.run.save()
+}
+
+// SetDone records the number of insights of the level generated
+func (p insightsProgress) SetDone(done int) {
+	p.run.setFilesDone(done)
+}
+
+// LLMCall records an insight generated with the LLM
+func (p insightsProgress) LLMCall() {
+	p.run.llmCall()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/llm/cache"
 	"cred.com/hack25/backend/pkg/llm/client"
 	"cred.com/hack25/backend/pkg/llm/interfaces"
 	"cred.com/hack25/backend/pkg/logger"
@@ -23,6 +24,7 @@ type ChatRequest struct {
 	Temperature *float32             `json:"temperature,omitempty"`
 	TopP        *float32             `json:"top_p,omitempty"`
 	Stream      bool                 `json:"stream,omitempty"`
+	Cache       string               `json:"cache,omitempty"` // "bypass" or "refresh" the response cache, used by default
 }
 
 // ChatResponse represents a response from chatting with an LLM
@@ -49,6 +51,15 @@ func NewLLMService(clientFactory *client.Factory, defaultModelName string) *LLMS
 
 // Chat sends a chat request to the appropriate LLM
 func (s *LLMService) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	// The request may bypass or refresh the cache of responses
+	if req.Cache != "" {
+		mode, err := cache.ParseMode(req.Cache)
+		if err != nil {
+			return nil, err
+		}
+		ctx = cache.WithMode(ctx, mode)
+	}
+
 	// Determine model to use
 	modelName := s.defaultModel.Name
 	provider := s.defaultModel.Provider
@@ -78,6 +89,11 @@ func (s *LLMService) Chat(ctx context.Context, req ChatRequest) (*ChatResponse,
 		model = defaultModel
 	}
 
+	// Fallback chains are resolved by the factory, whose client reports the model that answered
+	if interfaces.IsFallbackChain(req.ModelName) {
+		fullModelName = req.ModelName
+	}
+
 	// Get the appropriate client
 	llmClient, err := s.clientFactory.GetClient(fullModelName)
 	if err != nil {
@@ -141,6 +157,11 @@ func (s *LLMService) StreamChat(ctx context.Context, req ChatRequest, callback f
 		model = defaultModel
 	}
 
+	// Fallback chains are resolved by the factory, whose client reports the model that answered
+	if interfaces.IsFallbackChain(req.ModelName) {
+		fullModelName = req.ModelName
+	}
+
 	// Get the appropriate client
 	llmClient, err := s.clientFactory.GetClient(fullModelName)
 	if err != nil {
@@ -187,6 +208,7 @@ func (s *LLMService) ChatWithModels(ctx context.Context, req models.LLMChatReque
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
 		Stream:      req.Stream,
+		Cache:       req.Cache,
 	}
 
 	// Call the regular Chat method
@@ -203,6 +225,12 @@ func (s *LLMService) ChatWithModels(ctx context.Context, req models.LLMChatReque
 	}, nil
 }
 
+// ListModels lists the models chats may use, keyed by their name along with their provider,
+// including those discovered on the local model server
+func (s *LLMService) ListModels(ctx context.Context) map[string]interfaces.Model {
+	return s.clientFactory.ListModels(ctx)
+}
+
 // GenerateEmbedding generates an embedding for the given text
 func (s *LLMService) GenerateEmbedding(ctx context.Context, text string, modelName string) ([]float32, error) {
 	// Use default embedding model if not specified
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/llm/usage"
+)
+
+// Errors of budget operations
+var (
+	ErrBudgetExceeded = errors.New("LLM budget exceeded")
+	ErrBudgetNotFound = errors.New("budget not found")
+)
+
+// LLMUsageRepository defines the methods required to record LLM usage and check budgets
+type LLMUsageRepository interface {
+	CreateLLMUsage(u *models.LLMUsage) error
+	SummarizeLLMUsage(q models.LLMUsageQuery) (*models.LLMUsageSummary, []models.LLMUsageSummary, error)
+	GetLLMSpend(scope, scopeID string, since time.Time) (float64, error)
+	SetLLMBudget(budget *models.LLMBudget) error
+	GetLLMBudget(scope, scopeID string) (*models.LLMBudget, error)
+	ListLLMBudgets() ([]models.LLMBudget, error)
+	DeleteLLMBudget(id int64) (bool, error)
+}
+
+// LLMUsageService records what LLM calls cost and who they were made for, and holds users
+// and repositories to their budgets
+type LLMUsageService struct {
+	repo   LLMUsageRepository
+	prices usage.PriceTable
+	logger *ServiceLogger
+	now    func() time.Time
+}
+
+// NewLLMUsageService creates a new LLM usage service, pricing calls with a price table
+func NewLLMUsageService(repo LLMUsageRepository, prices usage.PriceTable) *LLMUsageService {
+	if prices == nil {
+		prices = usage.DefaultPrices()
+	}
+	return &LLMUsageService{
+		repo:   repo,
+		prices: prices,
+		logger: NewServiceLogger("llm-usage-service"),
+		now:    time.Now,
+	}
+}
+
+// RecordUsage implements usage.Recorder, storing the usage of a call along with its cost.
+// Calls answered from the cache cost nothing. Calls whose usage cannot be stored are logged
+// rather than failed.
+func (s *LLMUsageService) RecordUsage(ctx context.Context, record usage.Record) {
+	cost := 0.0
+	if !record.Cached {
+		if _, ok := s.prices.Lookup(record.Model); !ok {
+			s.logger.Warn("No price for LLM model, its calls are recorded at no cost", "model", record.Model)
+		}
+		cost = s.prices.Cost(record.Model, record.PromptTokens, record.CompletionTokens)
+	}
+
+	u := &models.LLMUsage{
+		UserID:           record.UserID,
+		Feature:          record.Feature,
+		Model:            record.Model,
+		PromptTokens:     record.PromptTokens,
+		CompletionTokens: record.CompletionTokens,
+		CostUSD:          cost,
+		Estimated:        record.Estimated,
+		Cached:           record.Cached,
+		CreatedAt:        record.CreatedAt,
+	}
+	if record.RepositoryID != 0 {
+		u.RepositoryID = &record.RepositoryID
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = s.now()
+	}
+
+	if err := s.repo.CreateLLMUsage(u); err != nil {
+		s.logger.Error("Error recording LLM usage", "model", u.Model, "feature", u.Feature,
+			"prompt_tokens", u.PromptTokens, "completion_tokens", u.CompletionTokens, "error", err)
+	}
+}
+
+// GetUsage aggregates the LLM usage selected by a query. The period defaults to the current
+// month up to now.
+func (s *LLMUsageService) GetUsage(q models.LLMUsageQuery) (*models.LLMUsageReport, error) {
+	if q.GroupBy == "" {
+		q.GroupBy = models.UsageByFeature
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if q.To.IsZero() {
+		q.To = s.now()
+	}
+	if q.From.IsZero() {
+		q.From = models.MonthStart(q.To)
+	}
+
+	total, groups, err := s.repo.SummarizeLLMUsage(q)
+	if err != nil {
+		return nil, fmt.Errorf("error summarizing LLM usage: %w", err)
+	}
+	if groups == nil {
+		groups = []models.LLMUsageSummary{}
+	}
+	return &models.LLMUsageReport{GroupBy: q.GroupBy, From: q.From, To: q.To, Total: *total, Groups: groups}, nil
+}
+
+// CheckBudget checks that neither a user nor a repository spent its budget of the month,
+// returning ErrBudgetExceeded otherwise. Either may be left empty.
+func (s *LLMUsageService) CheckBudget(userID string, repoID int64) error {
+	if userID != "" {
+		if err := s.checkBudget(models.BudgetScopeUser, userID); err != nil {
+			return err
+		}
+	}
+	if repoID != 0 {
+		return s.checkBudget(models.BudgetScopeRepository, strconv.FormatInt(repoID, 10))
+	}
+	return nil
+}
+
+// checkBudget checks the budget of a user or repository, if it has one
+func (s *LLMUsageService) checkBudget(scope, scopeID string) error {
+	budget, err := s.repo.GetLLMBudget(scope, scopeID)
+	if err != nil {
+		return fmt.Errorf("error getting LLM budget: %w", err)
+	}
+	if budget == nil {
+		return nil
+	}
+	if err := s.fillSpent(budget); err != nil {
+		return err
+	}
+	if budget.Exceeded() {
+		s.logger.Warn("LLM budget exceeded", "scope", scope, "scope_id", scopeID,
+			"spent", budget.SpentUSD, "limit", budget.MonthlyLimitUSD)
+		return fmt.Errorf("%w: %s %s spent $%.2f of its $%.2f monthly budget",
+			ErrBudgetExceeded, scope, scopeID, budget.SpentUSD, budget.MonthlyLimitUSD)
+	}
+	return nil
+}
+
+// SetBudget sets the monthly budget of a user or repository
+func (s *LLMUsageService) SetBudget(request *models.SetLLMBudgetRequest) (*models.LLMBudget, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	budget := &models.LLMBudget{Scope: request.Scope, ScopeID: request.ScopeID, MonthlyLimitUSD: request.MonthlyLimitUSD}
+	if err := s.repo.SetLLMBudget(budget); err != nil {
+		return nil, fmt.Errorf("error setting LLM budget: %w", err)
+	}
+	if err := s.fillSpent(budget); err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// ListBudgets lists the budgets of every user and repository, with what they spent this month
+func (s *LLMUsageService) ListBudgets() ([]models.LLMBudget, error) {
+	budgets, err := s.repo.ListLLMBudgets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing LLM budgets: %w", err)
+	}
+	for i := range budgets {
+		if err := s.fillSpent(&budgets[i]); err != nil {
+			return nil, err
+		}
+	}
+	if budgets == nil {
+		budgets = []models.LLMBudget{}
+	}
+	return budgets, nil
+}
+
+// DeleteBudget deletes a budget, lifting the limit of its user or repository
+func (s *LLMUsageService) DeleteBudget(id int64) error {
+	deleted, err := s.repo.DeleteLLMBudget(id)
+	if err != nil {
+		return fmt.Errorf("error deleting LLM budget: %w", err)
+	}
+	if !deleted {
+		return ErrBudgetNotFound
+	}
+	return nil
+}
+
+// fillSpent sets what the user or repository of a budget spent this month
+func (s *LLMUsageService) fillSpent(budget *models.LLMBudget) error {
+	spent, err := s.repo.GetLLMSpend(budget.Scope, budget.ScopeID, models.MonthStart(s.now()))
+	if err != nil {
+		return fmt.Errorf("error getting LLM spend: %w", err)
+	}
+	budget.SpentUSD = spent
+	return nil
+}
+
+// SetUsageService holds the index jobs of users and repositories to their LLM budgets
+func (s *CodeAnalyzerService) SetUsageService(usageService *LLMUsageService) {
+	s.usageService = usageService
+}
+
+// checkBudget checks that a job may be queued for a user and repository, which is always
+// the case without a usage service
+func (s *CodeAnalyzerService) checkBudget(userID string, repoID int64) error {
+	if s.usageService == nil {
+		return nil
+	}
+	return s.usageService.CheckBudget(userID, repoID)
+}
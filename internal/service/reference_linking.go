@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"cred.com/hack25/backend/internal/models"
+	analyzerModels "cred.com/hack25/backend/pkg/goanalyzer/models"
+)
+
+// linkSymbolReferences stores the references found in each file of a snapshot against the
+// symbols they refer to. It runs after all files are stored, so references to symbols of
+// files processed later resolve as well.
+func (s *CodeAnalyzerService) linkSymbolReferences(snapshotID int64, fileRefs map[int64][]analyzerModels.ReferenceInfo) error {
+	files, err := s.repo.GetSnapshotFiles(snapshotID)
+	if err != nil {
+		return fmt.Errorf("error getting snapshot files: %w", err)
+	}
+	symbols, err := s.repo.GetSnapshotSymbolNames(snapshotID)
+	if err != nil {
+		return fmt.Errorf("error getting snapshot symbols: %w", err)
+	}
+
+	linker := models.NewSymbolLinker(files, symbols)
+
+	total := 0
+	var refs []models.SymbolReference
+	for fileID, references := range fileRefs {
+		total += len(references)
+		refs = append(refs, linker.Link(fileID, references)...)
+	}
+
+	if err := s.repo.BatchAddSymbolReferences(refs); err != nil {
+		return fmt.Errorf("error storing symbol references: %w", err)
+	}
+
+	s.logger.Info("Symbol references linked", "snapshot_id", snapshotID, "references", total, "linked", len(refs))
+	return nil
+}
+
+// FindSymbolUsages lists the references to a symbol of an indexed repository at a ref, or at
+// its default branch when ref is empty. The symbol is a package-level name such as
+// "DefaultTimeout", or "Type.Member" for a field or method; the package import path narrows
+// the search when the name is declared in several packages.
+func (s *CodeAnalyzerService) FindSymbolUsages(url, symbol, pkgPath, ref string) (*models.SymbolUsagesResponse, error) {
+	s.logger.Info("Finding symbol usages", "url", url, "symbol", symbol, "package", pkgPath, "ref", ref)
+
+	repo, err := s.repo.GetRepositoryByURL(url)
+	if err != nil {
+		s.logger.Error("Error retrieving repository", "url", url, "error", err)
+		return nil, fmt.Errorf("error retrieving repository: %w", err)
+	}
+
+	if repo == nil {
+		s.logger.Warn("Repository not found", "url", url)
+		return nil, fmt.Errorf("repository not found")
+	}
+
+	snapshot, err := s.resolveSnapshot(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	name, member, _ := strings.Cut(symbol, ".")
+	usages, err := s.repo.GetSymbolUsages(snapshot.ID, name, member, pkgPath)
+	if err != nil {
+		s.logger.Error("Error retrieving symbol usages", "symbol", symbol, "error", err)
+		return nil, fmt.Errorf("error retrieving symbol usages: %w", err)
+	}
+	s.logger.Debug("Symbol usages found", "symbol", symbol, "count", len(usages))
+
+	return &models.SymbolUsagesResponse{
+		Repository: repo,
+		Snapshot:   snapshot,
+		Symbol:     symbol,
+		Package:    pkgPath,
+		Usages:     usages,
+	}, nil
+}
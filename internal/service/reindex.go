@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/goanalyzer"
+	analyzerModels "cred.com/hack25/backend/pkg/goanalyzer/models"
+	"cred.com/hack25/backend/pkg/source"
+)
+
+// storedIndex is what was stored for a snapshot before it is re-indexed
+type storedIndex struct {
+	files     map[string]*models.RepositoryFile     // By path
+	functions map[int64][]models.RepositoryFunction // By file ID
+	symbols   map[int64][]models.RepositorySymbol   // By file ID
+}
+
+// newStoredIndex indexes the stored files, functions and symbols of a snapshot
+func newStoredIndex(files []models.RepositoryFile, functions []models.RepositoryFunction, symbols []models.RepositorySymbol) *storedIndex {
+	idx := &storedIndex{
+		files:     make(map[string]*models.RepositoryFile, len(files)),
+		functions: make(map[int64][]models.RepositoryFunction),
+		symbols:   make(map[int64][]models.RepositorySymbol),
+	}
+	for i := range files {
+		idx.files[files[i].FilePath] = &files[i]
+	}
+	for _, fn := range functions {
+		idx.functions[fn.FileID] = append(idx.functions[fn.FileID], fn)
+	}
+	for _, sym := range symbols {
+		idx.symbols[sym.FileID] = append(idx.symbols[sym.FileID], sym)
+	}
+	return idx
+}
+
+// reindexedFile is a file analyzed again, waiting to be stored once the stored functions
+// and symbols of its package are reconciled
+type reindexedFile struct {
+	relPath    string
+	file       *models.RepositoryFile
+	functions  []models.RepositoryFunction
+	symbols    []models.RepositorySymbol
+	statements []models.FunctionStatement
+	calls      []models.FunctionCall
+	refs       []models.FunctionReference
+	deps       []models.FileDependency
+	unchanged  []bool // By function; set when the stored function has the same code
+}
+
+// planReindex lists the Go files of a tree to index: none when it is at the commit its
+// snapshot was last indexed at, those changed since that commit when the tree is a git
+// checkout, or every file when there is nothing to diff against
+func (s *CodeAnalyzerService) planReindex(ctx context.Context, tree *source.Tree, baseCommit string, storedFiles []models.RepositoryFile) ([]models.FileChange, error) {
+	localPath, headCommit := tree.Path, tree.Commit
+	if baseCommit != "" && headCommit != "" && len(storedFiles) > 0 {
+		if baseCommit == headCommit {
+			return nil, nil
+		}
+		// Sources fetched as archives have no history to diff against
+		if tree.Git {
+			if gitCommitExists(ctx, localPath, baseCommit) {
+				changes, err := gitChangedFiles(ctx, localPath, baseCommit, headCommit)
+				if err == nil {
+					return models.FilterFileChanges(changes, isIndexedGoFile), nil
+				}
+				s.logger.Warn("Error diffing against the indexed commit, re-indexing every file", "commit", baseCommit, "error", err)
+			} else {
+				// History was rewritten, or the clone was replaced
+				s.logger.Warn("Indexed commit not found, re-indexing every file", "commit", baseCommit)
+			}
+		}
+	}
+
+	goFiles, err := s.listGoFiles(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return models.FullReindexChanges(storedFiles, goFiles), nil
+}
+
+// reindexPackage re-analyzes the changed files of a package and reconciles them with what is
+// stored: functions and symbols still present keep their rows, even when they moved to
+// another file of the package, and those gone are removed along with deleted files.
+// Insights are only regenerated for functions whose code changed.
+func (s *CodeAnalyzerService) reindexPackage(run *jobRun, analyzer *goanalyzer.Analyzer, repoID int64, localPath string, stored *storedIndex,
+	changes []models.FileChange, modulePaths map[string]string, fileRefs map[int64][]analyzerModels.ReferenceInfo) error {
+
+	// Files whose stored functions and symbols the re-analyzed ones replace
+	var pooled, deleted []int64
+	var analyze []string
+	for _, change := range changes {
+		switch change.Status {
+		case models.FileDeleted:
+			if file, ok := stored.files[change.Path]; ok {
+				pooled = append(pooled, file.ID)
+				deleted = append(deleted, file.ID)
+			}
+			continue
+		case models.FileRenamed:
+			if file, ok := stored.files[change.OldPath]; ok {
+				if _, taken := stored.files[change.Path]; taken {
+					pooled = append(pooled, file.ID)
+					deleted = append(deleted, file.ID)
+				} else {
+					// Keep the file's ID so what is stored for it moves along
+					if err := s.repo.RenameRepositoryFile(file.ID, change.Path); err != nil {
+						return fmt.Errorf("error renaming file entry: %w", err)
+					}
+					delete(stored.files, change.OldPath)
+					file.FilePath = change.Path
+					stored.files[change.Path] = file
+				}
+			}
+		}
+
+		if file, ok := stored.files[change.Path]; ok {
+			pooled = append(pooled, file.ID)
+		}
+		analyze = append(analyze, change.Path)
+	}
+
+	var poolFunctions []models.RepositoryFunction
+	var poolSymbols []models.RepositorySymbol
+	for _, fileID := range pooled {
+		poolFunctions = append(poolFunctions, stored.functions[fileID]...)
+		poolSymbols = append(poolSymbols, stored.symbols[fileID]...)
+	}
+	pool := models.NewReindexPool(poolFunctions, poolSymbols)
+
+	var files []*reindexedFile
+	var movedFunctions []models.RepositoryFunction
+	var movedSymbols []models.RepositorySymbol
+	for _, relPath := range analyze {
+		// Nothing of the package is changed yet, so stopping here leaves its old index intact
+		if err := run.ctx.Err(); err != nil {
+			return err
+		}
+
+		filePath := filepath.Join(localPath, relPath)
+		s.logger.Debug("Analyzing file", "file", relPath)
+
+		// Analyze the file
+		analysis, err := analyzer.AnalyzeFile(filePath)
+		if err != nil {
+			s.logger.Warn("Error analyzing file", "file", relPath, "error", err)
+			continue
+		}
+		s.logger.Debug("File analyzed successfully", "file", relPath, "package", analysis.Package)
+
+		// Create repository file entry
+		// Type-checked files know their import path; otherwise derive it from the enclosing module
+		packagePath := analysis.PackagePath
+		if packagePath == "" {
+			packagePath = importPathOf(localPath, filePath, modulePaths)
+		}
+
+		file := &models.RepositoryFile{
+			RepositoryID: repoID,
+			SnapshotID:   run.snapshot.ID,
+			FilePath:     relPath,
+			Package:      analysis.Package,
+			PackagePath:  packagePath,
+			LastAnalyzed: time.Now(),
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+
+		err = s.repo.CreateRepositoryFile(file)
+		if err != nil {
+			s.logger.Error("Error creating file entry", "file", relPath, "error", err)
+			return fmt.Errorf("error creating file entry: %w", err)
+		}
+		s.logger.Debug("File entry created", "file", relPath, "fileID", file.ID)
+		fileRefs[file.ID] = analysis.References
+
+		// Convert functions and symbols to repository models
+		functions, symbols, statements, funcCalls, funcRefs, fileDeps := models.FileAnalysisToRepositoryModels(analysis, repoID, file.ID)
+		s.logger.Info("Extracted entities from file", "file", relPath, "functions", len(functions), "symbols", len(symbols),
+			"statements", len(statements), "calls", len(funcCalls), "references", len(funcRefs), "dependencies", len(fileDeps))
+
+		f := &reindexedFile{
+			relPath:    relPath,
+			file:       file,
+			functions:  functions,
+			symbols:    symbols,
+			statements: statements,
+			calls:      funcCalls,
+			refs:       funcRefs,
+			deps:       fileDeps,
+			unchanged:  make([]bool, len(functions)),
+		}
+		for i, fn := range functions {
+			if prev, ok := pool.TakeFunction(fn); ok {
+				f.unchanged[i] = prev.BodyHash != "" && prev.BodyHash == fn.BodyHash
+				prev.FileID, prev.Line = fn.FileID, fn.Line
+				movedFunctions = append(movedFunctions, prev)
+			}
+		}
+		for _, sym := range symbols {
+			if prev, ok := pool.TakeSymbol(sym); ok {
+				prev.FileID, prev.Line = sym.FileID, sym.Line
+				movedSymbols = append(movedSymbols, prev)
+			}
+		}
+		files = append(files, f)
+	}
+
+	// Remove what no longer exists, then move what is kept to where it is now, so storing
+	// the re-analyzed files updates the kept rows in place
+	staleFunctions, staleSymbols := pool.Remaining()
+	if err := s.repo.DeleteFunctions(functionIDs(staleFunctions)); err != nil {
+		return fmt.Errorf("error removing functions: %w", err)
+	}
+	if err := s.repo.DeleteSymbols(symbolIDs(staleSymbols)); err != nil {
+		return fmt.Errorf("error removing symbols: %w", err)
+	}
+	if err := s.repo.MoveFunctions(movedFunctions); err != nil {
+		return fmt.Errorf("error moving functions: %w", err)
+	}
+	if err := s.repo.MoveSymbols(movedSymbols); err != nil {
+		return fmt.Errorf("error moving symbols: %w", err)
+	}
+	if err := s.repo.DeleteRepositoryFiles(deleted); err != nil {
+		return fmt.Errorf("error removing deleted files: %w", err)
+	}
+
+	fileIDs := make([]int64, len(files))
+	for i, f := range files {
+		fileIDs[i] = f.file.ID
+	}
+	if err := s.repo.ClearFileAnalysis(fileIDs); err != nil {
+		return fmt.Errorf("error clearing file analysis: %w", err)
+	}
+
+	for _, f := range files {
+		if err := s.storeFileAnalysis(run, repoID, f); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Debug("Package re-indexed", "repo_id", repoID, "snapshot_id", run.snapshot.ID, "files", len(files), "deleted_files", len(deleted),
+		"removed_functions", len(staleFunctions), "removed_symbols", len(staleSymbols))
+	return nil
+}
+
+// listGoFiles lists the Go files of a repository relative to its root, leaving out vendored files
+func (s *CodeAnalyzerService) listGoFiles(localPath string) ([]string, error) {
+	s.logger.Info("Finding Go files in repository", "path", localPath)
+
+	var goFiles []string
+	err := filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			s.logger.Error("Error accessing path during walk", "path", path, "error", err)
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(localPath, path)
+		if err != nil {
+			s.logger.Warn("Unable to get relative path for file", "file", path, "error", err)
+			return nil
+		}
+		if relPath = filepath.ToSlash(relPath); isIndexedGoFile(relPath) {
+			goFiles = append(goFiles, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Error walking directory", "error", err)
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+	return goFiles, nil
+}
+
+// isIndexedGoFile reports whether a file of a repository is indexed: Go files outside of
+// vendor directories
+func isIndexedGoFile(relPath string) bool {
+	path := "/" + relPath
+	return strings.HasSuffix(path, ".go") && !strings.Contains(path, "/vendor/") && !strings.Contains(path, "/.git/")
+}
+
+// groupChangesByPackage groups file changes by the directory, and so the package, of the file
+func groupChangesByPackage(changes []models.FileChange) [][]models.FileChange {
+	byDir := make(map[string][]models.FileChange)
+	for _, change := range changes {
+		dir := filepath.Dir(change.Path)
+		byDir[dir] = append(byDir[dir], change)
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	groups := make([][]models.FileChange, len(dirs))
+	for i, dir := range dirs {
+		groups[i] = byDir[dir]
+	}
+	return groups
+}
+
+// functionIDs returns the IDs of functions
+func functionIDs(functions []models.RepositoryFunction) []int64 {
+	ids := make([]int64, len(functions))
+	for i, fn := range functions {
+		ids[i] = fn.ID
+	}
+	return ids
+}
+
+// symbolIDs returns the IDs of symbols
+func symbolIDs(symbols []models.RepositorySymbol) []int64 {
+	ids := make([]int64, len(symbols))
+	for i, sym := range symbols {
+		ids[i] = sym.ID
+	}
+	return ids
+}
+
+// gitCommitExists reports whether a commit is in the history of a local repository
+func gitCommitExists(ctx context.Context, localPath, commit string) bool {
+	return exec.CommandContext(ctx, "git", "-C", localPath, "cat-file", "-e", commit+"^{commit}").Run() == nil
+}
+
+// gitChangedFiles lists the files changed between two commits of a local repository
+func gitChangedFiles(ctx context.Context, localPath, fromCommit, toCommit string) ([]models.FileChange, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", localPath, "diff", "--name-status", "-z", "-M", fromCommit, toCommit)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w", err)
+	}
+	return models.ParseGitNameStatus(string(output)), nil
+}
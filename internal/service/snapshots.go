@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"cred.com/hack25/backend/internal/models"
+)
+
+// errNotIndexed is returned when a repository was not indexed at the requested ref
+var errNotIndexed = errors.New("not indexed")
+
+// selectSnapshot picks the snapshot a job indexes a ref into once its commit is known. Refs
+// at one commit share its snapshot; otherwise the ref keeps its own snapshot, moved to the
+// new commit when no other ref resolves to it, so a branch is re-indexed in place while the
+// tags and commits along its history keep theirs.
+func (s *CodeAnalyzerService) selectSnapshot(repoID int64, ref, commit string) (*models.RepositorySnapshot, error) {
+	snapshot, err := s.repo.GetSnapshotByCommit(repoID, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot == nil {
+		current, err := s.repo.GetRefSnapshot(repoID, ref)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			refs, err := s.repo.CountSnapshotRefs(current.ID)
+			if err != nil {
+				return nil, err
+			}
+			if refs == 1 {
+				s.logger.Info("Advancing snapshot", "snapshot_id", current.ID, "ref", ref,
+					"from_commit", current.CommitSHA, "to_commit", commit)
+				if err := s.repo.AdvanceSnapshot(current.ID, commit); err != nil {
+					return nil, err
+				}
+				current.CommitSHA = commit
+				snapshot = current
+			}
+		}
+	}
+
+	if snapshot == nil {
+		snapshot = &models.RepositorySnapshot{RepositoryID: repoID, CommitSHA: commit, IndexStatus: "in_progress"}
+		if err := s.repo.CreateSnapshot(snapshot); err != nil {
+			return nil, err
+		}
+		s.logger.Info("Created snapshot", "snapshot_id", snapshot.ID, "ref", ref, "commit", commit)
+	}
+
+	if err := s.repo.SetSnapshotRef(repoID, ref, snapshot.ID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSnapshotStatus(snapshot.ID, "in_progress", ""); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// resolveSnapshot gets the snapshot to read for a ref of a repository: a branch or tag it
+// was indexed at, a commit SHA or prefix, or its default branch when ref is empty
+func (s *CodeAnalyzerService) resolveSnapshot(repo *models.Repository, ref string) (*models.RepositorySnapshot, error) {
+	snapshot, err := s.repo.ResolveSnapshot(repo.ID, ref)
+	if err != nil {
+		s.logger.Error("Error resolving snapshot", "repo_id", repo.ID, "ref", ref, "error", err)
+		return nil, fmt.Errorf("error resolving snapshot: %w", err)
+	}
+	if snapshot == nil {
+		s.logger.Warn("Snapshot not found", "repo_id", repo.ID, "ref", ref)
+		if ref == "" {
+			return nil, fmt.Errorf("repository %w", errNotIndexed)
+		}
+		return nil, fmt.Errorf("ref %s %w", ref, errNotIndexed)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+
+	"cred.com/hack25/backend/internal/models"
+	"cred.com/hack25/backend/pkg/source"
+)
+
+// SourceProvider materializes the working tree of a repository at a ref, fetching it into
+// dir unless it is indexed in place
+type SourceProvider interface {
+	Fetch(ctx context.Context, src source.Source, dir string) (*source.Tree, error)
+}
+
+// registerDefaultSourceProviders registers the providers that need no configuration: git
+// remotes, and the GitLab and Bitbucket APIs without credentials. Local directories are only
+// indexed once a provider with allowed roots is registered.
+func (s *CodeAnalyzerService) registerDefaultSourceProviders() {
+	git := source.NewGitProvider()
+	s.sources = map[string]SourceProvider{
+		source.KindGitHub:    git,
+		source.KindGit:       git,
+		source.KindGitLab:    source.NewGitLabProvider("", ""),
+		source.KindBitbucket: source.NewBitbucketProvider("", "", ""),
+		source.KindArchive:   source.NewArchiveProvider(s.uploadsDir()),
+	}
+}
+
+// RegisterSourceProvider sets the provider repositories of a kind are fetched with. It must
+// be called before the index workers are started.
+func (s *CodeAnalyzerService) RegisterSourceProvider(kind string, provider SourceProvider) {
+	s.sources[kind] = provider
+}
+
+// uploadsDir is where uploaded archives are stored
+func (s *CodeAnalyzerService) uploadsDir() string {
+	return filepath.Join(s.workspaceDir, "uploads")
+}
+
+// UploadRepository stores an uploaded .tar.gz or .zip archive of a repository under a name
+// and queues its indexing for a user. Uploading under the same name again replaces the archive.
+func (s *CodeAnalyzerService) UploadRepository(userID, name string, archive io.Reader) (*models.IndexRepositoryResponse, error) {
+	s.logger.Info("Storing uploaded repository archive", "name", name)
+
+	if err := source.StoreArchive(s.uploadsDir(), name, archive); err != nil {
+		s.logger.Error("Error storing archive", "name", name, "error", err)
+		return nil, err
+	}
+
+	return s.queueIndexing(&models.Repository{
+		Kind:      source.KindArchive,
+		URL:       source.ArchiveScheme + name,
+		Name:      name,
+		Owner:     "upload",
+		LocalPath: filepath.Join(s.workspaceDir, source.KindArchive, name),
+	}, "", userID, "")
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t(a);")},
+		"migrations/0001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (a INT);")},
+		"migrations/0001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"migrations/README.md":                  {Data: []byte("not a migration")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+	}
+	if m := migrations[0]; m.Version != 1 || m.Name != "create_table" || m.Up == "" || m.Down != "DROP TABLE t;" {
+		t.Errorf("Unexpected first migration: %+v", m)
+	}
+	if m := migrations[1]; m.Version != 2 || m.Name != "add_index" || m.Down != "" {
+		t.Errorf("Unexpected second migration: %+v", m)
+	}
+
+	fsys["migrations/0002_other.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err := LoadMigrations(fsys, "migrations"); err == nil || !strings.Contains(err.Error(), "used by both") {
+		t.Errorf("Expected a version used twice to fail, got %v", err)
+	}
+
+	delete(fsys, "migrations/0002_other.down.sql")
+	fsys["migrations/0003_no_up.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err := LoadMigrations(fsys, "migrations"); err == nil || !strings.Contains(err.Error(), "no up migration") {
+		t.Errorf("Expected a migration without up to fail, got %v", err)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected migration %d_%s to have version %d", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("Expected migration %d_%s to have a down migration", m.Version, m.Name)
+		}
+		if strings.Contains(m.Up, `\c `) {
+			t.Errorf("Expected migration %d_%s not to switch databases", m.Version, m.Name)
+		}
+	}
+	if len(migrations) < legacySchemaVersion {
+		t.Errorf("Expected the legacy schema version %d to be migrated, got %d migrations", legacySchemaVersion, len(migrations))
+	}
+}
@@ -0,0 +1,28 @@
+-- Users of the API
+CREATE SCHEMA IF NOT EXISTS users;
+
+-- The API server used to create the table in the public schema itself
+DO $$
+BEGIN
+    IF to_regclass('public.users') IS NOT NULL AND to_regclass('users.users') IS NULL THEN
+        ALTER TABLE public.users SET SCHEMA users;
+    END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS users.users (
+    id UUID PRIMARY KEY,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    first_name VARCHAR(100),
+    last_name VARCHAR(100),
+    active BOOLEAN DEFAULT TRUE,
+    role VARCHAR(50) DEFAULT 'user',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users.users(email);
+CREATE INDEX IF NOT EXISTS idx_users_role ON users.users(role);
+CREATE INDEX IF NOT EXISTS idx_users_active ON users.users(active);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS code_analysis.workflow_step_variables;
+DROP TABLE IF EXISTS code_analysis.workflow_step_dependencies;
+DROP TABLE IF EXISTS code_analysis.workflow_steps;
+DROP TABLE IF EXISTS code_analysis.method_params;
+DROP TABLE IF EXISTS code_analysis.methods;
+DROP TABLE IF EXISTS code_analysis.struct_fields;
+DROP TABLE IF EXISTS code_analysis.structs;
+DROP TABLE IF EXISTS code_analysis.init_functions;
+DROP TABLE IF EXISTS code_analysis.constants;
+DROP TABLE IF EXISTS code_analysis.global_vars;
+DROP TABLE IF EXISTS code_analysis.dependencies;
+DROP TABLE IF EXISTS code_analysis.files;
+DROP TABLE IF EXISTS code_analysis.repositories;
+DROP SCHEMA IF EXISTS code_analysis;
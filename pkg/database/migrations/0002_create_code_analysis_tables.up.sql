@@ -1,19 +1,9 @@
--- Connect to the database
-\c code_analyser
-
+-- Tables of the first version of the code analysis, kept for the data stored in them
 CREATE SCHEMA IF NOT EXISTS code_analysis;
 
--- Grant all privileges on code_analysis schema to code_analyser_user
-GRANT ALL PRIVILEGES ON SCHEMA code_analysis TO code_analyser_user;
-GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA code_analysis TO code_analyser_user;
-GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA code_analysis TO code_analyser_user;
-GRANT USAGE ON SCHEMA code_analysis TO code_analyser_user;
-ALTER DEFAULT PRIVILEGES IN SCHEMA code_analysis GRANT ALL PRIVILEGES ON TABLES TO code_analyser_user;
-ALTER DEFAULT PRIVILEGES IN SCHEMA code_analysis GRANT ALL PRIVILEGES ON SEQUENCES TO code_analyser_user;
-
 -- Create repositories table
 CREATE TABLE IF NOT EXISTS code_analysis.repositories (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     repo_url VARCHAR(255) UNIQUE NOT NULL,
     owner VARCHAR(100) NOT NULL,
     name VARCHAR(100) NOT NULL,
@@ -24,7 +14,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.repositories (
 
 -- Create files table
 CREATE TABLE IF NOT EXISTS code_analysis.files (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     repository_id UUID NOT NULL REFERENCES code_analysis.repositories(id) ON DELETE CASCADE,
     path VARCHAR(1000) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
@@ -34,7 +24,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.files (
 
 -- Create dependencies table
 CREATE TABLE IF NOT EXISTS code_analysis.dependencies (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -42,7 +32,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.dependencies (
 
 -- Create global_vars table
 CREATE TABLE IF NOT EXISTS code_analysis.global_vars (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     type VARCHAR(100),
@@ -52,7 +42,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.global_vars (
 
 -- Create constants table
 CREATE TABLE IF NOT EXISTS code_analysis.constants (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     type VARCHAR(100),
@@ -62,7 +52,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.constants (
 
 -- Create init_functions table
 CREATE TABLE IF NOT EXISTS code_analysis.init_functions (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     functionality TEXT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -70,7 +60,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.init_functions (
 
 -- Create structs table
 CREATE TABLE IF NOT EXISTS code_analysis.structs (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -78,7 +68,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.structs (
 
 -- Create struct_fields table
 CREATE TABLE IF NOT EXISTS code_analysis.struct_fields (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     struct_id UUID NOT NULL REFERENCES code_analysis.structs(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     type VARCHAR(100),
@@ -87,7 +77,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.struct_fields (
 
 -- Create methods table
 CREATE TABLE IF NOT EXISTS code_analysis.methods (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     receiver VARCHAR(255),
@@ -97,7 +87,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.methods (
 
 -- Create method_params table
 CREATE TABLE IF NOT EXISTS code_analysis.method_params (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     method_id UUID NOT NULL REFERENCES code_analysis.methods(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     type VARCHAR(100),
@@ -107,7 +97,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.method_params (
 
 -- Create workflow_steps table
 CREATE TABLE IF NOT EXISTS code_analysis.workflow_steps (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     file_id UUID NOT NULL REFERENCES code_analysis.files(id) ON DELETE CASCADE,
     name VARCHAR(255) NOT NULL,
     step_type VARCHAR(100) NOT NULL,
@@ -119,7 +109,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.workflow_steps (
 
 -- Create workflow_step_dependencies table
 CREATE TABLE IF NOT EXISTS code_analysis.workflow_step_dependencies (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     workflow_step_id UUID NOT NULL REFERENCES code_analysis.workflow_steps(id) ON DELETE CASCADE,
     dependency VARCHAR(255) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -127,7 +117,7 @@ CREATE TABLE IF NOT EXISTS code_analysis.workflow_step_dependencies (
 
 -- Create workflow_step_variables table
 CREATE TABLE IF NOT EXISTS code_analysis.workflow_step_variables (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     workflow_step_id UUID NOT NULL REFERENCES code_analysis.workflow_steps(id) ON DELETE CASCADE,
     variable_name VARCHAR(255) NOT NULL,
     is_input BOOLEAN NOT NULL,
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS code_analyzer.file_dependencies;
+DROP TABLE IF EXISTS code_analyzer.symbol_references;
+DROP TABLE IF EXISTS code_analyzer.repository_symbols;
+DROP TABLE IF EXISTS code_analyzer.function_statements;
+DROP TABLE IF EXISTS code_analyzer.function_references;
+DROP TABLE IF EXISTS code_analyzer.function_calls;
+DROP TABLE IF EXISTS code_analyzer.repository_functions;
+DROP TABLE IF EXISTS code_analyzer.repository_files;
+DROP TABLE IF EXISTS code_analyzer.repositories;
+DROP SCHEMA IF EXISTS code_analyzer;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS code_analyzer.repository_insights;
+DROP TABLE IF EXISTS code_analyzer.file_insights;
+DROP TABLE IF EXISTS code_analyzer.struct_insights;
+DROP TABLE IF EXISTS code_analyzer.symbol_insights;
+DROP TABLE IF EXISTS code_analyzer.function_insights;
+DROP TABLE IF EXISTS code_analyzer.insights;
@@ -1,8 +1,33 @@
-\c code_analyser
+-- LLM-generated insights, of any kind in one table
+CREATE TABLE IF NOT EXISTS code_analyzer.insights (
+    id SERIAL PRIMARY KEY,
+    repository_id BIGINT NOT NULL,
+    file_id BIGINT,
+    function_id BIGINT,
+    symbol_id BIGINT,
+    path VARCHAR(1024),
+    type VARCHAR(50) NOT NULL,
+    data TEXT NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT fk_repository FOREIGN KEY (repository_id) REFERENCES code_analyzer.repositories(id) ON DELETE CASCADE,
+    CONSTRAINT fk_file FOREIGN KEY (file_id) REFERENCES code_analyzer.repository_files(id) ON DELETE CASCADE,
+    CONSTRAINT fk_function FOREIGN KEY (function_id) REFERENCES code_analyzer.repository_functions(id) ON DELETE CASCADE,
+    CONSTRAINT fk_symbol FOREIGN KEY (symbol_id) REFERENCES code_analyzer.repository_symbols(id) ON DELETE CASCADE
+);
+
+-- Indexes for faster queries
+CREATE INDEX IF NOT EXISTS idx_insights_repository_id ON code_analyzer.insights(repository_id);
+CREATE INDEX IF NOT EXISTS idx_insights_file_id ON code_analyzer.insights(file_id);
+CREATE INDEX IF NOT EXISTS idx_insights_function_id ON code_analyzer.insights(function_id);
+CREATE INDEX IF NOT EXISTS idx_insights_symbol_id ON code_analyzer.insights(symbol_id);
+CREATE INDEX IF NOT EXISTS idx_insights_type ON code_analyzer.insights(type);
 
--- Migration to split the insights table into separate tables for each insight type
--- This will make querying and organizing data easier
+-- Add a comment to the table
+COMMENT ON TABLE code_analyzer.insights IS 'Stores LLM-generated insights for repository components';
 
+-- Insights of each kind in their own table
 -- Create function_insights table
 CREATE TABLE IF NOT EXISTS code_analyzer.function_insights (
     id SERIAL PRIMARY KEY,
@@ -67,65 +92,22 @@ CREATE TABLE IF NOT EXISTS code_analyzer.repository_insights (
 );
 
 -- Add indexes for better query performance
-CREATE INDEX idx_function_insights_repository_id ON code_analyzer.function_insights(repository_id);
-CREATE INDEX idx_function_insights_function_id ON code_analyzer.function_insights(function_id);
+CREATE INDEX IF NOT EXISTS idx_function_insights_repository_id ON code_analyzer.function_insights(repository_id);
+CREATE INDEX IF NOT EXISTS idx_function_insights_function_id ON code_analyzer.function_insights(function_id);
 
-CREATE INDEX idx_symbol_insights_repository_id ON code_analyzer.symbol_insights(repository_id);
-CREATE INDEX idx_symbol_insights_symbol_id ON code_analyzer.symbol_insights(symbol_id);
+CREATE INDEX IF NOT EXISTS idx_symbol_insights_repository_id ON code_analyzer.symbol_insights(repository_id);
+CREATE INDEX IF NOT EXISTS idx_symbol_insights_symbol_id ON code_analyzer.symbol_insights(symbol_id);
 
-CREATE INDEX idx_struct_insights_repository_id ON code_analyzer.struct_insights(repository_id);
-CREATE INDEX idx_struct_insights_symbol_id ON code_analyzer.struct_insights(symbol_id);
+CREATE INDEX IF NOT EXISTS idx_struct_insights_repository_id ON code_analyzer.struct_insights(repository_id);
+CREATE INDEX IF NOT EXISTS idx_struct_insights_symbol_id ON code_analyzer.struct_insights(symbol_id);
 
-CREATE INDEX idx_file_insights_repository_id ON code_analyzer.file_insights(repository_id);
-CREATE INDEX idx_file_insights_file_id ON code_analyzer.file_insights(file_id);
+CREATE INDEX IF NOT EXISTS idx_file_insights_repository_id ON code_analyzer.file_insights(repository_id);
+CREATE INDEX IF NOT EXISTS idx_file_insights_file_id ON code_analyzer.file_insights(file_id);
 
-CREATE INDEX idx_repository_insights_repository_id ON code_analyzer.repository_insights(repository_id);
+CREATE INDEX IF NOT EXISTS idx_repository_insights_repository_id ON code_analyzer.repository_insights(repository_id);
 
--- -- Migrate data from the old insights table to the new tables
--- -- Function insights migration
--- INSERT INTO code_analyzer.function_insights (repository_id, function_id, data, model, created_at, updated_at)
--- SELECT repository_id, function_id, data::jsonb, model, created_at, updated_at
--- FROM code_analyzer.insights
--- WHERE function_id IS NOT NULL AND type = 'function';
-
--- -- Symbol insights migration
--- INSERT INTO code_analyzer.symbol_insights (repository_id, symbol_id, data, model, created_at, updated_at)
--- SELECT repository_id, symbol_id, data::jsonb, model, created_at, updated_at
--- FROM code_analyzer.insights
--- WHERE symbol_id IS NOT NULL AND type = 'symbol';
-
--- -- Struct insights migration
--- INSERT INTO code_analyzer.struct_insights (repository_id, symbol_id, data, model, created_at, updated_at)
--- SELECT repository_id, symbol_id, data::jsonb, model, created_at, updated_at
--- FROM code_analyzer.insights
--- WHERE symbol_id IS NOT NULL AND type = 'struct';
-
--- -- File insights migration
--- INSERT INTO code_analyzer.file_insights (repository_id, file_id, data, model, created_at, updated_at)
--- SELECT repository_id, file_id, data::jsonb, model, created_at, updated_at
--- FROM code_analyzer.insights
--- WHERE file_id IS NOT NULL AND type = 'file';
-
--- -- Repository insights migration
--- INSERT INTO code_analyzer.repository_insights (repository_id, data, model, created_at, updated_at)
--- SELECT repository_id, data::jsonb, model, created_at, updated_at
--- FROM code_analyzer.insights
--- WHERE type = 'repository';
-
--- Add comments to the tables for better documentation
 COMMENT ON TABLE code_analyzer.function_insights IS 'Stores LLM-generated insights for functions';
 COMMENT ON TABLE code_analyzer.symbol_insights IS 'Stores LLM-generated insights for symbols';
 COMMENT ON TABLE code_analyzer.struct_insights IS 'Stores LLM-generated insights for struct types';
 COMMENT ON TABLE code_analyzer.file_insights IS 'Stores LLM-generated insights for files';
 COMMENT ON TABLE code_analyzer.repository_insights IS 'Stores LLM-generated insights for repositories';
-
--- NOTE: After verifying the migration worked correctly, you can optionally 
--- drop the original insights table with:
--- DROP TABLE IF EXISTS code_analyzer.insights;
-
--- Down migration (if needed to rollback)
--- DROP TABLE IF EXISTS code_analyzer.function_insights;
--- DROP TABLE IF EXISTS code_analyzer.symbol_insights; 
--- DROP TABLE IF EXISTS code_analyzer.struct_insights;
--- DROP TABLE IF EXISTS code_analyzer.file_insights;
--- DROP TABLE IF EXISTS code_analyzer.repository_insights;
@@ -0,0 +1,13 @@
+-- Calls fanned out to several implementations collapse back into one per call site
+DELETE FROM code_analyzer.function_calls c
+USING code_analyzer.function_calls d
+WHERE c.caller_id = d.caller_id AND c.callee_name = d.callee_name AND c.line = d.line AND c.id > d.id;
+
+ALTER TABLE code_analyzer.function_calls
+    DROP CONSTRAINT IF EXISTS function_calls_caller_callee_line_key;
+
+ALTER TABLE code_analyzer.function_calls
+    ADD CONSTRAINT function_calls_caller_id_callee_name_line_key UNIQUE (caller_id, callee_name, line);
+
+ALTER TABLE code_analyzer.function_calls
+    DROP COLUMN IF EXISTS call_kind;
@@ -0,0 +1,13 @@
+-- Calls through an interface are stored once per concrete implementation,
+-- so a call site is now identified by the callee's package as well as its name
+ALTER TABLE code_analyzer.function_calls
+    ADD COLUMN IF NOT EXISTS call_kind VARCHAR(20) NOT NULL DEFAULT 'static'; -- "static" or "dynamic"
+
+ALTER TABLE code_analyzer.function_calls
+    DROP CONSTRAINT IF EXISTS function_calls_caller_id_callee_name_line_key;
+
+ALTER TABLE code_analyzer.function_calls
+    DROP CONSTRAINT IF EXISTS function_calls_caller_callee_line_key;
+
+ALTER TABLE code_analyzer.function_calls
+    ADD CONSTRAINT function_calls_caller_callee_line_key UNIQUE (caller_id, callee_package, callee_name, line);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS code_analyzer.idx_repository_files_package_path;
+
+ALTER TABLE code_analyzer.function_calls
+    DROP COLUMN IF EXISTS external_kind,
+    DROP COLUMN IF EXISTS confidence;
+
+ALTER TABLE code_analyzer.repository_files
+    DROP COLUMN IF EXISTS package_path;
@@ -0,0 +1,12 @@
+-- Import path of the package a file belongs to, used to resolve calls across files
+ALTER TABLE code_analyzer.repository_files
+    ADD COLUMN IF NOT EXISTS package_path VARCHAR(500) NOT NULL DEFAULT '';
+
+-- Outcome of the linking phase that runs once all files of a repository are stored
+ALTER TABLE code_analyzer.function_calls
+    ADD COLUMN IF NOT EXISTS confidence REAL; -- 0..1, NULL until the call has been linked
+
+ALTER TABLE code_analyzer.function_calls
+    ADD COLUMN IF NOT EXISTS external_kind VARCHAR(20) NOT NULL DEFAULT ''; -- "stdlib", "third_party", "builtin" or '' for repository calls
+
+CREATE INDEX IF NOT EXISTS idx_repository_files_package_path ON code_analyzer.repository_files(repository_id, package_path);
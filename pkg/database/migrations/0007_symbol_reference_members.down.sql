@@ -0,0 +1,5 @@
+-- idx_repository_symbols_name already existed, so it is left in place
+DROP INDEX IF EXISTS code_analyzer.idx_symbol_references_file_id;
+
+ALTER TABLE code_analyzer.symbol_references
+    DROP COLUMN IF EXISTS member;
@@ -0,0 +1,7 @@
+-- References to a field or method are stored against the declaring type, with the member referenced.
+-- Reference types are "declaration", "read", "write", "address_taken" and "call".
+ALTER TABLE code_analyzer.symbol_references
+    ADD COLUMN IF NOT EXISTS member VARCHAR(255) NOT NULL DEFAULT ''; -- '' for references to the symbol itself
+
+CREATE INDEX IF NOT EXISTS idx_symbol_references_file_id ON code_analyzer.symbol_references(file_id);
+CREATE INDEX IF NOT EXISTS idx_repository_symbols_name ON code_analyzer.repository_symbols(repository_id, name);
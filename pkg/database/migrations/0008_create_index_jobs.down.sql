@@ -0,0 +1 @@
+DROP TABLE IF EXISTS code_analyzer.index_jobs;
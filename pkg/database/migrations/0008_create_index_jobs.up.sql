@@ -0,0 +1,21 @@
+-- Queue of repository indexing jobs, claimed by the worker pool of the API server
+CREATE TABLE IF NOT EXISTS code_analyzer.index_jobs (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES code_analyzer.repositories(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued', -- "queued", "running", "completed", "failed", "cancelled"
+    phase VARCHAR(50) NOT NULL DEFAULT '', -- "fetch", "analyze", "link" while running
+    files_total INTEGER NOT NULL DEFAULT 0,
+    files_done INTEGER NOT NULL DEFAULT 0,
+    llm_calls INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0, -- Number of times a worker started the job
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    worker_id VARCHAR(100) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_index_jobs_status ON code_analyzer.index_jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_index_jobs_repository_id ON code_analyzer.index_jobs(repository_id);
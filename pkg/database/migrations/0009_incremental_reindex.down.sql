@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS code_analyzer.idx_function_references_file_id;
+
+ALTER TABLE code_analyzer.function_calls
+    DROP CONSTRAINT IF EXISTS function_calls_callee_id_fkey;
+
+ALTER TABLE code_analyzer.function_calls
+    ADD CONSTRAINT function_calls_callee_id_fkey FOREIGN KEY (callee_id)
+        REFERENCES code_analyzer.repository_functions(id) ON DELETE CASCADE;
+
+ALTER TABLE code_analyzer.repository_functions
+    DROP COLUMN IF EXISTS body_hash;
+
+ALTER TABLE code_analyzer.repositories
+    DROP COLUMN IF EXISTS last_indexed_commit;
@@ -0,0 +1,23 @@
+-- Commit the stored index reflects; re-indexing only analyzes the files changed since
+ALTER TABLE code_analyzer.repositories
+    ADD COLUMN IF NOT EXISTS last_indexed_commit VARCHAR(40) NOT NULL DEFAULT '';
+
+-- Hash of the code of a function, so insights are only regenerated when it changes
+ALTER TABLE code_analyzer.repository_functions
+    ADD COLUMN IF NOT EXISTS body_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Hash the functions already stored, so the first re-index keeps their insights too
+UPDATE code_analyzer.repository_functions
+SET body_hash = encode(sha256(convert_to(COALESCE(code_block, ''), 'UTF8')), 'hex')
+WHERE body_hash = '';
+
+-- Removing a function re-indexed away unlinks the calls to it instead of deleting them,
+-- so calls from unchanged files are linked again to whatever they now resolve to
+ALTER TABLE code_analyzer.function_calls
+    DROP CONSTRAINT IF EXISTS function_calls_callee_id_fkey;
+
+ALTER TABLE code_analyzer.function_calls
+    ADD CONSTRAINT function_calls_callee_id_fkey FOREIGN KEY (callee_id)
+        REFERENCES code_analyzer.repository_functions(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_function_references_file_id ON code_analyzer.function_references(file_id);
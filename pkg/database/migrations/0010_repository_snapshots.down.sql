@@ -0,0 +1,28 @@
+-- Only the default branch snapshot of each repository is kept
+ALTER TABLE code_analyzer.repositories
+    ADD COLUMN IF NOT EXISTS last_indexed_commit VARCHAR(40) NOT NULL DEFAULT '';
+
+UPDATE code_analyzer.repositories r
+SET last_indexed_commit = s.indexed_commit
+FROM code_analyzer.snapshot_refs sr
+JOIN code_analyzer.repository_snapshots s ON s.id = sr.snapshot_id
+WHERE sr.repository_id = r.id AND sr.ref = '';
+
+DELETE FROM code_analyzer.repository_files
+WHERE snapshot_id NOT IN (SELECT snapshot_id FROM code_analyzer.snapshot_refs WHERE ref = '');
+
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS snapshot_id,
+    DROP COLUMN IF EXISTS ref;
+
+ALTER TABLE code_analyzer.repository_files
+    DROP CONSTRAINT IF EXISTS repository_files_snapshot_id_file_path_key;
+ALTER TABLE code_analyzer.repository_files
+    ADD CONSTRAINT repository_files_repository_id_file_path_key UNIQUE (repository_id, file_path);
+
+ALTER TABLE code_analyzer.repository_symbols DROP COLUMN IF EXISTS snapshot_id;
+ALTER TABLE code_analyzer.repository_functions DROP COLUMN IF EXISTS snapshot_id;
+ALTER TABLE code_analyzer.repository_files DROP COLUMN IF EXISTS snapshot_id;
+
+DROP TABLE IF EXISTS code_analyzer.snapshot_refs;
+DROP TABLE IF EXISTS code_analyzer.repository_snapshots;
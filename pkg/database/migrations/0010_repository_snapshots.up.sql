@@ -0,0 +1,82 @@
+-- Index of a repository at one commit. Branches, tags and commits are indexed side by side,
+-- each into its own snapshot.
+CREATE TABLE IF NOT EXISTS code_analyzer.repository_snapshots (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES code_analyzer.repositories(id) ON DELETE CASCADE,
+    commit_sha VARCHAR(40) NOT NULL, -- Commit being indexed; empty for sources that are not git checkouts
+    indexed_commit VARCHAR(40) NOT NULL DEFAULT '', -- Commit the stored index reflects
+    index_status VARCHAR(50) NOT NULL DEFAULT 'pending', -- "pending", "in_progress", "completed", "failed", "cancelled"
+    index_error TEXT NOT NULL DEFAULT '',
+    last_indexed TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE(repository_id, commit_sha)
+);
+
+-- Snapshot each indexed ref resolves to; the empty ref is the default branch
+CREATE TABLE IF NOT EXISTS code_analyzer.snapshot_refs (
+    repository_id INTEGER NOT NULL REFERENCES code_analyzer.repositories(id) ON DELETE CASCADE,
+    ref VARCHAR(255) NOT NULL,
+    snapshot_id INTEGER NOT NULL REFERENCES code_analyzer.repository_snapshots(id) ON DELETE CASCADE,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (repository_id, ref)
+);
+
+-- What is already indexed becomes the default branch snapshot of its repository
+INSERT INTO code_analyzer.repository_snapshots (repository_id, commit_sha, indexed_commit, index_status, index_error, last_indexed)
+SELECT r.id, r.last_indexed_commit, r.last_indexed_commit, r.index_status, COALESCE(r.index_error, ''), r.last_indexed
+FROM code_analyzer.repositories r
+WHERE EXISTS (SELECT 1 FROM code_analyzer.repository_files f WHERE f.repository_id = r.id)
+ON CONFLICT (repository_id, commit_sha) DO NOTHING;
+
+INSERT INTO code_analyzer.snapshot_refs (repository_id, ref, snapshot_id)
+SELECT repository_id, '', id
+FROM code_analyzer.repository_snapshots
+ON CONFLICT (repository_id, ref) DO NOTHING;
+
+-- Scope files, functions and symbols to a snapshot
+ALTER TABLE code_analyzer.repository_files
+    ADD COLUMN IF NOT EXISTS snapshot_id INTEGER REFERENCES code_analyzer.repository_snapshots(id) ON DELETE CASCADE;
+ALTER TABLE code_analyzer.repository_functions
+    ADD COLUMN IF NOT EXISTS snapshot_id INTEGER REFERENCES code_analyzer.repository_snapshots(id) ON DELETE CASCADE;
+ALTER TABLE code_analyzer.repository_symbols
+    ADD COLUMN IF NOT EXISTS snapshot_id INTEGER REFERENCES code_analyzer.repository_snapshots(id) ON DELETE CASCADE;
+
+UPDATE code_analyzer.repository_files f
+SET snapshot_id = s.id
+FROM code_analyzer.repository_snapshots s
+WHERE s.repository_id = f.repository_id AND f.snapshot_id IS NULL;
+
+UPDATE code_analyzer.repository_functions fn
+SET snapshot_id = f.snapshot_id
+FROM code_analyzer.repository_files f
+WHERE f.id = fn.file_id AND fn.snapshot_id IS NULL;
+
+UPDATE code_analyzer.repository_symbols sym
+SET snapshot_id = f.snapshot_id
+FROM code_analyzer.repository_files f
+WHERE f.id = sym.file_id AND sym.snapshot_id IS NULL;
+
+ALTER TABLE code_analyzer.repository_files ALTER COLUMN snapshot_id SET NOT NULL;
+ALTER TABLE code_analyzer.repository_functions ALTER COLUMN snapshot_id SET NOT NULL;
+ALTER TABLE code_analyzer.repository_symbols ALTER COLUMN snapshot_id SET NOT NULL;
+
+-- A path is unique within a snapshot rather than within the repository
+ALTER TABLE code_analyzer.repository_files
+    DROP CONSTRAINT IF EXISTS repository_files_repository_id_file_path_key;
+ALTER TABLE code_analyzer.repository_files
+    DROP CONSTRAINT IF EXISTS repository_files_snapshot_id_file_path_key;
+ALTER TABLE code_analyzer.repository_files
+    ADD CONSTRAINT repository_files_snapshot_id_file_path_key UNIQUE (snapshot_id, file_path);
+
+CREATE INDEX IF NOT EXISTS idx_repository_functions_snapshot_id ON code_analyzer.repository_functions(snapshot_id);
+CREATE INDEX IF NOT EXISTS idx_repository_symbols_snapshot_id ON code_analyzer.repository_symbols(snapshot_id);
+
+-- Jobs index a ref into a snapshot
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS ref VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS snapshot_id INTEGER REFERENCES code_analyzer.repository_snapshots(id) ON DELETE SET NULL;
+
+-- The indexed commit is now kept per snapshot
+ALTER TABLE code_analyzer.repositories
+    DROP COLUMN IF EXISTS last_indexed_commit;
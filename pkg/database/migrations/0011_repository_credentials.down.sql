@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS code_analyzer.idx_repositories_credential_id;
+
+ALTER TABLE code_analyzer.repositories
+    DROP COLUMN IF EXISTS credential_id;
+
+DROP TABLE IF EXISTS code_analyzer.repository_credentials;
@@ -0,0 +1,23 @@
+-- Credentials for private repositories, owned by a user or an organization. Secrets are
+-- encrypted by the API server and never stored in clear.
+CREATE TABLE IF NOT EXISTS code_analyzer.repository_credentials (
+    id SERIAL PRIMARY KEY,
+    owner_type VARCHAR(20) NOT NULL, -- "user" or "organization"
+    owner_id VARCHAR(255) NOT NULL, -- User ID or organization name
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL, -- "github_pat", "deploy_key" or "basic_auth"
+    host VARCHAR(255) NOT NULL, -- Host the credential may be sent to
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    encrypted_secret BYTEA NOT NULL,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (owner_type, owner_id, name)
+);
+
+-- Credential a repository is fetched with
+ALTER TABLE code_analyzer.repositories
+    ADD COLUMN IF NOT EXISTS credential_id INTEGER REFERENCES code_analyzer.repository_credentials(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_repositories_credential_id ON code_analyzer.repositories(credential_id);
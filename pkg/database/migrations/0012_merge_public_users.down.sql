@@ -0,0 +1,2 @@
+-- The users copied from public.users are kept, and public.users is left as it was
+SELECT 1;
@@ -0,0 +1,12 @@
+-- Databases set up by the former scripts could hold users in both users.users, seeded by the
+-- scripts, and public.users, created by the API server. The API now only uses users.users.
+DO $$
+BEGIN
+    IF to_regclass('public.users') IS NOT NULL THEN
+        INSERT INTO users.users (id, email, password, first_name, last_name, active, role, created_at, updated_at, deleted_at)
+        SELECT id, email, password, first_name, last_name, active, role, created_at, updated_at, deleted_at
+        FROM public.users
+        ON CONFLICT DO NOTHING;
+    END IF;
+END
+$$;
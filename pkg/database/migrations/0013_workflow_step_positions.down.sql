@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS code_analysis.idx_workflow_steps_step_type;
+
+ALTER TABLE code_analysis.workflow_step_variables DROP COLUMN IF EXISTS position;
+ALTER TABLE code_analysis.workflow_step_dependencies DROP COLUMN IF EXISTS position;
+ALTER TABLE code_analysis.workflow_steps DROP COLUMN IF EXISTS position;
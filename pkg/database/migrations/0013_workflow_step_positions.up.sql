@@ -0,0 +1,12 @@
+-- Order of the workflow steps of a file, and of the dependencies and variables of a step, as
+-- the analysis returned them. Rows stored together otherwise share their created_at.
+ALTER TABLE code_analysis.workflow_steps
+    ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE code_analysis.workflow_step_dependencies
+    ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE code_analysis.workflow_step_variables
+    ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_workflow_steps_step_type ON code_analysis.workflow_steps(step_type);
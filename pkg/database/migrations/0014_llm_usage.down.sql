@@ -0,0 +1,5 @@
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS requested_by;
+
+DROP TABLE IF EXISTS code_analyzer.llm_budgets;
+DROP TABLE IF EXISTS code_analyzer.llm_usage;
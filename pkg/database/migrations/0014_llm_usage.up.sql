@@ -0,0 +1,34 @@
+-- Usage of every LLM call, attributed to the user, repository and feature it was made for,
+-- priced when it was recorded
+CREATE TABLE IF NOT EXISTS code_analyzer.llm_usage (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL DEFAULT '', -- Empty for calls made for no user
+    repository_id INTEGER REFERENCES code_analyzer.repositories(id) ON DELETE SET NULL,
+    feature VARCHAR(50) NOT NULL DEFAULT '', -- "chat", "function_insight", "file_analysis"...
+    model VARCHAR(255) NOT NULL, -- Along with its provider, such as "openai:gpt-4o"
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost_usd NUMERIC(14, 6) NOT NULL DEFAULT 0,
+    estimated BOOLEAN NOT NULL DEFAULT FALSE, -- Tokens estimated as the provider did not report them
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at ON code_analyzer.llm_usage(created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_user_id ON code_analyzer.llm_usage(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_repository_id ON code_analyzer.llm_usage(repository_id, created_at);
+
+-- Monthly spending limits of users and repositories; no new index jobs are queued for them
+-- once their spending of the month exceeds the limit
+CREATE TABLE IF NOT EXISTS code_analyzer.llm_budgets (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(20) NOT NULL, -- "user" or "repository"
+    scope_id VARCHAR(255) NOT NULL, -- User ID or repository ID
+    monthly_limit_usd NUMERIC(14, 6) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (scope, scope_id)
+);
+
+-- User who queued an index job, whose budget its LLM calls are charged to
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS requested_by VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE code_analyzer.llm_usage
+    DROP COLUMN IF EXISTS cached;
+
+DROP TABLE IF EXISTS code_analyzer.llm_cache;
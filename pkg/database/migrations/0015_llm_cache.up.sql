@@ -0,0 +1,18 @@
+-- Responses of LLM calls, keyed by a hash of their model, messages, schema and temperature,
+-- so that identical prompts are only paid for once
+CREATE TABLE IF NOT EXISTS code_analyzer.llm_cache (
+    key CHAR(64) PRIMARY KEY, -- Hex SHA-256 of the request
+    model VARCHAR(255) NOT NULL, -- Model that answered
+    response TEXT NOT NULL,
+    finish_reason VARCHAR(50) NOT NULL DEFAULT '',
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_cache_expires_at ON code_analyzer.llm_cache(expires_at);
+
+-- Calls answered from the cache are recorded at no cost
+ALTER TABLE code_analyzer.llm_usage
+    ADD COLUMN IF NOT EXISTS cached BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS code_analyzer.idx_insights_repository_type;
+
+DELETE FROM code_analyzer.insights WHERE type = 'package';
+
+DELETE FROM code_analyzer.index_jobs WHERE kind <> 'index';
+
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS model;
+
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,10 @@
+-- Jobs of other kinds share the queue of index jobs, such as generating the insights of a
+-- repository bottom-up, with the model they generate them with
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'index'; -- "index", "insights"
+
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS model VARCHAR(100) NOT NULL DEFAULT '';
+
+-- File, package and repository insights are looked up by kind to find the missing or stale ones
+CREATE INDEX IF NOT EXISTS idx_insights_repository_type ON code_analyzer.insights(repository_id, type, created_at);
@@ -0,0 +1,13 @@
+DELETE FROM code_analyzer.index_jobs WHERE kind = 'regenerate';
+
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS tokens_used;
+
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS max_tokens;
+
+ALTER TABLE code_analyzer.insights
+    DROP COLUMN IF EXISTS input_hash;
+
+ALTER TABLE code_analyzer.function_insights
+    DROP COLUMN IF EXISTS input_hash;
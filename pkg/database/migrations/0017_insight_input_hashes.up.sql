@@ -0,0 +1,17 @@
+-- Insights record a hash of what they were generated from: the code, signature and callees of
+-- functions, the declaration of structs, the hashes of the insights summarized into files,
+-- packages and repositories, and the version of the prompt templates. Insights whose hash no
+-- longer matches their inputs are stale; those generated before hashes were recorded have none.
+ALTER TABLE code_analyzer.function_insights
+    ADD COLUMN IF NOT EXISTS input_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE code_analyzer.insights
+    ADD COLUMN IF NOT EXISTS input_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Jobs regenerating stale insights may be capped to a number of tokens, and every job counts
+-- the tokens its LLM calls used
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS max_tokens INTEGER NOT NULL DEFAULT 0; -- 0 for no cap
+
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS tokens_used INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS code_analyzer.idx_repository_files_path;
+
+ALTER TABLE code_analyzer.insights
+    DROP COLUMN IF EXISTS prompt_version;
+
+ALTER TABLE code_analyzer.function_insights
+    DROP COLUMN IF EXISTS prompt_version;
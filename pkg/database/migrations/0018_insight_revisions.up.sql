@@ -0,0 +1,11 @@
+-- Every insight stored for a function, struct or other item is a revision of it, the latest
+-- being current. Revisions record the version of the prompt templates they were generated with
+-- alongside their model; those generated before have none.
+ALTER TABLE code_analyzer.function_insights
+    ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(16) NOT NULL DEFAULT '';
+
+ALTER TABLE code_analyzer.insights
+    ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(16) NOT NULL DEFAULT '';
+
+-- Revisions of a function or struct are followed across snapshots by file path and name
+CREATE INDEX IF NOT EXISTS idx_repository_files_path ON code_analyzer.repository_files(repository_id, file_path);
@@ -0,0 +1,18 @@
+-- Reviews of generated function insights. The generated insight is kept as is; reviewers approve
+-- it, reject it, or edit it into a curated version stored alongside. Curated insights apply to
+-- every function of the repository with the same code, and edited ones are the few-shot examples
+-- of the prompts generating the insights of its other functions.
+CREATE TABLE IF NOT EXISTS code_analyzer.function_insight_reviews (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES code_analyzer.repositories(id) ON DELETE CASCADE,
+    function_insight_id INTEGER NOT NULL REFERENCES code_analyzer.function_insights(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL, -- "approved", "rejected" or "edited"
+    data JSONB, -- Curated insight of edited reviews
+    comment TEXT NOT NULL DEFAULT '',
+    reviewed_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    UNIQUE (function_insight_id) -- Reviewing an insight again replaces its review
+);
+
+CREATE INDEX IF NOT EXISTS idx_function_insight_reviews_repository ON code_analyzer.function_insight_reviews(repository_id, status, updated_at);
@@ -0,0 +1,3 @@
+UPDATE code_analyzer.function_calls
+SET external_kind = ''
+WHERE external_kind = 'unresolved';
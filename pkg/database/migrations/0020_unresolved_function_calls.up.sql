@@ -0,0 +1,4 @@
+-- Calls the linker could not resolve are marked, so that later links of the snapshot skip them
+UPDATE code_analyzer.function_calls
+SET external_kind = 'unresolved'
+WHERE callee_id IS NULL AND confidence IS NOT NULL AND external_kind = '';
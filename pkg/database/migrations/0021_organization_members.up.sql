@@ -0,0 +1,9 @@
+-- Members of the organizations owning credentials, who may index with them
+CREATE TABLE IF NOT EXISTS code_analyzer.organization_members (
+    organization VARCHAR(255) NOT NULL, -- Organization name, the owner_id of its credentials
+    user_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON code_analyzer.organization_members(user_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS code_analyzer.idx_function_insights_body_hash;
+
+ALTER TABLE code_analyzer.function_insights
+    DROP COLUMN IF EXISTS body_hash;
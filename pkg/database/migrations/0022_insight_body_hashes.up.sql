@@ -0,0 +1,8 @@
+-- Function insights record the hash of the code they were generated from, since functions keep
+-- their ID when their code changes. Reviews of an insight only apply to functions whose code is
+-- still the one reviewed; insights generated before the hash was recorded have none, so their
+-- reviews no longer apply until the function is reviewed again.
+ALTER TABLE code_analyzer.function_insights
+    ADD COLUMN IF NOT EXISTS body_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_function_insights_body_hash ON code_analyzer.function_insights(repository_id, body_hash);
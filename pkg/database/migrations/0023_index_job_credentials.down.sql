@@ -0,0 +1,2 @@
+ALTER TABLE code_analyzer.index_jobs
+    DROP COLUMN IF EXISTS credential_id;
@@ -0,0 +1,5 @@
+-- Index jobs record the credential their requester was authorized to fetch the repository with,
+-- so workers only decrypt credentials for the users allowed to use them. Jobs queued before
+-- have none and fetch without credentials.
+ALTER TABLE code_analyzer.index_jobs
+    ADD COLUMN IF NOT EXISTS credential_id INTEGER REFERENCES code_analyzer.repository_credentials(id) ON DELETE SET NULL;
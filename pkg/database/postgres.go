@@ -17,6 +17,8 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	AutoMigrate bool // Apply pending migrations when the API server starts
 }
 
 // DB is a wrapper for the SQL DB
@@ -60,36 +62,6 @@ func (d *DB) Close() error {
 	return d.Conn.Close()
 }
 
-// InitSchema initializes the database schema
-func (d *DB) InitSchema() error {
-	logger.Info("Initializing database schema")
-
-	// Create users table
-	userTableSQL := `
-	CREATE TABLE IF NOT EXISTS users (
-		id UUID PRIMARY KEY,
-		email VARCHAR(255) UNIQUE NOT NULL,
-		password VARCHAR(255) NOT NULL,
-		first_name VARCHAR(100),
-		last_name VARCHAR(100),
-		active BOOLEAN DEFAULT TRUE,
-		role VARCHAR(50) DEFAULT 'user',
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		deleted_at TIMESTAMP WITH TIME ZONE
-	);
-	`
-
-	_, err := d.Conn.Exec(userTableSQL)
-	if err != nil {
-		logger.Errorf("Failed to create users table: %v", err)
-		return fmt.Errorf("failed to create users table: %w", err)
-	}
-
-	logger.Info("Database schema initialized successfully")
-	return nil
-}
-
 // Transaction executes a function within a database transaction
 func (d *DB) Transaction(fn func(*sql.Tx) error) error {
 	tx, err := d.Conn.Begin()
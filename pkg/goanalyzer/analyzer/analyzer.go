@@ -5,6 +5,7 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"cred.com/hack25/backend/pkg/goanalyzer/models"
 	"cred.com/hack25/backend/pkg/logger"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/packages"
 )
 
 // Analyzer is the main analyzer struct
@@ -22,6 +24,17 @@ type Analyzer struct {
 	callGraph   map[string][]models.CallInfo
 	references  map[string][]models.ReferenceInfo
 	symbolTable map[string]models.Symbol
+	typed       map[string]*typedFile
+	fieldOwners map[*types.Var]*types.TypeName
+	// packages holds the type-checked packages by directory
+	packages map[string]*types.Package
+	// loaded holds the packages loaded by go/packages by module root, for the call graph builder
+	loaded          map[string][]*packages.Package
+	implementations map[*types.TypeName][]types.Type
+	// callGraphAlgorithm selects the call graph builder for type-checked files;
+	// preciseCalls holds its calls by file
+	callGraphAlgorithm string
+	preciseCalls       map[string][]models.CallInfo
 }
 
 // New creates a new code analyzer
@@ -33,6 +46,10 @@ func New() *Analyzer {
 		callGraph:   make(map[string][]models.CallInfo),
 		references:  make(map[string][]models.ReferenceInfo),
 		symbolTable: make(map[string]models.Symbol),
+		typed:       make(map[string]*typedFile),
+		fieldOwners: make(map[*types.Var]*types.TypeName),
+		packages:    make(map[string]*types.Package),
+		loaded:      make(map[string][]*packages.Package),
 	}
 }
 
@@ -42,19 +59,9 @@ func (a *Analyzer) log() *logrus.Entry {
 
 // AnalyzeFile analyzes a single Go file
 func (a *Analyzer) AnalyzeFile(filePath string) (*models.FileAnalysis, error) {
-	// Read file content
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading file: %w", err)
-	}
-
-	// Store the code content for extracting code blocks later
-	a.codeMap[filePath] = string(content)
-
-	// Parse the file
-	file, err := parser.ParseFile(a.fset, filePath, content, parser.AllErrors|parser.ParseComments)
+	file, err := a.loadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing file: %w", err)
+		return nil, err
 	}
 
 	// Store the file AST for later reference analysis
@@ -86,19 +93,9 @@ func (a *Analyzer) AnalyzeDirectory(dirPath string) ([]models.FileAnalysis, erro
 		}
 		if !info.IsDir() && strings.HasSuffix(path, ".go") {
 			// Just load and parse the file, don't analyze yet
-			content, err := os.ReadFile(path)
-			if err != nil {
-				fmt.Printf("Error reading file %s: %v\n", path, err)
-				return nil // continue with next file
-			}
-
-			// Store the code content
-			a.codeMap[path] = string(content)
-
-			// Parse the file
-			file, err := parser.ParseFile(a.fset, path, content, parser.AllErrors|parser.ParseComments)
+			file, err := a.loadFile(path)
 			if err != nil {
-				fmt.Printf("Error parsing file %s: %v\n", path, err)
+				fmt.Printf("Error loading file %s: %v\n", path, err)
 				return nil // continue with next file
 			}
 
@@ -137,6 +134,44 @@ func (a *Analyzer) AnalyzeDirectory(dirPath string) ([]models.FileAnalysis, erro
 	return results, nil
 }
 
+// AnalyzeModule analyzes all Go files in a directory using type information where the
+// modules under it can be type-checked, and syntax-only analysis everywhere else
+func (a *Analyzer) AnalyzeModule(dirPath string) ([]models.FileAnalysis, error) {
+	if err := a.TypeCheckModules(dirPath); err != nil {
+		a.log().WithFields(logrus.Fields{
+			"path":  dirPath,
+			"error": err,
+		}).Warn("Type-checking incomplete, falling back to syntax-only analysis where needed")
+	}
+
+	return a.AnalyzeDirectory(dirPath)
+}
+
+// loadFile returns the AST for a file, reusing the type-checked AST when one exists
+// so that type information can be looked up by node
+func (a *Analyzer) loadFile(filePath string) (*ast.File, error) {
+	if tf, ok := a.typed[filePath]; ok {
+		return tf.file, nil
+	}
+
+	// Read file content
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	// Store the code content for extracting code blocks later
+	a.codeMap[filePath] = string(content)
+
+	// Parse the file
+	file, err := parser.ParseFile(a.fset, filePath, content, parser.AllErrors|parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file: %w", err)
+	}
+
+	return file, nil
+}
+
 // extractCodeBlocks extracts the code block and AST nodes for functions
 func (a *Analyzer) extractCodeBlocks(file *ast.File, filePath string, analysis *models.FileAnalysis) {
 	fileContent, ok := a.codeMap[filePath]
@@ -3,78 +3,130 @@ package analyzer
 import (
 	"fmt"
 	"go/ast"
-	"strings"
+	"go/types"
 
 	"cred.com/hack25/backend/pkg/goanalyzer/models"
 )
 
 // analyzeCallHierarchy analyzes function calls
 func (a *Analyzer) analyzeCallHierarchy(file *ast.File, filePath string, analysis *models.FileAnalysis) {
-	// Find all function calls
-	ast.Inspect(file, func(n ast.Node) bool {
-		callExpr, ok := n.(*ast.CallExpr)
-		if !ok {
-			return true
+	info := a.typeInfo(filePath)
+
+	// Type-checked files use the calls resolved by the selected call graph algorithm
+	if info != nil && a.preciseCalls != nil {
+		for _, call := range a.preciseCalls[filePath] {
+			analysis.Calls = append(analysis.Calls, call)
+			callerKey := fmt.Sprintf("%s:%s", filePath, call.Caller)
+			a.callGraph[callerKey] = append(a.callGraph[callerKey], call)
 		}
+		return
+	}
 
-		pos := a.fset.Position(callExpr.Pos())
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Body == nil {
+			continue
+		}
 
 		// Determine the caller function
-		var callerFunc *models.Symbol
-		fileContent, ok := a.codeMap[filePath]
-		for _, fn := range analysis.Functions {
-			fnPos := fn.Position
-			if fnPos.File == filePath &&
-				fnPos.Line <= pos.Line &&
-				(len(fn.CodeBlock) == 0 || (ok && pos.Offset < len(fileContent) &&
-					strings.Contains(fn.CodeBlock, fileContent[pos.Offset:pos.Offset+1]))) {
-				callerFunc = &fn
-				break
-			}
-		}
+		callerFunc := a.findFunctionSymbol(funcDecl, analysis)
 
 		// If we couldn't find the containing function, skip
 		if callerFunc == nil {
-			return true
+			continue
 		}
 
-		// Determine the callee function name
-		var calleeName string
-		switch fun := callExpr.Fun.(type) {
-		case *ast.Ident:
-			calleeName = fun.Name
-		case *ast.SelectorExpr:
-			if x, ok := fun.X.(*ast.Ident); ok {
-				calleeName = x.Name + "." + fun.Sel.Name
-			} else {
-				calleeName = a.formatNode(fun.X) + "." + fun.Sel.Name
+		// Find all function calls
+		ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+			callExpr, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
 			}
-		default:
-			calleeName = a.formatNode(callExpr.Fun)
-		}
 
-		// Extract parameters
-		var params []string
-		for _, arg := range callExpr.Args {
-			params = append(params, a.formatNode(arg))
-		}
+			pos := a.fset.Position(callExpr.Pos())
+
+			// Extract parameters
+			var params []string
+			for _, arg := range callExpr.Args {
+				params = append(params, a.formatNode(arg))
+			}
+
+			// Create call info
+			call := models.CallInfo{
+				Caller:     callerFunc.Name,
+				CallerPath: filePath,
+				Callee:     a.calleeName(callExpr),
+				Position:   models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
+				Parameters: params,
+			}
+
+			calls := []models.CallInfo{call}
 
-		// Create call info
-		call := models.CallInfo{
-			Caller:     callerFunc.Name,
-			CallerPath: filePath,
-			Callee:     calleeName,
-			Position:   models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-			Parameters: params,
+			// With type information the callee can be resolved to its declaration
+			if info != nil {
+				callee := calleeObject(info, callExpr)
+				calls[0].CalleePath = a.qualifiedName(callee)
+				if calls[0].CalleePath != "" {
+					calls[0].CalleePackage = a.objectPackage(callee)
+				}
+				calls[0].Kind = callKind(info, callExpr, callee)
+
+				// Calls through an interface reach every concrete implementation of the method
+				if fn, ok := callee.(*types.Func); ok {
+					for _, target := range a.dispatchTargets(fn) {
+						dispatched := call
+						dispatched.CalleePath = a.qualifiedName(target)
+						dispatched.CalleePackage = a.objectPackage(target)
+						dispatched.Kind = models.CallKindDynamic
+						dispatched.Interface = calls[0].CalleePath
+						calls = append(calls, dispatched)
+					}
+				}
+			}
+
+			// Add to calls
+			analysis.Calls = append(analysis.Calls, calls...)
+
+			// Also add to call graph for lookup
+			callerKey := fmt.Sprintf("%s:%s", filePath, callerFunc.Name)
+			a.callGraph[callerKey] = append(a.callGraph[callerKey], calls...)
+
+			return true
+		})
+	}
+}
+
+// calleeName returns the callee of a call expression as written in the source
+func (a *Analyzer) calleeName(callExpr *ast.CallExpr) string {
+	switch fun := callExpr.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		if x, ok := fun.X.(*ast.Ident); ok {
+			return x.Name + "." + fun.Sel.Name
 		}
+		return a.formatNode(fun.X) + "." + fun.Sel.Name
+	default:
+		return a.formatNode(callExpr.Fun)
+	}
+}
 
-		// Add to calls
-		analysis.Calls = append(analysis.Calls, call)
+// findFunctionSymbol returns the analyzed symbol for a function declaration
+func (a *Analyzer) findFunctionSymbol(funcDecl *ast.FuncDecl, analysis *models.FileAnalysis) *models.Symbol {
+	for i, fn := range analysis.Functions {
+		if fn.Name != funcDecl.Name.Name {
+			continue
+		}
 
-		// Also add to call graph for lookup
-		callerKey := fmt.Sprintf("%s:%s", filePath, callerFunc.Name)
-		a.callGraph[callerKey] = append(a.callGraph[callerKey], call)
+		if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+			if fn.Kind != "method" || fn.Receiver != a.formatNode(funcDecl.Recv.List[0].Type) {
+				continue
+			}
+		} else if fn.Kind == "method" {
+			continue
+		}
 
-		return true
-	})
+		return &analysis.Functions[i]
+	}
+	return nil
 }
@@ -0,0 +1,285 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// The call graph builder works on the SSA form of the type-checked modules. Closures are
+// nodes of their own, named after their enclosing function like SSA does ("main$1"), and
+// calls through bound methods, thunks and wrappers are resolved to the method they invoke.
+
+// sourceCall is the call expression of the source an SSA call instruction comes from
+type sourceCall struct {
+	call *ast.CallExpr
+	mode string // "", models.CallModeGo or models.CallModeDefer
+}
+
+// SetCallGraphAlgorithm selects the algorithm used to build the call graph of type-checked
+// packages: models.CallGraphCHA, models.CallGraphRTA or models.CallGraphVTA. The empty string
+// keeps the syntactic call walk. It must be set before TypeCheckModules.
+func (a *Analyzer) SetCallGraphAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", models.CallGraphCHA, models.CallGraphRTA, models.CallGraphVTA:
+		a.callGraphAlgorithm = algorithm
+		return nil
+	}
+	return fmt.Errorf("unknown call graph algorithm: %s", algorithm)
+}
+
+// buildCallGraph resolves the calls of every type-checked function with the selected
+// algorithm and stores them by file for analyzeCallHierarchy
+func (a *Analyzer) buildCallGraph() {
+	a.preciseCalls = make(map[string][]models.CallInfo)
+	sources := a.sourceCalls()
+
+	functions, edges := 0, 0
+	for moduleRoot, loaded := range a.loaded {
+		graph := a.moduleCallGraph(loaded)
+		if graph == nil {
+			continue
+		}
+
+		for fn, node := range graph.Nodes {
+			file, ok := a.callerFile(fn)
+			if !ok {
+				continue
+			}
+			functions++
+			edges += a.recordCalls(node, file, sources)
+		}
+
+		a.log().WithFields(logrus.Fields{
+			"module": moduleRoot,
+			"nodes":  len(graph.Nodes),
+		}).Debug("Built module call graph")
+	}
+
+	for _, calls := range a.preciseCalls {
+		sort.SliceStable(calls, func(i, j int) bool {
+			if calls[i].Position.Line != calls[j].Position.Line {
+				return calls[i].Position.Line < calls[j].Position.Line
+			}
+			return calls[i].Position.Column < calls[j].Position.Column
+		})
+	}
+
+	a.log().WithFields(logrus.Fields{
+		"algorithm": a.callGraphAlgorithm,
+		"functions": functions,
+		"calls":     edges,
+	}).Info("Built call graph")
+}
+
+// moduleCallGraph builds the SSA program of the packages of a module and its call graph with
+// the selected algorithm, with synthetic wrappers replaced by the functions they call
+func (a *Analyzer) moduleCallGraph(loaded []*packages.Package) *callgraph.Graph {
+	prog, pkgs := ssautil.AllPackages(loaded, ssa.InstantiateGenerics)
+	prog.Build()
+
+	var graph *callgraph.Graph
+	switch a.callGraphAlgorithm {
+	case models.CallGraphCHA:
+		graph = cha.CallGraph(prog)
+	case models.CallGraphRTA:
+		roots := rtaRoots(prog, pkgs)
+		if len(roots) == 0 {
+			return nil
+		}
+		graph = rta.Analyze(roots, true).CallGraph
+	case models.CallGraphVTA:
+		graph = vta.CallGraph(ssautil.AllFunctions(prog), cha.CallGraph(prog))
+	default:
+		return nil
+	}
+
+	graph.DeleteSyntheticNodes()
+	return graph
+}
+
+// rtaRoots returns the init and main functions of the main packages of a module, or the
+// init functions and exported functions and methods of its packages if it has none
+func rtaRoots(prog *ssa.Program, pkgs []*ssa.Package) []*ssa.Function {
+	var roots []*ssa.Function
+	for _, pkg := range ssautil.MainPackages(pkgs) {
+		roots = append(roots, pkg.Func("init"), pkg.Func("main"))
+	}
+	if len(roots) > 0 {
+		return roots
+	}
+
+	modulePkgs := make(map[*ssa.Package]bool)
+	for _, pkg := range pkgs {
+		if pkg != nil {
+			modulePkgs[pkg] = true
+			roots = append(roots, pkg.Func("init"))
+		}
+	}
+	for fn := range ssautil.AllFunctions(prog) {
+		if fn.Synthetic != "" || fn.Parent() != nil || !modulePkgs[fn.Pkg] {
+			continue
+		}
+		if obj := fn.Object(); obj != nil && obj.Exported() {
+			roots = append(roots, fn)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].String() < roots[j].String() })
+	return roots
+}
+
+// sourceCalls indexes the call expressions of the type-checked files by the position SSA
+// gives their call instructions: the opening parenthesis, or the go and defer keywords
+func (a *Analyzer) sourceCalls() map[token.Pos]sourceCall {
+	sources := make(map[token.Pos]sourceCall)
+	for _, tf := range a.typed {
+		ast.Inspect(tf.file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.CallExpr:
+				sources[node.Lparen] = sourceCall{call: node}
+			case *ast.GoStmt:
+				sources[node.Go] = sourceCall{call: node.Call, mode: models.CallModeGo}
+			case *ast.DeferStmt:
+				sources[node.Defer] = sourceCall{call: node.Call, mode: models.CallModeDefer}
+			}
+			return true
+		})
+	}
+	return sources
+}
+
+// callerFile returns the type-checked file declaring a function of the source, closures
+// included. Generic functions are analyzed once, in their generic form, and the root node
+// of the graph has no function.
+func (a *Analyzer) callerFile(fn *ssa.Function) (string, bool) {
+	if fn == nil || fn.Synthetic != "" || !fn.Pos().IsValid() {
+		return "", false
+	}
+	file := a.fset.Position(fn.Pos()).Filename
+	_, ok := a.typed[file]
+	return file, ok
+}
+
+// ssaFuncName returns the name of an SSA function relative to its package, its fully
+// qualified name and the import path of its package. Closures are named after their
+// enclosing function, and instances of generic functions after their generic form.
+func (a *Analyzer) ssaFuncName(fn *ssa.Function) (name, qualified, pkgPath string) {
+	outer := fn
+	for outer.Parent() != nil {
+		outer = outer.Parent()
+	}
+	suffix := strings.TrimPrefix(fn.Name(), outer.Name())
+
+	if obj, ok := outer.Object().(*types.Func); ok {
+		return obj.Name() + suffix, a.qualifiedName(obj) + suffix, a.objectPackage(obj)
+	}
+	if outer.Pkg != nil {
+		pkgPath = outer.Pkg.Pkg.Path()
+		return fn.Name(), pkgPath + "." + fn.Name(), pkgPath
+	}
+	return fn.Name(), fn.Name(), ""
+}
+
+// recordCalls stores one call per target of each call site of a function and returns the
+// number stored
+func (a *Analyzer) recordCalls(node *callgraph.Node, file string, sources map[token.Pos]sourceCall) int {
+	callees := make(map[ssa.CallInstruction][]*ssa.Function)
+	for _, edge := range node.Out {
+		callees[edge.Site] = append(callees[edge.Site], edge.Callee.Func)
+	}
+
+	caller, _, _ := a.ssaFuncName(node.Func)
+	stored := 0
+	for _, block := range node.Func.Blocks {
+		for _, instr := range block.Instrs {
+			site, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+			// Calls SSA synthesizes have no call expression in the source
+			source, ok := sources[site.Pos()]
+			if !ok {
+				continue
+			}
+			calls := a.siteCalls(caller, file, site, source, callees[site])
+			a.preciseCalls[file] = append(a.preciseCalls[file], calls...)
+			stored += len(calls)
+		}
+	}
+	return stored
+}
+
+// siteCalls returns one call per distinct target of a call site. Calls without a known
+// target are kept with the interface method, the builtin or without a callee path.
+func (a *Analyzer) siteCalls(caller, file string, site ssa.CallInstruction, source sourceCall, callees []*ssa.Function) []models.CallInfo {
+	pos := a.fset.Position(source.call.Pos())
+
+	var params []string
+	for _, arg := range source.call.Args {
+		params = append(params, a.formatNode(arg))
+	}
+
+	call := models.CallInfo{
+		Caller:     caller,
+		CallerPath: file,
+		Callee:     a.calleeName(source.call),
+		Kind:       models.CallKindDynamic,
+		Mode:       source.mode,
+		Position:   models.Position{File: file, Line: pos.Line, Column: pos.Column},
+		Parameters: params,
+	}
+
+	common := site.Common()
+	switch {
+	case common.IsInvoke():
+		call.Interface = a.qualifiedName(common.Method)
+	case common.StaticCallee() != nil:
+		call.Kind = models.CallKindStatic
+	default:
+		if builtin, ok := common.Value.(*ssa.Builtin); ok {
+			call.Kind = models.CallKindStatic
+			call.CalleePath = builtin.Name()
+			return []models.CallInfo{call}
+		}
+	}
+
+	packages := make(map[string]string)
+	for _, callee := range callees {
+		_, path, pkgPath := a.ssaFuncName(callee)
+		packages[path] = pkgPath
+	}
+	if len(packages) == 0 {
+		if common.IsInvoke() {
+			call.CalleePath, call.Interface = call.Interface, ""
+			call.CalleePackage = a.objectPackage(common.Method)
+		}
+		return []models.CallInfo{call}
+	}
+
+	paths := make([]string, 0, len(packages))
+	for path := range packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	calls := make([]models.CallInfo, 0, len(paths))
+	for _, path := range paths {
+		resolved := call
+		resolved.CalleePath, resolved.CalleePackage = path, packages[path]
+		calls = append(calls, resolved)
+	}
+	return calls
+}
@@ -0,0 +1,202 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// callGraphModule has two implementations of Shape, of which only Square is ever created,
+// and dynamic calls through a goroutine, a deferred call, a func-typed field and a method value
+var callGraphModule = map[string]string{
+	"go.mod": "module example.com/shapes\n\ngo 1.21\n",
+	"main.go": `package main
+
+type Shape interface{ Area() int }
+
+type Square struct{ side int }
+
+func (s Square) Area() int { return s.side * s.side }
+
+type Circle struct{ r int }
+
+func (c *Circle) Area() int { return 3 * c.r * c.r }
+
+type Job struct{ run func() }
+
+func measure(s Shape) int { return s.Area() }
+
+func cleanup() {}
+
+func work() {}
+
+func report(s Shape) {}
+
+func main() {
+	var s Shape = Square{side: 2}
+	measure(s)
+
+	job := Job{run: work}
+	job.run()
+
+	go report(s)
+	defer cleanup()
+
+	sq := Square{side: 3}
+	area := sq.Area
+	area()
+}
+`,
+}
+
+// callTargets returns the sorted callee paths of the calls of a caller in a file
+func callTargets(calls []models.CallInfo, caller string) []string {
+	var targets []string
+	for _, call := range calls {
+		if call.Caller == caller && call.CalleePath != "" {
+			targets = append(targets, call.CalleePath)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func TestCallGraphAlgorithms(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+
+	// Every algorithm resolves the func-typed field and the method value called in main
+	mainCalls := []string{
+		"example.com/shapes.Square.Area", "example.com/shapes.cleanup", "example.com/shapes.measure",
+		"example.com/shapes.report", "example.com/shapes.work",
+	}
+	// CHA calls every function of the signature of a function value: cleanup, main and work
+	chaMainCalls := []string{
+		"example.com/shapes.Square.Area", "example.com/shapes.cleanup", "example.com/shapes.cleanup",
+		"example.com/shapes.main", "example.com/shapes.measure", "example.com/shapes.report",
+		"example.com/shapes.work",
+	}
+
+	testCases := []struct {
+		algorithm string
+		measure   []string
+		main      []string
+	}{
+		{models.CallGraphCHA, []string{"example.com/shapes.(*Circle).Area", "example.com/shapes.Square.Area"}, chaMainCalls},
+		{models.CallGraphRTA, []string{"example.com/shapes.Square.Area"}, mainCalls},
+		{models.CallGraphVTA, []string{"example.com/shapes.Square.Area"}, mainCalls},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			root := writeModule(t, callGraphModule)
+
+			a := New()
+			if err := a.SetCallGraphAlgorithm(tc.algorithm); err != nil {
+				t.Fatalf("SetCallGraphAlgorithm failed: %v", err)
+			}
+			results, err := a.AnalyzeModule(root)
+			if err != nil {
+				t.Fatalf("AnalyzeModule failed: %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Expected 1 analyzed file, got %d", len(results))
+			}
+			calls := results[0].Calls
+
+			if got := callTargets(calls, "measure"); strings.Join(got, ",") != strings.Join(tc.measure, ",") {
+				t.Errorf("measure calls %v, want %v", got, tc.measure)
+			}
+			if got := callTargets(calls, "main"); strings.Join(got, ",") != strings.Join(tc.main, ",") {
+				t.Errorf("main calls %v, want %v", got, tc.main)
+			}
+
+			modes := make(map[string]string)
+			for _, call := range calls {
+				if call.Mode != "" {
+					modes[call.CalleePath] = call.Mode
+				}
+			}
+			if modes["example.com/shapes.report"] != models.CallModeGo || modes["example.com/shapes.cleanup"] != models.CallModeDefer {
+				t.Errorf("Expected go and defer modes, got %v", modes)
+			}
+		})
+	}
+
+	if err := New().SetCallGraphAlgorithm("pointer"); err == nil {
+		t.Error("Expected an error for an unknown algorithm")
+	}
+}
+
+func TestCallGraphClosures(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+
+	root := writeModule(t, map[string]string{
+		"go.mod": "module example.com/jobs\n\ngo 1.21\n",
+		"main.go": `package main
+
+func work() {}
+
+func report() {}
+
+func each(fn func()) { fn() }
+
+func main() {
+	each(func() {
+		work()
+	})
+
+	go func() {
+		report()
+	}()
+}
+`,
+	})
+
+	for _, algorithm := range []string{models.CallGraphCHA, models.CallGraphRTA, models.CallGraphVTA} {
+		t.Run(algorithm, func(t *testing.T) {
+			a := New()
+			if err := a.SetCallGraphAlgorithm(algorithm); err != nil {
+				t.Fatalf("SetCallGraphAlgorithm failed: %v", err)
+			}
+			results, err := a.AnalyzeModule(root)
+			if err != nil {
+				t.Fatalf("AnalyzeModule failed: %v", err)
+			}
+			calls := results[0].Calls
+
+			// Calls in closures belong to the closures, which are called like any other function
+			if got := callTargets(calls, "main$1"); strings.Join(got, ",") != "example.com/jobs.work" {
+				t.Errorf("main$1 calls %v, want work", got)
+			}
+			if got := callTargets(calls, "main$2"); strings.Join(got, ",") != "example.com/jobs.report" {
+				t.Errorf("main$2 calls %v, want report", got)
+			}
+			if got := callTargets(calls, "main"); strings.Join(got, ",") != "example.com/jobs.each,example.com/jobs.main$2" {
+				t.Errorf("main calls %v, want each and main$2", got)
+			}
+			if got := callTargets(calls, "each"); !contains(got, "example.com/jobs.main$1") {
+				t.Errorf("each calls %v, want main$1 among them", got)
+			}
+
+			for _, call := range calls {
+				if call.Caller == "main" && call.CalleePath == "example.com/jobs.main$2" && (call.Mode != models.CallModeGo || call.CalleePackage != "example.com/jobs") {
+					t.Errorf("Expected main$2 to be launched as a goroutine of example.com/jobs, got %+v", call)
+				}
+			}
+		})
+	}
+}
+
+// contains reports whether a list of callee paths has path
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+)
+
+// computeImplementations records, for every named interface of the type-checked packages,
+// the named concrete types (or pointers to them) that implement it
+func (a *Analyzer) computeImplementations() {
+	a.implementations = make(map[*types.TypeName][]types.Type)
+
+	var interfaces, concretes []*types.TypeName
+	for _, pkg := range a.packages {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			typeName, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || typeName.IsAlias() {
+				continue
+			}
+			named, ok := typeName.Type().(*types.Named)
+			// Uninstantiated generic types cannot be checked against an interface
+			if !ok || named.TypeParams().Len() > 0 {
+				continue
+			}
+			if types.IsInterface(named) {
+				interfaces = append(interfaces, typeName)
+			} else {
+				concretes = append(concretes, typeName)
+			}
+		}
+	}
+
+	for _, iface := range interfaces {
+		underlying := iface.Type().Underlying().(*types.Interface)
+		// Every type implements the empty interface, which says nothing about dispatch
+		if underlying.NumMethods() == 0 {
+			continue
+		}
+
+		for _, concrete := range concretes {
+			if types.Implements(concrete.Type(), underlying) {
+				a.implementations[iface] = append(a.implementations[iface], concrete.Type())
+			} else if ptr := types.NewPointer(concrete.Type()); types.Implements(ptr, underlying) {
+				a.implementations[iface] = append(a.implementations[iface], ptr)
+			}
+		}
+	}
+}
+
+// interfaceOf returns the named interface declaring a method, or nil if fn is not an interface method
+func interfaceOf(fn *types.Func) *types.TypeName {
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return nil
+	}
+
+	named, ok := types.Unalias(sig.Recv().Type()).(*types.Named)
+	if !ok || !types.IsInterface(named) {
+		return nil
+	}
+	return named.Obj()
+}
+
+// dispatchTargets returns the concrete methods an interface method call can reach, by qualified name
+func (a *Analyzer) dispatchTargets(method *types.Func) []*types.Func {
+	iface := interfaceOf(method)
+	if iface == nil {
+		return nil
+	}
+
+	var targets []*types.Func
+	for _, impl := range a.implementations[iface] {
+		obj, _, _ := types.LookupFieldOrMethod(impl, false, method.Pkg(), method.Name())
+		if fn, ok := obj.(*types.Func); ok {
+			targets = append(targets, fn)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return a.qualifiedName(targets[i]) < a.qualifiedName(targets[j])
+	})
+	return targets
+}
+
+// implementationsOf returns the qualified names of the types implementing the interface declared by ident
+func (a *Analyzer) implementationsOf(filePath string, ident *ast.Ident) []string {
+	info := a.typeInfo(filePath)
+	if info == nil {
+		return nil
+	}
+
+	typeName, ok := info.Defs[ident].(*types.TypeName)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, impl := range a.implementations[typeName] {
+		names = append(names, types.TypeString(impl, nil))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// callKind classifies a call as static when its target is known at compile time
+// and dynamic when it goes through an interface or a function value
+func callKind(info *types.Info, call *ast.CallExpr, callee types.Object) string {
+	if fn, ok := callee.(*types.Func); ok && interfaceOf(fn) != nil {
+		return models.CallKindDynamic
+	}
+	if callee != nil {
+		return models.CallKindStatic
+	}
+
+	// Conversions such as string(b) are not calls at runtime
+	if tv, ok := info.Types[call.Fun]; ok && tv.IsType() {
+		return models.CallKindStatic
+	}
+	return models.CallKindDynamic
+}
+
+// GetImplementations returns the qualified names of the types implementing an interface,
+// given the interface's qualified name such as "pkg/path.Interface"
+func (a *Analyzer) GetImplementations(interfaceName string) []string {
+	for iface, impls := range a.implementations {
+		if a.qualifiedName(iface) != interfaceName {
+			continue
+		}
+		var names []string
+		for _, impl := range impls {
+			names = append(names, types.TypeString(impl, nil))
+		}
+		sort.Strings(names)
+		return names
+	}
+	return nil
+}
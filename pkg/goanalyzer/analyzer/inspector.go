@@ -23,6 +23,9 @@ func (a *Analyzer) analyzeFile(file *ast.File, filePath string) *models.FileAnal
 		FilePath: filePath,
 		Package:  file.Name.Name,
 	}
+	if tf, ok := a.typed[filePath]; ok {
+		analysis.PackagePath = tf.pkg.Path()
+	}
 
 	a.log().Info("Analyzing file", "file", filePath, "imports", file.Imports)
 	// Extract imports
@@ -228,6 +231,8 @@ func (a *Analyzer) analyzeFile(file *ast.File, filePath string) *models.FileAnal
 								Exported: typeSpec.Name.IsExported(),
 								Comments: comments,
 								Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
+								// Only known when the package was type-checked
+								Implementations: a.implementationsOf(filePath, typeSpec.Name),
 							}
 
 							// Extract methods
@@ -1,400 +1,450 @@
 package analyzer
 
 import (
-	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
 	"strings"
 
 	"cred.com/hack25/backend/pkg/goanalyzer/models"
 	"github.com/sirupsen/logrus"
 )
 
-// analyzeReferences analyzes references to symbols
-func (a *Analyzer) analyzeReferences(file *ast.File, filePath string, analysis *models.FileAnalysis) {
-	// Create a map to track assignment targets
-	assignmentTargets := make(map[string]bool)
-	positionRefs := make(map[string][]models.ReferenceInfo)
+// symbolRef is an identifier resolved to the symbol it refers to
+type symbolRef struct {
+	symbol  string // Name of the symbol, fully qualified when the package is known
+	pkgPath string // Import path of the package declaring the symbol, "" for the file's own package
+	decl    bool   // The identifier declares the symbol
+	field   bool   // The symbol is a struct field
+}
 
+// analyzeReferences records every reference to a package-level symbol, struct field or method
+// and classifies it as a declaration, read, write, address-taken or call. Type-checked files
+// resolve identifiers with go/types; other files use the scopes built by the parser. Local
+// variables, parameters, labels and builtins are not symbols and are skipped.
+func (a *Analyzer) analyzeReferences(file *ast.File, filePath string, analysis *models.FileAnalysis) {
 	// Build the parent map for AST nodes
 	parentMap := make(map[ast.Node]ast.Node)
 	v := &parentTrackingVisitor{parentMap: parentMap}
 	ast.Walk(v, file)
 
-	// First pass: identify assignment targets
+	var resolve func(id *ast.Ident) (symbolRef, bool)
+	if info := a.typeInfo(filePath); info != nil {
+		resolve = func(id *ast.Ident) (symbolRef, bool) {
+			return a.typedReference(info, id)
+		}
+	} else {
+		scope := newSyntaxScope(file, parentMap)
+		resolve = scope.reference
+	}
+
 	ast.Inspect(file, func(n ast.Node) bool {
-		switch node := n.(type) {
-		case *ast.AssignStmt:
-			// Mark all identifiers on the left-hand side as assignment targets
-			for _, lhs := range node.Lhs {
-				if id, ok := lhs.(*ast.Ident); ok {
-					pos := a.fset.Position(id.Pos())
-					key := id.Name + "_" + filePath + "_" + pos.String()
-					assignmentTargets[key] = true
-				}
-			}
-		case *ast.SelectorExpr:
-			// Handle package-qualified identifiers
-			if x, ok := node.X.(*ast.Ident); ok {
-				// Check if this selector is part of an assignment
-				parent := getParentAssignStmt(n, parentMap)
-				if parent != nil {
-					// Check if this is on the LHS of the assignment
-					for _, lhs := range parent.Lhs {
-						if sameNode(lhs, n) {
-							pos := a.fset.Position(node.Sel.Pos())
-							key := x.Name + "." + node.Sel.Name + "_" + filePath + "_" + pos.String()
-							assignmentTargets[key] = true
-						}
-					}
-				}
-			}
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		ref, ok := resolve(id)
+		if !ok {
+			return true
 		}
+
+		refType := models.RefDeclaration
+		if !ref.decl {
+			refType = referenceType(id, parentMap, ref.field)
+		}
+
+		pos := a.fset.Position(id.Pos())
+		info := models.ReferenceInfo{
+			Symbol:   ref.symbol,
+			Package:  ref.pkgPath,
+			Path:     filePath,
+			RefType:  refType,
+			Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
+		}
+		analysis.References = append(analysis.References, info)
+
+		// Also add to references map for lookup
+		a.references[ref.symbol] = append(a.references[ref.symbol], info)
 		return true
 	})
 
 	a.log().WithFields(logrus.Fields{
-		"assignmentTargets": assignmentTargets,
-		"parentMap":         parentMap,
-		"symbolTable":       a.symbolTable,
-	}).Debug("Identified assignment targets")
-	// Second pass: track all identifiers used in the file
-	ast.Inspect(file, func(n ast.Node) bool {
-		switch node := n.(type) {
-		case *ast.Ident:
-			pos := a.fset.Position(node.Pos())
-			symbol := node.Name
+		"file":       filePath,
+		"references": len(analysis.References),
+	}).Debug("Analyzed references")
+}
 
-			// Skip if it's too short (likely a single letter variable)
-			if len(symbol) <= 1 {
-				return true
-			}
+// typedReference resolves an identifier of a type-checked file. Fields of anonymous structs
+// and methods of anonymous interfaces have no qualified name and are skipped.
+func (a *Analyzer) typedReference(info *types.Info, id *ast.Ident) (symbolRef, bool) {
+	obj := info.Defs[id]
+	decl := obj != nil
+	if !decl {
+		obj = info.Uses[id]
+	}
+	// Universe objects (builtins, nil, true) have no package
+	if obj == nil || obj.Pkg() == nil {
+		return symbolRef{}, false
+	}
 
-			// Skip if it's a reserved keyword or a built-in type
-			if isReservedOrBuiltin(symbol) {
-				return true
-			}
+	field := false
+	switch o := obj.(type) {
+	case *types.PkgName, *types.Label:
+		return symbolRef{}, false
+	case *types.Func:
+		// Functions and methods, including methods of named interfaces
+	case *types.Var:
+		field = o.IsField()
+		if !field && o.Parent() != o.Pkg().Scope() {
+			return symbolRef{}, false
+		}
+	default:
+		if obj.Parent() != obj.Pkg().Scope() {
+			return symbolRef{}, false
+		}
+	}
+
+	pkgPath := obj.Pkg().Path()
+	symbol := a.qualifiedName(obj)
+	if !strings.HasPrefix(symbol, pkgPath+".") {
+		return symbolRef{}, false
+	}
+
+	return symbolRef{symbol: symbol, pkgPath: pkgPath, decl: decl, field: field}, true
+}
+
+// syntaxScope resolves the identifiers of a file that was not type-checked. Identifiers the
+// parser resolved are package-level when declared in the file scope and local otherwise;
+// unresolved ones are imports, builtins or package-level symbols of another file.
+type syntaxScope struct {
+	file      *ast.File
+	parentMap map[ast.Node]ast.Node
+	imports   map[string]string     // import name -> import path
+	declared  map[*ast.Ident]string // declaring identifier -> package-relative symbol
+}
+
+// newSyntaxScope indexes the imports and the package-level declarations of a file
+func newSyntaxScope(file *ast.File, parentMap map[ast.Node]ast.Node) *syntaxScope {
+	s := &syntaxScope{
+		file:      file,
+		parentMap: parentMap,
+		imports:   make(map[string]string),
+		declared:  make(map[*ast.Ident]string),
+	}
+
+	for _, imp := range file.Imports {
+		if name := importName(imp); name != "." && name != "_" {
+			s.imports[name] = strings.Trim(imp.Path.Value, `"`)
+		}
+	}
+
+	declare := func(id *ast.Ident, symbol string) {
+		if id.Name != "_" {
+			s.declared[id] = symbol
+		}
+	}
 
-			// Look for the symbol in our symbol table
-			var found bool
-			for qualifiedName, sym := range a.symbolTable {
-				parts := strings.Split(qualifiedName, ".")
-				simpleName := parts[len(parts)-1]
-
-				if simpleName == symbol || qualifiedName == symbol {
-					// Determine reference type
-					refType := "usage"
-
-					// If this is where the symbol is defined
-					if sym.Position.File == filePath && sym.Position.Line == pos.Line && sym.Position.Column == pos.Column {
-						refType = "declaration"
-					} else {
-						// Check if this is a modification (assignment target)
-						key := symbol + "_" + filePath + "_" + pos.String()
-						if assignmentTargets[key] {
-							refType = "modification"
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if recv := receiverTypeName(d.Recv); recv != "" {
+				declare(d.Name, recv+"."+d.Name.Name)
+			} else if d.Recv == nil {
+				declare(d.Name, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range sp.Names {
+						declare(name, name.Name)
+					}
+				case *ast.TypeSpec:
+					declare(sp.Name, sp.Name.Name)
+
+					var members *ast.FieldList
+					switch t := sp.Type.(type) {
+					case *ast.StructType:
+						members = t.Fields
+					case *ast.InterfaceType:
+						members = t.Methods
+					}
+					if members == nil {
+						continue
+					}
+					for _, member := range members.List {
+						for _, name := range member.Names {
+							declare(name, sp.Name.Name+"."+name.Name)
 						}
 					}
-					_ = refType
-
-					// Create reference info
-					// ref := models.ReferenceInfo{
-					// 	Symbol:   qualifiedName,
-					// 	Path:     filePath,
-					// 	RefType:  refType,
-					// 	Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-					// }
-					// posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-					// if _, ok := positionRefs[posKey]; ok {
-					// 	break
-					// }
-					// positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-					// // Add to references
-					// analysis.References = append(analysis.References, ref)
-
-					// // Also add to references map for lookup
-					// a.references[qualifiedName] = append(a.references[qualifiedName], ref)
-					// a.log().WithFields(logrus.Fields{
-					// 	"symbol":        symbol,
-					// 	"qualifiedName": qualifiedName,
-					// 	"sym":           sym,
-					// 	"simpleName":    simpleName,
-					// 	"refType":       refType,
-					// }).Debug("Found reference in symbol table :", ref)
-					// found = true
 				}
 			}
+		}
+	}
 
-			// If not found but it's capitalized, it might be an exported symbol from another package
-			if !found && len(symbol) > 0 && symbol[0] >= 'A' && symbol[0] <= 'Z' {
-				// Try to resolve it using import information
-				// resolvedSymbol := a.tryResolveExportedSymbol(symbol, file, filePath)
-
-				// Determine reference type
-				// refType := "usage"
-				// key := symbol + "_" + filePath + "_" + pos.String()
-				// if assignmentTargets[key] {
-				// 	refType = "modification"
-				// }
-
-				// ref := models.ReferenceInfo{
-				// 	Symbol:   resolvedSymbol,
-				// 	Path:     filePath,
-				// 	RefType:  refType,
-				// 	Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-				// }
-
-				// posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-				// if _, ok := positionRefs[posKey]; ok {
-				// 	break
-				// }
-				// positionRefs[posKey] = []models.ReferenceInfo{}
-				// positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-				// a.log().WithFields(logrus.Fields{
-				// 	"symbol":         symbol,
-				// 	"resolvedSymbol": resolvedSymbol,
-				// 	"key":            key,
-				// 	"refType":        refType,
-				// }).Debug("Found reference in CAP symbol table :", ref)
-				// analysis.References = append(analysis.References, ref)
-			}
-		case *ast.SelectorExpr:
-			// Handle package-qualified references (pkg.Symbol)
-			if x, ok := node.X.(*ast.Ident); ok {
-				pkgName := x.Name
-				symbolName := node.Sel.Name
-				pos := a.fset.Position(node.Sel.Pos())
-
-				// Skip if it's a field access on a variable (not a package)
-				if !a.isPackage(pkgName, file) && !a.isImportAlias(pkgName, file) {
-					return true
-				}
+	return s
+}
 
-				// Try to resolve the import path
-				importPath := a.resolveImportPath(pkgName, file)
-				qualifiedName := pkgName + "." + symbolName
-				if importPath != "" {
-					qualifiedName = importPath + "." + symbolName
-				}
+// reference resolves an identifier of the file
+func (s *syntaxScope) reference(id *ast.Ident) (symbolRef, bool) {
+	if symbol, ok := s.declared[id]; ok {
+		return symbolRef{symbol: symbol, decl: true}, true
+	}
 
-				// Determine reference type
-				refType := "usage"
-				key := pkgName + "." + symbolName + "_" + filePath + "_" + pos.String()
-				if assignmentTargets[key] {
-					refType = "modification"
-				}
+	switch p := s.parentMap[id].(type) {
+	case *ast.SelectorExpr:
+		if p.Sel == id {
+			return s.selectorReference(p)
+		}
+	case *ast.KeyValueExpr:
+		// Keys of a composite literal of a named type are its fields; the type of elided
+		// literals such as the elements of []T{{Key: v}} is unknown
+		if lit, ok := s.parentMap[p].(*ast.CompositeLit); ok && p.Key == id {
+			if lit.Type == nil {
+				return symbolRef{}, false
+			}
+			if typeName, pkgPath := s.typeName(lit.Type); typeName != "" {
+				return symbolRef{symbol: typeName + "." + id.Name, pkgPath: pkgPath, field: true}, true
+			}
+		}
+	case *ast.LabeledStmt, *ast.BranchStmt, *ast.ImportSpec, *ast.File:
+		return symbolRef{}, false
+	}
 
-				ref := models.ReferenceInfo{
-					Symbol:   qualifiedName,
-					Path:     filePath,
-					RefType:  refType,
-					Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-				}
+	if id.Name == "_" {
+		return symbolRef{}, false
+	}
+	if id.Obj != nil {
+		if s.file.Scope.Lookup(id.Name) != id.Obj {
+			return symbolRef{}, false
+		}
+		return symbolRef{symbol: id.Name}, true
+	}
+	if _, ok := s.imports[id.Name]; ok || types.Universe.Lookup(id.Name) != nil {
+		return symbolRef{}, false
+	}
+	return symbolRef{symbol: id.Name}, true
+}
 
-				posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-				if _, ok := positionRefs[posKey]; ok {
-					break
-				}
-				positionRefs[posKey] = []models.ReferenceInfo{}
-				positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-				a.log().WithFields(logrus.Fields{
-					"symbolName":    symbolName,
-					"importPath":    importPath,
-					"pkgName":       pkgName,
-					"qualifiedName": qualifiedName,
-					"refType":       refType,
-				}).Debug("Found reference in symbol table :", ref)
-				analysis.References = append(analysis.References, ref)
-			}
-		case *ast.CallExpr:
-			// Handle function calls
-			switch fun := node.Fun.(type) {
-			case *ast.Ident:
-				// Direct function call (e.g., foo())
-				pos := a.fset.Position(fun.Pos())
-				symbol := fun.Name
-
-				// Skip if it's a built-in function
-				if isReservedOrBuiltin(symbol) {
-					return true
-				}
+// selectorReference resolves the selected identifier of x.Sel: a member of an imported package,
+// or a field or method of x. Without a declared type for x the reference is recorded as x.Sel.
+func (s *syntaxScope) selectorReference(sel *ast.SelectorExpr) (symbolRef, bool) {
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return symbolRef{}, false
+	}
 
-				// Look for the function in our symbol table
-				var found bool
-				var bestMatch string
-				for qualifiedName, _ := range a.symbolTable {
-					parts := strings.Split(qualifiedName, ".")
-					simpleName := parts[len(parts)-1]
-
-					if simpleName == symbol || qualifiedName == symbol {
-						bestMatch = qualifiedName
-						found = true
-						break
-					}
-				}
+	if importPath, ok := s.imports[x.Name]; ok && x.Obj == nil {
+		return symbolRef{symbol: importPath + "." + sel.Sel.Name, pkgPath: importPath}, true
+	}
 
-				if found {
-					// Create reference info - function calls are always usage
-					ref := models.ReferenceInfo{
-						Symbol:   bestMatch,
-						Path:     filePath,
-						RefType:  "usage",
-						Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-					}
+	if typeName, pkgPath := s.typeOf(x); typeName != "" {
+		return symbolRef{symbol: typeName + "." + sel.Sel.Name, pkgPath: pkgPath}, true
+	}
+	return symbolRef{symbol: x.Name + "." + sel.Sel.Name}, true
+}
 
-					posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-					if _, ok := positionRefs[posKey]; ok {
-						break
-					}
-					positionRefs[posKey] = []models.ReferenceInfo{}
-					positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-					a.log().WithFields(logrus.Fields{
-						"symbol":    symbol,
-						"bestMatch": bestMatch,
-						"filePath":  filePath,
-						"pos":       pos.String(),
-					}).Debug("Found reference in CallExpr table :", ref)
-
-					analysis.References = append(analysis.References, ref)
-					// Also add to references map for lookup
-					a.references[bestMatch] = append(a.references[bestMatch], ref)
-				} else if len(symbol) > 0 && symbol[0] >= 'A' && symbol[0] <= 'Z' {
-					// If not found but it's capitalized, it might be an exported function from another package
-					// Try to resolve it using import information
-					resolvedSymbol := a.tryResolveExportedSymbol(symbol, file, filePath)
-
-					ref := models.ReferenceInfo{
-						Symbol:   resolvedSymbol,
-						Path:     filePath,
-						RefType:  "usage",
-						Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-					}
-					posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-					if _, ok := positionRefs[posKey]; ok {
-						break
-					}
-					positionRefs[posKey] = []models.ReferenceInfo{}
-					positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-					a.log().WithFields(logrus.Fields{
-						"symbol":         symbol,
-						"resolvedSymbol": resolvedSymbol,
-						"filePath":       filePath,
-						"pos":            pos.String(),
-					}).Debug("Found reference in CallExpr CAP table :", ref)
-					analysis.References = append(analysis.References, ref)
-				}
+// typeOf returns the named type of a variable from its declaration: an explicit type, a composite
+// literal, &T{} or new(T). The package path is set for types of imported packages.
+func (s *syntaxScope) typeOf(x *ast.Ident) (string, string) {
+	if x.Obj == nil {
+		return "", ""
+	}
 
-			case *ast.SelectorExpr:
-				// Method call (e.g., x.foo())
-				if x, ok := fun.X.(*ast.Ident); ok {
-					pkgName := x.Name
-					methodName := fun.Sel.Name
-					pos := a.fset.Position(fun.Sel.Pos())
-
-					// Try to determine if this is a package-qualified function call or a method call
-					if a.isPackage(pkgName, file) || a.isImportAlias(pkgName, file) {
-						// It's a package-qualified function call (e.g., fmt.Println())
-						importPath := a.resolveImportPath(pkgName, file)
-						qualifiedName := pkgName + "." + methodName
-						if importPath != "" {
-							qualifiedName = importPath + "." + methodName
-						}
-						_ = qualifiedName
-
-						// Only add one reference for package-qualified function call
-						// ref := models.ReferenceInfo{
-						// 	Symbol:   qualifiedName,
-						// 	Path:     filePath,
-						// 	RefType:  "usage",
-						// 	Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-						// }
-
-						// posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-						// if _, ok := positionRefs[posKey]; ok {
-						// 	break
-						// }
-						// positionRefs[posKey] = []models.ReferenceInfo{}
-						// positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-						// a.log().WithFields(logrus.Fields{
-						// 	"symbol":     qualifiedName,
-						// 	"pkgName":    pkgName,
-						// 	"methodName": methodName,
-						// 	"filePath":   filePath,
-						// 	"pos":        pos.String(),
-						// }).Debug("Found reference in SelectorExpr table :", ref)
-						// analysis.References = append(analysis.References, ref)
-					} else {
-						// It's likely a method call on a variable
-						// Here we need to find the type of 'x' to fully qualify the method
-						// For simplicity, we'll just record it as a reference to x.methodName
-						qualifiedName := pkgName + "." + methodName
-
-						// Add only one reference for method call
-						ref := models.ReferenceInfo{
-							Symbol:   qualifiedName,
-							Path:     filePath,
-							RefType:  "usage",
-							Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
-						}
+	switch decl := x.Obj.Decl.(type) {
+	case *ast.Field:
+		return s.typeName(decl.Type)
+	case *ast.ValueSpec:
+		if decl.Type != nil {
+			return s.typeName(decl.Type)
+		}
+		for i, name := range decl.Names {
+			if name == x && i < len(decl.Values) && len(decl.Names) == len(decl.Values) {
+				return s.valueType(decl.Values[i])
+			}
+		}
+	case *ast.AssignStmt:
+		for i, lhs := range decl.Lhs {
+			if lhs == x && len(decl.Lhs) == len(decl.Rhs) {
+				return s.valueType(decl.Rhs[i])
+			}
+		}
+	}
+	return "", ""
+}
 
-						posKey := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
-						if _, ok := positionRefs[posKey]; ok {
-							break
-						}
-						positionRefs[posKey] = []models.ReferenceInfo{}
-						positionRefs[posKey] = append(positionRefs[posKey], ref)
-
-						a.log().WithFields(logrus.Fields{
-							"symbol":     qualifiedName,
-							"pkgName":    pkgName,
-							"methodName": methodName,
-							"filePath":   filePath,
-							"pos":        pos.String(),
-						}).Debug("Found reference in SelectorExpr method call on variable :", ref)
-						analysis.References = append(analysis.References, ref)
-					}
-				}
+// valueType returns the named type of a value whose type is evident from its syntax
+func (s *syntaxScope) valueType(expr ast.Expr) (string, string) {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.CompositeLit:
+		if e.Type != nil {
+			return s.typeName(e.Type)
+		}
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			return s.valueType(e.X)
+		}
+	case *ast.CallExpr:
+		if fun, ok := e.Fun.(*ast.Ident); ok && fun.Name == "new" && fun.Obj == nil && len(e.Args) == 1 {
+			return s.typeName(e.Args[0])
+		}
+	}
+	return "", ""
+}
+
+// typeName returns the name of a named type expression, dereferencing pointers and dropping
+// type arguments. Types of imported packages are qualified by their import path.
+func (s *syntaxScope) typeName(expr ast.Expr) (string, string) {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return s.typeName(t.X)
+	case *ast.IndexExpr:
+		return s.typeName(t.X)
+	case *ast.IndexListExpr:
+		return s.typeName(t.X)
+	case *ast.ParenExpr:
+		return s.typeName(t.X)
+	case *ast.Ident:
+		if t.Obj == nil && types.Universe.Lookup(t.Name) != nil {
+			return "", ""
+		}
+		return t.Name, ""
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && x.Obj == nil {
+			if importPath, ok := s.imports[x.Name]; ok {
+				return importPath + "." + t.Sel.Name, importPath
 			}
 		}
-		return true
-	})
+	}
+	return "", ""
 }
 
-// tryResolveExportedSymbol attempts to resolve an exported symbol to its package
-func (a *Analyzer) tryResolveExportedSymbol(symbol string, file *ast.File, filePath string) string {
-	// Default to just the symbol name if we can't resolve it
-	return symbol
+// receiverTypeName returns the name of the receiver type of a method, or "" for functions
+func receiverTypeName(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+
+	expr := recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
 }
 
-// isPackage checks if an identifier is a package name
-func (a *Analyzer) isPackage(name string, file *ast.File) bool {
-	// Check if it's in the imports
-	for _, imp := range file.Imports {
-		if imp.Name != nil && imp.Name.Name == name {
-			return true
+// referenceType classifies a reference that does not declare its symbol by the expression
+// enclosing it. Keys of composite literals are writes when they name a struct field.
+func referenceType(id *ast.Ident, parentMap map[ast.Node]ast.Node, field bool) string {
+	// The reference of a selected member is the whole selector expression: x.f = v
+	var expr ast.Expr = id
+	if sel, ok := parentMap[id].(*ast.SelectorExpr); ok && sel.Sel == id {
+		expr = sel
+	}
+
+	parent := parentMap[expr]
+	for {
+		paren, ok := parent.(*ast.ParenExpr)
+		if !ok {
+			break
 		}
+		expr = paren
+		parent = parentMap[paren]
+	}
 
-		// Extract the package name from the import path
-		importPath := strings.Trim(imp.Path.Value, `"`)
-		parts := strings.Split(importPath, "/")
-		pkgName := parts[len(parts)-1]
-		if pkgName == name {
-			return true
+	// Explicit instantiation of a generic function: f[T](x)
+	switch index := parent.(type) {
+	case *ast.IndexExpr:
+		if call, ok := parentMap[index].(*ast.CallExpr); ok && index.X == expr && call.Fun == index {
+			return models.RefCall
+		}
+	case *ast.IndexListExpr:
+		if call, ok := parentMap[index].(*ast.CallExpr); ok && index.X == expr && call.Fun == index {
+			return models.RefCall
 		}
 	}
 
-	return false
+	switch p := parent.(type) {
+	case *ast.CallExpr:
+		if p.Fun == expr {
+			return models.RefCall
+		}
+	case *ast.UnaryExpr:
+		if p.Op == token.AND {
+			return models.RefAddressTaken
+		}
+	case *ast.AssignStmt:
+		for _, lhs := range p.Lhs {
+			if lhs == expr {
+				return models.RefWrite
+			}
+		}
+	case *ast.IncDecStmt:
+		return models.RefWrite
+	case *ast.RangeStmt:
+		if p.Tok == token.ASSIGN && (p.Key == expr || p.Value == expr) {
+			return models.RefWrite
+		}
+	case *ast.KeyValueExpr:
+		if p.Key == expr && field {
+			return models.RefWrite
+		}
+	}
+
+	return models.RefRead
+}
+
+// typedSymbol returns the fully qualified name of the object an identifier resolves to,
+// or false when the file was not type-checked or the identifier is unresolved
+func (a *Analyzer) typedSymbol(info *types.Info, id *ast.Ident) (string, bool) {
+	if info == nil {
+		return "", false
+	}
+
+	obj := info.Uses[id]
+	if obj == nil {
+		obj = info.Defs[id]
+	}
+	if obj == nil {
+		return "", false
+	}
+
+	return a.qualifiedName(obj), true
+}
+
+// importName returns the name an import binds in the file scope: its alias, "." or "_",
+// or the last element of its path
+func importName(imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name
+	}
+
+	importPath := strings.Trim(imp.Path.Value, `"`)
+	parts := strings.Split(importPath, "/")
+	return parts[len(parts)-1]
+}
+
+// isPackage checks if an identifier is a package name
+func (a *Analyzer) isPackage(name string, file *ast.File) bool {
+	return a.resolveImportPath(name, file) != ""
 }
 
 // isImportAlias checks if a name is an import alias
 func (a *Analyzer) isImportAlias(name string, file *ast.File) bool {
 	for _, imp := range file.Imports {
-		if imp.Name != nil && imp.Name.Name == name {
+		if imp.Name != nil && imp.Name.Name == name && name != "." && name != "_" {
 			return true
 		}
 	}
@@ -402,21 +452,17 @@ func (a *Analyzer) isImportAlias(name string, file *ast.File) bool {
 	return false
 }
 
-// resolveImportPath resolves a package name to its import path
+// resolveImportPath resolves a package name to its import path. An alias hides the name
+// of the package it imports, and dot and blank imports bind no name.
 func (a *Analyzer) resolveImportPath(pkgName string, file *ast.File) string {
+	if pkgName == "." || pkgName == "_" {
+		return ""
+	}
+
 	for _, imp := range file.Imports {
-		// Check explicit aliases
-		if imp.Name != nil && imp.Name.Name == pkgName {
+		if importName(imp) == pkgName {
 			return strings.Trim(imp.Path.Value, `"`)
 		}
-
-		// Check if the last part of the import path matches
-		importPath := strings.Trim(imp.Path.Value, `"`)
-		parts := strings.Split(importPath, "/")
-		lastPart := parts[len(parts)-1]
-		if lastPart == pkgName {
-			return importPath
-		}
 	}
 
 	return ""
@@ -439,43 +485,14 @@ func (v *parentTrackingVisitor) Visit(node ast.Node) ast.Visitor {
 		v.parentMap[node] = v.currentParent
 	}
 
-	// Use this node as the parent for its children
-	v.currentParent = node
-
+	// Use this node as the parent for its children, leaving this visitor's parent
+	// unchanged for the node's siblings
 	return &parentTrackingVisitor{
 		parentMap:     v.parentMap,
-		currentParent: v.currentParent,
-	}
-}
-
-// findParentNode looks for a parent node of a specific type
-func findParentNode[T ast.Node](parentMap map[ast.Node]ast.Node, node ast.Node) T {
-	var zero T
-	current := node
-	for {
-		parent, exists := parentMap[current]
-		if !exists {
-			return zero
-		}
-
-		if typed, ok := parent.(T); ok {
-			return typed
-		}
-
-		current = parent
+		currentParent: node,
 	}
 }
 
-// getParentAssignStmt finds the parent assignment statement for a node if it exists
-func getParentAssignStmt(node ast.Node, parentMap map[ast.Node]ast.Node) *ast.AssignStmt {
-	return findParentNode[*ast.AssignStmt](parentMap, node)
-}
-
-// sameNode checks if two nodes are the same
-func sameNode(a, b ast.Node) bool {
-	return a.Pos() == b.Pos() && a.End() == b.End()
-}
-
 // isReservedOrBuiltin checks if a word is a Go reserved keyword or built-in type
 func isReservedOrBuiltin(word string) bool {
 	// Go keywords
@@ -4,6 +4,8 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"sort"
+	"strings"
 	"testing"
 
 	"cred.com/hack25/backend/pkg/goanalyzer/models"
@@ -32,7 +34,7 @@ func TestAnalyzeReferences(t *testing.T) {
 			expectedRefTypes: map[string]string{
 				"main": "declaration",
 			},
-			expectedRefCount: 0,
+			expectedRefCount: 1, // main declaration; locals are not symbols
 		},
 		{
 			name: "Test Import and Package References",
@@ -61,12 +63,14 @@ func TestAnalyzeReferences(t *testing.T) {
 				}
 			`,
 			expectedRefTypes: map[string]string{
-				"fmt.Println":  "usage",
-				"strings.Join": "usage",
-				"m.DoStuff":    "usage",
-				// "main":         "declaration",
+				"fmt.Println":      "call",
+				"strings.Join":     "call",
+				"MyStruct.DoStuff": "call",
+				"MyStruct.Value":   "write",
+				"MyStruct":         "read",
+				"main":             "declaration",
 			},
-			expectedRefCount: 3,
+			expectedRefCount: 10, // 4 declarations, MyStruct twice, m.Value, m.DoStuff and both package calls
 		},
 		{
 			name: "Test Direct Function Calls",
@@ -83,9 +87,9 @@ func TestAnalyzeReferences(t *testing.T) {
 				}
 			`,
 			expectedRefTypes: map[string]string{
-				"doSomething": "usage", // doSomething() call
+				"doSomething": "call", // doSomething() call
 			},
-			expectedRefCount: 1, // doSomething declaration + usage (we skip built-ins)
+			expectedRefCount: 3, // doSomething and main declarations + call (we skip built-ins)
 		},
 		{
 			name: "Test Method Calls",
@@ -106,9 +110,9 @@ func TestAnalyzeReferences(t *testing.T) {
 				}
 			`,
 			expectedRefTypes: map[string]string{
-				"m.DoStuff": "usage", // Method call reference
+				"MyStruct.DoStuff": "call", // Method call through the declared type of m
 			},
-			expectedRefCount: 1, // MyStruct, m, and m.DoStuff
+			expectedRefCount: 7, // MyStruct, Value, DoStuff and main declarations, MyStruct twice and the call
 		},
 		{
 			name: "Test Multiple Function Calls",
@@ -127,11 +131,11 @@ func TestAnalyzeReferences(t *testing.T) {
 				}
 			`,
 			expectedRefTypes: map[string]string{
-				"helper1":     "usage",
-				"helper2":     "usage",
-				"fmt.Println": "usage",
+				"helper1":     "call",
+				"helper2":     "call",
+				"fmt.Println": "call",
 			},
-			expectedRefCount: 3, // helper1, helper2 declarations + all usage references
+			expectedRefCount: 6, // helper1, helper2, main declarations + all calls
 		},
 		{
 			name: "Test Nested Function Calls",
@@ -149,10 +153,10 @@ func TestAnalyzeReferences(t *testing.T) {
 				}
 			`,
 			expectedRefTypes: map[string]string{
-				"getData":     "usage",
-				"fmt.Println": "usage",
+				"getData":     "call",
+				"fmt.Println": "call",
 			},
-			expectedRefCount: 2, // getData declaration + both usage references
+			expectedRefCount: 4, // getData and main declarations + both calls
 		},
 	}
 
@@ -244,11 +248,11 @@ func TestAnalyzeReferences(t *testing.T) {
 			}
 
 			// Check that we found all expected references
-			// for symbol, expectedType := range tt.expectedRefTypes {
-			// 	if !refTypeFound[symbol] {
-			// 		t.Errorf("Reference for '%s' with type '%s' not found", symbol, expectedType)
-			// 	}
-			// }
+			for symbol, expectedType := range tt.expectedRefTypes {
+				if !refTypeFound[symbol] {
+					t.Errorf("Reference for '%s' with type '%s' not found", symbol, expectedType)
+				}
+			}
 
 			// Print all references for debugging
 			if t.Failed() {
@@ -421,3 +425,76 @@ func TestIsReservedOrBuiltin(t *testing.T) {
 		})
 	}
 }
+
+func TestTypeCheckedReferences(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+
+	root := writeModule(t, map[string]string{
+		"go.mod": "module example.com/refs\n\ngo 1.21\n",
+		"config.go": `package refs
+
+const DefaultTimeout = 30
+
+type Config struct {
+	Timeout int
+	Name    string
+}
+
+func (c *Config) Reset() { c.Timeout = DefaultTimeout }
+`,
+		"use.go": `package refs
+
+func use() int {
+	cfg := Config{Timeout: DefaultTimeout}
+	cfg.Timeout++
+	p := &cfg.Name
+	_ = p
+	cfg.Reset()
+	x := 1 // locals are not symbols
+	return cfg.Timeout + x
+}
+`,
+	})
+
+	a := New()
+	results, err := a.AnalyzeModule(root)
+	if err != nil {
+		t.Fatalf("AnalyzeModule failed: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, result := range results {
+		for _, ref := range result.References {
+			if ref.Package != "example.com/refs" {
+				t.Errorf("Unexpected package %q for %s", ref.Package, ref.Symbol)
+			}
+			got[ref.Symbol] = append(got[ref.Symbol], ref.RefType)
+		}
+	}
+
+	expected := map[string][]string{
+		"example.com/refs.DefaultTimeout":  {models.RefDeclaration, models.RefRead, models.RefRead},
+		"example.com/refs.Config.Timeout":  {models.RefDeclaration, models.RefWrite, models.RefWrite, models.RefWrite, models.RefRead},
+		"example.com/refs.Config.Name":     {models.RefDeclaration, models.RefAddressTaken},
+		"example.com/refs.(*Config).Reset": {models.RefDeclaration, models.RefCall},
+		"example.com/refs.use":             {models.RefDeclaration},
+	}
+	for symbol, want := range expected {
+		refTypes := got[symbol]
+		sort.Strings(refTypes)
+		sort.Strings(want)
+		if strings.Join(refTypes, ",") != strings.Join(want, ",") {
+			t.Errorf("References of %s = %v, want %v", symbol, refTypes, want)
+		}
+	}
+	for symbol := range got {
+		if _, ok := expected[symbol]; !ok && symbol != "example.com/refs.Config" {
+			t.Errorf("Unexpected reference to %s", symbol)
+		}
+	}
+
+	ref := models.ReferenceInfo{Symbol: "example.com/refs.(*Config).Reset", Package: "example.com/refs"}
+	if name := ref.LocalName(); name != "Config.Reset" {
+		t.Errorf("LocalName() = %q, want Config.Reset", name)
+	}
+}
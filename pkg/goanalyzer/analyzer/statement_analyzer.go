@@ -306,44 +306,106 @@ func (a *Analyzer) analyzeStatement(stmt ast.Stmt, filePath string) *models.Stat
 		if s.Body != nil {
 			for _, clause := range s.Body.List {
 				if caseClause, ok := clause.(*ast.CaseClause); ok {
-					caseInfo := &models.StatementInfo{
-						Type: "case",
-						Position: models.Position{
-							File:   filePath,
-							Line:   a.fset.Position(caseClause.Pos()).Line,
-							Column: a.fset.Position(caseClause.Pos()).Column,
-						},
-					}
+					info.SubStatements = append(info.SubStatements, a.analyzeCaseClause(caseClause, filePath))
+				}
+			}
+		}
 
-					// Extract case expressions
-					var caseExprs []string
-					for _, expr := range caseClause.List {
-						caseExprs = append(caseExprs, a.formatNode(expr))
-					}
+		return info
 
-					if len(caseExprs) > 0 {
-						caseInfo.Text = "case " + strings.Join(caseExprs, ", ")
-						caseInfo.Conditions = caseExprs
-					} else {
-						caseInfo.Text = "default"
-						caseInfo.Type = "default"
-					}
+	case *ast.TypeSwitchStmt:
+		info := &models.StatementInfo{
+			Type:     "type_switch",
+			Text:     "switch ... .(type)",
+			Position: stmtPos,
+		}
 
-					// Extract case body
-					for _, stmt := range caseClause.Body {
-						stmtInfo := a.analyzeStatement(stmt, filePath)
-						if stmtInfo != nil {
-							caseInfo.SubStatements = append(caseInfo.SubStatements, *stmtInfo)
-						}
-					}
+		// Extract the expression whose type is switched on, and the variable bound to it
+		switch assign := s.Assign.(type) {
+		case *ast.AssignStmt:
+			info.Variables = extractVariables(a, assign.Lhs)
+			if len(assign.Rhs) == 1 {
+				if typeAssert, ok := assign.Rhs[0].(*ast.TypeAssertExpr); ok {
+					info.Conditions = append(info.Conditions, a.formatNode(typeAssert.X)+".(type)")
+				}
+			}
+		case *ast.ExprStmt:
+			if typeAssert, ok := assign.X.(*ast.TypeAssertExpr); ok {
+				info.Conditions = append(info.Conditions, a.formatNode(typeAssert.X)+".(type)")
+			}
+		}
 
-					info.SubStatements = append(info.SubStatements, *caseInfo)
+		// Process body
+		if s.Body != nil {
+			for _, clause := range s.Body.List {
+				if caseClause, ok := clause.(*ast.CaseClause); ok {
+					info.SubStatements = append(info.SubStatements, a.analyzeCaseClause(caseClause, filePath))
 				}
 			}
 		}
 
 		return info
 
+	case *ast.SelectStmt:
+		info := &models.StatementInfo{
+			Type:     "select",
+			Text:     "select",
+			Position: stmtPos,
+		}
+
+		// Process communication clauses like the cases of a switch
+		if s.Body != nil {
+			for _, clause := range s.Body.List {
+				commClause, ok := clause.(*ast.CommClause)
+				if !ok {
+					continue
+				}
+				pos := a.fset.Position(commClause.Pos())
+				caseInfo := models.StatementInfo{
+					Type:     "default",
+					Text:     "default",
+					Position: models.Position{File: filePath, Line: pos.Line, Column: pos.Column},
+				}
+				if commClause.Comm != nil {
+					if commInfo := a.analyzeStatement(commClause.Comm, filePath); commInfo != nil {
+						caseInfo.Type = "case"
+						caseInfo.Text = "case " + commInfo.Text
+						caseInfo.Conditions = []string{commInfo.Text}
+						caseInfo.Variables = commInfo.Variables
+					}
+				}
+				for _, stmt := range commClause.Body {
+					if stmtInfo := a.analyzeStatement(stmt, filePath); stmtInfo != nil {
+						caseInfo.SubStatements = append(caseInfo.SubStatements, *stmtInfo)
+					}
+				}
+				info.SubStatements = append(info.SubStatements, caseInfo)
+			}
+		}
+
+		return info
+
+	case *ast.LabeledStmt:
+		// The labeled statement is kept as the only sub-statement, so that labeled break and
+		// continue statements can be matched with the loop or switch they leave
+		info := &models.StatementInfo{
+			Type:     "labeled",
+			Text:     s.Label.Name,
+			Position: stmtPos,
+		}
+		if subInfo := a.analyzeStatement(s.Stmt, filePath); subInfo != nil {
+			info.SubStatements = append(info.SubStatements, *subInfo)
+		}
+
+		return info
+
+	case *ast.SendStmt:
+		return &models.StatementInfo{
+			Type:     "send",
+			Text:     a.formatNode(s.Chan) + " <- " + a.formatNode(s.Value),
+			Position: stmtPos,
+		}
+
 	default:
 		return &models.StatementInfo{
 			Type:     fmt.Sprintf("%T", stmt),
@@ -353,6 +415,43 @@ func (a *Analyzer) analyzeStatement(stmt ast.Stmt, filePath string) *models.Stat
 	}
 }
 
+// analyzeCaseClause analyzes a clause of a switch or type switch along with its body
+func (a *Analyzer) analyzeCaseClause(caseClause *ast.CaseClause, filePath string) models.StatementInfo {
+	pos := a.fset.Position(caseClause.Pos())
+	caseInfo := models.StatementInfo{
+		Type: "case",
+		Position: models.Position{
+			File:   filePath,
+			Line:   pos.Line,
+			Column: pos.Column,
+		},
+	}
+
+	// Extract case expressions
+	var caseExprs []string
+	for _, expr := range caseClause.List {
+		caseExprs = append(caseExprs, a.formatNode(expr))
+	}
+
+	if len(caseExprs) > 0 {
+		caseInfo.Text = "case " + strings.Join(caseExprs, ", ")
+		caseInfo.Conditions = caseExprs
+	} else {
+		caseInfo.Text = "default"
+		caseInfo.Type = "default"
+	}
+
+	// Extract case body
+	for _, stmt := range caseClause.Body {
+		stmtInfo := a.analyzeStatement(stmt, filePath)
+		if stmtInfo != nil {
+			caseInfo.SubStatements = append(caseInfo.SubStatements, *stmtInfo)
+		}
+	}
+
+	return caseInfo
+}
+
 // extractVariables extracts variable names from a list of expressions
 func extractVariables(a *Analyzer, exprs []ast.Expr) []string {
 	var vars []string
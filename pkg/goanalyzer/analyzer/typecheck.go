@@ -0,0 +1,277 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/packages"
+)
+
+// typedFile holds a type-checked file together with the type information of its package
+type typedFile struct {
+	file *ast.File
+	pkg  *types.Package
+	info *types.Info
+}
+
+// loadMode is what go/packages loads for the packages of a module and their dependencies:
+// syntax and full type information, dependencies included, for SSA to be built from
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax | packages.NeedDeps
+
+// TypeCheckModules loads every Go module found under root and type-checks its packages.
+// Files of packages that type-check successfully are analyzed with full type information
+// by AnalyzeFile and AnalyzeDirectory; all other files keep using the syntax-only path.
+func (a *Analyzer) TypeCheckModules(root string) error {
+	// Drop type information from a previous run over the same tree
+	for path := range a.typed {
+		if strings.HasPrefix(path, root) {
+			delete(a.typed, path)
+		}
+	}
+	for dir := range a.packages {
+		if strings.HasPrefix(dir, root) {
+			delete(a.packages, dir)
+		}
+	}
+	for moduleRoot := range a.loaded {
+		if strings.HasPrefix(moduleRoot, root) {
+			delete(a.loaded, moduleRoot)
+		}
+	}
+
+	var moduleRoots []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || info.Name() == ".git" || info.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && info.Name() == "go.mod" {
+			moduleRoots = append(moduleRoots, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking directory: %w", err)
+	}
+
+	if len(moduleRoots) == 0 {
+		return fmt.Errorf("no go.mod found under %s", root)
+	}
+
+	var errs []error
+	for _, moduleRoot := range moduleRoots {
+		if err := a.typeCheckModule(moduleRoot); err != nil {
+			a.log().WithFields(logrus.Fields{
+				"module": moduleRoot,
+				"error":  err,
+			}).Warn("Module could not be type-checked, using syntax-only analysis")
+			errs = append(errs, fmt.Errorf("%s: %w", moduleRoot, err))
+		}
+	}
+
+	// Interface implementations are computed across all modules so that calls
+	// through an interface can be fanned out to every concrete method
+	a.computeImplementations()
+
+	if a.callGraphAlgorithm != "" {
+		a.buildCallGraph()
+	}
+
+	return errors.Join(errs...)
+}
+
+// typeCheckModule loads and type-checks all packages of the module rooted at moduleRoot with
+// go/packages. Packages with errors are left to the syntax-only analysis.
+func (a *Analyzer) typeCheckModule(moduleRoot string) error {
+	conf := &packages.Config{
+		Mode: loadMode,
+		Dir:  moduleRoot,
+		Fset: a.fset,
+	}
+	pkgs, err := packages.Load(conf, "./...")
+	if err != nil {
+		return fmt.Errorf("error loading packages: %w", err)
+	}
+
+	var checked []*packages.Package
+	var errs []error
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			for _, pkgErr := range pkg.Errors {
+				errs = append(errs, fmt.Errorf("%s: %s", pkg.PkgPath, pkgErr.Msg))
+			}
+			continue
+		}
+		if err := a.recordPackage(pkg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pkg.PkgPath, err))
+			continue
+		}
+		checked = append(checked, pkg)
+	}
+
+	a.log().WithFields(logrus.Fields{
+		"module":   moduleRoot,
+		"packages": len(checked),
+	}).Info("Type-checked module")
+
+	if len(checked) == 0 {
+		return errors.Join(append(errs, errors.New("no package could be type-checked"))...)
+	}
+	a.loaded[moduleRoot] = checked
+	return errors.Join(errs...)
+}
+
+// recordPackage keeps the files of a type-checked package, with their content for the code
+// blocks of their functions
+func (a *Analyzer) recordPackage(pkg *packages.Package) error {
+	files := make(map[string]*typedFile, len(pkg.Syntax))
+	for _, file := range pkg.Syntax {
+		path := a.fset.File(file.Pos()).Name()
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+		a.codeMap[path] = string(content)
+		files[path] = &typedFile{file: file, pkg: pkg.Types, info: pkg.TypesInfo}
+	}
+
+	for path, tf := range files {
+		a.typed[path] = tf
+	}
+	if len(pkg.GoFiles) > 0 {
+		a.packages[filepath.Dir(pkg.GoFiles[0])] = pkg.Types
+	}
+	a.recordFieldOwners(pkg.Types)
+	return nil
+}
+
+// recordFieldOwners remembers which named struct type declares each field of a package,
+// since a *types.Var field does not know the type it belongs to
+func (a *Analyzer) recordFieldOwners(pkg *types.Package) {
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		typeName, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || typeName.IsAlias() {
+			continue
+		}
+		st, ok := typeName.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			a.fieldOwners[st.Field(i)] = typeName
+		}
+	}
+}
+
+// typeInfo returns the type information for a file, or nil if the file was not type-checked
+func (a *Analyzer) typeInfo(filePath string) *types.Info {
+	if tf, ok := a.typed[filePath]; ok {
+		return tf.info
+	}
+	return nil
+}
+
+// calleeObject returns the function or method object a call expression invokes, if it is static
+// or an interface method; calls through function values return nil
+func calleeObject(info *types.Info, call *ast.CallExpr) types.Object {
+	fun := ast.Unparen(call.Fun)
+
+	// Strip explicit instantiation of generic functions: f[T](x)
+	switch index := fun.(type) {
+	case *ast.IndexExpr:
+		fun = ast.Unparen(index.X)
+	case *ast.IndexListExpr:
+		fun = ast.Unparen(index.X)
+	}
+
+	var obj types.Object
+	switch f := fun.(type) {
+	case *ast.Ident:
+		obj = info.Uses[f]
+	case *ast.SelectorExpr:
+		if sel, ok := info.Selections[f]; ok {
+			obj = sel.Obj()
+		} else {
+			obj = info.Uses[f.Sel]
+		}
+	}
+
+	switch obj.(type) {
+	case *types.Func, *types.Builtin:
+		return obj
+	}
+	return nil
+}
+
+// objectPackage returns the import path of the package declaring an object, that of the struct
+// type declaring it for fields, or "" for objects of no package such as builtins
+func (a *Analyzer) objectPackage(obj types.Object) string {
+	if v, ok := obj.(*types.Var); ok && v.IsField() {
+		if owner, ok := a.fieldOwners[v.Origin()]; ok && owner.Pkg() != nil {
+			return owner.Pkg().Path()
+		}
+		return ""
+	}
+	if obj == nil || obj.Pkg() == nil {
+		return ""
+	}
+	return obj.Pkg().Path()
+}
+
+// qualifiedName returns the fully qualified name of an object, such as
+// "pkg/path.Func", "pkg/path.(*Type).Method", "pkg/path.Type.Field" or "pkg/path.Const".
+// Objects that are not package-level (locals, parameters) are returned by their plain name.
+func (a *Analyzer) qualifiedName(obj types.Object) string {
+	if obj == nil {
+		return ""
+	}
+
+	switch o := obj.(type) {
+	case *types.PkgName:
+		return o.Imported().Path()
+	case *types.Func:
+		o = o.Origin()
+		sig, _ := o.Type().(*types.Signature)
+		if sig != nil && sig.Recv() != nil {
+			recv := sig.Recv().Type()
+			pointer := false
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+				pointer = true
+			}
+			named, ok := types.Unalias(recv).(*types.Named)
+			if !ok || o.Pkg() == nil {
+				// Method of an anonymous interface
+				return o.Name()
+			}
+			if pointer {
+				return fmt.Sprintf("%s.(*%s).%s", o.Pkg().Path(), named.Obj().Name(), o.Name())
+			}
+			return fmt.Sprintf("%s.%s.%s", o.Pkg().Path(), named.Obj().Name(), o.Name())
+		}
+	case *types.Var:
+		if o.IsField() {
+			o = o.Origin()
+			if owner, ok := a.fieldOwners[o]; ok && owner.Pkg() != nil {
+				return fmt.Sprintf("%s.%s.%s", owner.Pkg().Path(), owner.Name(), o.Name())
+			}
+			return o.Name()
+		}
+	}
+
+	// Package-level objects are qualified by their package path
+	if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
@@ -0,0 +1,214 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/goanalyzer/models"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// writeModule writes a throwaway Go module to a temp directory and returns its root
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return root
+}
+
+func TestTypeCheckedCallHierarchy(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+
+	root := writeModule(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"store/store.go": `package store
+
+type Store struct{ Name string }
+
+func (s *Store) Get(id int) string { return s.Name }
+
+func New() *Store { return &Store{} }
+`,
+		"svc/svc.go": `package svc
+
+import (
+	"strings"
+
+	db "example.com/app/store"
+)
+
+type Getter interface{ Get(id int) string }
+
+type Service struct {
+	repo   *db.Store
+	getter Getter
+}
+
+func (s *Service) Run() string {
+	s.repo.Name = "x"
+	a := s.repo.Get(1)
+	b := s.getter.Get(2)
+	return strings.ToUpper(a + b)
+}
+
+func Build() *Service {
+	return &Service{repo: db.New()}
+}
+`,
+	})
+
+	a := New()
+	results, err := a.AnalyzeModule(root)
+	if err != nil {
+		t.Fatalf("AnalyzeModule failed: %v", err)
+	}
+	if len(a.typed) != 2 {
+		t.Fatalf("Expected 2 type-checked files, got %d", len(a.typed))
+	}
+
+	var svc *models.FileAnalysis
+	for i := range results {
+		if results[i].Package == "svc" {
+			svc = &results[i]
+		}
+	}
+	if svc == nil {
+		t.Fatal("svc.go was not analyzed")
+	}
+
+	want := map[string]string{
+		"s.repo.Get":      "example.com/app/store.(*Store).Get",
+		"s.getter.Get":    "example.com/app/svc.Getter.Get",
+		"strings.ToUpper": "strings.ToUpper",
+		"db.New":          "example.com/app/store.New",
+	}
+	got := make(map[string]string)
+	for _, call := range svc.Calls {
+		if call.Interface == "" {
+			got[call.Callee] = call.CalleePath
+		}
+	}
+	for callee, path := range want {
+		if got[callee] != path {
+			t.Errorf("CalleePath for %s = %q, want %q", callee, got[callee], path)
+		}
+	}
+
+	// The call through Getter fans out to *store.Store, which implements it
+	var dispatched []models.CallInfo
+	for _, call := range svc.Calls {
+		if call.Interface == "example.com/app/svc.Getter.Get" {
+			dispatched = append(dispatched, call)
+		}
+	}
+	if len(dispatched) != 1 || dispatched[0].CalleePath != "example.com/app/store.(*Store).Get" || dispatched[0].Kind != models.CallKindDynamic {
+		t.Errorf("Expected Getter.Get to dispatch to (*Store).Get, got %+v", dispatched)
+	}
+	for _, call := range svc.Calls {
+		if call.Callee == "s.repo.Get" && call.Kind != models.CallKindStatic {
+			t.Errorf("Expected s.repo.Get to be static, got %q", call.Kind)
+		}
+	}
+
+	if impls := a.GetImplementations("example.com/app/svc.Getter"); len(impls) != 1 || impls[0] != "*example.com/app/store.Store" {
+		t.Errorf("Unexpected implementations of Getter: %v", impls)
+	}
+
+	// References resolve to the declaring package
+	found := false
+	for _, ref := range svc.References {
+		if ref.Symbol == "example.com/app/store.New" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a qualified reference to store.New, got %+v", svc.References)
+	}
+}
+
+func TestTypeCheckFallback(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+
+	root := writeModule(t, map[string]string{
+		"go.mod": "module example.com/broken\n\ngo 1.21\n",
+		"main.go": `package main
+
+func main() {
+	undefinedCall()
+}
+`,
+	})
+
+	a := New()
+	results, err := a.AnalyzeModule(root)
+	if err != nil {
+		t.Fatalf("AnalyzeModule failed: %v", err)
+	}
+	if len(a.typed) != 0 {
+		t.Fatalf("Expected no type-checked files, got %d", len(a.typed))
+	}
+	if len(results) != 1 || len(results[0].Calls) != 1 {
+		t.Fatalf("Expected syntax-only analysis to find 1 call, got %+v", results)
+	}
+	if results[0].Calls[0].CalleePath != "" {
+		t.Errorf("Expected no CalleePath without type information, got %q", results[0].Calls[0].CalleePath)
+	}
+}
+
+func TestVersionedPackagePath(t *testing.T) {
+	logger.Init(logrus.InfoLevel, "")
+
+	root := writeModule(t, map[string]string{
+		"go.mod": "module gopkg.in/yaml.v3\n\ngo 1.21\n",
+		"yaml.go": `package yaml
+
+type Encoder struct{}
+
+func (e *Encoder) Encode(v any) error { return nil }
+
+func Marshal(v any) ([]byte, error) { return nil, nil }
+`,
+		"cmd/main.go": `package main
+
+import "gopkg.in/yaml.v3"
+
+func main() {
+	yaml.Marshal(1)
+	new(yaml.Encoder).Encode(1)
+}
+`,
+	})
+
+	a := New()
+	results, err := a.AnalyzeModule(root)
+	if err != nil {
+		t.Fatalf("AnalyzeModule failed: %v", err)
+	}
+
+	want := map[string]string{
+		"gopkg.in/yaml.v3.Marshal":           "gopkg.in/yaml.v3",
+		"gopkg.in/yaml.v3.(*Encoder).Encode": "gopkg.in/yaml.v3",
+	}
+	got := make(map[string]string)
+	for _, result := range results {
+		for _, call := range result.Calls {
+			got[call.CalleePath] = call.CalleePackage
+		}
+	}
+	for path, pkgPath := range want {
+		if got[path] != pkgPath {
+			t.Errorf("CalleePackage for %s = %q, want %q", path, got[path], pkgPath)
+		}
+	}
+}
@@ -14,6 +14,14 @@ type Analyzer struct {
 	analyzer *analyzer.Analyzer
 }
 
+// Options configures an Analyzer
+type Options struct {
+	// CallGraphAlgorithm selects how calls of type-checked packages are resolved:
+	// models.CallGraphCHA, models.CallGraphRTA or models.CallGraphVTA. Empty keeps the
+	// syntactic call walk, which also fans interface calls out to their implementations.
+	CallGraphAlgorithm string
+}
+
 // New creates a new code analyzer
 func New() *Analyzer {
 	return &Analyzer{
@@ -21,6 +29,15 @@ func New() *Analyzer {
 	}
 }
 
+// NewWithOptions creates a new code analyzer with the given options
+func NewWithOptions(opts Options) (*Analyzer, error) {
+	a := New()
+	if err := a.analyzer.SetCallGraphAlgorithm(opts.CallGraphAlgorithm); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
 // AnalyzeFile analyzes a single Go file
 func (a *Analyzer) AnalyzeFile(filePath string) (*models.FileAnalysis, error) {
 	absPath, err := filepath.Abs(filePath)
@@ -55,6 +72,28 @@ func (a *Analyzer) AnalyzeDirectory(dirPath string) ([]models.FileAnalysis, erro
 	return a.analyzer.AnalyzeDirectory(absPath)
 }
 
+// AnalyzeModule analyzes all Go files in a directory, type-checking the Go modules
+// under it and falling back to syntax-only analysis where that is not possible
+func (a *Analyzer) AnalyzeModule(dirPath string) ([]models.FileAnalysis, error) {
+	absPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path: %w", err)
+	}
+
+	return a.analyzer.AnalyzeModule(absPath)
+}
+
+// TypeCheckModules type-checks the Go modules under a directory so that subsequent
+// AnalyzeFile calls for their files report fully qualified callees and references
+func (a *Analyzer) TypeCheckModules(dirPath string) error {
+	absPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return fmt.Errorf("error resolving path: %w", err)
+	}
+
+	return a.analyzer.TypeCheckModules(absPath)
+}
+
 // GetCallHierarchy returns the call hierarchy for a specific function
 func (a *Analyzer) GetCallHierarchy(filePath, funcName string) []models.CallInfo {
 	absPath, err := filepath.Abs(filePath)
@@ -69,6 +108,12 @@ func (a *Analyzer) GetReferences(symbolName string) []models.ReferenceInfo {
 	return a.analyzer.GetReferences(symbolName)
 }
 
+// GetImplementations returns the types implementing an interface, given its qualified
+// name such as "pkg/path.Interface". Requires TypeCheckModules to have been run.
+func (a *Analyzer) GetImplementations(interfaceName string) []string {
+	return a.analyzer.GetImplementations(interfaceName)
+}
+
 // GetSymbol returns a symbol by name
 func (a *Analyzer) GetSymbol(symbolName string) (models.Symbol, bool) {
 	return a.analyzer.GetSymbol(symbolName)
@@ -1,6 +1,9 @@
 package models
 
-import "go/ast"
+import (
+	"go/ast"
+	"strings"
+)
 
 // Symbol represents a Go symbol such as a variable, function, or type
 type Symbol struct {
@@ -16,6 +19,7 @@ type Symbol struct {
 	Fields           []Symbol        `json:"fields,omitempty"`
 	Methods          []string        `json:"methods,omitempty"`
 	Receiver         string          `json:"receiver,omitempty"`
+	Implementations  []string        `json:"implementations,omitempty"` // For interfaces, the types implementing them
 	CodeBlock        string          `json:"code_block,omitempty"`
 	ASTNode          ast.Node        `json:"-"`                   // The AST node for this symbol
 	Statements       []ast.Stmt      `json:"-"`                   // List of statements for functions/methods
@@ -42,37 +46,90 @@ type Position struct {
 	Column int    `json:"column"`
 }
 
+// Call kinds
+const (
+	// CallKindStatic is a call whose target is known at compile time
+	CallKindStatic = "static"
+	// CallKindDynamic is a call dispatched through an interface or a function value
+	CallKindDynamic = "dynamic"
+)
+
+// Call modes for calls that do not return to the caller immediately
+const (
+	CallModeGo    = "go"    // Goroutine launch: go f()
+	CallModeDefer = "defer" // Deferred call: defer f()
+)
+
+// Call graph algorithms, from least to most precise
+const (
+	// CallGraphCHA dispatches dynamic calls to every implementation in the program
+	CallGraphCHA = "cha"
+	// CallGraphRTA only considers types and function values used by code reachable from main and init
+	CallGraphRTA = "rta"
+	// CallGraphVTA only considers types and function values that flow to the receiver of each call
+	CallGraphVTA = "vta"
+)
+
 // CallInfo represents information about a function call
 type CallInfo struct {
-	Caller     string   `json:"caller"`
-	CallerPath string   `json:"caller_path"`
-	Callee     string   `json:"callee"`
-	CalleePath string   `json:"callee_path,omitempty"`
-	Position   Position `json:"position"`
-	Parameters []string `json:"parameters,omitempty"`
+	Caller        string   `json:"caller"`
+	CallerPath    string   `json:"caller_path"`
+	Callee        string   `json:"callee"`
+	CalleePath    string   `json:"callee_path,omitempty"`
+	CalleePackage string   `json:"callee_package,omitempty"` // Import path of the package declaring the callee, set with CalleePath
+	Kind          string   `json:"kind,omitempty"`           // "static" or "dynamic", set by type-checked analysis
+	Interface     string   `json:"interface,omitempty"`      // For calls fanned out to an implementation, the interface method called
+	Mode          string   `json:"mode,omitempty"`           // "go" or "defer", set by the call graph builder
+	Position      Position `json:"position"`
+	Parameters    []string `json:"parameters,omitempty"`
 }
 
+// Reference types
+const (
+	RefDeclaration  = "declaration"   // The identifier declares the symbol
+	RefRead         = "read"          // The value of the symbol is read
+	RefWrite        = "write"         // The symbol is assigned, incremented or set in a composite literal
+	RefAddressTaken = "address_taken" // The address of the symbol is taken: &x or &x.f
+	RefCall         = "call"          // The symbol is called
+)
+
 // ReferenceInfo represents a reference to a symbol
 type ReferenceInfo struct {
 	Symbol   string   `json:"symbol"`
+	Package  string   `json:"package,omitempty"` // Import path of the package declaring the symbol, when known
 	Path     string   `json:"path"`
-	RefType  string   `json:"ref_type"` // "declaration", "usage", "modification"
+	RefType  string   `json:"ref_type"` // One of the Ref* reference types
 	Position Position `json:"position"`
 }
 
+// LocalName returns the name of the referenced symbol relative to its package, with
+// methods of pointer receivers unwrapped, e.g. "Type.Field" or "Type.Method". References
+// without a package are to symbols of the package of the referencing file.
+func (r ReferenceInfo) LocalName() string {
+	name := r.Symbol
+	if r.Package != "" {
+		name = strings.TrimPrefix(name, r.Package+".")
+	}
+	if rest, ok := strings.CutPrefix(name, "(*"); ok {
+		name = strings.Replace(rest, ")", "", 1)
+	}
+	return name
+}
+
 // FileAnalysis represents the analysis of a single file
 type FileAnalysis struct {
-	FilePath   string          `json:"file_path"`
-	Package    string          `json:"package"`
-	Imports    []Symbol        `json:"imports"`
-	Constants  []Symbol        `json:"constants"`
-	Variables  []Symbol        `json:"variables"`
-	Types      []Symbol        `json:"types"`
-	Functions  []Symbol        `json:"functions"`
-	Structs    []Symbol        `json:"structs"`
-	Interfaces []Symbol        `json:"interfaces"`
-	Calls      []CallInfo      `json:"calls"`
-	References []ReferenceInfo `json:"references"`
+	FilePath    string          `json:"file_path"`
+	Package     string          `json:"package"`
+	PackagePath string          `json:"package_path,omitempty"` // Import path, set by type-checked analysis
+	Imports     []Symbol        `json:"imports"`
+	Constants   []Symbol        `json:"constants"`
+	Variables   []Symbol        `json:"variables"`
+	Types       []Symbol        `json:"types"`
+	Functions   []Symbol        `json:"functions"`
+	Structs     []Symbol        `json:"structs"`
+	Interfaces  []Symbol        `json:"interfaces"`
+	Calls       []CallInfo      `json:"calls"`
+	References  []ReferenceInfo `json:"references"`
 }
 
 // PackageAnalysis represents the analysis of a package
@@ -81,3 +138,20 @@ type PackageAnalysis struct {
 	PackageName string         `json:"package_name"`
 	Files       []FileAnalysis `json:"files"`
 }
+
+// QualifiedFunctionName builds the fully qualified name of a function or method in the
+// format used by the type-checked analysis, e.g. "pkg/path.(*Type).Method"
+func QualifiedFunctionName(pkgPath, receiver, name string) string {
+	if receiver == "" {
+		return pkgPath + "." + name
+	}
+
+	// Drop type parameters of generic receivers: List[T] -> List
+	if i := strings.Index(receiver, "["); i >= 0 {
+		receiver = receiver[:i]
+	}
+	if strings.HasPrefix(receiver, "*") {
+		return pkgPath + ".(" + receiver + ")." + name
+	}
+	return pkgPath + "." + receiver + "." + name
+}
@@ -0,0 +1,397 @@
+// Package anthropic implements the LLMClient interface for the Anthropic Messages API.
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+const (
+	// DefaultBaseURL is the URL of the Anthropic API
+	DefaultBaseURL = "https://api.anthropic.com"
+	// APIVersion is the version of the Messages API the client speaks
+	APIVersion = "2023-06-01"
+	// defaultMaxTokens is the maximum number of tokens generated when neither the request
+	// nor its model set one, as the API requires it
+	defaultMaxTokens = 4096
+)
+
+// Client is an implementation of the LLMClient interface for Anthropic
+type Client struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a new Anthropic client
+func NewClient(apiKey, baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 0}, // No timeout for streaming
+	}
+}
+
+// MessagesRequest represents a request to the Messages API
+type MessagesRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float32  `json:"temperature,omitempty"`
+	TopP        *float32  `json:"top_p,omitempty"`
+	Tools       []Tool    `json:"tools,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+// Message represents a message of a conversation with the Messages API
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// ContentBlock is a block of the content of a message: text, a tool call or its result
+type ContentBlock struct {
+	Type string `json:"type"` // "text", "tool_use" or "tool_result"
+
+	// Text blocks
+	Text string `json:"text,omitempty"`
+
+	// Tool use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// Tool result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// Tool represents a tool the model may call
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// Usage represents the tokens used by a request
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// MessagesResponse represents a response of the Messages API
+type MessagesResponse struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	Role       string         `json:"role"`
+	Model      string         `json:"model"`
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      Usage          `json:"usage"`
+}
+
+// StreamEvent represents an event of a streamed response, of which only the fields of its
+// type are set
+type StreamEvent struct {
+	Type    string            `json:"type"`
+	Message *MessagesResponse `json:"message,omitempty"` // message_start
+	Index   int               `json:"index"`
+	Delta   *struct {
+		Type       string `json:"type"` // "text_delta" or "input_json_delta" in content_block_delta
+		Text       string `json:"text,omitempty"`
+		StopReason string `json:"stop_reason,omitempty"` // message_delta
+	} `json:"delta,omitempty"`
+	Usage *Usage      `json:"usage,omitempty"` // message_delta
+	Error *ErrorEvent `json:"error,omitempty"` // error
+}
+
+// ErrorEvent is an error of the API, as returned in a streamed response
+type ErrorEvent struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// errorStatuses are the HTTP statuses of the errors that may occur in a stream, for them
+// to be handled as if they were the status of the response
+var errorStatuses = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// Completion implements the Completion method of the LLMClient interface
+func (c *Client) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	resp, err := c.send(ctx, newMessagesRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Decode response
+	var messagesResp MessagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&messagesResp); err != nil {
+		logger.Errorf("Failed to decode Anthropic response: %v", err)
+		return nil, err
+	}
+
+	// Text blocks are joined, tool use blocks are calls for the caller to answer
+	var text strings.Builder
+	var toolCalls []interfaces.ToolCall
+	for _, block := range messagesResp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, interfaces.ToolCall{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+
+	model := messagesResp.Model
+	if model == "" {
+		model = req.Model.Name
+	}
+
+	return &interfaces.CompletionResponse{
+		Text:         text.String(),
+		FinishReason: finishReason(messagesResp.StopReason),
+		ToolCalls:    toolCalls,
+		TokenUsage:   tokenUsage(messagesResp.Usage),
+		ModelName:    model,
+	}, nil
+}
+
+// StreamCompletion implements the StreamCompletion method of the LLMClient interface.
+// Text is passed to the callback as it is generated; tool calls are not streamed.
+func (c *Client) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	resp, err := c.send(ctx, newMessagesRequest(req, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Process the stream, an event per data line
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			logger.Errorf("Error reading Anthropic stream: %v", err)
+			return err
+		}
+
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue // Event names, which the data repeats, and blank lines
+		}
+
+		var event StreamEvent
+		if err := json.Unmarshal(bytes.TrimSpace(line[len("data:"):]), &event); err != nil {
+			logger.Errorf("Failed to parse Anthropic stream event: %v", err)
+			continue
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta != nil && event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				if err := callback(event.Delta.Text); err != nil {
+					logger.Errorf("Error in stream callback: %v", err)
+					return err
+				}
+			}
+		case "error":
+			return streamError(event.Error)
+		case "message_stop":
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Embedding implements the Embedding method of the LLMClient interface. Anthropic does not
+// provide embeddings.
+func (c *Client) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	return nil, errors.New("anthropic does not provide embeddings")
+}
+
+// send sends a request to the Messages API, returning its response if it succeeded
+func (c *Client) send(ctx context.Context, messagesReq MessagesRequest) (*http.Response, error) {
+	// Convert to JSON
+	jsonData, err := json.Marshal(messagesReq)
+	if err != nil {
+		logger.Errorf("Failed to marshal Anthropic request: %v", err)
+		return nil, err
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf("Failed to create HTTP request: %v", err)
+		return nil, err
+	}
+
+	// Add headers
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", APIVersion)
+
+	// Send request
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		logger.Errorf("Failed to send request to Anthropic: %v", err)
+		return nil, err
+	}
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		apiErr := interfaces.NewAPIError("anthropic", resp)
+		logger.Errorf("Anthropic API error: Status %d, Body: %s", apiErr.StatusCode, apiErr.Body)
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// newMessagesRequest converts a completion request to a Messages API request. System
+// messages become the system prompt, and the results of tool calls user messages, as the
+// API expects them.
+func newMessagesRequest(req interfaces.CompletionRequest, stream bool) MessagesRequest {
+	maxTokens := req.Model.MaxTokens
+	if req.MaxTokens > 0 {
+		maxTokens = req.MaxTokens
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultMaxTokens
+	}
+
+	temperature := req.Model.Temperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	messagesReq := MessagesRequest{
+		Model:       req.Model.Name,
+		MaxTokens:   maxTokens,
+		Temperature: &temperature,
+		TopP:        req.TopP, // Only when asked for, as models may not take it along with a temperature
+		Stream:      stream,
+	}
+
+	var system []string
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case interfaces.RoleSystem:
+			system = append(system, msg.Content)
+		case interfaces.RoleTool:
+			messagesReq.Messages = appendBlocks(messagesReq.Messages, interfaces.RoleUser,
+				ContentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		default:
+			var blocks []ContentBlock
+			if msg.Content != "" {
+				blocks = append(blocks, ContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := call.Input
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, ContentBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+			}
+			messagesReq.Messages = appendBlocks(messagesReq.Messages, msg.Role, blocks...)
+		}
+	}
+	messagesReq.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		schema := tool.InputSchema
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type": "object"}`)
+		}
+		messagesReq.Tools = append(messagesReq.Tools, Tool{Name: tool.Name, Description: tool.Description, InputSchema: schema})
+	}
+
+	return messagesReq
+}
+
+// appendBlocks appends content blocks to a conversation, in the last message if it is of
+// the same role, as the API expects the roles of its messages to alternate
+func appendBlocks(messages []Message, role string, blocks ...ContentBlock) []Message {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, Message{Role: role, Content: blocks})
+}
+
+// finishReason maps a stop reason of the API to the finish reasons of the other providers
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence", "pause_turn":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return stopReason
+}
+
+// tokenUsage maps the usage of a request, counting the prompt tokens read from and written
+// to the prompt cache as prompt tokens
+func tokenUsage(usage Usage) *interfaces.TokenUsage {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return &interfaces.TokenUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      prompt + usage.OutputTokens,
+	}
+}
+
+// streamError converts an error event of a stream to an APIError, with the status the error
+// has when it is the status of a response
+func streamError(event *ErrorEvent) error {
+	if event == nil {
+		return &interfaces.APIError{Provider: "anthropic", StatusCode: http.StatusInternalServerError, Body: "stream error"}
+	}
+	status, ok := errorStatuses[event.Type]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	body, _ := json.Marshal(map[string]interface{}{"type": "error", "error": event})
+	logger.Errorf("Anthropic stream error: %s: %s", event.Type, event.Message)
+	return &interfaces.APIError{Provider: "anthropic", StatusCode: status, Body: string(body)}
+}
+
+// IsValidModel checks if the given model name is a valid Anthropic model
+func IsValidModel(modelName string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(modelName, "anthropic:"), "claude-")
+}
@@ -0,0 +1,210 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init(logrus.ErrorLevel, "")
+}
+
+// fixtureServer serves a recorded response of the Messages API, keeping the request it got
+type fixtureServer struct {
+	status      int
+	fixture     string
+	contentType string
+	request     MessagesRequest
+	headers     http.Header
+}
+
+func (f *fixtureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(body, &f.request)
+	f.headers = r.Header
+
+	data, err := os.ReadFile(filepath.Join("testdata", f.fixture))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.WriteHeader(f.status)
+	_, _ = w.Write(data)
+}
+
+func newTestClient(t *testing.T, server *fixtureServer) *Client {
+	if server.status == 0 {
+		server.status = http.StatusOK
+	}
+	if server.contentType == "" {
+		server.contentType = "application/json"
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return NewClient("test-key", httpServer.URL)
+}
+
+func request(messages ...interfaces.Message) interfaces.CompletionRequest {
+	return interfaces.CompletionRequest{
+		Model:    interfaces.Model{Name: "claude-3-7-sonnet-20250219", Provider: "anthropic", MaxTokens: 1024, Temperature: 0.2},
+		Messages: messages,
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	server := &fixtureServer{fixture: "message.json"}
+	client := newTestClient(t, server)
+
+	resp, err := client.Completion(context.Background(), request(
+		interfaces.Message{Role: interfaces.RoleSystem, Content: "You are terse."},
+		interfaces.Message{Role: interfaces.RoleSystem, Content: "Answer in English."},
+		interfaces.Message{Role: interfaces.RoleUser, Content: "Hello"},
+	))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello! How can I help you today?", resp.Text)
+	assert.Equal(t, "stop", resp.FinishReason)
+	assert.Equal(t, "claude-3-7-sonnet-20250219", resp.ModelName)
+	assert.Empty(t, resp.ToolCalls)
+	assert.Equal(t, &interfaces.TokenUsage{PromptTokens: 25, CompletionTokens: 12, TotalTokens: 37}, resp.TokenUsage)
+
+	// System messages are the system prompt rather than messages
+	assert.Equal(t, "test-key", server.headers.Get("x-api-key"))
+	assert.Equal(t, APIVersion, server.headers.Get("anthropic-version"))
+	assert.Equal(t, "You are terse.\n\nAnswer in English.", server.request.System)
+	assert.Equal(t, []Message{{Role: "user", Content: []ContentBlock{{Type: "text", Text: "Hello"}}}}, server.request.Messages)
+	assert.Equal(t, 1024, server.request.MaxTokens)
+	require.NotNil(t, server.request.Temperature)
+	assert.Equal(t, float32(0.2), *server.request.Temperature)
+	assert.Nil(t, server.request.TopP)
+	assert.False(t, server.request.Stream)
+}
+
+func TestCompletionToolUse(t *testing.T) {
+	server := &fixtureServer{fixture: "tool_use.json"}
+	client := newTestClient(t, server)
+
+	req := request(
+		interfaces.Message{Role: interfaces.RoleUser, Content: "Who calls queueIndexing?"},
+		interfaces.Message{Role: interfaces.RoleAssistant, ToolCalls: []interfaces.ToolCall{
+			{ID: "toolu_1", Name: "find_callers", Input: json.RawMessage(`{"function":"IndexRepository"}`)},
+			{ID: "toolu_2", Name: "find_callers", Input: json.RawMessage(`{"function":"UploadRepository"}`)},
+		}},
+		interfaces.Message{Role: interfaces.RoleTool, ToolCallID: "toolu_1", Content: "IndexRepository handler"},
+		interfaces.Message{Role: interfaces.RoleTool, ToolCallID: "toolu_2", Content: "UploadRepository handler"},
+	)
+	req.Tools = []interfaces.Tool{{
+		Name:        "find_callers",
+		Description: "Finds the callers of a function",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"function":{"type":"string"}}}`),
+	}}
+
+	resp, err := client.Completion(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "I'll look up the callers of that function.", resp.Text)
+	assert.Equal(t, "tool_calls", resp.FinishReason)
+	require.Len(t, resp.ToolCalls, 1)
+	assert.Equal(t, "toolu_01A09q90qw90lq917835lq9", resp.ToolCalls[0].ID)
+	assert.Equal(t, "find_callers", resp.ToolCalls[0].Name)
+	assert.JSONEq(t, `{"function": "queueIndexing"}`, string(resp.ToolCalls[0].Input))
+
+	// Tool calls are tool use blocks, and their results a single user message of tool result blocks
+	require.Len(t, server.request.Tools, 1)
+	assert.Equal(t, "find_callers", server.request.Tools[0].Name)
+	require.Len(t, server.request.Messages, 3)
+	assistant := server.request.Messages[1]
+	assert.Equal(t, "assistant", assistant.Role)
+	require.Len(t, assistant.Content, 2)
+	assert.Equal(t, "tool_use", assistant.Content[0].Type)
+	assert.Equal(t, "toolu_1", assistant.Content[0].ID)
+	results := server.request.Messages[2]
+	assert.Equal(t, "user", results.Role)
+	assert.Equal(t, []ContentBlock{
+		{Type: "tool_result", ToolUseID: "toolu_1", Content: "IndexRepository handler"},
+		{Type: "tool_result", ToolUseID: "toolu_2", Content: "UploadRepository handler"},
+	}, results.Content)
+}
+
+func TestCompletionError(t *testing.T) {
+	server := &fixtureServer{status: http.StatusBadRequest, fixture: "error_prompt_too_long.json"}
+	client := newTestClient(t, server)
+
+	_, err := client.Completion(context.Background(), request(interfaces.Message{Role: interfaces.RoleUser, Content: "Hello"}))
+
+	var apiErr *interfaces.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "anthropic", apiErr.Provider)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, interfaces.ErrorClassContextLength, interfaces.ClassifyError(err))
+}
+
+func TestStreamCompletion(t *testing.T) {
+	server := &fixtureServer{fixture: "stream.txt", contentType: "text/event-stream"}
+	client := newTestClient(t, server)
+
+	var chunks []string
+	err := client.StreamCompletion(context.Background(), request(interfaces.Message{Role: interfaces.RoleUser, Content: "Hello"}),
+		func(chunk string) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+	require.NoError(t, err)
+
+	// Only text is streamed, not the input of tool calls
+	assert.Equal(t, []string{"Hello", "!"}, chunks)
+	assert.True(t, server.request.Stream)
+}
+
+func TestStreamCompletionError(t *testing.T) {
+	server := &fixtureServer{fixture: "stream_overloaded.txt", contentType: "text/event-stream"}
+	client := newTestClient(t, server)
+
+	var chunks []string
+	err := client.StreamCompletion(context.Background(), request(interfaces.Message{Role: interfaces.RoleUser, Content: "Hello"}),
+		func(chunk string) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+
+	// An overloaded error in the stream is the error of an overloaded response
+	assert.Equal(t, []string{"Hel"}, chunks)
+	var apiErr *interfaces.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 529, apiErr.StatusCode)
+	assert.True(t, apiErr.Temporary())
+	assert.Equal(t, interfaces.ErrorClassAvailability, interfaces.ClassifyError(err))
+}
+
+func TestFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"max_tokens":    "length",
+		"tool_use":      "tool_calls",
+		"refusal":       "content_filter",
+		"unknown":       "unknown",
+	}
+	for stopReason, want := range tests {
+		assert.Equal(t, want, finishReason(stopReason), stopReason)
+	}
+}
+
+func TestEmbeddingIsUnsupported(t *testing.T) {
+	_, err := NewClient("test-key", "").Embedding(context.Background(), "text", "claude-3-7-sonnet-20250219")
+	assert.Error(t, err)
+}
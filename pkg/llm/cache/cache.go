@@ -0,0 +1,248 @@
+// Package cache caches LLM responses by the content of their requests, so that identical
+// prompts, such as those repeated by re-indexing a repository, are only paid for once.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// Mode is how a call uses the cache
+type Mode int
+
+const (
+	// ModeUse answers from the cache when it can, and caches the responses of the provider
+	ModeUse Mode = iota
+	// ModeBypass neither reads nor writes the cache
+	ModeBypass
+	// ModeRefresh always calls the provider, replacing the cached response
+	ModeRefresh
+)
+
+// ParseMode parses a mode named "use", "bypass" or "refresh", ModeUse if empty
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "", "use":
+		return ModeUse, nil
+	case "bypass":
+		return ModeBypass, nil
+	case "refresh":
+		return ModeRefresh, nil
+	}
+	return ModeUse, fmt.Errorf("cache mode must be use, bypass or refresh")
+}
+
+type modeKey struct{}
+
+// WithMode returns a context whose LLM calls use the cache as given
+func WithMode(ctx context.Context, mode Mode) context.Context {
+	return context.WithValue(ctx, modeKey{}, mode)
+}
+
+// ModeFromContext returns how the LLM calls made with a context use the cache
+func ModeFromContext(ctx context.Context) Mode {
+	mode, _ := ctx.Value(modeKey{}).(Mode)
+	return mode
+}
+
+// Entry is a cached response
+type Entry struct {
+	Key              string
+	Model            string // Model that answered, as the response named it
+	Response         string
+	FinishReason     string
+	PromptTokens     int
+	CompletionTokens int
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+}
+
+// Expired reports whether the entry may no longer be used
+func (e *Entry) Expired(now time.Time) bool {
+	return !now.Before(e.ExpiresAt)
+}
+
+// Store persists cached responses
+type Store interface {
+	// GetCachedResponse gets the response cached under a key, nil if there is none
+	GetCachedResponse(key string) (*Entry, error)
+	// PutCachedResponse caches a response, replacing any under the same key
+	PutCachedResponse(entry *Entry) error
+	// DeleteExpiredResponses deletes the responses expired at a time, returning how many
+	DeleteExpiredResponses(now time.Time) (int64, error)
+}
+
+// Config holds the configuration of a cache
+type Config struct {
+	TTL           time.Duration // How long responses are cached
+	MemoryEntries int           // Responses also kept in memory, least recently used evicted first; none if 0
+	SweepInterval time.Duration // How often expired responses are deleted from the store
+}
+
+// DefaultConfig returns the default configuration of a cache
+func DefaultConfig() Config {
+	return Config{
+		TTL:           7 * 24 * time.Hour,
+		MemoryEntries: 1000,
+		SweepInterval: time.Hour,
+	}
+}
+
+// Cache is a cache of LLM responses, held in a store with an optional in-memory LRU in front
+type Cache struct {
+	store  Store // Optional, responses are only kept in memory without one
+	memory *lru  // Optional
+	config Config
+	now    func() time.Time
+}
+
+// New creates a cache of the responses held in a store
+func New(store Store, config Config) *Cache {
+	c := &Cache{
+		store:  store,
+		config: config,
+		now:    time.Now,
+	}
+	if config.MemoryEntries > 0 {
+		c.memory = newLRU(config.MemoryEntries)
+	}
+	return c
+}
+
+// Get gets the unexpired response cached under a key. Responses the store fails to get are
+// logged and missed.
+func (c *Cache) Get(key string) (*Entry, bool) {
+	now := c.now()
+	if c.memory != nil {
+		if entry, ok := c.memory.get(key); ok {
+			if !entry.Expired(now) {
+				return entry, true
+			}
+			c.memory.remove(key)
+		}
+	}
+	if c.store == nil {
+		return nil, false
+	}
+
+	entry, err := c.store.GetCachedResponse(key)
+	if err != nil {
+		logger.WithFields(logger.Fields{"key": key, "error": err}).Warn("Failed to get cached LLM response")
+		return nil, false
+	}
+	if entry == nil || entry.Expired(now) {
+		return nil, false
+	}
+	if c.memory != nil {
+		c.memory.put(entry)
+	}
+	return entry, true
+}
+
+// Put caches a response until the TTL of the cache passes. Responses the store fails to
+// keep are logged, and only cached in memory.
+func (c *Cache) Put(entry *Entry) {
+	entry.CreatedAt = c.now()
+	entry.ExpiresAt = entry.CreatedAt.Add(c.config.TTL)
+	if c.memory != nil {
+		c.memory.put(entry)
+	}
+	if c.store == nil {
+		return
+	}
+	if err := c.store.PutCachedResponse(entry); err != nil {
+		logger.WithFields(logger.Fields{"key": entry.Key, "model": entry.Model, "error": err}).Warn("Failed to cache LLM response")
+	}
+}
+
+// Sweep deletes the expired responses of the store. Those in memory are evicted as they
+// are found expired or least recently used.
+func (c *Cache) Sweep() (int64, error) {
+	if c.store == nil {
+		return 0, nil
+	}
+	return c.store.DeleteExpiredResponses(c.now())
+}
+
+// Run sweeps the store at the sweep interval of the cache until the context is done
+func (c *Cache) Run(ctx context.Context) {
+	if c.store == nil || c.config.SweepInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.config.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := c.Sweep()
+			if err != nil {
+				logger.Errorf("Failed to sweep expired LLM responses: %v", err)
+			} else if deleted > 0 {
+				logger.Infof("Swept %d expired LLM responses", deleted)
+			}
+		}
+	}
+}
+
+// Key returns the key of a request, a hash of its model, messages, response format,
+// temperature and maximum tokens. Messages are normalized so that line endings and surrounding
+// whitespace do not matter.
+func Key(model string, messages []interfaces.Message, format json.RawMessage, temperature *float32, maxTokens int) string {
+	request := struct {
+		Model       string     `json:"model"`
+		Messages    [][]string `json:"messages"`
+		Format      string     `json:"format,omitempty"`
+		Temperature string     `json:"temperature,omitempty"`
+		MaxTokens   int        `json:"max_tokens,omitempty"`
+	}{Model: model, MaxTokens: maxTokens}
+
+	for _, m := range messages {
+		request.Messages = append(request.Messages, []string{
+			strings.ToLower(strings.TrimSpace(m.Role)),
+			normalize(m.Content),
+		})
+	}
+	if len(format) > 0 {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, format); err != nil {
+			compact.Reset()
+			compact.Write(format)
+		}
+		request.Format = compact.String()
+	}
+	if temperature != nil {
+		request.Temperature = strconv.FormatFloat(float64(*temperature), 'f', -1, 32)
+	}
+
+	encoded, _ := json.Marshal(request)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Cacheable reports whether a response is worth caching: it has content, and the model
+// stopped on its own rather than being cut off or filtered
+func Cacheable(response, finishReason string) bool {
+	return response != "" && (finishReason == "" || finishReason == "stop")
+}
+
+// normalize normalizes the line endings and trailing whitespace of the lines of a text,
+// and trims it
+func normalize(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
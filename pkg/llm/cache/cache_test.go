@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/usage"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init(logrus.ErrorLevel, "")
+}
+
+// memoryStore is a store keeping its entries in a map
+type memoryStore struct {
+	entries map[string]*Entry
+	gets    int
+	err     error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]*Entry)}
+}
+
+func (s *memoryStore) GetCachedResponse(key string) (*Entry, error) {
+	s.gets++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.entries[key], nil
+}
+
+func (s *memoryStore) PutCachedResponse(entry *Entry) error {
+	if s.err != nil {
+		return s.err
+	}
+	copied := *entry
+	s.entries[entry.Key] = &copied
+	return nil
+}
+
+func (s *memoryStore) DeleteExpiredResponses(now time.Time) (int64, error) {
+	var deleted int64
+	for key, entry := range s.entries {
+		if entry.Expired(now) {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// countingClient answers completions with the number of calls made to it, as the model it
+// reports if any
+type countingClient struct {
+	calls        int
+	model        string
+	finishReason string
+}
+
+func (c *countingClient) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	c.calls++
+	model := c.model
+	if model == "" {
+		model = req.Model.Name
+	}
+	return &interfaces.CompletionResponse{
+		Text:         string(rune('0' + c.calls)),
+		FinishReason: c.finishReason,
+		ModelName:    model,
+		TokenUsage:   &interfaces.TokenUsage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+	}, nil
+}
+
+func (c *countingClient) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	c.calls++
+	return callback("streamed")
+}
+
+func (c *countingClient) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	c.calls++
+	return &interfaces.EmbeddingResponse{ModelName: modelName}, nil
+}
+
+type memoryRecorder struct {
+	records []usage.Record
+}
+
+func (r *memoryRecorder) RecordUsage(ctx context.Context, record usage.Record) {
+	r.records = append(r.records, record)
+}
+
+func messages(contents ...string) []interfaces.Message {
+	var msgs []interfaces.Message
+	for _, content := range contents {
+		msgs = append(msgs, interfaces.Message{Role: "user", Content: content})
+	}
+	return msgs
+}
+
+func TestKey(t *testing.T) {
+	zero, half := float32(0), float32(0.5)
+	key := Key("openai:gpt-4o", messages("Explain\nthis"), json.RawMessage(`{"type": "object"}`), &zero, 1024)
+
+	// Line endings, trailing whitespace and the formatting of the schema do not matter
+	assert.Equal(t, key, Key("openai:gpt-4o", []interfaces.Message{{Role: " USER", Content: "Explain  \r\nthis\n"}},
+		json.RawMessage(`{"type":"object"}`), &zero, 1024))
+
+	// The model, messages, response format, temperature and maximum tokens do
+	assert.NotEqual(t, key, Key("openai:gpt-4o-mini", messages("Explain\nthis"), json.RawMessage(`{"type": "object"}`), &zero, 1024))
+	assert.NotEqual(t, key, Key("openai:gpt-4o", messages("Explain that"), json.RawMessage(`{"type": "object"}`), &zero, 1024))
+	assert.NotEqual(t, key, Key("openai:gpt-4o", messages("Explain", "this"), json.RawMessage(`{"type": "object"}`), &zero, 1024))
+	assert.NotEqual(t, key, Key("openai:gpt-4o", messages("Explain\nthis"), json.RawMessage(`{"type": "array"}`), &zero, 1024))
+	assert.NotEqual(t, key, Key("openai:gpt-4o", messages("Explain\nthis"), json.RawMessage(`{"type": "object"}`), &half, 1024))
+	assert.NotEqual(t, key, Key("openai:gpt-4o", messages("Explain\nthis"), nil, &zero, 1024))
+	assert.NotEqual(t, key, Key("openai:gpt-4o", messages("Explain\nthis"), json.RawMessage(`{"type": "object"}`), &zero, 4096))
+}
+
+func TestCacheExpires(t *testing.T) {
+	store := newMemoryStore()
+	c := New(store, Config{TTL: time.Hour, MemoryEntries: 10})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Put(&Entry{Key: "key", Response: "cached"})
+	entry, ok := c.Get("key")
+	require.True(t, ok)
+	assert.Equal(t, "cached", entry.Response)
+
+	now = now.Add(time.Hour)
+	_, ok = c.Get("key")
+	assert.False(t, ok)
+
+	deleted, err := c.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Empty(t, store.entries)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	store := newMemoryStore()
+	c := New(store, Config{TTL: time.Hour, MemoryEntries: 2})
+
+	c.Put(&Entry{Key: "a"})
+	c.Put(&Entry{Key: "b"})
+	c.Get("a")
+	c.Put(&Entry{Key: "c"})
+
+	// b was evicted from memory, and is only found in the store
+	store.gets = 0
+	for _, key := range []string{"a", "c"} {
+		_, ok := c.Get(key)
+		assert.True(t, ok)
+	}
+	assert.Zero(t, store.gets)
+	_, ok := c.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, store.gets)
+}
+
+func TestCacheMissesOnStoreErrors(t *testing.T) {
+	store := newMemoryStore()
+	store.err = errors.New("connection refused")
+	c := New(store, Config{TTL: time.Hour})
+
+	c.Put(&Entry{Key: "key"})
+	_, ok := c.Get("key")
+	assert.False(t, ok)
+}
+
+func TestClientCachesCompletions(t *testing.T) {
+	llm := &countingClient{model: "gpt-4o-2024-08-06", finishReason: "stop"}
+	recorder := &memoryRecorder{}
+	client := NewClient(llm, "openai", New(newMemoryStore(), Config{TTL: time.Hour}), recorder)
+	req := interfaces.CompletionRequest{Model: interfaces.Model{Name: "gpt-4o"}, Messages: messages("hi")}
+	ctx := usage.WithAttribution(context.Background(), usage.Attribution{UserID: "user-1", Feature: usage.FeatureChat})
+
+	first, err := client.Completion(ctx, req)
+	require.NoError(t, err)
+	second, err := client.Completion(ctx, req)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, llm.calls)
+	assert.Equal(t, first.Text, second.Text)
+	assert.Equal(t, "gpt-4o-2024-08-06", second.ModelName)
+	assert.Equal(t, 120, second.TokenUsage.TotalTokens)
+
+	// The hit is recorded as cached, with the model and tokens of the response
+	require.Len(t, recorder.records, 1)
+	assert.Equal(t, usage.Record{
+		Attribution:      usage.Attribution{UserID: "user-1", Feature: usage.FeatureChat},
+		Model:            "openai:gpt-4o-2024-08-06",
+		PromptTokens:     100,
+		CompletionTokens: 20,
+		Cached:           true,
+		CreatedAt:        recorder.records[0].CreatedAt,
+	}, recorder.records[0])
+
+	// Other temperatures are other requests
+	temperature := float32(0.9)
+	req.Temperature = &temperature
+	_, err = client.Completion(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, llm.calls)
+
+	// So are other maximum tokens
+	req.MaxTokens = 256
+	_, err = client.Completion(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 3, llm.calls)
+}
+
+func TestClientDoesNotCacheUnfinishedCompletions(t *testing.T) {
+	llm := &countingClient{finishReason: "length"}
+	client := NewClient(llm, "openai", New(nil, Config{TTL: time.Hour, MemoryEntries: 10}), nil)
+	req := interfaces.CompletionRequest{Model: interfaces.Model{Name: "gpt-4o"}, Messages: messages("hi")}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Completion(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "length", resp.FinishReason)
+	}
+	assert.Equal(t, 2, llm.calls)
+}
+
+func TestClientBypassesAndRefreshes(t *testing.T) {
+	llm := &countingClient{}
+	client := NewClient(llm, "openai", New(nil, Config{TTL: time.Hour, MemoryEntries: 10}), nil)
+	req := interfaces.CompletionRequest{Model: interfaces.Model{Name: "gpt-4o"}, Messages: messages("hi")}
+
+	_, err := client.Completion(context.Background(), req)
+	require.NoError(t, err)
+
+	// Bypassing calls the provider without replacing the cached response
+	resp, err := client.Completion(WithMode(context.Background(), ModeBypass), req)
+	require.NoError(t, err)
+	assert.Equal(t, "2", resp.Text)
+	resp, err = client.Completion(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "1", resp.Text)
+
+	// Refreshing calls the provider and replaces it
+	resp, err = client.Completion(WithMode(context.Background(), ModeRefresh), req)
+	require.NoError(t, err)
+	assert.Equal(t, "3", resp.Text)
+	resp, err = client.Completion(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "3", resp.Text)
+	assert.Equal(t, 3, llm.calls)
+}
+
+func TestParseMode(t *testing.T) {
+	for name, want := range map[string]Mode{"": ModeUse, "use": ModeUse, "bypass": ModeBypass, "refresh": ModeRefresh} {
+		mode, err := ParseMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, mode)
+	}
+	_, err := ParseMode("never")
+	assert.Error(t, err)
+}
+
+func TestClientDoesNotCacheToolUse(t *testing.T) {
+	llm := &countingClient{}
+	client := NewClient(llm, "anthropic", New(nil, Config{TTL: time.Hour, MemoryEntries: 10}), nil)
+	req := interfaces.CompletionRequest{
+		Model:    interfaces.Model{Name: "claude-3-7-sonnet-20250219"},
+		Messages: messages("Who calls queueIndexing?"),
+		Tools:    []interfaces.Tool{{Name: "find_callers"}},
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Completion(context.Background(), req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, llm.calls)
+}
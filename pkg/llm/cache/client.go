@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/usage"
+)
+
+// Client is an LLM client whose completions are cached. Streams, embeddings and completions
+// offering tools, whose calls are answered by the caller, are not.
+type Client struct {
+	client   interfaces.LLMClient
+	provider string
+	cache    *Cache
+	recorder usage.Recorder // Optional, records the calls answered from the cache
+}
+
+// NewClient wraps an LLM client of a provider, caching its completions that finished. Completions
+// answered from the cache are recorded as cached with the model and tokens they first used.
+func NewClient(client interfaces.LLMClient, provider string, cache *Cache, recorder usage.Recorder) *Client {
+	return &Client{
+		client:   client,
+		provider: provider,
+		cache:    cache,
+		recorder: recorder,
+	}
+}
+
+// Completion implements the Completion method of the LLMClient interface
+func (c *Client) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	mode := ModeFromContext(ctx)
+	if mode == ModeBypass || len(req.Tools) > 0 {
+		return c.client.Completion(ctx, req)
+	}
+
+	temperature := req.Model.Temperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+	maxTokens := req.Model.MaxTokens
+	if req.MaxTokens > 0 {
+		maxTokens = req.MaxTokens
+	}
+	// Completion requests have no response format, which only the structured client sets
+	key := Key(c.provider+":"+req.Model.Name, req.Messages, nil, &temperature, maxTokens)
+
+	if mode == ModeUse {
+		if entry, ok := c.cache.Get(key); ok {
+			if c.recorder != nil {
+				// Hits are recorded under the model that answered, as misses are
+				model := entry.Model
+				if model == "" {
+					model = req.Model.Name
+				}
+				c.recorder.RecordUsage(ctx, usage.Record{
+					Attribution:      usage.FromContext(ctx),
+					Model:            c.provider + ":" + model,
+					PromptTokens:     entry.PromptTokens,
+					CompletionTokens: entry.CompletionTokens,
+					Cached:           true,
+					CreatedAt:        time.Now(),
+				})
+			}
+			return &interfaces.CompletionResponse{
+				Text:         entry.Response,
+				FinishReason: entry.FinishReason,
+				TokenUsage: &interfaces.TokenUsage{
+					PromptTokens:     entry.PromptTokens,
+					CompletionTokens: entry.CompletionTokens,
+					TotalTokens:      entry.PromptTokens + entry.CompletionTokens,
+				},
+				ModelName: entry.Model,
+			}, nil
+		}
+	}
+
+	resp, err := c.client.Completion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !Cacheable(resp.Text, resp.FinishReason) {
+		return resp, nil
+	}
+
+	entry := &Entry{Key: key, Model: resp.ModelName, Response: resp.Text, FinishReason: resp.FinishReason}
+	if resp.TokenUsage != nil {
+		entry.PromptTokens = resp.TokenUsage.PromptTokens
+		entry.CompletionTokens = resp.TokenUsage.CompletionTokens
+	}
+	c.cache.Put(entry)
+	return resp, nil
+}
+
+// StreamCompletion implements the StreamCompletion method of the LLMClient interface
+func (c *Client) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	return c.client.StreamCompletion(ctx, req, callback)
+}
+
+// Embedding implements the Embedding method of the LLMClient interface
+func (c *Client) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	return c.client.Embedding(ctx, text, modelName)
+}
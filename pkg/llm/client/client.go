@@ -14,6 +14,8 @@ type (
 	EmbeddingResponse  = interfaces.EmbeddingResponse
 	LLMClient          = interfaces.LLMClient
 	ModelInfo          = interfaces.ModelInfo
+	Tool               = interfaces.Tool
+	ToolCall           = interfaces.ToolCall
 )
 
 // Re-export constants from interfaces package
@@ -21,6 +23,7 @@ const (
 	RoleSystem    = interfaces.RoleSystem
 	RoleUser      = interfaces.RoleUser
 	RoleAssistant = interfaces.RoleAssistant
+	RoleTool      = interfaces.RoleTool
 )
 
 // DefaultModels returns default models for different providers
@@ -1,30 +1,51 @@
 package client
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"strings"
 
+	"cred.com/hack25/backend/pkg/llm/anthropic"
+	"cred.com/hack25/backend/pkg/llm/cache"
 	"cred.com/hack25/backend/pkg/llm/gemini"
 	"cred.com/hack25/backend/pkg/llm/interfaces"
 	"cred.com/hack25/backend/pkg/llm/litellm"
+	"cred.com/hack25/backend/pkg/llm/local"
 	"cred.com/hack25/backend/pkg/llm/openai"
+	"cred.com/hack25/backend/pkg/llm/resilience"
 	"cred.com/hack25/backend/pkg/llm/sonnet"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"cred.com/hack25/backend/pkg/logger"
 )
 
 // Factory creates and manages LLM clients
 type Factory struct {
-	openaiClient  *openai.Client
-	geminiClient  *gemini.Client
-	sonnetClient  *sonnet.Client
-	litellmClient *litellm.Client
+	openaiClient    *openai.Client
+	geminiClient    *gemini.Client
+	sonnetClient    *sonnet.Client
+	anthropicClient *anthropic.Client
+	litellmClient   *litellm.Client
+	localClient     *local.Client
 	// Other clients can be added here
+
+	guards    map[string]*resilience.Guard // By provider
+	fallbacks *interfaces.FallbackPolicy   // Chains keyed by the model with its provider
+	recorder  usage.Recorder               // Records the usage of the calls, if set
+	responses *cache.Cache                 // Caches the responses of completions, if set
 }
 
 // NewFactory creates a new LLM client factory
 func NewFactory(config Config) (*Factory, error) {
-	factory := &Factory{}
+	factory := &Factory{guards: make(map[string]*resilience.Guard)}
+
+	// The calls to each provider are retried, rate limited and circuit broken
+	resilienceConfig := resilience.DefaultConfig()
+	if config.Resilience != nil {
+		resilienceConfig = *config.Resilience
+	}
+	for _, provider := range []string{"openai", "google", "sonnet", "anthropic", "litellm", "local"} {
+		factory.guards[provider] = resilience.NewGuard(provider, resilienceConfig)
+	}
 
 	// Initialize OpenAI client if configured
 	if config.OpenAIAPIKey != "" {
@@ -49,71 +70,223 @@ func NewFactory(config Config) (*Factory, error) {
 		logger.Info("Sonnet client initialized")
 	}
 
+	// Initialize Anthropic client if configured
+	if config.AnthropicAPIKey != "" {
+		factory.anthropicClient = anthropic.NewClient(config.AnthropicAPIKey, config.AnthropicBaseURL)
+		logger.Info("Anthropic client initialized")
+	}
+
 	// Initialize LiteLLM client if configured
 	if config.LiteLLMAPIKey != "" || config.LiteLLMBaseURL != "" {
 		factory.litellmClient = litellm.NewClient(config.LiteLLMAPIKey, config.LiteLLMBaseURL)
 		logger.Info("LiteLLM client initialized")
 	}
 
+	// Initialize the client of the local OpenAI-compatible server if configured
+	if config.LocalBaseURL != "" {
+		factory.localClient = local.NewClient(config.LocalBaseURL, config.LocalAPIKey)
+		logger.Infof("Local model client initialized for %s", config.LocalBaseURL)
+	}
+
+	// Fallback chains are keyed by their first model, named along with its provider
+	factory.fallbacks = &interfaces.FallbackPolicy{Chains: make(map[string][]string), On: config.FallbackOn}
+	for _, chain := range config.FallbackChains {
+		models := interfaces.ParseFallbackChain(chain)
+		if len(models) < 2 {
+			continue
+		}
+		for i := range models {
+			models[i] = qualifiedModelName(models[i])
+		}
+		factory.fallbacks.Chains[models[0]] = models
+		logger.Infof("LLM fallback chain configured: %s", strings.Join(models, " -> "))
+	}
+
 	return factory, nil
 }
 
-// GetClient returns the appropriate LLM client for the given model
+// GetClient returns the appropriate LLM client for the given model. Models with a fallback
+// chain, and chains given as models separated by "->", get a client calling the models of the
+// chain in turn until one of them answers.
 func (f *Factory) GetClient(modelName string) (interfaces.LLMClient, error) {
-	// Determine provider from model name
-	provider := ""
-	if strings.Contains(modelName, ":") {
-		parts := strings.SplitN(modelName, ":", 2)
-		provider = parts[0]
-		modelName = parts[1]
-	} else {
-		// Try to infer provider from model name
-		if strings.HasPrefix(modelName, "gpt-") {
-			provider = "openai"
-		} else if strings.HasPrefix(modelName, "gemini-") {
-			provider = "google"
-		} else if strings.HasPrefix(modelName, "sonnet-") {
-			provider = "sonnet"
-		}
+	chain := f.chain(modelName)
+	if len(chain) == 1 {
+		return f.providerClient(chain[0])
 	}
+	return &fallbackClient{factory: f, models: chain}, nil
+}
+
+// providerClient returns the client of the provider of a model
+func (f *Factory) providerClient(model interfaces.ModelInfo) (interfaces.LLMClient, error) {
+	provider, modelName := model.Provider, model.Name
 
 	// Return the appropriate client
 	switch provider {
 	case "openai":
 		if f.openaiClient == nil {
-			return nil, errors.New("openai client not initialized")
+			return nil, fmt.Errorf("openai client not initialized: %w", interfaces.ErrUnavailable)
 		}
 		if !openai.IsValidModel(modelName) {
 			return nil, fmt.Errorf("invalid OpenAI model: %s", modelName)
 		}
-		return f.openaiClient, nil
+		return f.wrap(provider, f.openaiClient), nil
 	case "google":
 		if f.geminiClient == nil {
-			return nil, errors.New("gemini client not initialized")
+			return nil, fmt.Errorf("gemini client not initialized: %w", interfaces.ErrUnavailable)
 		}
 		if !gemini.IsValidModel(modelName) {
 			return nil, fmt.Errorf("invalid Gemini model: %s", modelName)
 		}
-		return f.geminiClient, nil
+		return f.wrap(provider, f.geminiClient), nil
 	case "sonnet":
 		if f.sonnetClient == nil {
-			return nil, errors.New("sonnet client not initialized")
+			return nil, fmt.Errorf("sonnet client not initialized: %w", interfaces.ErrUnavailable)
 		}
 		if !sonnet.IsValidModel(modelName) {
 			return nil, fmt.Errorf("invalid Sonnet model: %s", modelName)
 		}
-		return f.sonnetClient, nil
+		return f.wrap(provider, f.sonnetClient), nil
+	case "anthropic":
+		if f.anthropicClient == nil {
+			return nil, fmt.Errorf("anthropic client not initialized: %w", interfaces.ErrUnavailable)
+		}
+		if !anthropic.IsValidModel(modelName) {
+			return nil, fmt.Errorf("invalid Anthropic model: %s", modelName)
+		}
+		return f.wrap(provider, f.anthropicClient), nil
 	case "litellm":
 		if f.litellmClient == nil {
-			return nil, errors.New("litellm client not initialized")
+			return nil, fmt.Errorf("litellm client not initialized: %w", interfaces.ErrUnavailable)
 		}
 		// LiteLLM proxy supports many models, so we don't validate the model name
-		return f.litellmClient, nil
+		return f.wrap(provider, f.litellmClient), nil
+	case "local":
+		if f.localClient == nil {
+			return nil, fmt.Errorf("local model client not initialized: %w", interfaces.ErrUnavailable)
+		}
+		// Local servers serve whatever models were pulled, so we don't validate the model name
+		return f.wrap(provider, f.localClient), nil
 	default:
 		return nil, fmt.Errorf("unsupported provider for model: %s", modelName)
 	}
 }
 
+// wrap guards the calls of the client of a provider, records their usage and caches their
+// responses
+func (f *Factory) wrap(provider string, client interfaces.LLMClient) interfaces.LLMClient {
+	wrapped := interfaces.LLMClient(resilience.NewClient(client, f.guards[provider]))
+	if f.recorder != nil {
+		wrapped = usage.NewClient(wrapped, provider, f.recorder)
+	}
+	if f.responses != nil {
+		wrapped = cache.NewClient(wrapped, provider, f.responses, f.recorder)
+	}
+	return wrapped
+}
+
+// chain returns the models a call to a model is made to in turn, the model itself if it has
+// no fallback chain
+func (f *Factory) chain(modelName string) []interfaces.ModelInfo {
+	names := f.fallbacks.Chain(qualifiedModelName(modelName))
+	chain := make([]interfaces.ModelInfo, len(names))
+	for i, name := range names {
+		chain[i] = resolveModel(name)
+	}
+	return chain
+}
+
+// FallbackPolicy returns the fallback policy of the models of a provider, for the clients
+// of the provider that are not created by the factory. Its chains are restricted to the
+// models of the provider, named without the provider.
+func (f *Factory) FallbackPolicy(provider string) *interfaces.FallbackPolicy {
+	policy := &interfaces.FallbackPolicy{Chains: make(map[string][]string), On: f.fallbacks.On}
+	for _, chain := range f.fallbacks.Chains {
+		var models []string
+		for _, name := range chain {
+			if model := resolveModel(name); model.Provider == provider {
+				models = append(models, model.Name)
+			}
+		}
+		if len(models) > 1 && resolveModel(chain[0]).Provider == provider {
+			policy.Chains[models[0]] = models
+		}
+	}
+	return policy
+}
+
+// resolveModel determines the provider of a model, from its name if it has none
+func resolveModel(modelName string) interfaces.ModelInfo {
+	if interfaces.IsValidModelWithProvider(modelName) {
+		return interfaces.SplitModelName(modelName)
+	}
+
+	// Try to infer provider from model name
+	provider := ""
+	if strings.HasPrefix(modelName, "gpt-") {
+		provider = "openai"
+	} else if strings.HasPrefix(modelName, "gemini-") {
+		provider = "google"
+	} else if strings.HasPrefix(modelName, "sonnet-") {
+		provider = "sonnet"
+	}
+	return interfaces.ModelInfo{Provider: provider, Name: modelName}
+}
+
+// qualifiedModelName names a model along with its provider, such as openai:gpt-4o, leaving
+// fallback chains as they are
+func qualifiedModelName(modelName string) string {
+	if interfaces.IsFallbackChain(modelName) {
+		return modelName
+	}
+	if model := resolveModel(modelName); model.Provider != "" {
+		return model.Provider + ":" + model.Name
+	}
+	return modelName
+}
+
+// ListModels lists the default models, along with the models served by the local server
+// if one is configured. Models the local server fails to list are logged and left out.
+func (f *Factory) ListModels(ctx context.Context) map[string]interfaces.Model {
+	models := interfaces.DefaultModels()
+	if f.localClient == nil {
+		return models
+	}
+
+	names, err := f.localClient.ListModels(ctx)
+	if err != nil {
+		logger.Warnf("Failed to list local models: %v", err)
+		return models
+	}
+	for _, name := range names {
+		models["local:"+name] = interfaces.Model{
+			Name:        name,
+			Provider:    "local",
+			MaxTokens:   4096,
+			Temperature: 0.7,
+			TopP:        1.0,
+		}
+	}
+	return models
+}
+
+// Guard returns the guard of the calls made to a provider, for other clients of the
+// provider to share its limits and circuit
+func (f *Factory) Guard(provider string) *resilience.Guard {
+	return f.guards[provider]
+}
+
+// SetUsageRecorder sets the recorder of the usage of the calls made by the clients of the
+// factory, attributed as the context of each call says
+func (f *Factory) SetUsageRecorder(recorder usage.Recorder) {
+	f.recorder = recorder
+}
+
+// SetCache sets the cache of the responses of the completions of the clients of the
+// factory, used as the context of each call says
+func (f *Factory) SetCache(responses *cache.Cache) {
+	f.responses = responses
+}
+
 // Close closes all clients
 func (f *Factory) Close() {
 	if f.geminiClient != nil {
@@ -124,10 +297,17 @@ func (f *Factory) Close() {
 
 // Config holds configuration for all LLM clients
 type Config struct {
-	OpenAIAPIKey   string
-	GeminiAPIKey   string
-	SonnetAPIKey   string
-	SonnetBaseURL  string
-	LiteLLMAPIKey  string
-	LiteLLMBaseURL string
+	OpenAIAPIKey     string
+	GeminiAPIKey     string
+	SonnetAPIKey     string
+	SonnetBaseURL    string
+	AnthropicAPIKey  string
+	AnthropicBaseURL string // The Anthropic API if empty
+	LiteLLMAPIKey    string
+	LiteLLMBaseURL   string
+	LocalBaseURL     string // OpenAI-compatible server of local models, such as Ollama; none if empty
+	LocalAPIKey      string
+	Resilience       *resilience.Config      // Retries, rate limits and circuit breaking; defaults if nil
+	FallbackChains   []string                // Models separated by "->", tried in turn
+	FallbackOn       []interfaces.ErrorClass // Errors moving to the next model; DefaultFallbackOn if empty
 }
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/llm/resilience"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListModelsDiscoversLocalModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"qwen2.5-coder:7b","object":"model"}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	factory, err := NewFactory(Config{LocalBaseURL: server.URL, Resilience: &resilience.Config{}})
+	require.NoError(t, err)
+
+	models := factory.ListModels(context.Background())
+	require.Contains(t, models, "local:qwen2.5-coder:7b")
+	assert.Equal(t, "local", models["local:qwen2.5-coder:7b"].Provider)
+	assert.Contains(t, models, "openai:gpt-4o")
+
+	// Local models are not validated, as the server serves whatever was pulled
+	_, err = factory.GetClient("local:anything-pulled-later")
+	assert.NoError(t, err)
+}
+
+func TestListModelsWithoutLocalServer(t *testing.T) {
+	factory, err := NewFactory(Config{Resilience: &resilience.Config{}})
+	require.NoError(t, err)
+
+	models := factory.ListModels(context.Background())
+	assert.Equal(t, DefaultModels(), models)
+
+	_, err = factory.GetClient("local:llama3.1:8b")
+	assert.Error(t, err)
+}
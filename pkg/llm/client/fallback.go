@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// fallbackClient is an LLM client calling the models of a fallback chain in turn, until one
+// of them answers or fails with an error that does not fall back. Its responses are named
+// after the model that answered, along with its provider.
+type fallbackClient struct {
+	factory *Factory
+	models  []interfaces.ModelInfo
+}
+
+// Completion implements the Completion method of the LLMClient interface
+func (c *fallbackClient) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	var resp *interfaces.CompletionResponse
+	err := c.try(nil, func(client interfaces.LLMClient, model interfaces.ModelInfo) error {
+		var err error
+		resp, err = client.Completion(ctx, modelRequest(req, model))
+		if err != nil {
+			return err
+		}
+		resp.ModelName = model.Provider + ":" + model.Name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StreamCompletion implements the StreamCompletion method of the LLMClient interface. A
+// stream only falls back if it failed before any of it was passed to the callback.
+func (c *fallbackClient) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	streamed := false
+	canFallBack := func() bool { return !streamed }
+	return c.try(canFallBack, func(client interfaces.LLMClient, model interfaces.ModelInfo) error {
+		return client.StreamCompletion(ctx, modelRequest(req, model), func(chunk string) error {
+			streamed = true
+			return callback(chunk)
+		})
+	})
+}
+
+// Embedding implements the Embedding method of the LLMClient interface. The models of the
+// chain are used rather than the one given.
+func (c *fallbackClient) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	var resp *interfaces.EmbeddingResponse
+	err := c.try(nil, func(client interfaces.LLMClient, model interfaces.ModelInfo) error {
+		var err error
+		resp, err = client.Embedding(ctx, text, model.Name)
+		if err != nil {
+			return err
+		}
+		resp.ModelName = model.Provider + ":" + model.Name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// try makes a call to the models of the chain in turn, while it fails with errors that fall
+// back and canFallBack, if given, allows it
+func (c *fallbackClient) try(canFallBack func() bool, call func(client interfaces.LLMClient, model interfaces.ModelInfo) error) error {
+	var err error
+	for i, model := range c.models {
+		var client interfaces.LLMClient
+		client, err = c.factory.providerClient(model)
+		if err == nil {
+			if err = call(client, model); err == nil {
+				if i > 0 {
+					logger.Infof("%s:%s answered in place of %s:%s",
+						model.Provider, model.Name, c.models[0].Provider, c.models[0].Name)
+				}
+				return nil
+			}
+		}
+
+		if i == len(c.models)-1 || !c.factory.fallbacks.FallsBack(err) || (canFallBack != nil && !canFallBack()) {
+			return err
+		}
+		next := c.models[i+1]
+		logger.Warnf("Falling back from %s:%s to %s:%s after %s error: %v",
+			model.Provider, model.Name, next.Provider, next.Name, interfaces.ClassifyError(err), err)
+	}
+	return err
+}
+
+// modelRequest makes a request to another model of the chain, with the settings of the model
+// if it is a known one
+func modelRequest(req interfaces.CompletionRequest, model interfaces.ModelInfo) interfaces.CompletionRequest {
+	if defaults, ok := interfaces.DefaultModels()[model.Provider+":"+model.Name]; ok {
+		req.Model = defaults
+		return req
+	}
+	req.Model.Name = model.Name
+	req.Model.Provider = model.Provider
+	return req
+}
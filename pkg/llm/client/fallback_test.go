@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/resilience"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init(logrus.ErrorLevel, "")
+}
+
+// fakeProxy serves chat completions for the models it is given, failing the others with the
+// status and message of their failures, and records the models asked for
+type fakeProxy struct {
+	failures map[string]int
+	messages map[string]string
+	models   []string
+}
+
+func (f *fakeProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	f.models = append(f.models, req.Model)
+
+	if code, ok := f.failures[req.Model]; ok {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"error": {"message": %q}}`, f.messages[req.Model])
+		return
+	}
+	fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": "answered by %s"}, "finish_reason": "stop"}]}`, req.Model)
+}
+
+func newTestFactory(t *testing.T, proxy *fakeProxy, chains []string, on ...interfaces.ErrorClass) *Factory {
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+
+	factory, err := NewFactory(Config{
+		LiteLLMBaseURL: server.URL,
+		Resilience:     &resilience.Config{},
+		FallbackChains: chains,
+		FallbackOn:     on,
+	})
+	require.NoError(t, err)
+	return factory
+}
+
+func complete(t *testing.T, factory *Factory, model string) (*interfaces.CompletionResponse, error) {
+	client, err := factory.GetClient(model)
+	require.NoError(t, err)
+	return client.Completion(context.Background(), interfaces.CompletionRequest{
+		Messages: []interfaces.Message{{Role: "user", Content: "hello"}},
+	})
+}
+
+func TestFallbackChainAnswersWithNextModel(t *testing.T) {
+	proxy := &fakeProxy{
+		failures: map[string]int{"claude-3-7-sonnet": http.StatusServiceUnavailable},
+		messages: map[string]string{"claude-3-7-sonnet": "overloaded"},
+	}
+	factory := newTestFactory(t, proxy, []string{"litellm:claude-3-7-sonnet -> litellm:gpt-4o"})
+
+	resp, err := complete(t, factory, "litellm:claude-3-7-sonnet")
+	require.NoError(t, err)
+	assert.Equal(t, "answered by gpt-4o", resp.Text)
+	assert.Equal(t, "litellm:gpt-4o", resp.ModelName)
+	assert.Equal(t, []string{"claude-3-7-sonnet", "gpt-4o"}, proxy.models)
+}
+
+func TestFallbackChainAsModelName(t *testing.T) {
+	proxy := &fakeProxy{
+		failures: map[string]int{"small": http.StatusBadRequest},
+		messages: map[string]string{"small": "This model's maximum context length is 8192 tokens"},
+	}
+	factory := newTestFactory(t, proxy, nil)
+
+	resp, err := complete(t, factory, "litellm:small -> litellm:large")
+	require.NoError(t, err)
+	assert.Equal(t, "litellm:large", resp.ModelName)
+}
+
+func TestFallbackChainStopsOnErrorsThatDoNotFallBack(t *testing.T) {
+	proxy := &fakeProxy{
+		failures: map[string]int{"strict": http.StatusBadRequest},
+		messages: map[string]string{"strict": "The response was filtered due to the content policy"},
+	}
+	factory := newTestFactory(t, proxy, []string{"litellm:strict -> litellm:lenient"})
+
+	_, err := complete(t, factory, "litellm:strict")
+	require.Error(t, err)
+	assert.Equal(t, interfaces.ErrorClassContentPolicy, interfaces.ClassifyError(err))
+	assert.Equal(t, []string{"strict"}, proxy.models)
+
+	// Unless content policy refusals are configured to fall back
+	factory = newTestFactory(t, proxy, []string{"litellm:strict -> litellm:lenient"}, interfaces.ErrorClassContentPolicy)
+	resp, err := complete(t, factory, "litellm:strict")
+	require.NoError(t, err)
+	assert.Equal(t, "litellm:lenient", resp.ModelName)
+}
+
+func TestFallbackChainSkipsUnconfiguredProviders(t *testing.T) {
+	proxy := &fakeProxy{}
+	factory := newTestFactory(t, proxy, []string{"openai:gpt-4o -> litellm:gpt-4o"})
+
+	// gpt-4o is inferred to be an OpenAI model, whose client is not configured
+	resp, err := complete(t, factory, "gpt-4o")
+	require.NoError(t, err)
+	assert.Equal(t, "litellm:gpt-4o", resp.ModelName)
+}
+
+func TestFallbackPolicyOfProvider(t *testing.T) {
+	factory := newTestFactory(t, &fakeProxy{}, []string{
+		"litellm:claude-3-7-sonnet -> openai:gpt-4o -> litellm:gpt-4o",
+		"openai:gpt-4o -> litellm:gpt-4o",
+	})
+
+	policy := factory.FallbackPolicy("litellm")
+	assert.Equal(t, map[string][]string{"claude-3-7-sonnet": {"claude-3-7-sonnet", "gpt-4o"}}, policy.Chains)
+	assert.Equal(t, []string{"gpt-4"}, policy.Chain("gpt-4"))
+}
+
+func TestClassifyError(t *testing.T) {
+	apiErr := func(code int, message string) error {
+		return &interfaces.APIError{Provider: "litellm", StatusCode: code, Body: message}
+	}
+
+	assert.Equal(t, interfaces.ErrorClassAvailability, interfaces.ClassifyError(apiErr(http.StatusTooManyRequests, "slow down")))
+	assert.Equal(t, interfaces.ErrorClassAvailability, interfaces.ClassifyError(apiErr(http.StatusNotFound, "no such model")))
+	assert.Equal(t, interfaces.ErrorClassAvailability, interfaces.ClassifyError(resilience.ErrCircuitOpen))
+	assert.Equal(t, interfaces.ErrorClassContextLength, interfaces.ClassifyError(apiErr(http.StatusBadRequest, "prompt is too long")))
+	assert.Equal(t, interfaces.ErrorClassContentPolicy, interfaces.ClassifyError(apiErr(http.StatusBadRequest, "flagged by moderation")))
+	assert.Equal(t, interfaces.ErrorClassOther, interfaces.ClassifyError(apiErr(http.StatusBadRequest, "invalid temperature")))
+	assert.Equal(t, interfaces.ErrorClassOther, interfaces.ClassifyError(fmt.Errorf("call: %w", context.Canceled)))
+	assert.Equal(t, interfaces.ErrorClassOther, interfaces.ClassifyError(errors.New("unexpected")))
+}
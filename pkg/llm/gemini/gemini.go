@@ -85,7 +85,7 @@ func (c *Client) Completion(ctx context.Context, req interfaces.CompletionReques
 	resp, err := model.GenerateContent(ctx, parts...)
 	if err != nil {
 		logger.Errorf("Gemini completion error: %v", err)
-		return nil, err
+		return nil, apiError(err)
 	}
 
 	// Check if we have a response
@@ -181,7 +181,7 @@ func (c *Client) StreamCompletion(ctx context.Context, req interfaces.Completion
 				break
 			}
 			logger.Errorf("Error streaming from Gemini: %v", err)
-			return err
+			return apiError(err)
 		}
 
 		// Check if we have content
@@ -233,3 +233,13 @@ func (c *Client) Close() {
 		c.genaiClient.Close()
 	}
 }
+
+// apiError converts the errors of the Gemini API that carry an HTTP status to
+// interfaces.APIError, for their status to be known to callers
+func apiError(err error) error {
+	var httpErr interface{ HTTPCode() int }
+	if errors.As(err, &httpErr) && httpErr.HTTPCode() > 0 {
+		return &interfaces.APIError{Provider: "google", StatusCode: httpErr.HTTPCode(), Body: err.Error()}
+	}
+	return err
+}
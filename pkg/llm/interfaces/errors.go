@@ -0,0 +1,148 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnavailable is the error of a call to a provider that is not configured or known to be
+// unhealthy, which the errors of such calls wrap
+var ErrUnavailable = errors.New("provider unavailable")
+
+// APIError is an error response of the API of an LLM provider
+type APIError struct {
+	// Provider is the provider that returned the error (e.g., "openai", "litellm")
+	Provider string
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Body is the body of the response, which usually describes the error
+	Body string
+	// RetryAfter is how long the provider asked to wait before retrying, zero if it did not
+	RetryAfter time.Duration
+}
+
+// NewAPIError creates an APIError from a response, reading its body
+func NewAPIError(provider string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+	return &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// Error describes the error along with the status of the response
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Temporary checks whether the request may succeed when retried, which is the case when
+// the provider is rate limiting requests or failed to handle it
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= 500
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, either a number of seconds or
+// an HTTP date, returning zero if there is no valid value
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// ErrorClass is the kind of a failure of a call to a provider, which decides whether the call
+// may succeed with another model
+type ErrorClass string
+
+const (
+	// ErrorClassAvailability is a failure of the provider to serve the model: it is down,
+	// unreachable, rate limiting, not configured or does not know the model
+	ErrorClassAvailability ErrorClass = "availability"
+	// ErrorClassContentPolicy is a refusal of the prompt or response by the content policy of
+	// the provider
+	ErrorClassContentPolicy ErrorClass = "content_policy"
+	// ErrorClassContextLength is a prompt too long for the context window of the model
+	ErrorClassContextLength ErrorClass = "context_length"
+	// ErrorClassOther is any other failure, such as an invalid request or a cancelled call
+	ErrorClassOther ErrorClass = "other"
+)
+
+// contentPolicyMarkers and contextLengthMarkers are found in the messages of the errors of
+// each class, whatever the provider
+var (
+	contentPolicyMarkers = []string{
+		"content_policy", "content policy", "content_filter", "content filter", "safety",
+		"moderation", "flagged", "blocked",
+	}
+	contextLengthMarkers = []string{
+		"context_length", "context length", "context window", "maximum context", "too many tokens",
+		"prompt is too long", "input is too long", "max_tokens_exceeded", "token limit",
+	}
+)
+
+// ClassifyError classifies the error of a call to a provider
+func ClassifyError(err error) ErrorClass {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassOther
+	}
+
+	var apiErr *APIError
+	isAPIErr := errors.As(err, &apiErr)
+	if errors.Is(err, ErrUnavailable) || (isAPIErr && apiErr.Temporary()) {
+		return ErrorClassAvailability
+	}
+
+	message := strings.ToLower(err.Error())
+	if containsAny(message, contextLengthMarkers) {
+		return ErrorClassContextLength
+	}
+	if containsAny(message, contentPolicyMarkers) {
+		return ErrorClassContentPolicy
+	}
+
+	if isAPIErr {
+		switch apiErr.StatusCode {
+		case http.StatusRequestEntityTooLarge:
+			return ErrorClassContextLength
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return ErrorClassAvailability
+		}
+		return ErrorClassOther
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorClassAvailability
+	}
+	return ErrorClassOther
+}
+
+// containsAny checks whether a message contains any of the markers
+func containsAny(message string, markers []string) bool {
+	for _, marker := range markers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package interfaces
+
+import "strings"
+
+// DefaultFallbackOn are the classes of the errors that move a call to the next model of its
+// chain when none are configured. Another model may be available or have a larger context
+// window, but is not asked to answer what a content policy refused.
+var DefaultFallbackOn = []ErrorClass{ErrorClassAvailability, ErrorClassContextLength}
+
+// FallbackPolicy decides which models a call is made to, in turn, when it fails
+type FallbackPolicy struct {
+	// Chains are the models tried in turn, keyed by the first of them
+	Chains map[string][]string
+	// On are the classes of the errors that move a call to the next model of its chain
+	On []ErrorClass
+}
+
+// ParseFallbackChain parses a chain of models separated by "->", such as
+// "litellm:claude-3-7-sonnet -> openai:gpt-4o -> google:gemini-pro"
+func ParseFallbackChain(chain string) []string {
+	var models []string
+	for _, model := range strings.Split(chain, "->") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// IsFallbackChain checks whether a model name is a chain of models
+func IsFallbackChain(modelName string) bool {
+	return strings.Contains(modelName, "->")
+}
+
+// Chain returns the models a call to a model is made to in turn, only the model itself if
+// it has no chain. Model names that are chains are parsed.
+func (p *FallbackPolicy) Chain(model string) []string {
+	if IsFallbackChain(model) {
+		return ParseFallbackChain(model)
+	}
+	if p != nil {
+		if chain, ok := p.Chains[model]; ok {
+			return chain
+		}
+	}
+	return []string{model}
+}
+
+// FallsBack checks whether a failed call moves to the next model of its chain
+func (p *FallbackPolicy) FallsBack(err error) bool {
+	on := DefaultFallbackOn
+	if p != nil && len(p.On) > 0 {
+		on = p.On
+	}
+	class := ClassifyError(err)
+	for _, c := range on {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
 )
 
@@ -21,10 +22,34 @@ type Model struct {
 
 // Message represents a message in a conversation
 type Message struct {
-	// Role is the sender of the message (system, user, assistant)
+	// Role is the sender of the message (system, user, assistant, tool)
 	Role string
-	// Content is the text content of the message
+	// Content is the text content of the message, or the result of a tool call
 	Content string
+	// ToolCalls are the tools called by an assistant message
+	ToolCalls []ToolCall
+	// ToolCallID is the ID of the call a tool message is the result of
+	ToolCallID string
+}
+
+// Tool is a function a model may call to answer a request
+type Tool struct {
+	// Name is the name the model calls the tool by
+	Name string
+	// Description tells the model what the tool does and when to call it
+	Description string
+	// InputSchema is the JSON schema of the input of the tool
+	InputSchema json.RawMessage
+}
+
+// ToolCall is a call of a tool by a model
+type ToolCall struct {
+	// ID identifies the call, for its result to refer to it
+	ID string
+	// Name is the name of the tool called
+	Name string
+	// Input is the JSON input of the call, conforming to the input schema of the tool
+	Input json.RawMessage
 }
 
 // CompletionRequest represents a request for a text completion
@@ -41,14 +66,19 @@ type CompletionRequest struct {
 	TopP *float32
 	// Stream indicates whether to stream the response
 	Stream bool
+	// Tools are the tools the model may call, for providers supporting tool use
+	Tools []Tool
 }
 
 // CompletionResponse represents a response from a completion request
 type CompletionResponse struct {
 	// Text is the generated text
 	Text string
-	// FinishReason describes why the generation stopped
+	// FinishReason describes why the generation stopped: "stop", "length", "tool_calls" or
+	// "content_filter", or as the provider named it
 	FinishReason string
+	// ToolCalls are the tools the model called, for the caller to run and answer
+	ToolCalls []ToolCall
 	// TokenUsage contains token usage information
 	TokenUsage *TokenUsage
 	// ModelName is the name of the model that generated the response
@@ -125,6 +155,20 @@ func DefaultModels() map[string]Model {
 			Temperature: 0.7,
 			TopP:        1.0,
 		},
+		"anthropic:claude-3-7-sonnet-20250219": {
+			Name:        "claude-3-7-sonnet-20250219",
+			Provider:    "anthropic",
+			MaxTokens:   8192,
+			Temperature: 0.7,
+			TopP:        1.0,
+		},
+		"anthropic:claude-3-5-haiku-20241022": {
+			Name:        "claude-3-5-haiku-20241022",
+			Provider:    "anthropic",
+			MaxTokens:   8192,
+			Temperature: 0.7,
+			TopP:        1.0,
+		},
 		"litellm:claude-3-opus-20240229": {
 			Name:        "claude-3-opus-20240229",
 			Provider:    "litellm",
@@ -154,6 +198,7 @@ const (
 	RoleSystem    = "system"
 	RoleUser      = "user"
 	RoleAssistant = "assistant"
+	RoleTool      = "tool"
 )
 
 // ModelInfo contains provider and name information
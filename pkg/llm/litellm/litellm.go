@@ -6,7 +6,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -167,9 +166,9 @@ func (c *Client) Completion(ctx context.Context, req interfaces.CompletionReques
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Errorf("LiteLLM API error (status %d): %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("LiteLLM API error (status %d): %s", resp.StatusCode, string(body))
+		apiErr := interfaces.NewAPIError("litellm", resp)
+		logger.Errorf("LiteLLM API error (status %d): %s", apiErr.StatusCode, apiErr.Body)
+		return nil, apiErr
 	}
 
 	// Parse response
@@ -185,6 +184,11 @@ func (c *Client) Completion(ctx context.Context, req interfaces.CompletionReques
 		return nil, errors.New("no completion choices returned")
 	}
 
+	// Report the model that served the request, which may be a dated version of the one requested
+	if completionResp.Model != "" {
+		model = completionResp.Model
+	}
+
 	// Return the response
 	return &interfaces.CompletionResponse{
 		Text:         completionResp.Choices[0].Message.Content,
@@ -271,9 +275,9 @@ func (c *Client) StreamCompletion(ctx context.Context, req interfaces.Completion
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Errorf("LiteLLM API stream error (status %d): %s", resp.StatusCode, string(body))
-		return fmt.Errorf("LiteLLM API stream error (status %d): %s", resp.StatusCode, string(body))
+		apiErr := interfaces.NewAPIError("litellm", resp)
+		logger.Errorf("LiteLLM API stream error (status %d): %s", apiErr.StatusCode, apiErr.Body)
+		return apiErr
 	}
 
 	// Read the response line by line
@@ -382,9 +386,9 @@ func (c *Client) Embedding(ctx context.Context, text string, modelName string) (
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Errorf("LiteLLM API embedding error (status %d): %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("LiteLLM API embedding error (status %d): %s", resp.StatusCode, string(body))
+		apiErr := interfaces.NewAPIError("litellm", resp)
+		logger.Errorf("LiteLLM API embedding error (status %d): %s", apiErr.StatusCode, apiErr.Body)
+		return nil, apiErr
 	}
 
 	// Parse response
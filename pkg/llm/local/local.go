@@ -0,0 +1,206 @@
+// Package local implements the LLMClient interface for models served locally through an
+// OpenAI-compatible API, such as Ollama, vLLM or the llama.cpp server, so that source code
+// need not leave the machines of a team.
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultBaseURL is the URL Ollama serves its OpenAI-compatible API at by default
+	DefaultBaseURL = "http://localhost:11434"
+	// DefaultEmbeddingModel is the model embeddings are generated with when none is given
+	DefaultEmbeddingModel = "nomic-embed-text"
+)
+
+// Client is an implementation of the LLMClient interface for an OpenAI-compatible server
+type Client struct {
+	openaiClient *openai.Client
+}
+
+// NewClient creates a new client of the OpenAI-compatible server at a base URL, with or
+// without its /v1 path. The API key is only sent if set, as local servers rarely need one.
+func NewClient(baseURL, apiKey string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/v1") {
+		baseURL += "/v1"
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	return &Client{
+		openaiClient: openai.NewClientWithConfig(config),
+	}
+}
+
+// Completion implements the Completion method of the LLMClient interface
+func (c *Client) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	// Send the request to the server
+	resp, err := c.openaiClient.CreateChatCompletion(ctx, newChatRequest(req, false))
+	if err != nil {
+		logger.Errorf("Local model completion error: %v", err)
+		return nil, apiError(err)
+	}
+
+	// Check if we have any choices
+	if len(resp.Choices) == 0 {
+		logger.Error("Local model returned no choices")
+		return nil, errors.New("no completion choices returned")
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = req.Model.Name
+	}
+
+	// Return the response
+	return &interfaces.CompletionResponse{
+		Text:         resp.Choices[0].Message.Content,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		TokenUsage: &interfaces.TokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+		ModelName: model,
+	}, nil
+}
+
+// StreamCompletion implements the StreamCompletion method of the LLMClient interface
+func (c *Client) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	stream, err := c.openaiClient.CreateChatCompletionStream(ctx, newChatRequest(req, true))
+	if err != nil {
+		logger.Errorf("Local model stream completion error: %v", err)
+		return apiError(err)
+	}
+	defer stream.Close()
+
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			logger.Errorf("Error receiving from local model stream: %v", err)
+			return apiError(err)
+		}
+
+		if len(response.Choices) > 0 {
+			content := response.Choices[0].Delta.Content
+			if content != "" {
+				if err := callback(content); err != nil {
+					logger.Errorf("Error in stream callback: %v", err)
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Embedding implements the Embedding method of the LLMClient interface
+func (c *Client) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	if modelName == "" {
+		modelName = DefaultEmbeddingModel
+	}
+
+	// Get the embedding from the server
+	resp, err := c.openaiClient.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: []string{text},
+		Model: openai.EmbeddingModel(modelName),
+	})
+	if err != nil {
+		logger.Errorf("Local model embedding error: %v", err)
+		return nil, apiError(err)
+	}
+
+	// Check if we have any data
+	if len(resp.Data) == 0 {
+		logger.Error("Local model returned no embedding data")
+		return nil, errors.New("no embedding data returned")
+	}
+
+	return &interfaces.EmbeddingResponse{
+		Embedding: resp.Data[0].Embedding,
+		TokenUsage: &interfaces.TokenUsage{
+			PromptTokens: resp.Usage.PromptTokens,
+			TotalTokens:  resp.Usage.TotalTokens,
+		},
+		ModelName: modelName,
+	}, nil
+}
+
+// ListModels lists the models the server serves, by name
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	list, err := c.openaiClient.ListModels(ctx)
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	names := make([]string, len(list.Models))
+	for i, model := range list.Models {
+		names[i] = model.ID
+	}
+	return names, nil
+}
+
+// newChatRequest converts a completion request to a chat completion request
+func newChatRequest(req interfaces.CompletionRequest, stream bool) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+	}
+
+	maxTokens := req.Model.MaxTokens
+	if req.MaxTokens > 0 {
+		maxTokens = req.MaxTokens
+	}
+
+	temperature := req.Model.Temperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	topP := req.Model.TopP
+	if req.TopP != nil {
+		topP = *req.TopP
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:       req.Model.Name,
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+		TopP:        topP,
+		Stream:      stream,
+	}
+}
+
+// apiError converts the error responses of the server to interfaces.APIError, for their
+// status to be known to callers
+func apiError(err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode > 0 {
+		return &interfaces.APIError{Provider: "local", StatusCode: apiErr.HTTPStatusCode, Body: apiErr.Message}
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) && reqErr.HTTPStatusCode > 0 {
+		return &interfaces.APIError{Provider: "local", StatusCode: reqErr.HTTPStatusCode, Body: string(reqErr.Body)}
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init(logrus.ErrorLevel, "")
+}
+
+// newTestServer serves the OpenAI-compatible API of Ollama, keeping the last chat request it got
+func newTestServer(t *testing.T, request *map[string]interface{}) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(request)
+		if stream, _ := (*request)["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{"Hel", "lo"} {
+				fmt.Fprintf(w, "data: {\"model\":\"llama3.1:8b\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"llama3.1:8b","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],`+
+			`"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+	})
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(request)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":3,"total_tokens":3}}`)
+	})
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"llama3.1:8b","object":"model"},{"id":"nomic-embed-text","object":"model"}]}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func request() interfaces.CompletionRequest {
+	return interfaces.CompletionRequest{
+		Model:    interfaces.Model{Name: "llama3.1:8b", Provider: "local", MaxTokens: 4096, Temperature: 0.7, TopP: 1.0},
+		Messages: []interfaces.Message{{Role: interfaces.RoleUser, Content: "Hi"}},
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	var got map[string]interface{}
+	client := NewClient(newTestServer(t, &got).URL, "")
+
+	resp, err := client.Completion(context.Background(), request())
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello", resp.Text)
+	assert.Equal(t, "stop", resp.FinishReason)
+	assert.Equal(t, "llama3.1:8b", resp.ModelName)
+	assert.Equal(t, &interfaces.TokenUsage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}, resp.TokenUsage)
+	assert.Equal(t, "llama3.1:8b", got["model"])
+}
+
+func TestStreamCompletion(t *testing.T) {
+	var got map[string]interface{}
+	client := NewClient(newTestServer(t, &got).URL+"/v1/", "")
+
+	var chunks []string
+	err := client.StreamCompletion(context.Background(), request(), func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hel", "lo"}, chunks)
+}
+
+func TestEmbedding(t *testing.T) {
+	var got map[string]interface{}
+	client := NewClient(newTestServer(t, &got).URL, "")
+
+	resp, err := client.Embedding(context.Background(), "func main() {}", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, []float32{0.1, 0.2}, resp.Embedding)
+	assert.Equal(t, DefaultEmbeddingModel, resp.ModelName)
+	assert.Equal(t, DefaultEmbeddingModel, got["model"])
+}
+
+func TestListModels(t *testing.T) {
+	var got map[string]interface{}
+	client := NewClient(newTestServer(t, &got).URL, "")
+
+	models, err := client.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama3.1:8b", "nomic-embed-text"}, models)
+}
+
+func TestErrorsAreAPIErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"message":"model \"llama9\" not found, try pulling it first","type":"api_error"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := NewClient(server.URL, "").Completion(context.Background(), request())
+
+	var apiErr *interfaces.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "local", apiErr.Provider)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
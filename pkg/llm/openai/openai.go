@@ -63,7 +63,7 @@ func (c *Client) Completion(ctx context.Context, req interfaces.CompletionReques
 	resp, err := c.openaiClient.CreateChatCompletion(ctx, completionReq)
 	if err != nil {
 		logger.Errorf("OpenAI completion error: %v", err)
-		return nil, err
+		return nil, apiError(err)
 	}
 
 	// Check if we have any choices
@@ -72,6 +72,11 @@ func (c *Client) Completion(ctx context.Context, req interfaces.CompletionReques
 		return nil, errors.New("no completion choices returned")
 	}
 
+	// Report the model that served the request, which may be a dated version of the one requested
+	if resp.Model != "" {
+		model = resp.Model
+	}
+
 	// Return the response
 	return &interfaces.CompletionResponse{
 		Text:         resp.Choices[0].Message.Content,
@@ -125,7 +130,7 @@ func (c *Client) StreamCompletion(ctx context.Context, req interfaces.Completion
 	stream, err := c.openaiClient.CreateChatCompletionStream(ctx, completionReq)
 	if err != nil {
 		logger.Errorf("OpenAI stream completion error: %v", err)
-		return err
+		return apiError(err)
 	}
 	defer stream.Close()
 
@@ -137,7 +142,7 @@ func (c *Client) StreamCompletion(ctx context.Context, req interfaces.Completion
 		}
 		if err != nil {
 			logger.Errorf("Error receiving from OpenAI stream: %v", err)
-			return err
+			return apiError(err)
 		}
 
 		if len(response.Choices) > 0 {
@@ -170,7 +175,7 @@ func (c *Client) Embedding(ctx context.Context, text string, modelName string) (
 	resp, err := c.openaiClient.CreateEmbeddings(ctx, req)
 	if err != nil {
 		logger.Errorf("OpenAI embedding error: %v", err)
-		return nil, err
+		return nil, apiError(err)
 	}
 
 	// Check if we have any data
@@ -216,3 +221,17 @@ func IsValidModel(modelName string) bool {
 	}
 	return false
 }
+
+// apiError converts the error responses of the OpenAI API to interfaces.APIError, for their
+// status to be known to callers
+func apiError(err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode > 0 {
+		return &interfaces.APIError{Provider: "openai", StatusCode: apiErr.HTTPStatusCode, Body: apiErr.Message}
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) && reqErr.HTTPStatusCode > 0 {
+		return &interfaces.APIError{Provider: "openai", StatusCode: reqErr.HTTPStatusCode, Body: string(reqErr.Body)}
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package resilience
+
+import (
+	"context"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+)
+
+// Client is an LLM client whose calls are guarded
+type Client struct {
+	client interfaces.LLMClient
+	guard  *Guard
+}
+
+// NewClient wraps an LLM client, guarding its calls
+func NewClient(client interfaces.LLMClient, guard *Guard) *Client {
+	return &Client{
+		client: client,
+		guard:  guard,
+	}
+}
+
+// Completion implements the Completion method of the LLMClient interface
+func (c *Client) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	var resp *interfaces.CompletionResponse
+	err := c.guard.Do(ctx, req.Model.Name, EstimateTokens(req.Messages), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.client.Completion(ctx, req)
+		if err != nil {
+			return 0, err
+		}
+		if resp.TokenUsage != nil {
+			return resp.TokenUsage.TotalTokens, nil
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StreamCompletion implements the StreamCompletion method of the LLMClient interface. A
+// stream is only retried if it failed before any of it was passed to the callback.
+func (c *Client) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	return c.guard.Do(ctx, req.Model.Name, EstimateTokens(req.Messages), func(ctx context.Context) (int, error) {
+		streamed := false
+		err := c.client.StreamCompletion(ctx, req, func(chunk string) error {
+			streamed = true
+			return callback(chunk)
+		})
+		if err != nil && streamed {
+			return 0, Permanent(err)
+		}
+		return 0, err
+	})
+}
+
+// Embedding implements the Embedding method of the LLMClient interface
+func (c *Client) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	var resp *interfaces.EmbeddingResponse
+	err := c.guard.Do(ctx, modelName, len(text)/4, func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.client.Embedding(ctx, text, modelName)
+		if err != nil {
+			return 0, err
+		}
+		if resp.TokenUsage != nil {
+			return resp.TokenUsage.TotalTokens, nil
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// EstimateTokens roughly estimates the tokens of a prompt, at four characters per token
+func EstimateTokens(messages []interfaces.Message) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
+	}
+	return chars / 4
+}
@@ -0,0 +1,330 @@
+// Package resilience guards the calls made to LLM providers. Calls failing temporarily are
+// retried with jittered exponential backoff, honouring the Retry-After of the provider, the
+// requests and tokens sent to each model are rate limited, and calls to a provider failing
+// repeatedly fail fast until it recovers.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/logger"
+)
+
+// ErrCircuitOpen is the error of the calls to a provider rejected while it is unhealthy
+var ErrCircuitOpen = fmt.Errorf("circuit open: %w", interfaces.ErrUnavailable)
+
+// Limits are the rates at which requests may be sent to a model, unlimited if 0
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// Config holds the configuration of the guard of a provider
+type Config struct {
+	MaxRetries int           // Retries of a failed call after its first attempt
+	BaseDelay  time.Duration // Delay before the first retry, doubled for each further one
+	MaxDelay   time.Duration // Longest delay between retries, unless the provider asks for longer
+
+	Limits      Limits            // Limits of each model of the provider
+	ModelLimits map[string]Limits // Limits of the models whose limits differ
+
+	BreakerThreshold int           // Consecutive failures opening the circuit, never opened if 0
+	BreakerCooldown  time.Duration // How long the circuit stays open before a call is let through
+}
+
+// DefaultConfig returns the configuration used when none is given, which retries calls and
+// breaks the circuit but does not limit rates
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:       3,
+		BaseDelay:        500 * time.Millisecond,
+		MaxDelay:         30 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// Guard guards the calls made to a provider. It is safe for concurrent use, and meant to be
+// shared by all the clients of the provider for its limits to hold.
+type Guard struct {
+	provider string
+	config   Config
+	breaker  *breaker
+
+	mu       sync.Mutex
+	limiters map[string]*limiter // By model
+
+	// Replaced in tests
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+// NewGuard creates a guard for the calls made to a provider
+func NewGuard(provider string, config Config) *Guard {
+	g := &Guard{
+		provider: provider,
+		config:   config,
+		limiters: make(map[string]*limiter),
+		now:      time.Now,
+		sleep:    sleep,
+		jitter:   fullJitter,
+	}
+	g.breaker = &breaker{
+		provider:  provider,
+		threshold: config.BreakerThreshold,
+		cooldown:  config.BreakerCooldown,
+		now:       func() time.Time { return g.now() },
+	}
+	return g
+}
+
+// Provider returns the provider the guard is for
+func (g *Guard) Provider() string {
+	return g.provider
+}
+
+// Do calls a model, waiting for the limits of the model to allow it and retrying it while
+// it fails temporarily. The tokens the call is expected to use are reserved before each
+// attempt, and replaced with those the call returns it used, if it knows.
+func (g *Guard) Do(ctx context.Context, model string, tokens int, call func(ctx context.Context) (int, error)) error {
+	limiter := g.limiter(model)
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		reserved, err := limiter.wait(ctx, tokens, g.now, g.sleep)
+		if err != nil {
+			return err
+		}
+		if err := g.breaker.allow(); err != nil {
+			limiter.refund(reserved)
+			if lastErr != nil {
+				return lastErr
+			}
+			return err
+		}
+
+		used, err := call(ctx)
+		g.breaker.record(err)
+		if err == nil {
+			limiter.settle(reserved, used)
+			return nil
+		}
+		limiter.refund(reserved)
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		retry, retryAfter := temporary(err)
+		if !retry || ctx.Err() != nil || attempt >= g.config.MaxRetries {
+			return err
+		}
+		lastErr = err
+
+		delay := g.backoff(attempt, retryAfter)
+		logger.Warnf("Retrying %s call to %s in %s (retry %d of %d): %v",
+			g.provider, model, delay, attempt+1, g.config.MaxRetries, err)
+		if err := g.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// limiter gets the limiter of a model, creating it on first use
+func (g *Guard) limiter(model string) *limiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	l, ok := g.limiters[model]
+	if !ok {
+		limits, ok := g.config.ModelLimits[model]
+		if !ok {
+			limits = g.config.Limits
+		}
+		now := g.now()
+		l = &limiter{
+			requests: newBucket(limits.RequestsPerMinute, now),
+			tokens:   newBucket(limits.TokensPerMinute, now),
+		}
+		g.limiters[model] = l
+	}
+	return l
+}
+
+// backoff gets how long to wait before a retry: the time the provider asked for, if it did,
+// or else a random time up to the exponential backoff of the attempt
+func (g *Guard) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	delay := g.config.BaseDelay << attempt
+	if delay <= 0 || (g.config.MaxDelay > 0 && delay > g.config.MaxDelay) {
+		delay = g.config.MaxDelay
+	}
+	return g.jitter(delay)
+}
+
+// permanentError is an error of a call that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error of a call as one that must not be retried, whatever it is
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// temporary checks whether a failed call may succeed when retried, and how long the
+// provider asked to wait before retrying it
+func temporary(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+	var apiErr *interfaces.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary(), apiErr.RetryAfter
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// unhealthy checks whether a failed call shows the provider is unhealthy, rather than
+// rejecting the call or limiting its rate
+func unhealthy(err error) bool {
+	var apiErr *interfaces.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	retry, _ := temporary(err)
+	return retry
+}
+
+// fullJitter picks a random delay up to d
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// sleep waits for a while, or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// breakerState is the state of the circuit of a provider
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // Calls are made
+	breakerOpen                         // Calls fail fast
+	breakerHalfOpen                     // A call is made to find whether the provider recovered
+)
+
+// breaker is the circuit breaker of a provider. The circuit opens after a number of
+// consecutive failures, and a call is let through once it has been open for the cooldown;
+// the circuit closes if the call succeeds and opens again if it fails.
+type breaker struct {
+	provider  string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool // Whether the call of a half-open circuit was let through
+}
+
+// allow checks whether a call may be made
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return fmt.Errorf("%s is unavailable: %w", b.provider, ErrCircuitOpen)
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+	case breakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%s is unavailable: %w", b.provider, ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record records the outcome of a call
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	var apiErr *interfaces.APIError
+	switch {
+	case err == nil || (errors.As(err, &apiErr) && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests):
+		// The provider handled the call, even if it rejected it
+		if b.state != breakerClosed {
+			logger.Infof("%s recovered, closing its circuit", b.provider)
+		}
+		b.state = breakerClosed
+		b.failures = 0
+	case unhealthy(err):
+		b.failures++
+		if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+			logger.Warnf("%s is unhealthy after %d consecutive failures, opening its circuit for %s: %v",
+				b.provider, b.failures, b.cooldown, err)
+			b.state = breakerOpen
+			b.openedAt = b.now()
+		}
+	default:
+		// Rate limited or cancelled calls do not show whether the provider is healthy, but a
+		// half-open circuit lets another call through
+	}
+}
@@ -0,0 +1,121 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket refilled at a rate per minute, holding at most a minute's worth
+type bucket struct {
+	capacity float64
+	rate     float64 // Per second
+	tokens   float64 // Below zero when more was used than reserved
+	last     time.Time
+}
+
+// newBucket creates a full bucket, or returns nil if the rate is unlimited
+func newBucket(perMinute int, now time.Time) *bucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &bucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     now,
+	}
+}
+
+// refill adds the tokens accrued since the bucket was last refilled
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+	}
+}
+
+// delay gets how long to wait for the bucket to hold n tokens
+func (b *bucket) delay(n float64) time.Duration {
+	if b == nil || b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// limiter limits the requests and tokens sent to a model
+type limiter struct {
+	mu       sync.Mutex
+	requests *bucket // Nil if unlimited
+	tokens   *bucket // Nil if unlimited
+}
+
+// wait waits for a request using some tokens to be allowed and takes them, returning the
+// tokens reserved. Requests using more tokens than the limit allows per minute reserve a
+// minute's worth, not to wait forever.
+func (l *limiter) wait(ctx context.Context, tokens int, now func() time.Time, sleep func(context.Context, time.Duration) error) (int, error) {
+	if l.tokens == nil || tokens < 0 {
+		tokens = 0
+	}
+	if l.tokens != nil && float64(tokens) > l.tokens.capacity {
+		tokens = int(l.tokens.capacity)
+	}
+
+	for {
+		l.mu.Lock()
+		t := now()
+		if l.requests != nil {
+			l.requests.refill(t)
+		}
+		if l.tokens != nil {
+			l.tokens.refill(t)
+		}
+		delay := l.requests.delay(1)
+		if d := l.tokens.delay(float64(tokens)); d > delay {
+			delay = d
+		}
+		if delay == 0 {
+			if l.requests != nil {
+				l.requests.tokens--
+			}
+			if l.tokens != nil {
+				l.tokens.tokens -= float64(tokens)
+			}
+			l.mu.Unlock()
+			return tokens, nil
+		}
+		l.mu.Unlock()
+
+		if err := sleep(ctx, delay); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// settle replaces the tokens reserved for a request with those it used, if known
+func (l *limiter) settle(reserved, used int) {
+	if used > 0 {
+		l.adjust(float64(reserved - used))
+	}
+}
+
+// refund returns the tokens reserved for a request that failed
+func (l *limiter) refund(reserved int) {
+	l.adjust(float64(reserved))
+}
+
+// adjust adds tokens to the token bucket, up to its capacity
+func (l *limiter) adjust(n float64) {
+	if l.tokens == nil || n == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.tokens += n
+	if l.tokens.tokens > l.tokens.capacity {
+		l.tokens.tokens = l.tokens.capacity
+	}
+}
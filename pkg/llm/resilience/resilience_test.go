@@ -0,0 +1,254 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/litellm"
+	"cred.com/hack25/backend/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init(logrus.ErrorLevel, "")
+}
+
+// fakeProvider serves chat completions with canned responses, counting the requests
+type fakeProvider struct {
+	responses []func(w http.ResponseWriter)
+	requests  int
+}
+
+func (f *fakeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	respond := f.responses[len(f.responses)-1]
+	if f.requests < len(f.responses) {
+		respond = f.responses[f.requests]
+	}
+	f.requests++
+	respond(w)
+}
+
+func completion(text string, tokens int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": %q}, "finish_reason": "stop"}],
+			"usage": {"total_tokens": %d}}`, text, tokens)
+	}
+}
+
+func status(code int, headers ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(code)
+		fmt.Fprint(w, `{"error": {"message": "try later"}}`)
+	}
+}
+
+// fakeClock is the clock of a guard, whose sleeps pass instantly
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+// newTestClient creates a guarded LiteLLM client of a fake provider, whose backoff is
+// not jittered
+func newTestClient(t *testing.T, provider *fakeProvider, config Config) (*Client, *fakeClock) {
+	server := httptest.NewServer(provider)
+	t.Cleanup(server.Close)
+
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	guard := NewGuard("litellm", config)
+	guard.now = func() time.Time { return clock.now }
+	guard.sleep = clock.sleep
+	guard.jitter = func(d time.Duration) time.Duration { return d }
+
+	return NewClient(litellm.NewClient("key", server.URL), guard), clock
+}
+
+func request(prompt string) interfaces.CompletionRequest {
+	return interfaces.CompletionRequest{
+		Model:    interfaces.Model{Name: "claude-3-7-sonnet", MaxTokens: 100},
+		Messages: []interfaces.Message{{Role: interfaces.RoleUser, Content: prompt}},
+	}
+}
+
+func TestRetriesTemporaryFailures(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){
+		status(http.StatusBadGateway),
+		status(http.StatusServiceUnavailable),
+		status(http.StatusTooManyRequests, "Retry-After", "7"),
+		completion("hello", 10),
+	}}
+	client, clock := newTestClient(t, provider, DefaultConfig())
+
+	resp, err := client.Completion(context.Background(), request("hi"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Text)
+	assert.Equal(t, 4, provider.requests)
+	// Exponential backoff, then the delay the provider asked for
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second, 7 * time.Second}, clock.sleeps)
+}
+
+func TestDoesNotRetryRejectedRequests(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){status(http.StatusBadRequest)}}
+	client, _ := newTestClient(t, provider, DefaultConfig())
+
+	_, err := client.Completion(context.Background(), request("hi"))
+	var apiErr *interfaces.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, 1, provider.requests)
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError)}}
+	config := DefaultConfig()
+	config.MaxRetries = 2
+	config.MaxDelay = 700 * time.Millisecond
+	client, clock := newTestClient(t, provider, config)
+
+	_, err := client.Completion(context.Background(), request("hi"))
+	require.Error(t, err)
+	assert.Equal(t, 3, provider.requests)
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 700 * time.Millisecond}, clock.sleeps)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){
+		status(http.StatusBadGateway),
+		status(http.StatusBadGateway),
+		status(http.StatusBadGateway),
+		completion("back", 10),
+	}}
+	config := DefaultConfig()
+	config.MaxRetries = 0
+	config.BreakerThreshold = 2
+	config.BreakerCooldown = time.Minute
+	client, clock := newTestClient(t, provider, config)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Completion(ctx, request("hi"))
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+
+	// The provider is not called while the circuit is open
+	_, err := client.Completion(ctx, request("hi"))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, provider.requests)
+
+	// Once the cooldown passes a call is let through, and its failure opens the circuit again
+	clock.now = clock.now.Add(time.Minute)
+	_, err = client.Completion(ctx, request("hi"))
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	_, err = client.Completion(ctx, request("hi"))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 3, provider.requests)
+
+	// The circuit closes when the provider recovers
+	clock.now = clock.now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Completion(ctx, request("hi"))
+		require.NoError(t, err)
+		assert.Equal(t, "back", resp.Text)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){completion("ok", 0)}}
+	config := DefaultConfig()
+	config.Limits = Limits{RequestsPerMinute: 2}
+	config.ModelLimits = map[string]Limits{"gpt-4o": {TokensPerMinute: 600}}
+	client, clock := newTestClient(t, provider, config)
+	ctx := context.Background()
+
+	// Two requests a minute, a new one allowed every 30 seconds
+	for i := 0; i < 3; i++ {
+		_, err := client.Completion(ctx, request("hi"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []time.Duration{30 * time.Second}, clock.sleeps)
+
+	// 600 tokens a minute, 10 a second; each request is estimated at 400 tokens
+	clock.sleeps = nil
+	req := request(string(make([]byte, 1600)))
+	req.Model.Name = "gpt-4o"
+	for i := 0; i < 2; i++ {
+		_, err := client.Completion(ctx, req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []time.Duration{20 * time.Second}, clock.sleeps)
+	assert.Equal(t, 5, provider.requests)
+}
+
+func TestRateLimitsSettleUsedTokens(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){completion("ok", 900)}}
+	config := DefaultConfig()
+	config.Limits = Limits{TokensPerMinute: 1200}
+	client, clock := newTestClient(t, provider, config)
+	ctx := context.Background()
+
+	// The first request reserves 100 tokens but uses 900, leaving 300 for the next 400
+	req := request(string(make([]byte, 400)))
+	_, err := client.Completion(ctx, req)
+	require.NoError(t, err)
+	req = request(string(make([]byte, 1600)))
+	_, err = client.Completion(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Second}, clock.sleeps)
+}
+
+func TestStreamNotRetriedOnceStreamed(t *testing.T) {
+	provider := &fakeProvider{responses: []func(w http.ResponseWriter){
+		status(http.StatusServiceUnavailable),
+		func(w http.ResponseWriter) {
+			fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"hel\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"lo\"}}]}\n\ndata: [DONE]\n\n")
+		},
+	}}
+	client, _ := newTestClient(t, provider, DefaultConfig())
+
+	// A stream failing before any of it is streamed is retried
+	var chunks []string
+	err := client.StreamCompletion(context.Background(), request("hi"), func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hel", "lo"}, chunks)
+	assert.Equal(t, 2, provider.requests)
+
+	// A stream failing once streamed is not, as the chunks cannot be taken back
+	errGone := errors.New("client went away")
+	err = client.StreamCompletion(context.Background(), request("hi"), func(chunk string) error {
+		return fmt.Errorf("writing chunk: %w", &net.OpError{Op: "write", Err: errGone})
+	})
+	assert.ErrorIs(t, err, errGone)
+	assert.Equal(t, 3, provider.requests)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, interfaces.ParseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, interfaces.ParseRetryAfter("Wed, 01 Jan 2025 00:01:30 GMT", now))
+	assert.Zero(t, interfaces.ParseRetryAfter("Tue, 31 Dec 2024 23:59:00 GMT", now))
+	assert.Zero(t, interfaces.ParseRetryAfter("soon", now))
+	assert.Zero(t, interfaces.ParseRetryAfter("", now))
+}
@@ -162,9 +162,9 @@ func (c *Client) Completion(ctx context.Context, req interfaces.CompletionReques
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Errorf("Sonnet API error: Status %d, Body: %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("sonnet API error: %s", resp.Status)
+		apiErr := interfaces.NewAPIError("sonnet", resp)
+		logger.Errorf("Sonnet API error: Status %d, Body: %s", apiErr.StatusCode, apiErr.Body)
+		return nil, apiErr
 	}
 
 	// Decode response
@@ -259,9 +259,9 @@ func (c *Client) StreamCompletion(ctx context.Context, req interfaces.Completion
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Errorf("Sonnet API error: Status %d, Body: %s", resp.StatusCode, string(body))
-		return fmt.Errorf("sonnet API error: %s", resp.Status)
+		apiErr := interfaces.NewAPIError("sonnet", resp)
+		logger.Errorf("Sonnet API error: Status %d, Body: %s", apiErr.StatusCode, apiErr.Body)
+		return apiErr
 	}
 
 	// Process the stream
@@ -362,9 +362,9 @@ func (c *Client) Embedding(ctx context.Context, text string, modelName string) (
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Errorf("Sonnet API error: Status %d, Body: %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("sonnet API error: %s", resp.Status)
+		apiErr := interfaces.NewAPIError("sonnet", resp)
+		logger.Errorf("Sonnet API error: Status %d, Body: %s", apiErr.StatusCode, apiErr.Body)
+		return nil, apiErr
 	}
 
 	// Decode response
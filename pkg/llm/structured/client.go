@@ -2,19 +2,34 @@ package structured
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/resilience"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"github.com/sirupsen/logrus"
 )
 
 // ResponseFormat represents the format specification for the LLM response
 type ResponseFormat struct {
-	// Type should be "json_object" for structured JSON output
-	Type string `json:"type"`
+	// Type is "json_schema" for output conforming to JSONSchema, where the provider supports
+	// it, or "json_object" for any JSON object
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat is the schema of a json_schema response format
+type JSONSchemaFormat struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
 }
 
 // LiteLLMRequest represents a request to the LiteLLM API
@@ -34,16 +49,26 @@ type LiteLLMMessage struct {
 
 // LiteLLMResponse represents a response from the LiteLLM API
 type LiteLLMResponse struct {
+	Model   string `json:"model"` // Model that answered, such as a dated version of the one requested
 	Choices []struct {
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
+// maxResponseTokens is the maximum number of tokens of the responses to requests
+const maxResponseTokens = 8192
+
 // Client is a simplified LLM client for structured output generation
 type Client struct {
 	baseURL      string
@@ -51,6 +76,16 @@ type Client struct {
 	defaultModel string
 	httpClient   *http.Client
 	logger       *logrus.Entry
+	guard        *resilience.Guard          // Retries, rate limits and circuit breaking of requests
+	fallbacks    *interfaces.FallbackPolicy // Models calls fall back to, if any
+
+	maxAttempts   int             // Attempts of a structured call, repairs included
+	recorder      AttemptRecorder // Optional, sees every attempt
+	usageRecorder usage.Recorder  // Optional, records the usage of every request
+	responses     *cache.Cache    // Optional, caches the responses of requests
+
+	mu           sync.Mutex
+	noJSONSchema map[string]bool // Models that turned out not to support json_schema
 }
 
 // NewClient creates a new LLM client
@@ -62,61 +97,176 @@ func NewClient(baseURL, apiKey, defaultModel string, logger *logrus.Entry) *Clie
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second, // 2 minute timeout
 		},
-		logger: logger,
+		logger:       logger,
+		guard:        resilience.NewGuard("litellm", resilience.DefaultConfig()),
+		maxAttempts:  DefaultMaxAttempts,
+		noJSONSchema: make(map[string]bool),
 	}
 }
 
-// Call makes a request to the LLM API with the given prompt
-func (c *Client) Call(model, prompt string, schema json.RawMessage) (string, error) {
+// SetAttemptRecorder sets a function called with every attempt of a structured call
+func (c *Client) SetAttemptRecorder(recorder AttemptRecorder) {
+	c.recorder = recorder
+}
+
+// SetUsageRecorder sets the recorder of the usage of every request, attributed as the
+// context of its call says
+func (c *Client) SetUsageRecorder(recorder usage.Recorder) {
+	c.usageRecorder = recorder
+}
+
+// SetCache sets the cache of the responses of requests, used as the context of each call
+// says
+func (c *Client) SetCache(responses *cache.Cache) {
+	c.responses = responses
+}
+
+// SetGuard sets the guard of the requests of the client, for them to share the limits and
+// circuit of the other clients of the provider
+func (c *Client) SetGuard(guard *resilience.Guard) {
+	if guard != nil {
+		c.guard = guard
+	}
+}
+
+// SetFallbackPolicy sets the models structured calls fall back to when they fail, named as
+// the LiteLLM proxy knows them
+func (c *Client) SetFallbackPolicy(policy *interfaces.FallbackPolicy) {
+	c.fallbacks = policy
+}
+
+// Call makes a request to the LLM API with the given prompt. The schema, if any, is added
+// to the prompt, and the response is returned as is.
+func (c *Client) Call(ctx context.Context, model, prompt string, schema json.RawMessage) (string, error) {
 	if model == "" {
 		model = c.defaultModel
 	}
 
-	// Prepare the request body
-	requestBody := LiteLLMRequest{
-		Model: model,
-		Messages: []LiteLLMMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		MaxTokens: 8192, // Adjust as needed for your use case
-		Stream:    false,
+	var format *ResponseFormat
+	if len(schema) > 0 {
+		format = &ResponseFormat{Type: "json_object"}
+		prompt += schemaInstructions(schema)
 	}
 
-	// Add response format for JSON output if schema is provided
-	if len(schema) > 0 {
-		// According to OpenAI documentation, just set the type to json_object
-		// The schema should be included in the prompt itself
-		requestBody.ResponseFormat = &ResponseFormat{
-			Type: "json_object",
+	return c.send(ctx, model, []LiteLLMMessage{{Role: "user", Content: prompt}}, format)
+}
+
+// send sends a chat completion request through the guard of the client and returns the
+// content of its response, unless the cache has it. The usage of the request is recorded
+// once it succeeds, or is answered from the cache.
+func (c *Client) send(ctx context.Context, model string, messages []LiteLLMMessage, format *ResponseFormat) (string, error) {
+	promptLen := 0
+	for _, m := range messages {
+		promptLen += len(m.Content)
+	}
+
+	var key string
+	mode := cache.ModeFromContext(ctx)
+	if c.responses != nil && mode != cache.ModeBypass {
+		key = cacheKey(model, messages, format)
+		if entry, ok := c.responses.Get(key); ok && mode == cache.ModeUse {
+			c.recordUsage(ctx, usage.Record{
+				Model:            "litellm:" + answeredBy(entry.Model, model),
+				PromptTokens:     entry.PromptTokens,
+				CompletionTokens: entry.CompletionTokens,
+				Cached:           true,
+			})
+			return entry.Response, nil
 		}
-		
-		// Extract a readable version of the schema to include in the prompt
-		var schemaObj map[string]interface{}
-		if err := json.Unmarshal(schema, &schemaObj); err == nil {
-			prettySchema, err := json.MarshalIndent(schemaObj, "", "  ")
-			if err == nil {
-				// Add the schema to the prompt to guide the model
-				schemaPrompt := "\n\nYou must respond with a JSON object that conforms to this schema:\n```json\n" + 
-					string(prettySchema) + "\n```\n\nThe response should be a valid JSON object with no other text."
-				prompt += schemaPrompt
-				requestBody.Messages[0].Content = prompt
-			}
+	}
+
+	var resp *interfaces.CompletionResponse
+	err := c.guard.Do(ctx, model, promptLen/4, func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.sendOnce(ctx, model, messages, format)
+		if resp != nil && resp.TokenUsage != nil {
+			return resp.TokenUsage.TotalTokens, err
 		}
+		return 0, err
+	})
+	if err != nil {
+		return "", err
+	}
+	content := resp.Text
+
+	record := usage.Record{Model: "litellm:" + answeredBy(resp.ModelName, model)}
+	if tokens := resp.TokenUsage; tokens != nil {
+		record.PromptTokens, record.CompletionTokens = tokens.PromptTokens, tokens.CompletionTokens
+	} else {
+		record.PromptTokens, record.CompletionTokens = promptLen/4, usage.EstimateTokens(content)
+		record.Estimated = true
+	}
+	c.recordUsage(ctx, record)
+
+	if key != "" && cache.Cacheable(content, resp.FinishReason) {
+		c.responses.Put(&cache.Entry{
+			Key:              key,
+			Model:            resp.ModelName,
+			Response:         content,
+			FinishReason:     resp.FinishReason,
+			PromptTokens:     record.PromptTokens,
+			CompletionTokens: record.CompletionTokens,
+		})
+	}
+	return content, nil
+}
+
+// recordUsage records the usage of a request, attributed as the context of its call says,
+// and counts its tokens with the meter of the context
+func (c *Client) recordUsage(ctx context.Context, record usage.Record) {
+	usage.CountTokens(ctx, record)
+	if c.usageRecorder == nil {
+		return
+	}
+	record.Attribution = usage.FromContext(ctx)
+	record.CreatedAt = time.Now()
+	c.usageRecorder.RecordUsage(ctx, record)
+}
+
+// answeredBy returns the model the API reported answering a request with, or the model
+// requested if it reported none
+func answeredBy(reported, requested string) string {
+	if reported != "" {
+		return reported
+	}
+	return requested
+}
+
+// cacheKey returns the key the response of a request is cached under
+func cacheKey(model string, messages []LiteLLMMessage, format *ResponseFormat) string {
+	converted := make([]interfaces.Message, len(messages))
+	for i, m := range messages {
+		converted[i] = interfaces.Message{Role: m.Role, Content: m.Content}
+	}
+	var schema json.RawMessage
+	if format != nil {
+		schema, _ = json.Marshal(format)
+	}
+	return cache.Key("litellm:"+model, converted, schema, nil, maxResponseTokens)
+}
+
+// sendOnce sends a chat completion request and returns its response, with the model that
+// answered it and the tokens it used if the API reported them
+func (c *Client) sendOnce(ctx context.Context, model string, messages []LiteLLMMessage, format *ResponseFormat) (*interfaces.CompletionResponse, error) {
+	// Prepare the request body
+	requestBody := LiteLLMRequest{
+		Model:          model,
+		Messages:       messages,
+		MaxTokens:      maxResponseTokens,
+		Stream:         false,
+		ResponseFormat: format,
 	}
 
 	// Convert request to JSON
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create the HTTP request
-	req, err := http.NewRequest("POST", c.baseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
@@ -124,48 +274,69 @@ func (c *Client) Call(model, prompt string, schema json.RawMessage) (string, err
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
 	// Log request
+	promptLen := 0
+	for _, m := range messages {
+		promptLen += len(m.Content)
+	}
 	c.logger.WithFields(logrus.Fields{
 		"model":  model,
 		"url":    c.baseURL,
-		"tokens": len(prompt) / 4, // Rough estimate
+		"tokens": promptLen / 4, // Rough estimate
 	}).Info("Sending request to LLM API")
 
 	// Send the request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call LLM API: %w", err)
+		return nil, fmt.Errorf("failed to call LLM API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// Check if the response is OK
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("LLM API returned non-OK status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+		return nil, &interfaces.APIError{
+			Provider:   "litellm",
+			StatusCode: resp.StatusCode,
+			Body:       string(bodyBytes),
+			RetryAfter: interfaces.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	// Parse the response
 	var llmResponse LiteLLMResponse
 	if err := json.Unmarshal(bodyBytes, &llmResponse); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	// Check for errors in the response
 	if llmResponse.Error != nil {
-		return "", fmt.Errorf("LLM API returned error: %s", llmResponse.Error.Message)
+		return nil, fmt.Errorf("LLM API returned error: %s", llmResponse.Error.Message)
 	}
 
 	// Ensure we have a valid response
 	if len(llmResponse.Choices) == 0 {
-		return "", fmt.Errorf("LLM API returned empty choices")
+		return nil, fmt.Errorf("LLM API returned empty choices")
 	}
 
 	// Extract the content
 	content := llmResponse.Choices[0].Message.Content
+	completion := &interfaces.CompletionResponse{
+		Text:         content,
+		FinishReason: llmResponse.Choices[0].FinishReason,
+		ModelName:    llmResponse.Model,
+	}
+	if llmResponse.Usage != nil {
+		completion.TokenUsage = &interfaces.TokenUsage{
+			PromptTokens:     llmResponse.Usage.PromptTokens,
+			CompletionTokens: llmResponse.Usage.CompletionTokens,
+			TotalTokens:      llmResponse.Usage.TotalTokens,
+		}
+	}
 
 	// Log response size
 	c.logger.WithFields(logrus.Fields{
@@ -173,5 +344,20 @@ func (c *Client) Call(model, prompt string, schema json.RawMessage) (string, err
 		"response_len": len(content),
 	}).Info("Received response from LLM API")
 
-	return content, nil
+	return completion, nil
+}
+
+// schemaInstructions asks for a response conforming to a schema, for providers that cannot
+// be given the schema as the response format
+func schemaInstructions(schema json.RawMessage) string {
+	var schemaObj map[string]interface{}
+	if err := json.Unmarshal(schema, &schemaObj); err != nil {
+		return ""
+	}
+	prettySchema, err := json.MarshalIndent(schemaObj, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return "\n\nYou must respond with a JSON object that conforms to this schema:\n```json\n" +
+		string(prettySchema) + "\n```\n\nThe response should be a valid JSON object with no other text."
 }
@@ -0,0 +1,98 @@
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/usage"
+)
+
+// DefaultChunkTokens is the size of the chunks insights are summarized in for models whose
+// maximum number of tokens is unknown
+const DefaultChunkTokens = 4096
+
+// ModelTokens returns the maximum number of tokens of a model, named with or without its
+// provider, or DefaultChunkTokens if the model is unknown. Fallback chains are sized to their
+// first model.
+func ModelTokens(model string) int {
+	if chain := interfaces.ParseFallbackChain(model); len(chain) > 0 {
+		model = chain[0]
+	}
+
+	models := interfaces.DefaultModels()
+	if m, ok := models[model]; ok && m.MaxTokens > 0 {
+		return m.MaxTokens
+	}
+	if m, ok := models["litellm:"+model]; ok && m.MaxTokens > 0 {
+		return m.MaxTokens
+	}
+	for _, m := range models {
+		if m.Name == model && m.MaxTokens > 0 {
+			return m.MaxTokens
+		}
+	}
+	return DefaultChunkTokens
+}
+
+// ChunkParts splits parts, in order, into chunks whose estimated tokens fit in a budget. Parts
+// larger than half of the budget are truncated, so that any two parts fit in a chunk together.
+func ChunkParts(parts []string, budget int) [][]string {
+	if budget <= 0 {
+		budget = DefaultChunkTokens
+	}
+	maxPart := budget / 2
+
+	var chunks [][]string
+	var chunk []string
+	chunkTokens := 0
+	for _, part := range parts {
+		if usage.EstimateTokens(part) > maxPart {
+			part = strings.ToValidUTF8(part[:maxPart*4], "") + "\n... [truncated] ..."
+		}
+		tokens := usage.EstimateTokens(part)
+		if len(chunk) > 0 && chunkTokens+tokens > budget {
+			chunks = append(chunks, chunk)
+			chunk, chunkTokens = nil, 0
+		}
+		chunk = append(chunk, part)
+		chunkTokens += tokens
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// mapReduce summarizes parts with summarize, at once if they fit in the token budget. Otherwise
+// each chunk of them is summarized on its own, and the summaries of the chunks are summarized
+// in turn, until they fit. As every chunk holds at least two parts, each round halves them.
+func mapReduce[T any](ctx context.Context, parts []string, budget int, summarize func(ctx context.Context, parts []string) (*T, error)) (*T, error) {
+	for {
+		chunks := ChunkParts(parts, budget)
+		if len(chunks) <= 1 {
+			if len(chunks) == 1 {
+				parts = chunks[0]
+			}
+			return summarize(ctx, parts)
+		}
+
+		summaries := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			summary, err := summarize(ctx, chunk)
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(summary)
+			if err != nil {
+				return nil, err
+			}
+			summaries = append(summaries, string(data))
+		}
+		parts = summaries
+	}
+}
@@ -0,0 +1,92 @@
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelTokens(t *testing.T) {
+	assert.Equal(t, 8192, ModelTokens("openai:gpt-4"))
+	assert.Equal(t, ModelTokens("openai:gpt-4"), ModelTokens("gpt-4"))
+	assert.Equal(t, ModelTokens("openai:gpt-4"), ModelTokens("openai:gpt-4 -> unknown-model"))
+	assert.Equal(t, DefaultChunkTokens, ModelTokens("unknown-model"))
+	assert.Equal(t, DefaultChunkTokens, ModelTokens(""))
+}
+
+func TestChunkParts(t *testing.T) {
+	part := strings.Repeat("a", 40) // 10 tokens
+
+	chunks := ChunkParts([]string{part, part, part, part, part}, 25)
+	require.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 2)
+	assert.Len(t, chunks[1], 2)
+	assert.Len(t, chunks[2], 1)
+
+	assert.Empty(t, ChunkParts(nil, 25))
+}
+
+func TestChunkPartsTruncatesLargeParts(t *testing.T) {
+	chunks := ChunkParts([]string{strings.Repeat("a", 400), "b"}, 20)
+	require.Len(t, chunks, 1)
+	assert.True(t, strings.HasPrefix(chunks[0][0], strings.Repeat("a", 40)+"\n"))
+	assert.Contains(t, chunks[0][0], "[truncated]")
+	assert.Equal(t, "b", chunks[0][1])
+}
+
+type testSummary struct {
+	Parts int `json:"parts"`
+}
+
+func TestMapReduce(t *testing.T) {
+	part := strings.Repeat("a", 40)
+	parts := make([]string, 8)
+	for i := range parts {
+		parts[i] = part
+	}
+
+	calls := 0
+	summary, err := mapReduce(context.Background(), parts, 25, func(ctx context.Context, parts []string) (*testSummary, error) {
+		calls++
+		total := 0
+		for _, part := range parts {
+			var child testSummary
+			if strings.HasPrefix(part, "{") {
+				require.NoError(t, json.Unmarshal([]byte(part), &child))
+				total += child.Parts
+			} else {
+				total++
+			}
+		}
+		return &testSummary{Parts: total}, nil
+	})
+	require.NoError(t, err)
+
+	// Every part is summarized once, through summaries of the summaries of its chunk
+	assert.Equal(t, 8, summary.Parts)
+	assert.Equal(t, 5, calls)
+}
+
+func TestMapReduceFitsAtOnce(t *testing.T) {
+	calls := 0
+	summary, err := mapReduce(context.Background(), []string{"a", "b"}, 100, func(ctx context.Context, parts []string) (*testSummary, error) {
+		calls++
+		return &testSummary{Parts: len(parts)}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, summary.Parts)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMapReduceError(t *testing.T) {
+	failure := errors.New("failed")
+	_, err := mapReduce(context.Background(), []string{strings.Repeat("a", 80), strings.Repeat("b", 80)}, 25, func(ctx context.Context, parts []string) (*testSummary, error) {
+		return nil, failure
+	})
+	assert.ErrorIs(t, err, failure)
+}
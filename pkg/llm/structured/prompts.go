@@ -7,6 +7,10 @@ import (
 	"cred.com/hack25/backend/internal/models"
 )
 
+// PromptVersion is the version of the prompt templates, recorded in the hashes of the inputs of
+// insights. Bump it when the templates change in a way that should regenerate the insights.
+const PromptVersion = "1"
+
 // PromptBuilder handles building prompts for different insight types
 type PromptBuilder struct {
 	useJSONFormat bool
@@ -19,13 +23,40 @@ func NewPromptBuilder(useJSONFormat bool) *PromptBuilder {
 	}
 }
 
-// BuildFunctionPrompt creates a prompt for function analysis
-func (p *PromptBuilder) BuildFunctionPrompt(function *models.RepositoryFunction, calls []models.FunctionCall) string {
+// MaxFewShotExamples is the most examples included in a prompt
+const MaxFewShotExamples = 3
+
+// FewShotExample is a function along with the insight reviewers corrected for it, shown to the
+// model as an example of the insights expected for the functions of the same repository
+type FewShotExample struct {
+	Function string `json:"function"` // Name, with its receiver
+	Code     string `json:"code"`
+	Insight  string `json:"insight"` // Corrected insight, as JSON
+}
+
+// BuildFunctionPrompt creates a prompt for function analysis, following examples of corrected
+// insights of the same repository if any
+func (p *PromptBuilder) BuildFunctionPrompt(function *models.RepositoryFunction, calls []models.FunctionCall, examples []FewShotExample) string {
 	var sb strings.Builder
 
 	// System instruction
 	sb.WriteString("You are an expert code analyst capable of understanding Go source code in depth.\n\n")
 
+	// Insights reviewers corrected, for the analysis to follow them
+	if len(examples) > 0 {
+		sb.WriteString("## Examples\n\n")
+		sb.WriteString("Reviewers corrected the insights of the following functions of the same repository. Follow their judgement where it applies:\n\n")
+		for i, example := range examples {
+			sb.WriteString(fmt.Sprintf("### Example %d: %s\n\n", i+1, example.Function))
+			sb.WriteString("```go\n")
+			sb.WriteString(example.Code)
+			sb.WriteString("\n```\n\n")
+			sb.WriteString("```json\n")
+			sb.WriteString(example.Insight)
+			sb.WriteString("\n```\n\n")
+		}
+	}
+
 	// Description of what we want
 	sb.WriteString("Please analyze the following Go function and extract key insights about its purpose, behavior, and implementation:\n\n")
 
@@ -506,3 +537,57 @@ func (p *PromptBuilder) BuildRepositoryPrompt(repo *models.Repository, files []m
 
 	return sb.String()
 }
+
+// BuildFileSummaryPrompt creates a prompt for file analysis from the insights of the functions
+// and structs of the file, rather than from its code
+func (p *PromptBuilder) BuildFileSummaryPrompt(repo *models.Repository, file *models.RepositoryFile, parts []string) string {
+	details := fmt.Sprintf("Path: %s\nPackage: %s\nRepository: %s\n", file.FilePath, file.PackagePath, repo.Name)
+	return p.buildSummaryPrompt("Go source file", details, "functions and structs", parts)
+}
+
+// BuildPackageSummaryPrompt creates a prompt for package analysis from the insights of the
+// files of the package
+func (p *PromptBuilder) BuildPackageSummaryPrompt(repo *models.Repository, pkgPath string, parts []string) string {
+	details := fmt.Sprintf("Import path: %s\nRepository: %s\n", pkgPath, repo.Name)
+	return p.buildSummaryPrompt("Go package", details, "files", parts)
+}
+
+// BuildRepositorySummaryPrompt creates a prompt for repository analysis from the insights of
+// the packages of the repository
+func (p *PromptBuilder) BuildRepositorySummaryPrompt(repo *models.Repository, parts []string) string {
+	details := fmt.Sprintf("Name: %s\nURL: %s\n", repo.Name, repo.URL)
+	return p.buildSummaryPrompt("Go repository", details, "packages", parts)
+}
+
+// buildSummaryPrompt creates a prompt summarizing the insights of the parts of a subject into
+// the insight of the subject. The insights may each summarize several parts already, when
+// the parts of the subject are too many to be summarized at once.
+func (p *PromptBuilder) buildSummaryPrompt(subject, details, children string, parts []string) string {
+	var sb strings.Builder
+
+	// System instruction
+	sb.WriteString("You are an expert code analyst capable of understanding large codebases in depth.\n\n")
+
+	// Description of what we want
+	sb.WriteString(fmt.Sprintf("Please summarize the following insights, generated for the %s of a %s or for groups of them, "+
+		"into the insight of the %s as a whole:\n\n", children, subject, subject))
+
+	// Subject details
+	sb.WriteString("## Details\n\n")
+	sb.WriteString(details)
+	sb.WriteString("\n")
+
+	// Insights of the parts
+	sb.WriteString("## Insights\n\n")
+	for _, part := range parts {
+		sb.WriteString(part)
+		sb.WriteString("\n\n")
+	}
+
+	if p.useJSONFormat {
+		sb.WriteString("Keep what matters at the level of the " + subject + " and leave out the details of its parts. ")
+		sb.WriteString("If you don't have information for a particular field, use an empty array [] or empty string \"\" as appropriate. Your response should be valid JSON with no other text or explanations outside the JSON object.")
+	}
+
+	return sb.String()
+}
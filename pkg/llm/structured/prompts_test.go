@@ -0,0 +1,25 @@
+package structured
+
+import (
+	"strings"
+	"testing"
+
+	"cred.com/hack25/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFunctionPromptWithExamples(t *testing.T) {
+	builder := NewPromptBuilder(true)
+	function := &models.RepositoryFunction{Name: "Login", CodeBlock: "func Login() {}"}
+
+	prompt := builder.BuildFunctionPrompt(function, nil, []FewShotExample{
+		{Function: "func (*Store) Load", Code: "func (s *Store) Load() {}", Insight: `{"notes":"reads the users table"}`},
+	})
+
+	assert.Contains(t, prompt, "## Examples")
+	assert.Contains(t, prompt, "### Example 1: func (*Store) Load")
+	assert.Contains(t, prompt, `{"notes":"reads the users table"}`)
+	assert.Less(t, strings.Index(prompt, "## Examples"), strings.Index(prompt, "## Function Details"), "examples come before the function")
+
+	assert.NotContains(t, builder.BuildFunctionPrompt(function, nil, nil), "## Examples")
+}
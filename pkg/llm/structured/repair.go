@@ -0,0 +1,231 @@
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxAttempts is how many times a structured call asks for a response conforming to
+// its schema, the first request included, before giving up
+const DefaultMaxAttempts = 3
+
+// ErrCodeInvalidOutput is the code of the error of a structured call whose responses never
+// conformed to its schema
+const ErrCodeInvalidOutput = "invalid_output"
+
+// jsonSchemaModels are prefixes of the models that support json_schema response formats
+var jsonSchemaModels = []string{
+	"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4",
+	"gemini-1.5", "gemini-2",
+	"claude-3-5", "claude-3-7", "claude-sonnet-4", "claude-opus-4",
+}
+
+// Attempt is a request of a structured call and how its response was found
+type Attempt struct {
+	Number         int           `json:"number"`
+	Model          string        `json:"model"`
+	ResponseFormat string        `json:"response_format"` // json_schema or json_object
+	Response       string        `json:"response"`
+	Errors         []string      `json:"errors,omitempty"` // Why the response was rejected, or the call failed
+	Duration       time.Duration `json:"duration"`
+}
+
+// AttemptRecorder is called with every attempt of a structured call, along with the name
+// of the schema the call is for
+type AttemptRecorder func(schemaName string, attempt Attempt)
+
+// CallStructured asks for a response conforming to a schema and decodes it into target.
+// Responses that are not valid JSON or do not conform to the schema are sent back to the
+// model along with what is wrong with them, up to the client's maximum number of attempts.
+// Calls failing with errors that fall back are made again to the next model of the fallback
+// chain of the model, if it has one. The attempts made are returned whether or not the call
+// succeeds, and name the model each was made to.
+func (c *Client) CallStructured(ctx context.Context, model, schemaName, prompt string, schema json.RawMessage, target interface{}) ([]Attempt, error) {
+	if model == "" {
+		model = c.defaultModel
+	}
+
+	chain := c.fallbacks.Chain(model)
+	var attempts []Attempt
+	for i, m := range chain {
+		modelAttempts, err := c.callModel(ctx, m, schemaName, prompt, schema, target, len(attempts))
+		attempts = append(attempts, modelAttempts...)
+		if err == nil || i == len(chain)-1 || !c.fallbacks.FallsBack(err) {
+			return attempts, err
+		}
+		c.logger.WithFields(logrus.Fields{
+			"model":    m,
+			"fallback": chain[i+1],
+			"schema":   schemaName,
+			"class":    interfaces.ClassifyError(err),
+			"error":    err,
+		}).Warn("Structured LLM call failed, falling back to the next model")
+	}
+	return attempts, nil
+}
+
+// callModel makes a structured call to a model, numbering its attempts after those already
+// made to other models
+func (c *Client) callModel(ctx context.Context, model, schemaName, prompt string, schema json.RawMessage, target interface{}, previous int) ([]Attempt, error) {
+	native := c.supportsJSONSchema(model)
+	if !native {
+		prompt += schemaInstructions(schema)
+	}
+	messages := []LiteLLMMessage{{Role: "user", Content: prompt}}
+
+	var attempts []Attempt
+	for counted := 0; counted < c.maxAttempts; counted++ {
+		attempt := Attempt{Number: previous + len(attempts) + 1, Model: model, ResponseFormat: "json_object"}
+		format := &ResponseFormat{Type: "json_object"}
+		if native {
+			attempt.ResponseFormat = "json_schema"
+			format = &ResponseFormat{
+				Type:       "json_schema",
+				JSONSchema: &JSONSchemaFormat{Name: schemaName, Schema: schema},
+			}
+		}
+
+		start := time.Now()
+		content, err := c.send(ctx, model, messages, format)
+		attempt.Duration = time.Since(start)
+		attempt.Response = content
+
+		if err != nil {
+			attempt.Errors = []string{err.Error()}
+			attempts = append(attempts, c.record(schemaName, attempt))
+
+			// Fall back to asking for the schema in the prompt, without counting the attempt
+			var apiErr *interfaces.APIError
+			if native && errors.As(err, &apiErr) && isResponseFormatError(apiErr) {
+				c.logger.WithField("model", model).Warn("Model does not support json_schema responses, falling back to json_object")
+				c.disableJSONSchema(model)
+				native = false
+				messages[0].Content += schemaInstructions(schema)
+				counted--
+				continue
+			}
+			return attempts, err
+		}
+
+		validationErrs := decodeStructured(content, schema, target)
+		attempt.Errors = validationErrs
+		attempts = append(attempts, c.record(schemaName, attempt))
+		if len(validationErrs) == 0 {
+			return attempts, nil
+		}
+
+		c.logger.WithFields(logrus.Fields{
+			"model":   model,
+			"schema":  schemaName,
+			"attempt": attempt.Number,
+			"errors":  len(validationErrs),
+		}).Warn("LLM response does not conform to its schema, asking for a repair")
+
+		messages = append(messages,
+			LiteLLMMessage{Role: "assistant", Content: content},
+			LiteLLMMessage{Role: "user", Content: repairPrompt(validationErrs)},
+		)
+	}
+
+	last := attempts[len(attempts)-1]
+	return attempts, NewError(ErrCodeInvalidOutput, "%s response did not conform to its schema after %d attempts: %s",
+		schemaName, len(attempts), strings.Join(last.Errors, "; "))
+}
+
+// record passes an attempt to the recorder, if any, and logs it
+func (c *Client) record(schemaName string, attempt Attempt) Attempt {
+	c.logger.WithFields(logrus.Fields{
+		"schema":          schemaName,
+		"attempt":         attempt.Number,
+		"model":           attempt.Model,
+		"response_format": attempt.ResponseFormat,
+		"errors":          attempt.Errors,
+		"duration_ms":     attempt.Duration.Milliseconds(),
+	}).Debug("Structured LLM call attempt")
+
+	if c.recorder != nil {
+		c.recorder(schemaName, attempt)
+	}
+	return attempt
+}
+
+// supportsJSONSchema checks whether a model is known to support json_schema response
+// formats, and has not turned out not to
+func (c *Client) supportsJSONSchema(model string) bool {
+	c.mu.Lock()
+	disabled := c.noJSONSchema[model]
+	c.mu.Unlock()
+	if disabled {
+		return false
+	}
+
+	// Models may be prefixed with their provider, such as openai/gpt-4o
+	name := strings.ToLower(model[strings.LastIndex(model, "/")+1:])
+	for _, prefix := range jsonSchemaModels {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// disableJSONSchema stops using json_schema response formats with a model
+func (c *Client) disableJSONSchema(model string) {
+	c.mu.Lock()
+	c.noJSONSchema[model] = true
+	c.mu.Unlock()
+}
+
+// isResponseFormatError checks whether the API rejected a request for its response format
+func isResponseFormatError(err *interfaces.APIError) bool {
+	if err.StatusCode != http.StatusBadRequest && err.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	body := strings.ToLower(err.Body)
+	return strings.Contains(body, "response_format") || strings.Contains(body, "json_schema")
+}
+
+// decodeStructured validates a response against a schema and decodes it into target,
+// returning what is wrong with it, if anything
+func decodeStructured(content string, schema json.RawMessage, target interface{}) []string {
+	data := extractJSON(content)
+
+	validationErrs, err := ValidateJSON(schema, []byte(data))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if len(validationErrs) > 0 {
+		errs := make([]string, len(validationErrs))
+		for i, e := range validationErrs {
+			errs[i] = e.String()
+		}
+		return errs
+	}
+
+	if err := json.Unmarshal([]byte(data), target); err != nil {
+		return []string{fmt.Sprintf("$: %v", err)}
+	}
+	return nil
+}
+
+// repairPrompt asks the model to correct its previous response
+func repairPrompt(errs []string) string {
+	var b strings.Builder
+	b.WriteString("Your previous response does not conform to the required JSON schema:\n")
+	for _, e := range errs {
+		b.WriteString("- " + e + "\n")
+	}
+	if len(errs) == 1 && strings.Contains(errs[0], "unexpected end of JSON input") {
+		b.WriteString("\nThe response was cut off. Keep descriptions short so that the whole object fits.\n")
+	}
+	b.WriteString("\nRespond again with only the corrected JSON object, with no other text.")
+	return b.String()
+}
@@ -0,0 +1,290 @@
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/usage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"count": {"type": "integer"},
+		"status": {"type": "string", "enum": ["pass", "warn", "fail"]},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["name", "status"]
+}`)
+
+type testOutput struct {
+	Name   string   `json:"name"`
+	Count  int      `json:"count"`
+	Status string   `json:"status"`
+	Tags   []string `json:"tags"`
+}
+
+func TestValidateJSON(t *testing.T) {
+	errs, err := ValidateJSON(testSchema, []byte(`{"name": "x", "count": 2, "status": "pass", "tags": ["a"]}`))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+
+	errs, err = ValidateJSON(testSchema, []byte(`{"count": 1.5, "status": "ok", "tags": ["a", 3]}`))
+	require.NoError(t, err)
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, e.String())
+	}
+	assert.Equal(t, []string{
+		`$: missing required property "name"`,
+		`$.count: expected integer, got number`,
+		`$.status: "ok" is not one of "pass", "warn", "fail"`,
+		`$.tags[1]: expected string, got number`,
+	}, messages)
+
+	errs, err = ValidateJSON(testSchema, []byte(`{"name": "x", "status": "pa`))
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "unexpected end of JSON input")
+}
+
+func TestExtractJSON(t *testing.T) {
+	for response, want := range map[string]string{
+		`{"a": 1}`:                                       `{"a": 1}`,
+		"```json\n{\"a\": {\"b\": \"}\"}}\n```":          `{"a": {"b": "}"}}`,
+		`Here is the analysis: {"a": "x"} Hope it helps`: `{"a": "x"}`,
+		`{"a": "cut`:                                     `{"a": "cut`,
+	} {
+		assert.Equal(t, want, extractJSON(response), response)
+	}
+}
+
+// fakeLLM serves chat completions with canned responses, recording the requests
+type fakeLLM struct {
+	responses []func(w http.ResponseWriter)
+	requests  []LiteLLMRequest
+}
+
+func (f *fakeLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req LiteLLMRequest
+	_ = json.Unmarshal(body, &req)
+	f.requests = append(f.requests, req)
+	f.responses[len(f.requests)-1](w)
+}
+
+func content(text string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		resp := map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"content": text}}},
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func newTestClient(t *testing.T, llm *fakeLLM) *Client {
+	server := httptest.NewServer(llm)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "key", "gpt-4o", logrus.NewEntry(logrus.New()))
+}
+
+func TestCallStructuredRepairs(t *testing.T) {
+	llm := &fakeLLM{responses: []func(w http.ResponseWriter){
+		content(`Sure! {"name": "x", "status": "passing"}`),
+		content(`{"name": "x", "status": "pass", "tags": ["a"]}`),
+	}}
+	client := newTestClient(t, llm)
+	var recorded []Attempt
+	client.SetAttemptRecorder(func(schemaName string, attempt Attempt) {
+		assert.Equal(t, "test", schemaName)
+		recorded = append(recorded, attempt)
+	})
+
+	var out testOutput
+	attempts, err := client.CallStructured(context.Background(), "", "test", "Describe x", testSchema, &out)
+	require.NoError(t, err)
+	assert.Equal(t, testOutput{Name: "x", Status: "pass", Tags: []string{"a"}}, out)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, attempts, recorded)
+	assert.Equal(t, []string{`$.status: "passing" is not one of "pass", "warn", "fail"`}, attempts[0].Errors)
+	assert.Empty(t, attempts[1].Errors)
+
+	// gpt-4o gets the schema as its response format rather than in the prompt
+	first := llm.requests[0]
+	require.NotNil(t, first.ResponseFormat.JSONSchema)
+	assert.Equal(t, "json_schema", first.ResponseFormat.Type)
+	assert.NotContains(t, first.Messages[0].Content, "conforms to this schema")
+
+	// The repair request carries the rejected response and what is wrong with it
+	repair := llm.requests[1].Messages
+	require.Len(t, repair, 3)
+	assert.Equal(t, "assistant", repair[1].Role)
+	assert.Contains(t, repair[2].Content, `"passing" is not one of`)
+}
+
+func TestCallStructuredGivesUp(t *testing.T) {
+	llm := &fakeLLM{}
+	for i := 0; i < DefaultMaxAttempts; i++ {
+		llm.responses = append(llm.responses, content(`{"name": "x"`))
+	}
+	client := newTestClient(t, llm)
+
+	var out testOutput
+	attempts, err := client.CallStructured(context.Background(), "", "test", "Describe x", testSchema, &out)
+	require.Error(t, err)
+	assert.Len(t, attempts, DefaultMaxAttempts)
+	var structuredErr *Error
+	require.ErrorAs(t, err, &structuredErr)
+	assert.Equal(t, ErrCodeInvalidOutput, structuredErr.Code)
+	assert.Contains(t, llm.requests[1].Messages[2].Content, "cut off")
+}
+
+func TestCallStructuredFallsBackToJSONObject(t *testing.T) {
+	llm := &fakeLLM{responses: []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"message": "response_format json_schema is not supported"}}`)
+		},
+		content(`{"name": "x", "status": "warn"}`),
+		content(`{"name": "y", "status": "fail"}`),
+	}}
+	client := newTestClient(t, llm)
+
+	var out testOutput
+	attempts, err := client.CallStructured(context.Background(), "gpt-4o-mini", "test", "Describe x", testSchema, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "x", out.Name)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "json_object", attempts[1].ResponseFormat)
+	assert.True(t, strings.Contains(llm.requests[1].Messages[0].Content, "conforms to this schema"))
+
+	// The model is not asked for json_schema again
+	_, err = client.CallStructured(context.Background(), "gpt-4o-mini", "test", "Describe y", testSchema, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "json_object", llm.requests[2].ResponseFormat.Type)
+}
+
+func TestCallStructuredFallsBackToNextModel(t *testing.T) {
+	llm := &fakeLLM{responses: []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"message": "This model's maximum context length is 8192 tokens"}}`)
+		},
+		content(`{"name": "x", "status": "pass"}`),
+	}}
+	client := newTestClient(t, llm)
+	client.SetFallbackPolicy(&interfaces.FallbackPolicy{
+		Chains: map[string][]string{"gpt-4o-mini": {"gpt-4o-mini", "claude-3-7-sonnet"}},
+	})
+
+	var out testOutput
+	attempts, err := client.CallStructured(context.Background(), "gpt-4o-mini", "test", "Describe x", testSchema, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "x", out.Name)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "gpt-4o-mini", attempts[0].Model)
+	assert.Equal(t, "claude-3-7-sonnet", attempts[1].Model)
+	assert.Equal(t, 2, attempts[1].Number)
+	assert.Equal(t, "claude-3-7-sonnet", llm.requests[1].Model)
+}
+
+func TestCallStructuredAnswersFromCache(t *testing.T) {
+	llm := &fakeLLM{responses: []func(w http.ResponseWriter){
+		content(`{"name": "x", "status": "pass"}`),
+		content(`{"name": "y", "status": "fail"}`),
+	}}
+	client := newTestClient(t, llm)
+	client.SetCache(cache.New(nil, cache.Config{TTL: time.Hour, MemoryEntries: 10}))
+
+	for i := 0; i < 2; i++ {
+		var out testOutput
+		_, err := client.CallStructured(context.Background(), "", "test", "Describe x", testSchema, &out)
+		require.NoError(t, err)
+		assert.Equal(t, "x", out.Name)
+	}
+	assert.Len(t, llm.requests, 1)
+
+	// Refreshing asks the model again
+	var out testOutput
+	_, err := client.CallStructured(cache.WithMode(context.Background(), cache.ModeRefresh), "", "test", "Describe x", testSchema, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "y", out.Name)
+	assert.Len(t, llm.requests, 2)
+}
+
+// answer serves a response as a model reports having answered it, and why it finished
+func answer(text, model, finishReason string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		resp := map[string]interface{}{
+			"model": model,
+			"choices": []interface{}{map[string]interface{}{
+				"message":       map[string]string{"content": text},
+				"finish_reason": finishReason,
+			}},
+			"usage": map[string]int{"prompt_tokens": 40, "completion_tokens": 10, "total_tokens": 50},
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+type recordedUsage struct {
+	records []usage.Record
+}
+
+func (r *recordedUsage) RecordUsage(ctx context.Context, record usage.Record) {
+	r.records = append(r.records, record)
+}
+
+func TestCachedCallsAreRecordedUnderTheAnsweringModel(t *testing.T) {
+	llm := &fakeLLM{responses: []func(w http.ResponseWriter){
+		answer(`{"name": "x", "status": "pass"}`, "gpt-4o-2024-08-06", "stop"),
+	}}
+	client := newTestClient(t, llm)
+	client.SetCache(cache.New(nil, cache.Config{TTL: time.Hour, MemoryEntries: 10}))
+	recorder := &recordedUsage{}
+	client.SetUsageRecorder(recorder)
+
+	for i := 0; i < 2; i++ {
+		var out testOutput
+		_, err := client.CallStructured(context.Background(), "", "test", "Describe x", testSchema, &out)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, recorder.records, 2)
+	for i, cached := range []bool{false, true} {
+		assert.Equal(t, "litellm:gpt-4o-2024-08-06", recorder.records[i].Model)
+		assert.Equal(t, 40, recorder.records[i].PromptTokens)
+		assert.Equal(t, cached, recorder.records[i].Cached)
+	}
+}
+
+func TestTruncatedResponsesAreNotCached(t *testing.T) {
+	llm := &fakeLLM{responses: []func(w http.ResponseWriter){
+		answer(`{"name": "x", "status": "pass"}`, "gpt-4o", "length"),
+		answer(`{"name": "y", "status": "pass"}`, "gpt-4o", "stop"),
+		answer(`{"name": "z", "status": "pass"}`, "gpt-4o", "stop"),
+	}}
+	client := newTestClient(t, llm)
+	client.SetCache(cache.New(nil, cache.Config{TTL: time.Hour, MemoryEntries: 10}))
+
+	for _, want := range []string{"x", "y", "y"} {
+		var out testOutput
+		_, err := client.CallStructured(context.Background(), "", "test", "Describe x", testSchema, &out)
+		require.NoError(t, err)
+		assert.Equal(t, want, out.Name)
+	}
+	assert.Len(t, llm.requests, 2)
+}
@@ -210,7 +210,7 @@ func (b *SchemaBuilder) SymbolInsightJSONSchema() json.RawMessage {
 						"description": map[string]interface{}{"type": "string"},
 						"metric":      map[string]interface{}{"type": "string"},
 						"value":       map[string]interface{}{"type": "number"},
-						"status":      map[string]interface{}{"type": "string"},
+						"status":      map[string]interface{}{"type": "string", "enum": []string{"pass", "warn", "fail"}},
 					},
 					"required": []string{"category", "description"},
 				},
@@ -292,7 +292,7 @@ func (b *SchemaBuilder) StructInsightJSONSchema() json.RawMessage {
 						"description": map[string]interface{}{"type": "string"},
 						"metric":      map[string]interface{}{"type": "string"},
 						"value":       map[string]interface{}{"type": "number"},
-						"status":      map[string]interface{}{"type": "string"},
+						"status":      map[string]interface{}{"type": "string", "enum": []string{"pass", "warn", "fail"}},
 					},
 					"required": []string{"category", "description"},
 				},
@@ -368,7 +368,7 @@ func (b *SchemaBuilder) FileInsightJSONSchema() json.RawMessage {
 						"description": map[string]interface{}{"type": "string"},
 						"metric":      map[string]interface{}{"type": "string"},
 						"value":       map[string]interface{}{"type": "number"},
-						"status":      map[string]interface{}{"type": "string"},
+						"status":      map[string]interface{}{"type": "string", "enum": []string{"pass", "warn", "fail"}},
 					},
 					"required": []string{"category", "description"},
 				},
@@ -393,6 +393,88 @@ func (b *SchemaBuilder) FileInsightJSONSchema() json.RawMessage {
 	return json.RawMessage(schemaJSON)
 }
 
+// PackageInsightJSONSchema returns the JSON schema for package insights
+func (b *SchemaBuilder) PackageInsightJSONSchema() json.RawMessage {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"responsibilities": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"problem": map[string]interface{}{"type": "string"},
+					"goal":    map[string]interface{}{"type": "string"},
+					"result":  map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"problem", "goal", "result"},
+			},
+			"api": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"dependencies": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":    map[string]interface{}{"type": "string"},
+						"version": map[string]interface{}{"type": "string"},
+						"purpose": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"name", "purpose"},
+				},
+			},
+			"design_patterns": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":   map[string]interface{}{"type": "string"},
+						"reason": map[string]interface{}{"type": "string"},
+						"applies_to": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "string",
+							},
+						},
+					},
+					"required": []string{"name", "reason"},
+				},
+			},
+			"patterns": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":      map[string]interface{}{"type": "string"},
+						"rationale": map[string]interface{}{"type": "string"},
+						"example":   map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"name", "rationale"},
+				},
+			},
+			"quality": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"metric":    map[string]interface{}{"type": "string"},
+						"value":     map[string]interface{}{"type": "number"},
+						"threshold": map[string]interface{}{"type": "number"},
+						"status":    map[string]interface{}{"type": "string", "enum": []string{"pass", "warn", "fail"}},
+					},
+					"required": []string{"metric", "status"},
+				},
+			},
+		},
+		"required": []string{"responsibilities", "api", "dependencies"},
+	}
+
+	schemaJSON, _ := json.Marshal(schema)
+	return json.RawMessage(schemaJSON)
+}
+
 // RepositoryInsightJSONSchema returns the JSON schema for repository insights
 func (b *SchemaBuilder) RepositoryInsightJSONSchema() json.RawMessage {
 	schema := map[string]interface{}{
@@ -477,7 +559,7 @@ func (b *SchemaBuilder) RepositoryInsightJSONSchema() json.RawMessage {
 					"properties": map[string]interface{}{
 						"category":    map[string]interface{}{"type": "string"},
 						"description": map[string]interface{}{"type": "string"},
-						"severity":    map[string]interface{}{"type": "string"},
+						"severity":    map[string]interface{}{"type": "string", "enum": []string{"high", "medium", "low"}},
 						"metric":      map[string]interface{}{"type": "string"},
 						"value":       map[string]interface{}{"type": "number"},
 						"status":      map[string]interface{}{"type": "string"},
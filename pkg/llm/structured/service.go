@@ -1,12 +1,16 @@
 package structured
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"cred.com/hack25/backend/internal/insights"
 	"cred.com/hack25/backend/internal/models"
 	"cred.com/hack25/backend/internal/repository"
+	"cred.com/hack25/backend/pkg/llm/cache"
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"cred.com/hack25/backend/pkg/llm/resilience"
+	"cred.com/hack25/backend/pkg/llm/usage"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,15 +21,23 @@ type Service struct {
 	promptBuilder    *PromptBuilder
 	parser           *Parser
 	schemaBuilder    *SchemaBuilder
+	examples         ExampleSource
 	logger           *logrus.Entry
 }
 
+// ExampleSource provides the insights reviewers corrected in a repository, as the few-shot
+// examples of the prompts generating its insights
+type ExampleSource interface {
+	FunctionInsightExamples(repoID int64, limit int) ([]FewShotExample, error)
+}
+
 // ServiceConfig holds configuration for the Service
 type ServiceConfig struct {
 	LiteLLMBaseURL string
 	APIKey         string
 	DefaultModel   string
 	UseJSONFormat  bool
+	MaxAttempts    int // Attempts at a response conforming to the schema; DefaultMaxAttempts if 0
 }
 
 // NewService creates a new Service instance
@@ -44,6 +56,9 @@ func NewService(
 		config.DefaultModel,
 		serviceLogger,
 	)
+	if config.MaxAttempts > 0 {
+		client.maxAttempts = config.MaxAttempts
+	}
 
 	// Initialize prompt builder
 	promptBuilder := NewPromptBuilder(config.UseJSONFormat)
@@ -64,10 +79,45 @@ func NewService(
 	}
 }
 
+// SetGuard sets the guard of the requests of the service, for them to share the limits and
+// circuit of the other clients of the provider
+func (s *Service) SetGuard(guard *resilience.Guard) {
+	s.client.SetGuard(guard)
+}
+
+// SetUsageRecorder sets the recorder of the usage of the LLM calls of the service, which are
+// attributed to the repository and insight they are made for
+func (s *Service) SetUsageRecorder(recorder usage.Recorder) {
+	s.client.SetUsageRecorder(recorder)
+}
+
+// SetCache sets the cache of the responses of the LLM calls of the service
+func (s *Service) SetCache(responses *cache.Cache) {
+	s.client.SetCache(responses)
+}
+
+// SetFallbackPolicy sets the models the LLM calls of the service fall back to when they fail
+func (s *Service) SetFallbackPolicy(policy *interfaces.FallbackPolicy) {
+	s.client.SetFallbackPolicy(policy)
+}
+
+// SetExampleSource sets where the few-shot examples of the prompts generating the insights of
+// functions come from
+func (s *Service) SetExampleSource(source ExampleSource) {
+	s.examples = source
+}
+
 // GenerateFunctionInsight generates insights for a function
-func (s *Service) GenerateFunctionInsight(repoID int64, functionID int64, modelName string) (*insights.FunctionInsight, error) {
-	// Get the function details
-	functions, err := s.codeAnalyzerRepo.GetRepositoryFunctions(repoID, 0)
+func (s *Service) GenerateFunctionInsight(ctx context.Context, repoID int64, functionID int64, modelName string) (*insights.FunctionInsight, error) {
+	// Get the function details from the file declaring it, in whichever snapshot that is
+	fileID, err := s.codeAnalyzerRepo.GetFunctionFileID(functionID)
+	if err != nil {
+		return nil, err
+	}
+	if fileID == 0 {
+		return nil, ErrNotFound("function", functionID)
+	}
+	functions, err := s.codeAnalyzerRepo.GetRepositoryFunctions(repoID, fileID)
 	if err != nil {
 		return nil, err
 	}
@@ -91,22 +141,22 @@ func (s *Service) GenerateFunctionInsight(repoID int64, functionID int64, modelN
 		return nil, err
 	}
 
-	// Prepare the prompt
-	prompt := s.promptBuilder.BuildFunctionPrompt(targetFunction, functionCalls)
-
-	// Get the JSON schema for symbol insights
-	schema := s.schemaBuilder.SymbolInsightJSONSchema()
-
-	// Call the LLM with the schema
-	response, err := s.client.Call(modelName, prompt, schema)
-	if err != nil {
-		return nil, err
+	// Prepare the prompt, with the corrections of reviewers as examples. Failing to get them
+	// does not fail the insight.
+	var examples []FewShotExample
+	if s.examples != nil {
+		examples, err = s.examples.FunctionInsightExamples(repoID, MaxFewShotExamples)
+		if err != nil {
+			s.logger.WithError(err).Warn("Failed to get few-shot examples")
+		}
 	}
+	prompt := s.promptBuilder.BuildFunctionPrompt(targetFunction, functionCalls, examples)
 
-	// Parse the response into a function insight
+	// Call the LLM with the schema, decoding the response once it conforms to it
+	schema := s.schemaBuilder.FunctionInsightJSONSchema()
 	var insight insights.FunctionInsight
-	err = json.Unmarshal([]byte(response), &insight)
-	if err != nil {
+	ctx = usage.WithRepository(ctx, repoID, usage.FeatureFunctionInsight)
+	if _, err := s.client.CallStructured(ctx, modelName, "function_insight", prompt, schema, &insight); err != nil {
 		return nil, err
 	}
 
@@ -114,9 +164,16 @@ func (s *Service) GenerateFunctionInsight(repoID int64, functionID int64, modelN
 }
 
 // GenerateSymbolInsight generates insights for a symbol
-func (s *Service) GenerateSymbolInsight(repoID int64, symbolID int64, modelName string) (*insights.SymbolInsight, error) {
-	// Get the symbol details
-	symbols, err := s.codeAnalyzerRepo.GetRepositorySymbols(repoID, 0)
+func (s *Service) GenerateSymbolInsight(ctx context.Context, repoID int64, symbolID int64, modelName string) (*insights.SymbolInsight, error) {
+	// Get the symbol details from the file declaring it, in whichever snapshot that is
+	fileID, err := s.codeAnalyzerRepo.GetSymbolFileID(symbolID)
+	if err != nil {
+		return nil, err
+	}
+	if fileID == 0 {
+		return nil, ErrNotFound("symbol", symbolID)
+	}
+	symbols, err := s.codeAnalyzerRepo.GetRepositorySymbols(repoID, fileID)
 	if err != nil {
 		return nil, err
 	}
@@ -143,19 +200,11 @@ func (s *Service) GenerateSymbolInsight(repoID int64, symbolID int64, modelName
 	// Prepare the prompt
 	prompt := s.promptBuilder.BuildSymbolPrompt(targetSymbol, symbolRefs)
 
-	// Get the JSON schema for symbol insights
+	// Call the LLM with the schema, decoding the response once it conforms to it
 	schema := s.schemaBuilder.SymbolInsightJSONSchema()
-
-	// Call the LLM with the schema
-	response, err := s.client.Call(modelName, prompt, schema)
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse the response into a symbol insight
 	var insight insights.SymbolInsight
-	err = json.Unmarshal([]byte(response), &insight)
-	if err != nil {
+	ctx = usage.WithRepository(ctx, repoID, usage.FeatureSymbolInsight)
+	if _, err := s.client.CallStructured(ctx, modelName, "symbol_insight", prompt, schema, &insight); err != nil {
 		return nil, err
 	}
 
@@ -163,9 +212,16 @@ func (s *Service) GenerateSymbolInsight(repoID int64, symbolID int64, modelName
 }
 
 // GenerateStructInsight generates insights for a struct
-func (s *Service) GenerateStructInsight(repoID int64, symbolID int64, modelName string) (*insights.StructInsight, error) {
-	// Get the symbol details (structs are stored as symbols)
-	symbols, err := s.codeAnalyzerRepo.GetRepositorySymbols(repoID, 0)
+func (s *Service) GenerateStructInsight(ctx context.Context, repoID int64, symbolID int64, modelName string) (*insights.StructInsight, error) {
+	// Get the symbol details (structs are stored as symbols) from the file declaring it
+	fileID, err := s.codeAnalyzerRepo.GetSymbolFileID(symbolID)
+	if err != nil {
+		return nil, err
+	}
+	if fileID == 0 {
+		return nil, ErrNotFound("struct", symbolID)
+	}
+	symbols, err := s.codeAnalyzerRepo.GetRepositorySymbols(repoID, fileID)
 	if err != nil {
 		return nil, err
 	}
@@ -192,27 +248,19 @@ func (s *Service) GenerateStructInsight(repoID int64, symbolID int64, modelName
 	// Prepare the prompt
 	prompt := s.promptBuilder.BuildStructPrompt(targetSymbol, symbolRefs)
 
-	// Get the JSON schema for symbol insights
-	schema := s.schemaBuilder.SymbolInsightJSONSchema()
-
-	// Call the LLM with the schema
-	response, err := s.client.Call(modelName, prompt, schema)
-	if err != nil {
+	// Call the LLM with the schema, decoding the response once it conforms to it
+	schema := s.schemaBuilder.StructInsightJSONSchema()
+	var insight insights.StructInsight
+	ctx = usage.WithRepository(ctx, repoID, usage.FeatureStructInsight)
+	if _, err := s.client.CallStructured(ctx, modelName, "struct_insight", prompt, schema, &insight); err != nil {
 		return nil, err
 	}
 
-	// Parse the response into a structured insight
-	insight := &insights.StructInsight{}
-	err = json.Unmarshal([]byte(response), insight)
-	if err != nil {
-		return nil, err
-	}
-
-	return insight, nil
+	return &insight, nil
 }
 
 // GenerateFileInsight generates insights for a file
-func (s *Service) GenerateFileInsight(repoID int64, fileID int64, modelName string) (*insights.FileInsight, error) {
+func (s *Service) GenerateFileInsight(ctx context.Context, repoID int64, fileID int64, modelName string) (*insights.FileInsight, error) {
 	// Get repository information
 	repo, err := s.codeAnalyzerRepo.GetRepositoryByID(repoID)
 	if err != nil {
@@ -244,19 +292,11 @@ func (s *Service) GenerateFileInsight(repoID int64, fileID int64, modelName stri
 	// Prepare the prompt
 	prompt := s.promptBuilder.BuildFilePrompt(repo, file, functions, symbols)
 
-	// Get the JSON schema for symbol insights
-	schema := s.schemaBuilder.SymbolInsightJSONSchema()
-
-	// Call the LLM with the schema
-	response, err := s.client.Call(modelName, prompt, schema)
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse the response into a file insight
+	// Call the LLM with the schema, decoding the response once it conforms to it
+	schema := s.schemaBuilder.FileInsightJSONSchema()
 	var insight insights.FileInsight
-	err = json.Unmarshal([]byte(response), &insight)
-	if err != nil {
+	ctx = usage.WithRepository(ctx, repoID, usage.FeatureFileInsight)
+	if _, err := s.client.CallStructured(ctx, modelName, "file_insight", prompt, schema, &insight); err != nil {
 		return nil, err
 	}
 
@@ -264,7 +304,7 @@ func (s *Service) GenerateFileInsight(repoID int64, fileID int64, modelName stri
 }
 
 // GenerateRepositoryInsight generates insights for an entire repository
-func (s *Service) GenerateRepositoryInsight(repoID int64, modelName string) (*insights.RepositoryInsight, error) {
+func (s *Service) GenerateRepositoryInsight(ctx context.Context, repoID int64, modelName string) (*insights.RepositoryInsight, error) {
 	// Get repository information
 	repo, err := s.codeAnalyzerRepo.GetRepositoryByID(repoID)
 	if err != nil {
@@ -292,25 +332,72 @@ func (s *Service) GenerateRepositoryInsight(repoID int64, modelName string) (*in
 	// Prepare the prompt
 	prompt := s.promptBuilder.BuildRepositoryPrompt(repo, files, functions, symbols)
 
-	// Get the JSON schema for symbol insights
-	schema := s.schemaBuilder.SymbolInsightJSONSchema()
-
-	// Call the LLM with the schema
-	response, err := s.client.Call(modelName, prompt, schema)
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse the response into a repository insight
+	// Call the LLM with the schema, decoding the response once it conforms to it
+	schema := s.schemaBuilder.RepositoryInsightJSONSchema()
 	var insight insights.RepositoryInsight
-	err = json.Unmarshal([]byte(response), &insight)
-	if err != nil {
+	ctx = usage.WithRepository(ctx, repoID, usage.FeatureRepositoryInsight)
+	if _, err := s.client.CallStructured(ctx, modelName, "repository_insight", prompt, schema, &insight); err != nil {
 		return nil, err
 	}
 
 	return &insight, nil
 }
 
+// SummarizeFile generates the insight of a file from the insights of its functions and structs,
+// given as parts, rather than from its code. Parts that do not fit in the model together are
+// summarized in chunks sized to its maximum number of tokens.
+func (s *Service) SummarizeFile(ctx context.Context, repo *models.Repository, file *models.RepositoryFile, parts []string, modelName string) (*insights.FileInsight, error) {
+	schema := s.schemaBuilder.FileInsightJSONSchema()
+	ctx = usage.WithRepository(ctx, repo.ID, usage.FeatureFileInsight)
+	return mapReduce(ctx, parts, s.chunkTokens(modelName), func(ctx context.Context, parts []string) (*insights.FileInsight, error) {
+		var insight insights.FileInsight
+		prompt := s.promptBuilder.BuildFileSummaryPrompt(repo, file, parts)
+		if _, err := s.client.CallStructured(ctx, modelName, "file_insight", prompt, schema, &insight); err != nil {
+			return nil, err
+		}
+		return &insight, nil
+	})
+}
+
+// SummarizePackage generates the insight of a package from the insights of its files, given
+// as parts, in chunks sized to the model if they do not fit in it together
+func (s *Service) SummarizePackage(ctx context.Context, repo *models.Repository, pkgPath string, parts []string, modelName string) (*insights.PackageInsight, error) {
+	schema := s.schemaBuilder.PackageInsightJSONSchema()
+	ctx = usage.WithRepository(ctx, repo.ID, usage.FeaturePackageInsight)
+	return mapReduce(ctx, parts, s.chunkTokens(modelName), func(ctx context.Context, parts []string) (*insights.PackageInsight, error) {
+		var insight insights.PackageInsight
+		prompt := s.promptBuilder.BuildPackageSummaryPrompt(repo, pkgPath, parts)
+		if _, err := s.client.CallStructured(ctx, modelName, "package_insight", prompt, schema, &insight); err != nil {
+			return nil, err
+		}
+		return &insight, nil
+	})
+}
+
+// SummarizeRepository generates the insight of a repository from the insights of its
+// packages, given as parts, in chunks sized to the model if they do not fit in it together
+func (s *Service) SummarizeRepository(ctx context.Context, repo *models.Repository, parts []string, modelName string) (*insights.RepositoryInsight, error) {
+	schema := s.schemaBuilder.RepositoryInsightJSONSchema()
+	ctx = usage.WithRepository(ctx, repo.ID, usage.FeatureRepositoryInsight)
+	return mapReduce(ctx, parts, s.chunkTokens(modelName), func(ctx context.Context, parts []string) (*insights.RepositoryInsight, error) {
+		var insight insights.RepositoryInsight
+		prompt := s.promptBuilder.BuildRepositorySummaryPrompt(repo, parts)
+		if _, err := s.client.CallStructured(ctx, modelName, "repository_insight", prompt, schema, &insight); err != nil {
+			return nil, err
+		}
+		return &insight, nil
+	})
+}
+
+// chunkTokens returns the tokens of the chunks insights are summarized in with a model, the
+// default model of the client if none is given
+func (s *Service) chunkTokens(modelName string) int {
+	if modelName == "" {
+		modelName = s.client.defaultModel
+	}
+	return ModelTokens(modelName)
+}
+
 // ErrNotFound returns a formatted error for when a resource is not found
 func ErrNotFound(resourceType string, id int64) error {
 	return fmt.Errorf("%s with ID %d not found", resourceType, id)
@@ -1,6 +1,7 @@
 package structured
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -115,7 +116,7 @@ func TestGenerateFunctionInsight_RealAPI(t *testing.T) {
 
 	// Call the method being tested
 	t.Log("Calling GenerateFunctionInsight with real database and API...")
-	insight, err := service.GenerateFunctionInsight(repoID, functionID, modelName)
+	insight, err := service.GenerateFunctionInsight(context.Background(), repoID, functionID, modelName)
 
 	// Assert results
 	require.NoError(t, err, "GenerateFunctionInsight should not return an error")
@@ -0,0 +1,194 @@
+package structured
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidationError is a way a response does not conform to its schema
+type ValidationError struct {
+	Path    string // Location in the response, such as $.params[0].name
+	Message string
+}
+
+// String describes the error along with where it is
+func (e ValidationError) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// schemaNode is the part of JSON Schema the schemas of SchemaBuilder use
+type schemaNode struct {
+	Type       json.RawMessage        `json:"type"` // A type name or a list of them
+	Properties map[string]*schemaNode `json:"properties"`
+	Required   []string               `json:"required"`
+	Items      *schemaNode            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+}
+
+// types gets the types the node allows, none if any type is
+func (n *schemaNode) types() []string {
+	if len(n.Type) == 0 {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(n.Type, &name); err == nil {
+		return []string{name}
+	}
+	var names []string
+	_ = json.Unmarshal(n.Type, &names)
+	return names
+}
+
+// ValidateJSON validates a JSON document against a schema, checking the types of values,
+// required properties and enums. Properties the schema does not describe are allowed.
+func ValidateJSON(schema json.RawMessage, data []byte) ([]ValidationError, error) {
+	var root schemaNode
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []ValidationError{{Path: "$", Message: "invalid JSON: " + err.Error()}}, nil
+	}
+
+	var errs []ValidationError
+	validateValue(&root, value, "$", &errs)
+	return errs, nil
+}
+
+// validateValue validates a decoded value against a schema node
+func validateValue(node *schemaNode, value interface{}, path string, errs *[]ValidationError) {
+	if types := node.types(); len(types) > 0 && !matchesType(value, types) {
+		*errs = append(*errs, ValidationError{
+			Path:    path,
+			Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), jsonType(value)),
+		})
+		return
+	}
+
+	if len(node.Enum) > 0 && !inEnum(value, node.Enum) {
+		allowed := make([]string, len(node.Enum))
+		for i, v := range node.Enum {
+			b, _ := json.Marshal(v)
+			allowed[i] = string(b)
+		}
+		got, _ := json.Marshal(value)
+		*errs = append(*errs, ValidationError{
+			Path:    path,
+			Message: fmt.Sprintf("%s is not one of %s", got, strings.Join(allowed, ", ")),
+		})
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range node.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("missing required property %q", name)})
+			}
+		}
+		// Properties are checked in order, for the errors to come out the same every time
+		names := make([]string, 0, len(node.Properties))
+		for name := range node.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := v[name]; ok {
+				validateValue(node.Properties[name], property, path+"."+name, errs)
+			}
+		}
+
+	case []interface{}:
+		if node.Items != nil {
+			for i, item := range v {
+				validateValue(node.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	}
+}
+
+// matchesType checks whether a decoded value is of one of the JSON Schema types
+func matchesType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, ok := value.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case jsonType(value):
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType gets the JSON Schema type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// inEnum checks whether a decoded value is one of the values of an enum
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, v := range enum {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractJSON extracts the JSON object from a response, which models sometimes wrap in a
+// markdown code block or surround with prose. The response is returned as is when it holds
+// no complete object, for the validation to report why.
+func extractJSON(response string) string {
+	trimmed := strings.TrimSpace(response)
+	if json.Valid([]byte(trimmed)) {
+		return trimmed
+	}
+
+	start := strings.Index(trimmed, "{")
+	if start < 0 {
+		return trimmed
+	}
+
+	// Find the brace closing the first one, skipping those in strings
+	depth, inString, escaped := 0, false, false
+	for i := start; i < len(trimmed); i++ {
+		c := trimmed[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return trimmed[start : i+1]
+			}
+		}
+	}
+	return trimmed[start:]
+}
@@ -0,0 +1,118 @@
+package usage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+)
+
+// Client is an LLM client whose calls are recorded, attributed as their context says
+type Client struct {
+	client   interfaces.LLMClient
+	provider string
+	recorder Recorder
+}
+
+// NewClient wraps an LLM client of a provider, recording the usage of its calls
+func NewClient(client interfaces.LLMClient, provider string, recorder Recorder) *Client {
+	return &Client{
+		client:   client,
+		provider: provider,
+		recorder: recorder,
+	}
+}
+
+// Completion implements the Completion method of the LLMClient interface
+func (c *Client) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	resp, err := c.client.Completion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	record := c.record(ctx, reportedModel(resp.ModelName, req.Model.Name))
+	if resp.TokenUsage != nil {
+		record.PromptTokens = resp.TokenUsage.PromptTokens
+		record.CompletionTokens = resp.TokenUsage.CompletionTokens
+	} else {
+		record.PromptTokens = promptTokens(req.Messages)
+		record.CompletionTokens = EstimateTokens(resp.Text)
+		record.Estimated = true
+	}
+	c.recordUsage(ctx, record)
+	return resp, nil
+}
+
+// StreamCompletion implements the StreamCompletion method of the LLMClient interface.
+// Streams do not report their tokens, which are estimated from what was streamed, even if
+// the stream failed part way.
+func (c *Client) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	var completion strings.Builder
+	err := c.client.StreamCompletion(ctx, req, func(chunk string) error {
+		completion.WriteString(chunk)
+		return callback(chunk)
+	})
+	if completion.Len() > 0 || err == nil {
+		record := c.record(ctx, req.Model.Name)
+		record.PromptTokens = promptTokens(req.Messages)
+		record.CompletionTokens = EstimateTokens(completion.String())
+		record.Estimated = true
+		c.recordUsage(ctx, record)
+	}
+	return err
+}
+
+// Embedding implements the Embedding method of the LLMClient interface
+func (c *Client) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	resp, err := c.client.Embedding(ctx, text, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	record := c.record(ctx, reportedModel(resp.ModelName, modelName))
+	if record.Feature == "" {
+		record.Feature = FeatureEmbedding
+	}
+	if resp.TokenUsage != nil {
+		record.PromptTokens = resp.TokenUsage.PromptTokens
+	} else {
+		record.PromptTokens = EstimateTokens(text)
+		record.Estimated = true
+	}
+	c.recordUsage(ctx, record)
+	return resp, nil
+}
+
+// recordUsage records the usage of a call, counting its tokens with the meter of its context
+func (c *Client) recordUsage(ctx context.Context, record Record) {
+	CountTokens(ctx, record)
+	c.recorder.RecordUsage(ctx, record)
+}
+
+// record starts the record of a call to a model of the provider
+func (c *Client) record(ctx context.Context, model string) Record {
+	return Record{
+		Attribution: FromContext(ctx),
+		Model:       c.provider + ":" + model,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// reportedModel returns the model a provider reports having served a call with, such as a
+// dated version of the model requested, or the requested model if it reports none
+func reportedModel(reported, requested string) string {
+	if reported != "" {
+		return reported
+	}
+	return requested
+}
+
+// promptTokens estimates the tokens of the messages of a prompt
+func promptTokens(messages []interfaces.Message) int {
+	tokens := 0
+	for _, m := range messages {
+		tokens += EstimateTokens(m.Content)
+	}
+	return tokens
+}
@@ -0,0 +1,74 @@
+package usage
+
+import "strings"
+
+// Price is what a model charges, in US dollars per million tokens
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PriceTable is the price of each model, keyed by the model name with or without its
+// provider. Names with a provider take precedence, so the same model may be priced
+// differently through a proxy.
+type PriceTable map[string]Price
+
+// DefaultPrices returns the list prices of the models commonly used
+func DefaultPrices() PriceTable {
+	return PriceTable{
+		"gpt-3.5-turbo":          {Prompt: 0.5, Completion: 1.5},
+		"gpt-4":                  {Prompt: 30, Completion: 60},
+		"gpt-4-turbo":            {Prompt: 10, Completion: 30},
+		"gpt-4o":                 {Prompt: 2.5, Completion: 10},
+		"gpt-4o-mini":            {Prompt: 0.15, Completion: 0.6},
+		"gpt-4.1":                {Prompt: 2, Completion: 8},
+		"gpt-4.1-mini":           {Prompt: 0.4, Completion: 1.6},
+		"text-embedding-ada-002": {Prompt: 0.1},
+		"claude-3-haiku":         {Prompt: 0.25, Completion: 1.25},
+		"claude-3-5-haiku":       {Prompt: 0.8, Completion: 4},
+		"claude-3-opus":          {Prompt: 15, Completion: 75},
+		"claude-3-5-sonnet":      {Prompt: 3, Completion: 15},
+		"claude-3-7-sonnet":      {Prompt: 3, Completion: 15},
+		"sonnet-3.5":             {Prompt: 3, Completion: 15},
+		"gemini-pro":             {Prompt: 0.5, Completion: 1.5},
+		"gemini-1.5-pro":         {Prompt: 1.25, Completion: 5},
+		"gemini-1.5-flash":       {Prompt: 0.075, Completion: 0.3},
+		"gemini-2.0-flash":       {Prompt: 0.1, Completion: 0.4},
+	}
+}
+
+// Lookup returns the price of a model, named with or without its provider. Versions of a
+// priced model, such as gpt-4o-2024-08-06, cost what the model does.
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	name := model
+	if _, bare, ok := strings.Cut(model, ":"); ok {
+		name = bare
+	}
+	if price, ok := t[name]; ok {
+		return price, true
+	}
+
+	// The longest priced name the model name starts with
+	var best string
+	for priced := range t {
+		if strings.HasPrefix(name, priced+"-") && len(priced) > len(best) {
+			best = priced
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t[best], true
+}
+
+// Cost returns what a call to a model cost in US dollars, 0 if the model is not priced
+func (t PriceTable) Cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := t.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
@@ -0,0 +1,119 @@
+// Package usage accounts for the tokens used by LLM calls and what they cost, attributing
+// each call to the user, repository and feature it was made for.
+package usage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Features LLM calls are made for
+const (
+	FeatureChat              = "chat"
+	FeatureEmbedding         = "embedding"
+	FeatureFileAnalysis      = "file_analysis" // Workflow analysis of the files of a repository
+	FeatureFunctionInsight   = "function_insight"
+	FeatureSymbolInsight     = "symbol_insight"
+	FeatureStructInsight     = "struct_insight"
+	FeatureFileInsight       = "file_insight"
+	FeaturePackageInsight    = "package_insight"
+	FeatureRepositoryInsight = "repository_insight"
+)
+
+// Attribution is who and what an LLM call is made for. Any of its fields may be unknown.
+type Attribution struct {
+	UserID       string
+	RepositoryID int64
+	Feature      string
+}
+
+// Record is the usage of an LLM call
+type Record struct {
+	Attribution
+	Model            string // Along with its provider, such as openai:gpt-4o
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool // The provider did not report the tokens, which were estimated
+	Cached           bool // Answered from the cache, with the tokens the cached response used
+	CreatedAt        time.Time
+}
+
+// Recorder stores the usage of LLM calls. Failing to store it must not fail the call.
+type Recorder interface {
+	RecordUsage(ctx context.Context, record Record)
+}
+
+type attributionKey struct{}
+
+// WithAttribution returns a context whose LLM calls are attributed as given
+func WithAttribution(ctx context.Context, attribution Attribution) context.Context {
+	return context.WithValue(ctx, attributionKey{}, attribution)
+}
+
+// WithFeature returns a context whose LLM calls are made for a feature, keeping the user
+// and repository they are attributed to
+func WithFeature(ctx context.Context, feature string) context.Context {
+	attribution := FromContext(ctx)
+	attribution.Feature = feature
+	return WithAttribution(ctx, attribution)
+}
+
+// WithRepository returns a context whose LLM calls are made for a repository and feature,
+// keeping the user they are attributed to
+func WithRepository(ctx context.Context, repoID int64, feature string) context.Context {
+	attribution := FromContext(ctx)
+	attribution.RepositoryID = repoID
+	attribution.Feature = feature
+	return WithAttribution(ctx, attribution)
+}
+
+// FromContext returns what the LLM calls made with a context are attributed to
+func FromContext(ctx context.Context) Attribution {
+	attribution, _ := ctx.Value(attributionKey{}).(Attribution)
+	return attribution
+}
+
+// EstimateTokens roughly estimates the tokens of a text, at four characters per token
+func EstimateTokens(text string) int {
+	return len(text) / 4
+}
+
+// Meter counts the tokens of the LLM calls made with a context, for jobs to know what they
+// used so far. Responses answered from the cache cost nothing and are not counted.
+type Meter struct {
+	tokens atomic.Int64
+}
+
+// Add counts the tokens of a call
+func (m *Meter) Add(record Record) {
+	if record.Cached {
+		return
+	}
+	m.tokens.Add(int64(record.PromptTokens + record.CompletionTokens))
+}
+
+// Tokens returns the tokens counted so far
+func (m *Meter) Tokens() int {
+	return int(m.tokens.Load())
+}
+
+type meterKey struct{}
+
+// WithMeter returns a context whose LLM calls are counted by a meter
+func WithMeter(ctx context.Context, meter *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, meter)
+}
+
+// MeterFromContext returns the meter counting the LLM calls made with a context, or nil
+func MeterFromContext(ctx context.Context) *Meter {
+	meter, _ := ctx.Value(meterKey{}).(*Meter)
+	return meter
+}
+
+// CountTokens counts the tokens of a call with the meter of its context, if it has one
+func CountTokens(ctx context.Context, record Record) {
+	if meter := MeterFromContext(ctx); meter != nil {
+		meter.Add(record)
+	}
+}
@@ -0,0 +1,216 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cred.com/hack25/backend/pkg/llm/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRecorder keeps the records of the usage of calls
+type memoryRecorder struct {
+	records []Record
+}
+
+func (r *memoryRecorder) RecordUsage(ctx context.Context, record Record) {
+	r.records = append(r.records, record)
+}
+
+// fakeClient answers every call with canned responses
+type fakeClient struct {
+	completion *interfaces.CompletionResponse
+	chunks     []string
+	err        error
+}
+
+func (f *fakeClient) Completion(ctx context.Context, req interfaces.CompletionRequest) (*interfaces.CompletionResponse, error) {
+	return f.completion, f.err
+}
+
+func (f *fakeClient) StreamCompletion(ctx context.Context, req interfaces.CompletionRequest, callback func(chunk string) error) error {
+	for _, chunk := range f.chunks {
+		if err := callback(chunk); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+func (f *fakeClient) Embedding(ctx context.Context, text string, modelName string) (*interfaces.EmbeddingResponse, error) {
+	return &interfaces.EmbeddingResponse{ModelName: modelName}, f.err
+}
+
+func request(prompt string) interfaces.CompletionRequest {
+	return interfaces.CompletionRequest{
+		Model:    interfaces.Model{Name: "gpt-4o", Provider: "openai"},
+		Messages: []interfaces.Message{{Role: "user", Content: prompt}},
+	}
+}
+
+func TestPriceTableLookup(t *testing.T) {
+	prices := PriceTable{
+		"gpt-4o":         {Prompt: 2.5, Completion: 10},
+		"gpt-4o-mini":    {Prompt: 0.15, Completion: 0.6},
+		"litellm:gpt-4o": {Prompt: 3, Completion: 12},
+	}
+
+	tests := []struct {
+		model string
+		price Price
+		found bool
+	}{
+		{"gpt-4o", Price{Prompt: 2.5, Completion: 10}, true},
+		{"openai:gpt-4o", Price{Prompt: 2.5, Completion: 10}, true},
+		{"litellm:gpt-4o", Price{Prompt: 3, Completion: 12}, true},
+		{"openai:gpt-4o-2024-08-06", Price{Prompt: 2.5, Completion: 10}, true},
+		{"openai:gpt-4o-mini-2024-07-18", Price{Prompt: 0.15, Completion: 0.6}, true},
+		{"openai:gpt-4", Price{}, false},
+		{"gpt-4oo", Price{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, found := prices.Lookup(tt.model)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.price, price)
+		})
+	}
+}
+
+func TestPriceTableCost(t *testing.T) {
+	prices := PriceTable{"gpt-4o": {Prompt: 2.5, Completion: 10}}
+
+	assert.InDelta(t, 0.0125, prices.Cost("openai:gpt-4o", 1000, 1000), 1e-9)
+	assert.Zero(t, prices.Cost("unknown", 1000, 1000))
+}
+
+func TestAttributionFromContext(t *testing.T) {
+	ctx := WithAttribution(context.Background(), Attribution{UserID: "user-1", Feature: FeatureChat})
+	ctx = WithRepository(ctx, 42, FeatureFunctionInsight)
+
+	assert.Equal(t, Attribution{UserID: "user-1", RepositoryID: 42, Feature: FeatureFunctionInsight}, FromContext(ctx))
+	assert.Equal(t, Attribution{UserID: "user-1", RepositoryID: 42, Feature: FeatureFileAnalysis},
+		FromContext(WithFeature(ctx, FeatureFileAnalysis)))
+	assert.Equal(t, Attribution{}, FromContext(context.Background()))
+}
+
+func TestMeterCountsUncachedTokens(t *testing.T) {
+	meter := &Meter{}
+	ctx := WithMeter(context.Background(), meter)
+
+	CountTokens(ctx, Record{PromptTokens: 100, CompletionTokens: 20})
+	CountTokens(ctx, Record{PromptTokens: 50, CompletionTokens: 10, Cached: true})
+	CountTokens(context.Background(), Record{PromptTokens: 7})
+
+	assert.Equal(t, 120, meter.Tokens())
+	assert.Same(t, meter, MeterFromContext(ctx))
+	assert.Nil(t, MeterFromContext(context.Background()))
+}
+
+func TestClientCountsTokensWithMeter(t *testing.T) {
+	meter := &Meter{}
+	client := NewClient(&fakeClient{completion: &interfaces.CompletionResponse{
+		Text:       "hello",
+		TokenUsage: &interfaces.TokenUsage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150},
+	}}, "openai", &memoryRecorder{})
+
+	_, err := client.Completion(WithMeter(context.Background(), meter), request("hi"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 150, meter.Tokens())
+}
+
+func TestClientRecordsReportedTokens(t *testing.T) {
+	recorder := &memoryRecorder{}
+	client := NewClient(&fakeClient{completion: &interfaces.CompletionResponse{
+		Text:       "hello",
+		TokenUsage: &interfaces.TokenUsage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150},
+	}}, "openai", recorder)
+
+	ctx := WithAttribution(context.Background(), Attribution{UserID: "user-1", RepositoryID: 7, Feature: FeatureChat})
+	_, err := client.Completion(ctx, request("hi"))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.records, 1)
+	record := recorder.records[0]
+	assert.Equal(t, Attribution{UserID: "user-1", RepositoryID: 7, Feature: FeatureChat}, record.Attribution)
+	assert.Equal(t, "openai:gpt-4o", record.Model)
+	assert.Equal(t, 120, record.PromptTokens)
+	assert.Equal(t, 30, record.CompletionTokens)
+	assert.False(t, record.Estimated)
+}
+
+func TestClientEstimatesUnreportedTokens(t *testing.T) {
+	recorder := &memoryRecorder{}
+	client := NewClient(&fakeClient{completion: &interfaces.CompletionResponse{Text: "12345678"}}, "openai", recorder)
+
+	_, err := client.Completion(context.Background(), request("1234567890123456"))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.records, 1)
+	assert.Equal(t, 4, recorder.records[0].PromptTokens)
+	assert.Equal(t, 2, recorder.records[0].CompletionTokens)
+	assert.True(t, recorder.records[0].Estimated)
+}
+
+func TestClientDoesNotRecordFailedCalls(t *testing.T) {
+	recorder := &memoryRecorder{}
+	client := NewClient(&fakeClient{err: errors.New("unavailable")}, "openai", recorder)
+
+	_, err := client.Completion(context.Background(), request("hi"))
+	assert.Error(t, err)
+	_, err = client.Embedding(context.Background(), "hi", "text-embedding-ada-002")
+	assert.Error(t, err)
+	err = client.StreamCompletion(context.Background(), request("hi"), func(string) error { return nil })
+	assert.Error(t, err)
+
+	assert.Empty(t, recorder.records)
+}
+
+func TestClientRecordsStreamedCompletion(t *testing.T) {
+	recorder := &memoryRecorder{}
+	client := NewClient(&fakeClient{chunks: []string{"1234", "5678"}}, "openai", recorder)
+
+	var streamed string
+	err := client.StreamCompletion(context.Background(), request("12345678"), func(chunk string) error {
+		streamed += chunk
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "12345678", streamed)
+	require.Len(t, recorder.records, 1)
+	assert.Equal(t, 2, recorder.records[0].PromptTokens)
+	assert.Equal(t, 2, recorder.records[0].CompletionTokens)
+	assert.True(t, recorder.records[0].Estimated)
+}
+
+func TestClientAttributesEmbeddings(t *testing.T) {
+	recorder := &memoryRecorder{}
+	client := NewClient(&fakeClient{}, "openai", recorder)
+
+	_, err := client.Embedding(WithAttribution(context.Background(), Attribution{UserID: "user-1"}), "12345678", "text-embedding-ada-002")
+	require.NoError(t, err)
+
+	require.Len(t, recorder.records, 1)
+	assert.Equal(t, FeatureEmbedding, recorder.records[0].Feature)
+	assert.Equal(t, "user-1", recorder.records[0].UserID)
+	assert.Equal(t, "openai:text-embedding-ada-002", recorder.records[0].Model)
+}
+
+func TestClientRecordsReportedModel(t *testing.T) {
+	recorder := &memoryRecorder{}
+	client := NewClient(&fakeClient{completion: &interfaces.CompletionResponse{
+		Text:       "hello",
+		TokenUsage: &interfaces.TokenUsage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+		ModelName:  "gpt-4o-mini-2024-07-18",
+	}}, "openai", recorder)
+
+	_, err := client.Completion(context.Background(), request("hi"))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.records, 1)
+	assert.Equal(t, "openai:gpt-4o-mini-2024-07-18", recorder.records[0].Model, "usage is recorded under the model that served the call")
+}
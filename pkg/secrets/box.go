@@ -0,0 +1,68 @@
+// Package secrets encrypts secrets stored at rest with AES-256-GCM.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of encryption keys, in bytes
+const KeySize = 32
+
+// ErrDecrypt is returned when a secret cannot be decrypted, because it was encrypted with
+// another key, for another record, or was tampered with
+var ErrDecrypt = errors.New("unable to decrypt secret")
+
+// Box encrypts and decrypts secrets with a key
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox creates a box for a base64-encoded 32-byte key
+func NewBox(encodedKey string) (*Box, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts a secret, bound to associated data such as the identity of the record it is
+// stored in: it only decrypts with the same associated data. The random nonce is prepended
+// to the ciphertext.
+func (b *Box) Seal(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// Open decrypts a secret sealed with the same key and associated data
+func (b *Box) Open(sealed, associatedData []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
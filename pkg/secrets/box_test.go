@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, KeySize)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestBoxSealOpen(t *testing.T) {
+	box, err := NewBox(newKey(t))
+	if err != nil {
+		t.Fatalf("NewBox failed: %v", err)
+	}
+
+	sealed, err := box.Seal([]byte("ghp_secret"), []byte("user:42"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("ghp_secret")) {
+		t.Error("Expected the secret to be encrypted")
+	}
+
+	plaintext, err := box.Open(sealed, []byte("user:42"))
+	if err != nil || string(plaintext) != "ghp_secret" {
+		t.Errorf("Expected the secret back, got %q, %v", plaintext, err)
+	}
+
+	if _, err := box.Open(sealed, []byte("user:43")); err != ErrDecrypt {
+		t.Errorf("Expected other associated data to fail, got %v", err)
+	}
+	other, _ := NewBox(newKey(t))
+	if _, err := other.Open(sealed, []byte("user:42")); err != ErrDecrypt {
+		t.Errorf("Expected another key to fail, got %v", err)
+	}
+}
+
+func TestNewBoxRejectsInvalidKeys(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := NewBox(key); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+}
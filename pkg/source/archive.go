@@ -0,0 +1,266 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits on what an archive may extract to, guarding against decompression bombs
+const (
+	maxExtractedBytes   = 1 << 30
+	maxExtractedEntries = 100000
+)
+
+// ErrUnsupportedArchive is returned for archives that are neither .tar.gz nor .zip
+var ErrUnsupportedArchive = errors.New("unsupported archive format, expected .tar.gz or .zip")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// ArchiveProvider extracts uploaded .tar.gz and .zip archives. Uploads are stored by name in
+// its directory, and their sources have an archive://name URL.
+type ArchiveProvider struct {
+	dir string
+}
+
+// NewArchiveProvider creates an archive provider for the uploads stored in dir
+func NewArchiveProvider(dir string) *ArchiveProvider {
+	return &ArchiveProvider{dir: dir}
+}
+
+// ArchivePath is where the upload of a name is stored in an uploads directory
+func ArchivePath(dir, name string) string {
+	return filepath.Join(dir, name+".archive")
+}
+
+// StoreArchive stores an uploaded archive under a name in an uploads directory, replacing
+// the previous upload of that name once the new one is complete
+func StoreArchive(dir, name string, r io.Reader) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid archive name %q", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating uploads directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating upload file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	header := make([]byte, len(zipMagic))
+	n, _ := io.ReadFull(r, header)
+	header = header[:n]
+	if !bytes.HasPrefix(header, gzipMagic) && !bytes.HasPrefix(header, zipMagic) {
+		tmp.Close()
+		return ErrUnsupportedArchive
+	}
+	if _, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(header), r)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error storing upload: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error storing upload: %w", err)
+	}
+	return os.Rename(tmp.Name(), ArchivePath(dir, name))
+}
+
+// Fetch extracts the uploaded archive of the source into dir. Its revision is derived from
+// the archive's SHA-256, so uploading the same archive again finds nothing to re-index.
+func (p *ArchiveProvider) Fetch(ctx context.Context, src Source, dir string) (*Tree, error) {
+	if src.Ref != "" {
+		return nil, fmt.Errorf("archives have no refs to check out")
+	}
+	name := strings.TrimPrefix(src.URL, ArchiveScheme)
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid archive name %q", name)
+	}
+
+	f, err := os.Open(ArchivePath(p.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+
+	if err := resetDir(dir); err != nil {
+		return nil, err
+	}
+	if err := extractArchive(ctx, f, dir); err != nil {
+		return nil, err
+	}
+	return &Tree{Path: treeRoot(dir), Commit: hex.EncodeToString(hash.Sum(nil))[:40]}, nil
+}
+
+// extractArchive extracts a .tar.gz or .zip archive, telling them apart by their content
+func extractArchive(ctx context.Context, f *os.File, dir string) error {
+	header := make([]byte, len(zipMagic))
+	n, _ := io.ReadFull(f, header)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading archive: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header[:n], gzipMagic):
+		return extractTarGz(ctx, f, dir)
+	case bytes.HasPrefix(header[:n], zipMagic):
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("error reading archive: %w", err)
+		}
+		return extractZip(ctx, f, info.Size(), dir)
+	}
+	return ErrUnsupportedArchive
+}
+
+// extractTarGz extracts the directories and regular files of a .tar.gz stream into dir
+func extractTarGz(ctx context.Context, r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error reading gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	x := &extractor{dir: dir}
+	tr := tar.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar archive: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(header.Name)
+		case tar.TypeReg:
+			err = x.file(header.Name, tr)
+		default:
+			// Links and special files are skipped, as they could point outside of dir
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip extracts the directories and regular files of a .zip archive into dir
+func extractZip(ctx context.Context, r io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("error reading zip archive: %w", err)
+	}
+
+	x := &extractor{dir: dir}
+	for _, zf := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(zf.Name)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			if rc, err = zf.Open(); err == nil {
+				err = x.file(zf.Name, rc)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractor writes archive entries under a directory, rejecting entries that would land
+// outside of it and archives that extract to too much
+type extractor struct {
+	dir     string
+	written int64
+	entries int
+}
+
+// path gets where an entry is extracted to
+func (x *extractor) path(name string) (string, error) {
+	x.entries++
+	if x.entries > maxExtractedEntries {
+		return "", fmt.Errorf("archive has more than %d entries", maxExtractedEntries)
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q is outside of the archive", name)
+	}
+	return filepath.Join(x.dir, clean), nil
+}
+
+func (x *extractor) mkdir(name string) error {
+	path, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+func (x *extractor) file(name string, r io.Reader) error {
+	path, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, maxExtractedBytes-x.written+1))
+	x.written += n
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error extracting %s: %w", name, err)
+	}
+	if x.written > maxExtractedBytes {
+		return fmt.Errorf("archive extracts to more than %d bytes", int64(maxExtractedBytes))
+	}
+	return nil
+}
+
+// treeRoot gets the root of an extracted tree: archives commonly hold a single top-level
+// directory, like the name-commit directory of GitLab and Bitbucket archives, which is skipped
+func treeRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name())
+	}
+	return dir
+}
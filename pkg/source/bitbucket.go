@@ -0,0 +1,101 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultBitbucketAPIURL is the Bitbucket Cloud REST API
+const DefaultBitbucketAPIURL = "https://api.bitbucket.org/2.0"
+
+// BitbucketProvider downloads repositories through the Bitbucket Cloud REST API. Only the
+// workspace and name are taken from repository URLs: requests, and so credentials, only go
+// to the configured API and its website.
+type BitbucketProvider struct {
+	apiURL     string
+	webURL     string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewBitbucketProvider creates a Bitbucket provider for the API at apiURL, the Bitbucket
+// Cloud API when empty, authenticating with a username and app password when given
+func NewBitbucketProvider(apiURL, username, password string) *BitbucketProvider {
+	webURL := "https://bitbucket.org"
+	if apiURL == "" {
+		apiURL = DefaultBitbucketAPIURL
+	} else if u, err := url.Parse(apiURL); err == nil && apiURL != DefaultBitbucketAPIURL {
+		webURL = u.Scheme + "://" + u.Host
+	}
+	return &BitbucketProvider{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		webURL:     webURL,
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{},
+	}
+}
+
+// Fetch resolves the ref of the repository to a commit and extracts the archive of that
+// commit into dir
+func (p *BitbucketProvider) Fetch(ctx context.Context, src Source, dir string) (*Tree, error) {
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bitbucket URL: %w", err)
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid Bitbucket URL %q", src.URL)
+	}
+	workspace, slug := url.PathEscape(parts[0]), url.PathEscape(parts[1])
+	repoURL := p.apiURL + "/repositories/" + workspace + "/" + slug
+
+	username, password, token := p.username, p.password, ""
+	if c := src.Credentials; c != nil {
+		username, password, token = c.Username, c.Password, c.Token
+	}
+	api := apiRequest{client: p.httpClient, auth: func(req *http.Request) {
+		switch {
+		case token != "":
+			req.Header.Set("Authorization", "Bearer "+token)
+		case username != "":
+			req.SetBasicAuth(username, password)
+		}
+	}}
+
+	ref := src.Ref
+	if ref == "" {
+		var repo struct {
+			MainBranch struct {
+				Name string `json:"name"`
+			} `json:"mainbranch"`
+		}
+		if err := api.getJSON(ctx, repoURL, &repo); err != nil {
+			return nil, fmt.Errorf("error getting Bitbucket repository: %w", err)
+		}
+		if repo.MainBranch.Name == "" {
+			return nil, fmt.Errorf("Bitbucket repository %s/%s has no main branch", parts[0], parts[1])
+		}
+		ref = repo.MainBranch.Name
+	}
+
+	var commit struct {
+		Hash string `json:"hash"`
+	}
+	if err := api.getJSON(ctx, repoURL+"/commit/"+url.PathEscape(ref), &commit); err != nil {
+		return nil, fmt.Errorf("error resolving %s on Bitbucket: %w", ref, err)
+	}
+	if commit.Hash == "" {
+		return nil, fmt.Errorf("Bitbucket returned no commit for %s", ref)
+	}
+
+	archiveURL := p.webURL + "/" + workspace + "/" + slug + "/get/" + url.PathEscape(commit.Hash) + ".tar.gz"
+	if err := api.downloadTarGz(ctx, archiveURL, dir); err != nil {
+		return nil, fmt.Errorf("error downloading Bitbucket archive: %w", err)
+	}
+	return &Tree{Path: treeRoot(dir), Commit: commit.Hash}, nil
+}
@@ -0,0 +1,143 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GitProvider clones any git remote, over SSH or HTTPS. Remotes are authenticated with the
+// credentials of their source only, so that no secret is sent to a host it was not meant for.
+// Remotes on the server's file system or run through a command, such as ext::, are refused.
+type GitProvider struct {
+	protocols []string // Transports git may use to reach remotes
+}
+
+// NewGitProvider creates a git provider
+func NewGitProvider() *GitProvider {
+	return &GitProvider{protocols: []string{"https", "ssh"}}
+}
+
+// Fetch clones the remote into dir, or updates the clone already there, and checks out the
+// ref: the default branch is pulled, other refs are fetched and checked out detached
+func (p *GitProvider) Fetch(ctx context.Context, src Source, dir string) (*Tree, error) {
+	env, cleanup, err := gitAuthEnv(src.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if _, err := runGit(ctx, env, "", p.remote("clone", "--", src.URL, dir)...); err != nil {
+			return nil, fmt.Errorf("git clone failed: %w", err)
+		}
+	} else if src.Ref == "" {
+		if _, err := runGit(ctx, env, dir, p.remote("pull")...); err != nil {
+			return nil, fmt.Errorf("git pull failed: %w", err)
+		}
+	}
+
+	if src.Ref != "" {
+		if err := p.checkoutRef(ctx, env, dir, src.Ref); err != nil {
+			return nil, err
+		}
+	}
+
+	commit, err := runGit(ctx, nil, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("git rev-parse failed: %w", err)
+	}
+	return &Tree{Path: dir, Commit: commit, Git: true}, nil
+}
+
+// checkoutRef fetches a branch, tag or commit from the remote and checks it out detached.
+// Abbreviated commits cannot be fetched by name, so they are looked up among all fetched commits.
+func (p *GitProvider) checkoutRef(ctx context.Context, env []string, dir, ref string) error {
+	target := "FETCH_HEAD"
+	if _, err := runGit(ctx, env, dir, p.remote("fetch", "origin", ref)...); err != nil {
+		if _, err := runGit(ctx, env, dir, p.remote("fetch", "--tags", "origin")...); err != nil {
+			return fmt.Errorf("git fetch failed: %w", err)
+		}
+		target = ref + "^{commit}"
+	}
+
+	if _, err := runGit(ctx, nil, dir, "checkout", "--detach", target); err != nil {
+		return fmt.Errorf("git checkout of %s failed: %w", ref, err)
+	}
+	return nil
+}
+
+// remote prefixes the arguments of a git command reaching the remote with the configuration
+// allowing only the transports of the provider
+func (p *GitProvider) remote(args ...string) []string {
+	config := []string{"-c", "protocol.allow=never"}
+	for _, protocol := range p.protocols {
+		config = append(config, "-c", "protocol."+protocol+".allow=always")
+	}
+	return append(config, args...)
+}
+
+// gitAuthEnv builds the environment git authenticates with. HTTPS credentials are passed as
+// an authorization header through the environment, so they end up neither in the command
+// line nor in the clone's config; an SSH key is written to a private temporary file removed
+// by the returned cleanup.
+func gitAuthEnv(credentials *Credentials) ([]string, func(), error) {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if credentials == nil {
+		return env, func() {}, nil
+	}
+
+	secret := credentials.Password
+	if secret == "" {
+		secret = credentials.Token
+	}
+	if secret != "" {
+		username := credentials.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + secret))
+		env = append(env, "GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth)
+	}
+
+	if credentials.SSHKey == "" {
+		return env, func() {}, nil
+	}
+	keyFile, err := os.CreateTemp("", "git-ssh-key-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating SSH key file: %w", err)
+	}
+	cleanup := func() { os.Remove(keyFile.Name()) }
+	key := credentials.SSHKey
+	if !strings.HasSuffix(key, "\n") {
+		key += "\n"
+	}
+	if _, err := keyFile.WriteString(key); err != nil {
+		keyFile.Close()
+		cleanup()
+		return nil, nil, fmt.Errorf("error writing SSH key file: %w", err)
+	}
+	keyFile.Close()
+	env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", keyFile.Name()))
+	return env, cleanup, nil
+}
+
+// runGit runs a git command, in dir unless empty, with extra environment variables and
+// returns its trimmed output
+func runGit(ctx context.Context, env []string, dir string, args ...string) (string, error) {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
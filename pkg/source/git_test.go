@@ -0,0 +1,141 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// git runs a git command for a test, failing it on error
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// bareRepo creates a bare repository with a v1 tag on its first commit and a second commit
+// on main, returning its path and both commits
+func bareRepo(t *testing.T) (string, string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	work := filepath.Join(root, "work")
+	git(t, root, "init", "--bare", "-b", "main", remote)
+	git(t, root, "init", "-b", "main", work)
+
+	os.WriteFile(filepath.Join(work, "main.go"), []byte("package main\n"), 0644)
+	git(t, work, "add", ".")
+	git(t, work, "commit", "-m", "first")
+	first := git(t, work, "rev-parse", "HEAD")
+	git(t, work, "tag", "v1")
+
+	os.WriteFile(filepath.Join(work, "util.go"), []byte("package main\n"), 0644)
+	git(t, work, "add", ".")
+	git(t, work, "commit", "-m", "second")
+	second := git(t, work, "rev-parse", "HEAD")
+
+	git(t, work, "push", remote, "main", "v1")
+	return remote, first, second
+}
+
+func TestGitProviderFetch(t *testing.T) {
+	remote, first, second := bareRepo(t)
+	ctx := context.Background()
+	// The test remote is a local bare repository, which the provider refuses by default
+	p := &GitProvider{protocols: []string{"file"}}
+	dir := filepath.Join(t.TempDir(), "checkout")
+
+	tree, err := p.Fetch(ctx, Source{URL: remote}, dir)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if tree.Path != dir || tree.Commit != second || !tree.Git {
+		t.Errorf("Expected a git checkout of %s at %s, got %+v", second, dir, tree)
+	}
+
+	// Fetching again pulls the existing clone
+	if tree, err = p.Fetch(ctx, Source{URL: remote}, dir); err != nil || tree.Commit != second {
+		t.Fatalf("Expected the clone to be updated, got %+v, %v", tree, err)
+	}
+
+	for _, ref := range []string{"v1", first[:7]} {
+		tree, err = p.Fetch(ctx, Source{URL: remote, Ref: ref}, filepath.Join(t.TempDir(), "checkout"))
+		if err != nil {
+			t.Fatalf("Fetch of %s failed: %v", ref, err)
+		}
+		if tree.Commit != first {
+			t.Errorf("Expected %s to check out %s, got %s", ref, first, tree.Commit)
+		}
+	}
+
+	if _, err := p.Fetch(ctx, Source{URL: remote, Ref: "missing"}, filepath.Join(t.TempDir(), "checkout")); err == nil {
+		t.Error("Expected fetching an unknown ref to fail")
+	}
+}
+
+func TestGitProviderRefusesLocalTransports(t *testing.T) {
+	remote, _, _ := bareRepo(t)
+	marker := filepath.Join(t.TempDir(), "marker")
+	p := NewGitProvider()
+
+	for _, url := range []string{remote, "file://" + remote, "ext::sh -c touch% " + marker} {
+		_, err := p.Fetch(context.Background(), Source{URL: url}, filepath.Join(t.TempDir(), "checkout"))
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("Expected cloning %s to be refused, got %v", url, err)
+		}
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected the ext:: command not to run")
+	}
+}
+
+func TestGitAuthEnv(t *testing.T) {
+	env, cleanup, err := gitAuthEnv(&Credentials{Token: "secret", SSHKey: "KEY"})
+	if err != nil {
+		t.Fatalf("gitAuthEnv failed: %v", err)
+	}
+	joined := strings.Join(env, "\n")
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:secret"))
+	if !strings.Contains(joined, "GIT_CONFIG_VALUE_0=Authorization: Basic "+auth) {
+		t.Errorf("Expected a basic authorization header, got %v", env)
+	}
+
+	var keyFile string
+	for _, v := range env {
+		if strings.HasPrefix(v, "GIT_SSH_COMMAND=") {
+			keyFile = strings.Fields(v)[2]
+		}
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private key file, got %v, %v", info, err)
+	}
+	cleanup()
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Error("Expected the key file to be removed")
+	}
+}
+
+func TestCredentialsRedact(t *testing.T) {
+	credentials := &Credentials{Username: "bot", Token: "ghp_secret"}
+	auth := base64.StdEncoding.EncodeToString([]byte("bot:ghp_secret"))
+	text := credentials.Redact("fatal: token ghp_secret rejected, header Basic " + auth)
+	if strings.Contains(text, "ghp_secret") || strings.Contains(text, auth) {
+		t.Errorf("Expected the secrets to be redacted, got %q", text)
+	}
+	if logged := fmt.Sprintf("%v %+v", credentials, *credentials); strings.Contains(logged, "ghp_secret") {
+		t.Errorf("Expected formatted credentials to hide their secrets, got %q", logged)
+	}
+}
@@ -0,0 +1,95 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultGitLabURL is the GitLab instance of gitlab.com
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLabProvider downloads projects through the GitLab REST API, on gitlab.com or a
+// self-managed instance
+type GitLabProvider struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewGitLabProvider creates a GitLab provider for the instance at baseURL, gitlab.com when
+// empty, with a default access token for its projects. Projects on other hosts are served
+// by their own host without the default token.
+func NewGitLabProvider(baseURL, token string) *GitLabProvider {
+	if baseURL == "" {
+		baseURL = DefaultGitLabURL
+	}
+	return &GitLabProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// Fetch resolves the ref of the project to a commit and extracts the archive of that commit
+// into dir
+func (p *GitLabProvider) Fetch(ctx context.Context, src Source, dir string) (*Tree, error) {
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab URL: %w", err)
+	}
+	projectPath := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if projectPath == "" {
+		return nil, fmt.Errorf("invalid GitLab URL %q", src.URL)
+	}
+
+	baseURL, token := p.baseURL, p.token
+	if base, err := url.Parse(baseURL); err != nil || base.Host != u.Host {
+		baseURL, token = u.Scheme+"://"+u.Host, ""
+	}
+	projectURL := baseURL + "/api/v4/projects/" + url.PathEscape(projectPath)
+
+	if c := src.Credentials; c != nil {
+		token = c.Token
+		if token == "" {
+			token = c.Password
+		}
+	}
+	api := apiRequest{client: p.httpClient, auth: func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("PRIVATE-TOKEN", token)
+		}
+	}}
+
+	ref := src.Ref
+	if ref == "" {
+		var project struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		if err := api.getJSON(ctx, projectURL, &project); err != nil {
+			return nil, fmt.Errorf("error getting GitLab project: %w", err)
+		}
+		if project.DefaultBranch == "" {
+			return nil, fmt.Errorf("GitLab project %s has no default branch", projectPath)
+		}
+		ref = project.DefaultBranch
+	}
+
+	var commit struct {
+		ID string `json:"id"`
+	}
+	if err := api.getJSON(ctx, projectURL+"/repository/commits/"+url.PathEscape(ref), &commit); err != nil {
+		return nil, fmt.Errorf("error resolving %s on GitLab: %w", ref, err)
+	}
+	if commit.ID == "" {
+		return nil, fmt.Errorf("GitLab returned no commit for %s", ref)
+	}
+
+	archiveURL := projectURL + "/repository/archive.tar.gz?sha=" + url.QueryEscape(commit.ID)
+	if err := api.downloadTarGz(ctx, archiveURL, dir); err != nil {
+		return nil, fmt.Errorf("error downloading GitLab archive: %w", err)
+	}
+	return &Tree{Path: treeRoot(dir), Commit: commit.ID}, nil
+}
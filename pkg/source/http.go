@@ -0,0 +1,66 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// apiRequest is a request to a hosting REST API, authenticated by setting headers
+type apiRequest struct {
+	client *http.Client
+	auth   func(req *http.Request)
+}
+
+// getJSON gets a URL and decodes its JSON response into out
+func (a apiRequest) getJSON(ctx context.Context, url string, out interface{}) error {
+	resp, err := a.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response of %s: %w", url, err)
+	}
+	return nil
+}
+
+// get gets a URL, failing on any status but 200
+func (a apiRequest) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if a.auth != nil {
+		a.auth(req)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, url, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// downloadTarGz downloads a .tar.gz archive and extracts it into dir
+func (a apiRequest) downloadTarGz(ctx context.Context, url, dir string) error {
+	resp, err := a.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := resetDir(dir); err != nil {
+		return err
+	}
+	return extractTarGz(ctx, resp.Body, dir)
+}
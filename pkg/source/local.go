@@ -0,0 +1,68 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalProvider indexes directories of the server in place. Only directories under one of
+// its roots may be indexed, so that the API cannot be used to read arbitrary files.
+type LocalProvider struct {
+	roots []string
+}
+
+// NewLocalProvider creates a local provider for the directories under the given roots
+func NewLocalProvider(roots ...string) *LocalProvider {
+	p := &LocalProvider{}
+	for _, root := range roots {
+		if root = strings.TrimSpace(root); root != "" {
+			p.roots = append(p.roots, filepath.Clean(root))
+		}
+	}
+	return p
+}
+
+// Fetch resolves the directory of the source, which is indexed as it is on disk: the
+// working tree may hold uncommitted changes, so it is never diffed with git and refs cannot
+// be checked out. The dir argument is unused.
+func (p *LocalProvider) Fetch(ctx context.Context, src Source, dir string) (*Tree, error) {
+	if src.Ref != "" {
+		return nil, fmt.Errorf("local sources are indexed as they are on disk, refs are not supported")
+	}
+
+	path, err := filepath.Abs(strings.TrimPrefix(src.URL, "file://"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid local path: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if !p.allowed(path) {
+		return nil, fmt.Errorf("local path %s is not under an allowed root", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading local path: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("local path %s is not a directory", path)
+	}
+	return &Tree{Path: path}, nil
+}
+
+// allowed reports whether a path is one of the roots or under one
+func (p *LocalProvider) allowed(path string) bool {
+	for _, root := range p.roots {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+// Package source materializes the working tree of a repository to analyze, whether it is a
+// git remote, a repository behind the GitLab or Bitbucket APIs, a local directory or an
+// uploaded archive.
+package source
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of source
+const (
+	KindGitHub    = "github"    // GitHub repository, cloned with git
+	KindGit       = "git"       // Any git remote over SSH or HTTPS
+	KindGitLab    = "gitlab"    // GitLab project, downloaded through its REST API
+	KindBitbucket = "bitbucket" // Bitbucket Cloud repository, downloaded through its REST API
+	KindLocal     = "local"     // Directory on the server
+	KindArchive   = "archive"   // Uploaded .tar.gz or .zip archive
+)
+
+// ArchiveScheme prefixes the URL of repositories uploaded as archives
+const ArchiveScheme = "archive://"
+
+// Credentials authenticate against a source. Which fields are used depends on the provider:
+// git uses Username with Password or Token over HTTPS and SSHKey over SSH, the APIs use
+// Token, or Username and Password.
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+	SSHKey   string // PEM-encoded private key
+}
+
+// String describes credentials without their secrets, so they are safe to log
+func (c Credentials) String() string {
+	return fmt.Sprintf("{Username:%s Password:%s Token:%s SSHKey:%s}",
+		c.Username, redacted(c.Password), redacted(c.Token), redacted(c.SSHKey))
+}
+
+// Redact replaces the secrets of the credentials in a text, such as the output of a failed
+// command, before it is logged or stored
+func (c *Credentials) Redact(text string) string {
+	if c == nil {
+		return text
+	}
+	secrets := []string{c.Password, c.Token, c.SSHKey}
+	if secret := c.Password + c.Token; secret != "" {
+		// The basic authorization header git is given
+		username := c.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		secrets = append(secrets, base64.StdEncoding.EncodeToString([]byte(username+":"+c.Password)),
+			base64.StdEncoding.EncodeToString([]byte(username+":"+c.Token)))
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	return text
+}
+
+// redacted masks a secret, only telling whether it is set
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// Source is a repository to materialize at a ref
+type Source struct {
+	URL         string
+	Ref         string       // Branch, tag or commit; the default branch if empty
+	Credentials *Credentials // Overrides the provider's own credentials when set
+}
+
+// Tree is a materialized working tree
+type Tree struct {
+	Path   string // Directory holding the files
+	Commit string // Revision of the files, empty when unknown
+	Git    bool   // Whether Path is a git checkout of Commit, so changes can be diffed with git
+}
+
+// Location is where a repository URL points to
+type Location struct {
+	Kind  string
+	Host  string
+	Owner string // Owner, organization or group path
+	Name  string
+}
+
+// Detect works out the kind, host, owner and name of a repository URL: HTTPS and SSH git
+// remotes, local paths and uploaded archives
+func Detect(rawURL string) (Location, error) {
+	switch {
+	case strings.HasPrefix(rawURL, ArchiveScheme):
+		name := strings.TrimPrefix(rawURL, ArchiveScheme)
+		if !ValidName(name) {
+			return Location{}, fmt.Errorf("invalid archive name %q", name)
+		}
+		return Location{Kind: KindArchive, Owner: "upload", Name: name}, nil
+
+	case strings.HasPrefix(rawURL, "/") || strings.HasPrefix(rawURL, "file://"):
+		dir := filepath.Clean(strings.TrimPrefix(rawURL, "file://"))
+		if dir == "/" {
+			return Location{}, fmt.Errorf("invalid local path %q", rawURL)
+		}
+		return Location{Kind: KindLocal, Owner: filepath.Base(filepath.Dir(dir)), Name: filepath.Base(dir)}, nil
+	}
+
+	var host, repoPath string
+	kind := ""
+	if !strings.Contains(rawURL, "://") {
+		// scp-like SSH remote, e.g. git@github.com:owner/name.git
+		userHost, p, ok := strings.Cut(rawURL, ":")
+		if !ok {
+			return Location{}, fmt.Errorf("invalid repository URL %q", rawURL)
+		}
+		_, host, _ = strings.Cut(userHost, "@")
+		if host == "" {
+			host = userHost
+		}
+		repoPath, kind = p, KindGit
+	} else {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return Location{}, fmt.Errorf("invalid repository URL %q: %w", rawURL, err)
+		}
+		host, repoPath = u.Hostname(), u.Path
+		if u.Scheme != "http" && u.Scheme != "https" {
+			kind = KindGit
+		}
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(path.Clean("/"+repoPath), "/"), ".git")
+	owner, name := path.Split(repoPath)
+	owner = strings.Trim(owner, "/")
+	if host == "" || owner == "" || name == "" {
+		return Location{}, fmt.Errorf("invalid repository URL %q", rawURL)
+	}
+
+	if kind == "" {
+		switch {
+		case host == "github.com":
+			kind = KindGitHub
+		case host == "bitbucket.org":
+			kind = KindBitbucket
+		case strings.Contains(host, "gitlab"):
+			kind = KindGitLab
+		default:
+			kind = KindGit
+		}
+	}
+	return Location{Kind: kind, Host: host, Owner: owner, Name: name}, nil
+}
+
+// WithKind overrides the kind of a location, to fetch a remote with another provider than
+// the one detected. Local directories and archives are only reachable through their own
+// URLs, which are checked against the allowed roots and the workspace, so overrides from or
+// to these kinds are refused.
+func (l Location) WithKind(kind string) (Location, error) {
+	if kind == "" || kind == l.Kind {
+		return l, nil
+	}
+	if l.Kind == KindLocal || l.Kind == KindArchive || kind == KindLocal || kind == KindArchive {
+		return Location{}, fmt.Errorf("a %s source cannot be indexed as %s", l.Kind, kind)
+	}
+	l.Kind = kind
+	return l, nil
+}
+
+// ValidName reports whether a name is usable for an uploaded archive: letters, digits, dots,
+// dashes and underscores
+func ValidName(name string) bool {
+	if name == "" || len(name) > 100 || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// resetDir empties a directory, creating it if needed, for a tree to be extracted into
+func resetDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("error clearing %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	return nil
+}
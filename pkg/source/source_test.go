@@ -0,0 +1,262 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for rawURL, want := range map[string]Location{
+		"https://github.com/acme/api":                {Kind: KindGitHub, Host: "github.com", Owner: "acme", Name: "api"},
+		"https://gitlab.com/acme/platform/api.git":   {Kind: KindGitLab, Host: "gitlab.com", Owner: "acme/platform", Name: "api"},
+		"https://bitbucket.org/acme/api":             {Kind: KindBitbucket, Host: "bitbucket.org", Owner: "acme", Name: "api"},
+		"https://git.example.com/acme/api.git":       {Kind: KindGit, Host: "git.example.com", Owner: "acme", Name: "api"},
+		"git@github.com:acme/api.git":                {Kind: KindGit, Host: "github.com", Owner: "acme", Name: "api"},
+		"ssh://git@gitlab.example.com:2222/acme/api": {Kind: KindGit, Host: "gitlab.example.com", Owner: "acme", Name: "api"},
+		"/srv/code/acme/api":                         {Kind: KindLocal, Owner: "acme", Name: "api"},
+		"file:///srv/code/acme/api/":                 {Kind: KindLocal, Owner: "acme", Name: "api"},
+		"archive://api-1.4":                          {Kind: KindArchive, Owner: "upload", Name: "api-1.4"},
+	} {
+		got, err := Detect(rawURL)
+		if err != nil || got != want {
+			t.Errorf("Detect(%q) = %+v, %v, want %+v", rawURL, got, err, want)
+		}
+	}
+
+	for _, rawURL := range []string{"https://github.com/acme", "github.com/acme/api", "archive://../etc", "/"} {
+		if _, err := Detect(rawURL); err == nil {
+			t.Errorf("Expected Detect(%q) to fail", rawURL)
+		}
+	}
+}
+
+func TestLocationWithKind(t *testing.T) {
+	remote, _ := Detect("https://git.example.com/acme/api.git")
+	if loc, err := remote.WithKind(KindGitLab); err != nil || loc.Kind != KindGitLab {
+		t.Errorf("Expected a remote to be fetched as a GitLab project, got %+v, %v", loc, err)
+	}
+	if loc, err := remote.WithKind(""); err != nil || loc != remote {
+		t.Errorf("Expected no override to keep the detected kind, got %+v, %v", loc, err)
+	}
+
+	local, _ := Detect("/srv/code/acme/api")
+	archive, _ := Detect("archive://api-1.4")
+	for _, tc := range []struct {
+		loc  Location
+		kind string
+	}{
+		{remote, KindLocal},
+		{remote, KindArchive},
+		{local, KindGit},
+		{local, KindArchive},
+		{archive, KindLocal},
+		{archive, KindGitHub},
+	} {
+		if _, err := tc.loc.WithKind(tc.kind); err == nil {
+			t.Errorf("Expected a %s source not to be indexed as %s", tc.loc.Kind, tc.kind)
+		}
+	}
+}
+
+// tarGz builds a .tar.gz archive of files
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// zipArchive builds a .zip archive of files
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestArchiveProviderFetch(t *testing.T) {
+	ctx := context.Background()
+	uploads := t.TempDir()
+	p := NewArchiveProvider(uploads)
+
+	for name, archive := range map[string][]byte{
+		"targz": tarGz(t, map[string]string{"api-main/go.mod": "module api\n", "api-main/cmd/main.go": "package main\n"}),
+		"zip":   zipArchive(t, map[string]string{"go.mod": "module api\n", "cmd/main.go": "package main\n"}),
+	} {
+		if err := StoreArchive(uploads, name, bytes.NewReader(archive)); err != nil {
+			t.Fatalf("StoreArchive(%s) failed: %v", name, err)
+		}
+		dir := filepath.Join(t.TempDir(), name)
+		tree, err := p.Fetch(ctx, Source{URL: ArchiveScheme + name}, dir)
+		if err != nil {
+			t.Fatalf("Fetch(%s) failed: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(tree.Path, "cmd", "main.go")); err != nil {
+			t.Errorf("Expected %s to be extracted at the tree root %s: %v", name, tree.Path, err)
+		}
+		if len(tree.Commit) != 40 || tree.Git {
+			t.Errorf("Expected a content revision, got %+v", tree)
+		}
+	}
+
+	if err := StoreArchive(uploads, "text", strings.NewReader("not an archive")); err != ErrUnsupportedArchive {
+		t.Errorf("Expected an unsupported archive error, got %v", err)
+	}
+}
+
+func TestArchiveRejectsEscapingEntries(t *testing.T) {
+	uploads := t.TempDir()
+	for name, archive := range map[string][]byte{
+		"targz": tarGz(t, map[string]string{"../evil.go": "package evil\n"}),
+		"zip":   zipArchive(t, map[string]string{"a/../../evil.go": "package evil\n"}),
+	} {
+		StoreArchive(uploads, name, bytes.NewReader(archive))
+		dir := filepath.Join(t.TempDir(), "tree")
+		if _, err := NewArchiveProvider(uploads).Fetch(context.Background(), Source{URL: ArchiveScheme + name}, dir); err == nil {
+			t.Errorf("Expected %s entries outside of the archive to be rejected", name)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil.go")); err == nil {
+			t.Errorf("Expected nothing to be written outside of the tree for %s", name)
+		}
+	}
+}
+
+func TestLocalProviderFetch(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "acme", "api")
+	os.MkdirAll(repo, 0755)
+	p := NewLocalProvider(root)
+
+	tree, err := p.Fetch(context.Background(), Source{URL: "file://" + repo}, "")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if resolved, _ := filepath.EvalSymlinks(repo); tree.Path != resolved || tree.Git {
+		t.Errorf("Expected the directory to be indexed in place, got %+v", tree)
+	}
+
+	for _, src := range []Source{
+		{URL: filepath.Join(root, "..")},
+		{URL: t.TempDir()},
+		{URL: repo, Ref: "main"},
+	} {
+		if _, err := p.Fetch(context.Background(), src, ""); err == nil {
+			t.Errorf("Expected %+v to be rejected", src)
+		}
+	}
+	if _, err := NewLocalProvider().Fetch(context.Background(), Source{URL: repo}, ""); err == nil {
+		t.Error("Expected local sources to be rejected without roots")
+	}
+}
+
+func TestGitLabProviderFetch(t *testing.T) {
+	const commit = "3f2a9c1e0b7d4a6f8c2e1d3b5a7f9e0c2d4b6a8f"
+	archive := tarGz(t, map[string]string{"api-" + commit + "/main.go": "package main\n"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/acme%2Fplatform%2Fapi":
+			w.Write([]byte(`{"default_branch":"main"}`))
+		case "/api/v4/projects/acme%2Fplatform%2Fapi/repository/commits/main":
+			w.Write([]byte(`{"id":"` + commit + `"}`))
+		case "/api/v4/projects/acme%2Fplatform%2Fapi/repository/archive.tar.gz":
+			if r.URL.Query().Get("sha") != commit {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	tree, err := NewGitLabProvider(server.URL, "token").Fetch(context.Background(),
+		Source{URL: server.URL + "/acme/platform/api.git"}, dir)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if tree.Commit != commit {
+		t.Errorf("Expected commit %s, got %s", commit, tree.Commit)
+	}
+	if _, err := os.Stat(filepath.Join(tree.Path, "main.go")); err != nil {
+		t.Errorf("Expected the archive to be extracted: %v", err)
+	}
+
+	_, err = NewGitLabProvider(server.URL, "").Fetch(context.Background(),
+		Source{URL: server.URL + "/acme/platform/api", Ref: "main", Credentials: &Credentials{Token: "wrong"}}, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an authorization error, got %v", err)
+	}
+
+	// The default token is only sent to the configured instance
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "" {
+			t.Error("Expected no token to be sent to another GitLab host")
+		}
+		http.NotFound(w, r)
+	}))
+	defer other.Close()
+	NewGitLabProvider(server.URL, "token").Fetch(context.Background(), Source{URL: other.URL + "/acme/api"}, t.TempDir())
+}
+
+func TestBitbucketProviderFetch(t *testing.T) {
+	const commit = "9e0c2d4b6a8f3f2a9c1e0b7d4a6f8c2e1d3b5a7f"
+	archive := tarGz(t, map[string]string{"acme-api-9e0c2d4b6a8f/main.go": "package main\n"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "bot" || password != "app-password" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/2.0/repositories/acme/api":
+			w.Write([]byte(`{"mainbranch":{"name":"develop"}}`))
+		case "/2.0/repositories/acme/api/commit/develop":
+			w.Write([]byte(`{"hash":"` + commit + `"}`))
+		case "/acme/api/get/" + commit + ".tar.gz":
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tree, err := NewBitbucketProvider(server.URL+"/2.0", "bot", "app-password").Fetch(context.Background(),
+		Source{URL: server.URL + "/acme/api"}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if tree.Commit != commit {
+		t.Errorf("Expected commit %s, got %s", commit, tree.Commit)
+	}
+	if _, err := os.Stat(filepath.Join(tree.Path, "main.go")); err != nil {
+		t.Errorf("Expected the archive to be extracted: %v", err)
+	}
+}
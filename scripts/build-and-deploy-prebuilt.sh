@@ -78,7 +78,7 @@ echo "This is faster than building in Docker"
 # Build with optimizations for Linux
 echo "Building binary for Linux..."
 GOOS=linux GOARCH=amd64 go mod tidy && go mod vendor
-GOOS=linux GOARCH=amd64 go build -o api-server ./cmd/api/main.go
+GOOS=linux GOARCH=amd64 go build -o api-server ./cmd/api
 
 echo -e "${GREEN}Binary built successfully at ./api-server${NC}"
 
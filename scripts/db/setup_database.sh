@@ -18,20 +18,6 @@ fi
 echo "Creating database and user..."
 psql postgres -f "$DIR/01_create_database.sql"
 
-echo "Creating users table..."
-psql postgres -f "$DIR/02_create_users_table.sql"
-
-echo "Creating code analysis tables..."
-psql postgres -f "$DIR/03_create_code_analysis_tables.sql"
-
-echo "Seeding initial data..."
-psql postgres -f "$DIR/04_seed_data.sql"
-
-echo "Adding code analyzer (new) schema..."
-psql postgres -f "$DIR/05_create_code_analyzer_tables.sql"
-
-echo "Database setup complete!"
-
 # Update the .env file with the database credentials
 if [ -f "$DIR/../../.env" ]; then
     echo "Updating .env file..."
@@ -86,4 +72,12 @@ EOL
     echo ".env file created with database credentials."
 fi
 
-echo "You can now run the application with 'go run cmd/api/main.go'"
+# Create the schema with the migrations embedded in the API server
+echo "Applying schema migrations..."
+(cd "$DIR/../.." && go run ./cmd/api migrate up)
+
+echo "Seeding development data..."
+psql postgres -f "$DIR/seed_dev_data.sql"
+
+echo "Database setup complete!"
+echo "You can now run the application with 'go run ./cmd/api'"